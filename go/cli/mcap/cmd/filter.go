@@ -21,6 +21,7 @@ type filterFlags struct {
 	start              uint64
 	end                uint64
 	includeMetadata    bool
+	excludeMetadata    []string
 	includeAttachments bool
 	outputCompression  string
 	chunkSize          int64
@@ -34,6 +35,7 @@ type filterOpts struct {
 	start              uint64
 	end                uint64
 	includeMetadata    bool
+	excludeMetadata    map[string]bool
 	includeAttachments bool
 	compressionFormat  mcap.CompressionFormat
 	chunkSize          int64
@@ -43,8 +45,12 @@ func buildFilterOptions(flags filterFlags) (*filterOpts, error) {
 	opts := &filterOpts{
 		output:             flags.output,
 		includeMetadata:    flags.includeMetadata,
+		excludeMetadata:    make(map[string]bool),
 		includeAttachments: flags.includeAttachments,
 	}
+	for _, name := range flags.excludeMetadata {
+		opts.excludeMetadata[name] = true
+	}
 	opts.start = flags.start * 1e9
 	if flags.end == 0 {
 		opts.end = math.MaxUint64
@@ -271,12 +277,12 @@ func filter(
 					return fmt.Errorf("encountered channel with topic %s with unknown schema ID %d", channel.Topic, channel.SchemaID)
 				}
 				if !schema.written {
-					if err = mcapWriter.WriteSchema(schema.Schema); err != nil {
+					if _, err = mcapWriter.WriteSchema(schema.Schema); err != nil {
 						return err
 					}
 					schema.written = true
 				}
-				if err = mcapWriter.WriteChannel(channel.Channel); err != nil {
+				if _, err = mcapWriter.WriteChannel(channel.Channel); err != nil {
 					return err
 				}
 				channel.written = true
@@ -311,6 +317,9 @@ func filter(
 			if err != nil {
 				return err
 			}
+			if opts.excludeMetadata[metadata.Name] {
+				continue
+			}
 			if err = mcapWriter.WriteMetadata(metadata); err != nil {
 				return err
 			}
@@ -344,6 +353,7 @@ usage:
 		end := filterCmd.PersistentFlags().Uint64P("end-secs", "e", 0, "messages with log times before timestamp will be included.")
 		chunkSize := filterCmd.PersistentFlags().Int64P("chunk-size", "", 4*1024*1024, "chunk size of output file")
 		includeMetadata := filterCmd.PersistentFlags().Bool("include-metadata", false, "whether to include metadata in the output bag")
+		excludeMetadata := filterCmd.PersistentFlags().StringArray("exclude-metadata-name", []string{}, "metadata records with this name will be excluded when including metadata, can be supplied multiple times")
 		includeAttachments := filterCmd.PersistentFlags().Bool("include-attachments", false, "whether to include attachments in the output mcap")
 		outputCompression := filterCmd.PersistentFlags().String("output-compression", "zstd", "compression algorithm to use on output file")
 		filterCmd.Run = func(cmd *cobra.Command, args []string) {
@@ -355,6 +365,7 @@ usage:
 				end:                *end,
 				chunkSize:          *chunkSize,
 				includeMetadata:    *includeMetadata,
+				excludeMetadata:    *excludeMetadata,
 				includeAttachments: *includeAttachments,
 				outputCompression:  *outputCompression,
 			})
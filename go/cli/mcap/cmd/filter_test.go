@@ -19,24 +19,28 @@ func writeFilterTestInput(t *testing.T, w io.Writer) {
 	assert.Nil(t, err)
 
 	assert.Nil(t, writer.WriteHeader(&mcap.Header{}))
-	assert.Nil(t, writer.WriteSchema(&mcap.Schema{
+	_, err = writer.WriteSchema(&mcap.Schema{
 		ID: 1,
-	}))
-	assert.Nil(t, writer.WriteChannel(&mcap.Channel{
+	})
+	assert.Nil(t, err)
+	_, err = writer.WriteChannel(&mcap.Channel{
 		ID:       1,
 		SchemaID: 1,
 		Topic:    "camera_a",
-	}))
-	assert.Nil(t, writer.WriteChannel(&mcap.Channel{
+	})
+	assert.Nil(t, err)
+	_, err = writer.WriteChannel(&mcap.Channel{
 		ID:       2,
 		SchemaID: 1,
 		Topic:    "camera_b",
-	}))
-	assert.Nil(t, writer.WriteChannel(&mcap.Channel{
+	})
+	assert.Nil(t, err)
+	_, err = writer.WriteChannel(&mcap.Channel{
 		ID:       3,
 		SchemaID: 1,
 		Topic:    "radar_a",
-	}))
+	})
+	assert.Nil(t, err)
 	for i := 0; i < 100; i++ {
 		assert.Nil(t, writer.WriteMessage(&mcap.Message{
 			ChannelID: 1,
@@ -129,6 +133,23 @@ func TestFiltering(t *testing.T) {
 			expectedAttachmentCount: 0,
 			expectedMetadataCount:   1,
 		},
+		{
+			name: "excluding metadata by name",
+			opts: &filterOpts{
+				compressionFormat: mcap.CompressionLZ4,
+				start:             0,
+				end:               1000,
+				includeMetadata:   true,
+				excludeMetadata:   map[string]bool{"metadata": true},
+			},
+			expectedMessageCount: map[uint16]int{
+				1: 100,
+				2: 100,
+				3: 100,
+			},
+			expectedAttachmentCount: 0,
+			expectedMetadataCount:   0,
+		},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
@@ -20,14 +20,28 @@ var (
 	mergeIncludeCRC  bool
 	mergeChunked     bool
 	mergeOutputFile  string
+	mergeOrderBy     string
 )
 
+// mergeOrders are the orders messages may be merged in with --order-by.
+var mergeOrders = map[string]func(a, b *mcap.Message) bool{
+	"log-time": utils.LogTimeLess,
+	"publish-time": func(a, b *mcap.Message) bool {
+		return a.PublishTime < b.PublishTime
+	},
+}
+
 type mergeOpts struct {
 	profile     string
 	compression string
 	chunkSize   int64
 	includeCRC  bool
 	chunked     bool
+	// orderBy reports whether message a is merged before message b. If nil,
+	// messages are merged in log time order. The merge reads each input in
+	// file order, so its output is in order only if the messages of each
+	// input, and so each of its chunks, are sorted by the same key.
+	orderBy func(a, b *mcap.Message) bool
 }
 
 // schemaID uniquely identifies a schema across the inputs
@@ -99,7 +113,7 @@ func (m *mcapMerger) addChannel(w *mcap.Writer, inputID int, channel *mcap.Chann
 	}
 	m.channels[key] = channel
 	m.channelIDs[key] = m.nextChannelID
-	err := w.WriteChannel(newChannel)
+	_, err := w.WriteChannel(newChannel)
 	if err != nil {
 		return 0, fmt.Errorf("failed to write channel: %w", err)
 	}
@@ -117,7 +131,7 @@ func (m *mcapMerger) addSchema(w *mcap.Writer, inputID int, schema *mcap.Schema)
 	}
 	m.schemas[key] = newSchema
 	m.schemaIDs[key] = m.nextSchemaID
-	err := w.WriteSchema(newSchema)
+	_, err := w.WriteSchema(newSchema)
 	if err != nil {
 		return 0, fmt.Errorf("failed to write schema: %w", err)
 	}
@@ -143,6 +157,9 @@ func (m *mcapMerger) mergeInputs(w io.Writer, inputs []io.Reader) error {
 		ChunkSize:   m.opts.chunkSize,
 		Compression: mcap.CompressionFormat(m.opts.compression),
 		IncludeCRC:  m.opts.includeCRC,
+		// channels and schemas of different inputs are kept distinct, even
+		// if identical.
+		SkipDeduplication: true,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create writer: %w", err)
@@ -155,7 +172,11 @@ func (m *mcapMerger) mergeInputs(w io.Writer, inputs []io.Reader) error {
 	}
 
 	iterators := make([]mcap.MessageIterator, len(inputs))
-	pq := utils.NewPriorityQueue(nil)
+	orderBy := m.opts.orderBy
+	if orderBy == nil {
+		orderBy = utils.LogTimeLess
+	}
+	pq := utils.NewPriorityQueueOrderedBy(orderBy, nil)
 
 	// for each input reader, initialize an mcap reader and read the first
 	// message off. Insert the schema and channel into the output with
@@ -242,6 +263,10 @@ var mergeCmd = &cobra.Command{
 		if mergeOutputFile == "" && !utils.StdoutRedirected() {
 			die(PleaseRedirect)
 		}
+		orderBy, ok := mergeOrders[mergeOrderBy]
+		if !ok {
+			die("unrecognized order: %s (supported: log-time, publish-time)", mergeOrderBy)
+		}
 		var readers []io.Reader
 		for _, arg := range args {
 			f, err := os.Open(arg)
@@ -257,6 +282,7 @@ var mergeCmd = &cobra.Command{
 			chunkSize:   mergeChunkSize,
 			includeCRC:  mergeIncludeCRC,
 			chunked:     mergeChunked,
+			orderBy:     orderBy,
 		}
 		merger := newMCAPMerger(opts)
 		var writer io.Writer
@@ -314,6 +340,13 @@ func init() {
 		true,
 		"chunk the output file",
 	)
+	mergeCmd.PersistentFlags().StringVarP(
+		&mergeOrderBy,
+		"order-by",
+		"",
+		"log-time",
+		"order to merge messages in (supported: log-time, publish-time). Each input must be sorted by it",
+	)
 	mergeCmd.PersistentFlags().StringVarP(
 		&mergeProfile,
 		"profile",
@@ -17,14 +17,16 @@ func prepInput(t *testing.T, w io.Writer, schemaID uint16, channelID uint16, top
 	assert.Nil(t, err)
 
 	assert.Nil(t, writer.WriteHeader(&mcap.Header{}))
-	assert.Nil(t, writer.WriteSchema(&mcap.Schema{
+	_, err = writer.WriteSchema(&mcap.Schema{
 		ID: schemaID,
-	}))
-	assert.Nil(t, writer.WriteChannel(&mcap.Channel{
+	})
+	assert.Nil(t, err)
+	_, err = writer.WriteChannel(&mcap.Channel{
 		ID:       channelID,
 		SchemaID: schemaID,
 		Topic:    topic,
-	}))
+	})
+	assert.Nil(t, err)
 	for i := 0; i < 100; i++ {
 		assert.Nil(t, writer.WriteMessage(&mcap.Message{
 			ChannelID: channelID,
@@ -92,3 +94,85 @@ func TestMultiChannelInput(t *testing.T) {
 	assert.Equal(t, 100, messages["/bar"])
 	assert.Equal(t, 100, messages["/baz"])
 }
+
+func TestMergeKeepsIdenticalChannelsDistinct(t *testing.T) {
+	buf1 := &bytes.Buffer{}
+	buf2 := &bytes.Buffer{}
+	prepInput(t, buf1, 1, 1, "/foo")
+	prepInput(t, buf2, 1, 1, "/foo")
+	merger := newMCAPMerger(mergeOpts{chunked: true})
+	output := &bytes.Buffer{}
+	assert.Nil(t, merger.mergeInputs(output, []io.Reader{buf1, buf2}))
+	reader, err := mcap.NewReader(bytes.NewReader(output.Bytes()))
+	assert.Nil(t, err)
+	info, err := reader.Info()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(info.Schemas))
+	assert.Equal(t, 2, len(info.Channels))
+	reader, err = mcap.NewReader(bytes.NewReader(output.Bytes()))
+	assert.Nil(t, err)
+	it, err := reader.Messages(readopts.UsingIndex(false))
+	assert.Nil(t, err)
+	messages := make(map[uint16]int)
+	err = mcap.Range(it, func(schema *mcap.Schema, channel *mcap.Channel, message *mcap.Message) error {
+		messages[channel.ID]++
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[uint16]int{1: 100, 2: 100}, messages)
+}
+
+func TestMergeOrderBy(t *testing.T) {
+	// the inputs are sorted by both log and publish time, but their publish
+	// times interleave while their log times do not.
+	prep := func(w io.Writer, topic string, logTimeBase uint64, publishTimeOffset uint64) {
+		writer, err := mcap.NewWriter(w, &mcap.WriterOptions{Chunked: true, ChunkSize: 256})
+		assert.Nil(t, err)
+		assert.Nil(t, writer.WriteHeader(&mcap.Header{}))
+		_, err = writer.WriteSchema(&mcap.Schema{ID: 1})
+		assert.Nil(t, err)
+		_, err = writer.WriteChannel(&mcap.Channel{ID: 1, SchemaID: 1, Topic: topic})
+		assert.Nil(t, err)
+		for i := uint64(0); i < 50; i++ {
+			assert.Nil(t, writer.WriteMessage(&mcap.Message{
+				ChannelID:   1,
+				LogTime:     logTimeBase + i,
+				PublishTime: 2*i + publishTimeOffset,
+			}))
+		}
+		assert.Nil(t, writer.Close())
+	}
+	merge := func(orderBy func(a, b *mcap.Message) bool) []*mcap.Message {
+		buf1 := &bytes.Buffer{}
+		buf2 := &bytes.Buffer{}
+		prep(buf1, "/foo", 0, 0)
+		prep(buf2, "/bar", 1000, 1)
+		merger := newMCAPMerger(mergeOpts{chunked: true, orderBy: orderBy})
+		output := &bytes.Buffer{}
+		assert.Nil(t, merger.mergeInputs(output, []io.Reader{buf1, buf2}))
+		reader, err := mcap.NewReader(output)
+		assert.Nil(t, err)
+		it, err := reader.Messages(readopts.UsingIndex(false))
+		assert.Nil(t, err)
+		var messages []*mcap.Message
+		err = mcap.Range(it, func(_ *mcap.Schema, _ *mcap.Channel, message *mcap.Message) error {
+			messages = append(messages, message)
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Len(t, messages, 100)
+		return messages
+	}
+	t.Run("log time by default", func(t *testing.T) {
+		messages := merge(nil)
+		for i, message := range messages[1:] {
+			assert.LessOrEqual(t, messages[i].LogTime, message.LogTime)
+		}
+	})
+	t.Run("publish time", func(t *testing.T) {
+		messages := merge(mergeOrders["publish-time"])
+		for i, message := range messages {
+			assert.Equal(t, uint64(i), message.PublishTime)
+		}
+	})
+}
@@ -6,39 +6,54 @@ import (
 	"github.com/foxglove/mcap/go/mcap"
 )
 
-type PriorityQueue []TaggedMessage
+// PriorityQueue is a heap of tagged messages, ordered by log time unless
+// another order is supplied with NewPriorityQueueOrderedBy. Messages that are
+// equal in order are ordered by input and then channel.
+type PriorityQueue struct {
+	msgs []TaggedMessage
+	less func(a, b *mcap.Message) bool
+}
+
+// LogTimeLess orders messages by log time.
+func LogTimeLess(a, b *mcap.Message) bool {
+	return a.LogTime < b.LogTime
+}
 
-func (pq PriorityQueue) Len() int {
-	return len(pq)
+func (pq *PriorityQueue) Len() int {
+	return len(pq.msgs)
 }
 
-func (pq PriorityQueue) Less(i, j int) bool {
-	if pq[i].Message.LogTime != pq[j].Message.LogTime {
-		return pq[i].Message.LogTime < pq[j].Message.LogTime
+func (pq *PriorityQueue) Less(i, j int) bool {
+	a, b := pq.msgs[i], pq.msgs[j]
+	if pq.less(a.Message, b.Message) {
+		return true
 	}
-	if pq[i].InputID != pq[j].InputID {
-		return pq[i].InputID < pq[j].InputID
+	if pq.less(b.Message, a.Message) {
+		return false
 	}
-	return pq[i].Message.ChannelID < pq[j].Message.ChannelID
+	if a.InputID != b.InputID {
+		return a.InputID < b.InputID
+	}
+	return a.Message.ChannelID < b.Message.ChannelID
 }
 
-func (pq PriorityQueue) Swap(i, j int) {
-	pq[i], pq[j] = pq[j], pq[i]
+func (pq *PriorityQueue) Swap(i, j int) {
+	pq.msgs[i], pq.msgs[j] = pq.msgs[j], pq.msgs[i]
 }
 
 func (pq *PriorityQueue) Push(x any) {
 	msg := x.(TaggedMessage)
-	*pq = append(*pq, msg)
+	pq.msgs = append(pq.msgs, msg)
 }
 
 func (pq *PriorityQueue) Pop() any {
-	old := *pq
+	old := pq.msgs
 	n := len(old)
 	if n == 0 {
 		return nil
 	}
 	msg := old[n-1]
-	*pq = old[0 : n-1]
+	pq.msgs = old[0 : n-1]
 	return msg
 }
 
@@ -54,7 +69,13 @@ func NewTaggedMessage(inputID int, msg *mcap.Message) TaggedMessage {
 }
 
 func NewPriorityQueue(msgs []TaggedMessage) *PriorityQueue {
-	pq := &PriorityQueue{}
+	return NewPriorityQueueOrderedBy(LogTimeLess, msgs)
+}
+
+// NewPriorityQueueOrderedBy returns a priority queue of msgs ordered by less,
+// which reports whether message a comes before message b.
+func NewPriorityQueueOrderedBy(less func(a, b *mcap.Message) bool, msgs []TaggedMessage) *PriorityQueue {
+	pq := &PriorityQueue{less: less}
 	heap.Init(pq)
 	for _, msg := range msgs {
 		heap.Push(pq, msg)
@@ -22,3 +22,19 @@ func TestPriorityQueue(t *testing.T) {
 		assert.Panics(t, func() { heap.Pop(pq) }, "expected Pop on empty heap to panic")
 	})
 }
+
+func TestPriorityQueueOrderedBy(t *testing.T) {
+	a := NewTaggedMessage(1, &mcap.Message{LogTime: 3, PublishTime: 1})
+	b := NewTaggedMessage(2, &mcap.Message{LogTime: 2, PublishTime: 2})
+	c := NewTaggedMessage(3, &mcap.Message{LogTime: 1, PublishTime: 3})
+	d := NewTaggedMessage(0, &mcap.Message{LogTime: 0, PublishTime: 3})
+	pq := NewPriorityQueueOrderedBy(func(a, b *mcap.Message) bool {
+		return a.PublishTime < b.PublishTime
+	}, []TaggedMessage{c, d, b, a})
+	// messages equal in order are ordered by input.
+	for _, expectedInput := range []int{1, 2, 0, 3} {
+		msg, ok := heap.Pop(pq).(TaggedMessage)
+		assert.True(t, ok)
+		assert.Equal(t, expectedInput, msg.InputID)
+	}
+}
@@ -191,7 +191,7 @@ func RewriteMCAP(w io.Writer, r io.ReadSeeker, fns ...func(writer *mcap.Writer)
 				return fmt.Errorf("failed to parse channel: %w", err)
 			}
 			if !channels[record.ID] {
-				err := writer.WriteChannel(record)
+				_, err := writer.WriteChannel(record)
 				if err != nil {
 					return fmt.Errorf("failed to write channel: %w", err)
 				}
@@ -203,7 +203,7 @@ func RewriteMCAP(w io.Writer, r io.ReadSeeker, fns ...func(writer *mcap.Writer)
 				return fmt.Errorf("failed to parse schema: %w", err)
 			}
 			if !schemas[record.ID] {
-				err := writer.WriteSchema(record)
+				_, err := writer.WriteSchema(record)
 				if err != nil {
 					return fmt.Errorf("failed to write schema: %w", err)
 				}
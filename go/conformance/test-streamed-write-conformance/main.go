@@ -37,6 +37,7 @@ func parseOptions(features []string) (*mcap.WriterOptions, error) {
 		SkipChunkIndex:           true,
 		SkipSummaryOffsets:       true,
 		OverrideLibrary:          true,
+		SkipDeduplication:        true,
 	}
 	for _, feature := range features {
 		switch feature {
@@ -366,7 +367,7 @@ func jsonToMCAP(w io.Writer, filepath string) error {
 			if err != nil {
 				return err
 			}
-			err = writer.WriteSchema(schema)
+			_, err = writer.WriteSchema(schema)
 			if err != nil {
 				return err
 			}
@@ -375,7 +376,7 @@ func jsonToMCAP(w io.Writer, filepath string) error {
 			if err != nil {
 				return err
 			}
-			err = writer.WriteChannel(channel)
+			_, err = writer.WriteChannel(channel)
 			if err != nil {
 				return err
 			}
@@ -0,0 +1,153 @@
+package mcap
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// NewAppendWriter returns a writer that continues an existing MCAP file, such
+// as one written by a logger before it was restarted. The writer's schemas,
+// channels, statistics and indexes are restored from the file's summary
+// section, which must be present and complete. The summary section and footer
+// are then overwritten by the records written, and rewritten, describing both
+// the existing and the new records, on Close. If the file ends up shorter
+// than it was, rws must implement `Truncate(size int64) error`, as *os.File
+// does, for Close to remove the remainder.
+//
+// The file's header is retained, so WriteHeader must not be called. Schemas
+// and channels already in the file are known to the writer and are not
+// written again: writing an identical schema or channel returns the existing
+// ID, and messages may be written on existing channels directly. Message
+// sequence numbers are chosen by the caller, as with NewWriter.
+func NewAppendWriter(rws io.ReadWriteSeeker, opts *WriterOptions) (*Writer, error) {
+	size, err := rws.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to seek to end: %w", err)
+	}
+	r, ok := rws.(io.ReaderAt)
+	if !ok {
+		r = &readSeekerAt{rs: rws}
+	}
+	footer, err := readFooterAt(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if footer.SummaryStart == 0 {
+		return nil, fmt.Errorf("cannot append to a file without a summary section")
+	}
+	reader, err := NewReader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	info, err := reader.Info()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read summary: %w", err)
+	}
+	if err := checkAppendable(info, opts); err != nil {
+		return nil, err
+	}
+	// records are appended over the data end record.
+	_, dataEnd, err := reader.DataSectionRange()
+	if err != nil {
+		return nil, err
+	}
+	_, record, err := readRecordAt(r, dataEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data end: %w", err)
+	}
+	end, err := ParseDataEnd(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse data end: %w", err)
+	}
+	dataSectionCRC := end.DataSectionCRC
+	if opts.IncludeCRC && dataSectionCRC == 0 {
+		// the file was written without a data section CRC.
+		crc := crc32.NewIEEE()
+		if _, err := io.Copy(crc, io.NewSectionReader(r, 0, int64(dataEnd))); err != nil {
+			return nil, fmt.Errorf("failed to read data section: %w", err)
+		}
+		dataSectionCRC = crc.Sum32()
+	}
+	if _, err := rws.Seek(int64(dataEnd), io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek to end of data section: %w", err)
+	}
+
+	w, err := newWriter(rws, opts)
+	if err != nil {
+		return nil, err
+	}
+	w.w.rewind(dataEnd, dataSectionCRC)
+	w.checkpointEnd = uint64(size)
+	for _, id := range sortedIDs(info.Schemas) {
+		schema := info.Schemas[id]
+		w.schemaIDs = append(w.schemaIDs, id)
+		w.schemas[id] = schema
+		key := keyOfSchema(schema)
+		if _, ok := w.schemaKeys[key]; !ok {
+			w.schemaKeys[key] = id
+		}
+	}
+	for _, id := range sortedIDs(info.Channels) {
+		channel := info.Channels[id]
+		w.channelIDs = append(w.channelIDs, id)
+		w.channels[id] = channel
+		key := channelKey{
+			schemaID:        channel.SchemaID,
+			topic:           channel.Topic,
+			messageEncoding: channel.MessageEncoding,
+			metadata:        string(makePrefixedMap(channel.Metadata)),
+		}
+		if _, ok := w.channelKeys[key]; !ok {
+			w.channelKeys[key] = id
+		}
+	}
+	if info.Statistics != nil {
+		stats := *info.Statistics
+		stats.ChannelMessageCounts = make(map[uint16]uint64, len(info.Statistics.ChannelMessageCounts))
+		for id, count := range info.Statistics.ChannelMessageCounts {
+			stats.ChannelMessageCounts[id] = count
+		}
+		w.Statistics = &stats
+		w.checkpointChunkCount = stats.ChunkCount
+	} else {
+		w.Statistics.SchemaCount = uint16(len(info.Schemas))
+		w.Statistics.ChannelCount = uint32(len(info.Channels))
+	}
+	w.ChunkIndexes = info.ChunkIndexes
+	w.AttachmentIndexes = info.AttachmentIndexes
+	w.MetadataIndexes = info.MetadataIndexes
+	return w, nil
+}
+
+// checkAppendable checks that the summary of a file records everything the
+// writer would write in its own summary with the given options, so that the
+// summary rewritten on close describes the whole file.
+func checkAppendable(info *Info, opts *WriterOptions) error {
+	if info.SummaryIncomplete && !opts.SkipChunkIndex {
+		return fmt.Errorf("summary section is missing chunk indexes")
+	}
+	stats := info.Statistics
+	if stats == nil {
+		if !opts.SkipStatistics {
+			return fmt.Errorf("summary section has no statistics")
+		}
+		return nil
+	}
+	if int(stats.SchemaCount) != len(info.Schemas) || int(stats.ChannelCount) != len(info.Channels) {
+		return fmt.Errorf("summary section lists %d of %d schemas and %d of %d channels",
+			len(info.Schemas), stats.SchemaCount, len(info.Channels), stats.ChannelCount)
+	}
+	if !opts.SkipChunkIndex && int(stats.ChunkCount) != len(info.ChunkIndexes) {
+		return fmt.Errorf("summary section indexes %d of %d chunks", len(info.ChunkIndexes), stats.ChunkCount)
+	}
+	if !opts.SkipAttachmentIndex && int(stats.AttachmentCount) != len(info.AttachmentIndexes) {
+		return fmt.Errorf("summary section indexes %d of %d attachments",
+			len(info.AttachmentIndexes), stats.AttachmentCount)
+	}
+	if !opts.SkipMetadataIndex && int(stats.MetadataCount) != len(info.MetadataIndexes) {
+		return fmt.Errorf("summary section indexes %d of %d metadata records",
+			len(info.MetadataIndexes), stats.MetadataCount)
+	}
+	return nil
+}
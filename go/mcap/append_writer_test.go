@@ -0,0 +1,150 @@
+package mcap
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAppendWriter(t *testing.T) {
+	opts := func() *WriterOptions {
+		return &WriterOptions{Chunked: true, ChunkSize: 100, Compression: CompressionZSTD, IncludeCRC: true}
+	}
+	schema := &Schema{ID: 1, Name: "schema", Encoding: "jsonschema", Data: []byte("{}")}
+	channel := &Channel{ID: 1, SchemaID: 1, Topic: "/a", MessageEncoding: "json", Metadata: map[string]string{}}
+	writeMessages := func(t *testing.T, w *Writer, channelID uint16, from, to int) {
+		for i := from; i < to; i++ {
+			assert.Nil(t, w.WriteMessage(&Message{
+				ChannelID: channelID,
+				Sequence:  uint32(i),
+				LogTime:   uint64(i),
+				Data:      []byte("hello"),
+			}))
+		}
+	}
+	// create writes a file of the first messages, closed as by a logger
+	// shutting down.
+	create := func(t *testing.T) *os.File {
+		f, err := os.Create(filepath.Join(t.TempDir(), "append.mcap"))
+		assert.Nil(t, err)
+		w, err := NewWriter(f, opts())
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteHeader(&Header{Profile: "test"}))
+		_, err = w.WriteSchema(schema)
+		assert.Nil(t, err)
+		_, err = w.WriteChannel(channel)
+		assert.Nil(t, err)
+		writeMessages(t, w, 1, 0, 20)
+		assert.Nil(t, w.WriteMetadata(&Metadata{Name: "first run", Metadata: map[string]string{}}))
+		assert.Nil(t, w.Close())
+		return f
+	}
+	readAll := func(t *testing.T, f *os.File) (*Info, []*Message) {
+		data, err := os.ReadFile(f.Name())
+		assert.Nil(t, err)
+		assert.Nil(t, TeeValidate(io.Discard, io.Discard, bytes.NewReader(data)))
+		assert.Nil(t, ValidateSummaryCRC(bytes.NewReader(data)))
+		reader, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		info, err := reader.Info()
+		assert.Nil(t, err)
+		it, err := reader.Messages()
+		assert.Nil(t, err)
+		var messages []*Message
+		assert.Nil(t, Range(it, func(_ *Schema, _ *Channel, m *Message) error {
+			messages = append(messages, m)
+			return nil
+		}))
+		return info, messages
+	}
+
+	t.Run("continues an existing file", func(t *testing.T) {
+		f := create(t)
+		defer f.Close()
+		w, err := NewAppendWriter(f, opts())
+		assert.Nil(t, err)
+		// the existing schema and channel are reused.
+		schemaID, err := w.WriteSchema(&Schema{ID: 5, Name: schema.Name, Encoding: schema.Encoding, Data: schema.Data})
+		assert.Nil(t, err)
+		assert.Equal(t, uint16(1), schemaID)
+		channelID, err := w.WriteChannel(&Channel{ID: 5, SchemaID: 5, Topic: "/a", MessageEncoding: "json"})
+		assert.Nil(t, err)
+		assert.Equal(t, uint16(1), channelID)
+		writeMessages(t, w, 5, 20, 30)
+		_, err = w.WriteChannel(&Channel{ID: 2, SchemaID: 1, Topic: "/b", MessageEncoding: "json"})
+		assert.Nil(t, err)
+		writeMessages(t, w, 2, 30, 40)
+		assert.Nil(t, w.Close())
+
+		info, messages := readAll(t, f)
+		assert.Equal(t, 1, len(info.Schemas))
+		assert.Equal(t, 2, len(info.Channels))
+		assert.Equal(t, uint64(40), info.Statistics.MessageCount)
+		assert.Equal(t, map[uint16]uint64{1: 30, 2: 10}, info.Statistics.ChannelMessageCounts)
+		assert.Equal(t, uint64(0), info.Statistics.MessageStartTime)
+		assert.Equal(t, uint64(39), info.Statistics.MessageEndTime)
+		assert.Equal(t, uint32(1), info.Statistics.MetadataCount)
+		assert.Equal(t, 1, len(info.MetadataIndexes))
+		assert.Equal(t, int(info.Statistics.ChunkCount), len(info.ChunkIndexes))
+		assert.Equal(t, "test", info.Header.Profile)
+		assert.Equal(t, 40, len(messages))
+		for i, m := range messages {
+			assert.Equal(t, uint64(i), m.LogTime)
+		}
+	})
+	t.Run("truncates a longer summary", func(t *testing.T) {
+		f := create(t)
+		defer f.Close()
+		before, err := f.Stat()
+		assert.Nil(t, err)
+		// the summary rewritten without the metadata index is shorter.
+		shorter := opts()
+		shorter.SkipMetadataIndex = true
+		w, err := NewAppendWriter(f, shorter)
+		assert.Nil(t, err)
+		assert.Nil(t, w.Close())
+		after, err := f.Stat()
+		assert.Nil(t, err)
+		assert.Less(t, after.Size(), before.Size())
+		assert.Equal(t, int64(w.Offset()), after.Size())
+		info, messages := readAll(t, f)
+		assert.Empty(t, info.MetadataIndexes)
+		assert.Equal(t, 20, len(messages))
+	})
+	t.Run("requires a summary", func(t *testing.T) {
+		f, err := os.Create(filepath.Join(t.TempDir(), "minimal.mcap"))
+		assert.Nil(t, err)
+		defer f.Close()
+		w, err := NewWriter(f, &WriterOptions{Minimal: true})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteHeader(&Header{}))
+		assert.Nil(t, w.Close())
+		_, err = NewAppendWriter(f, opts())
+		assert.Error(t, err)
+	})
+	t.Run("requires a complete summary", func(t *testing.T) {
+		f, err := os.Create(filepath.Join(t.TempDir(), "no-chunk-index.mcap"))
+		assert.Nil(t, err)
+		defer f.Close()
+		skipping := opts()
+		skipping.SkipChunkIndex = true
+		w, err := NewWriter(f, skipping)
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteHeader(&Header{}))
+		_, err = w.WriteChannel(&Channel{ID: 1, Topic: "/a"})
+		assert.Nil(t, err)
+		writeMessages(t, w, 1, 0, 20)
+		assert.Nil(t, w.Close())
+		_, err = NewAppendWriter(f, opts())
+		assert.Error(t, err)
+		skipping = opts()
+		skipping.SkipChunkIndex = true
+		w, err = NewAppendWriter(f, skipping)
+		assert.Nil(t, err)
+		assert.Nil(t, w.Close())
+	})
+}
@@ -0,0 +1,171 @@
+package mcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// AttachmentReader reads an attachment record as it is streamed from the
+// input, so that its data need not fit in memory. It is returned by
+// Lexer.AttachmentReader.
+type AttachmentReader struct {
+	LogTime    uint64
+	CreateTime uint64
+	Name       string
+	MediaType  string
+	DataSize   uint64
+
+	// record reads the remainder of the attachment record, and data the
+	// attachment's data within it.
+	record *io.LimitedReader
+	data   io.Reader
+	crc    hash.Hash32
+	// stored is the CRC stored in the record, once crcRead is set.
+	stored  uint32
+	crcRead bool
+}
+
+// Data returns a reader of the attachment's data. The data is read from the
+// lexer's input, so it must be read before the lexer is advanced.
+func (ar *AttachmentReader) Data() io.Reader {
+	return ar.data
+}
+
+// CRC returns the CRC stored in the attachment record, discarding any of the
+// data not yet read. A CRC of zero means that the record has none. Like the
+// data, it must be read before the lexer is advanced.
+func (ar *AttachmentReader) CRC() (uint32, error) {
+	stored, _, err := ar.readCRC()
+	return stored, err
+}
+
+// ComputedCRC returns the CRC of the attachment record computed over its
+// fields and data, discarding any of the data not yet read, for comparison
+// with the stored CRC.
+func (ar *AttachmentReader) ComputedCRC() (uint32, error) {
+	_, computed, err := ar.readCRC()
+	return computed, err
+}
+
+func (ar *AttachmentReader) readCRC() (stored uint32, computed uint32, err error) {
+	if _, err := io.Copy(io.Discard, ar.data); err != nil {
+		return 0, 0, err
+	}
+	computed = ar.crc.Sum32()
+	if !ar.crcRead {
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(ar.record, buf); err != nil {
+			return 0, 0, unexpectedEOF(err)
+		}
+		ar.stored = binary.LittleEndian.Uint32(buf)
+		ar.crcRead = true
+	}
+	return ar.stored, computed, nil
+}
+
+// AttachmentReader consumes the next record, which must be an attachment,
+// reading only the fields preceding its data. The returned reader streams the
+// data from the lexer's input, bounded to the attachment's data size. When the
+// lexer is next advanced, whatever remains of the attachment record is
+// discarded. Lexers reading ahead with ReadAheadChunks buffer the records
+// they read ahead, attachments included, so the data is then not streamed
+// from the input.
+func (l *Lexer) AttachmentReader() (*AttachmentReader, error) {
+	tokenType, err := l.Peek()
+	if err != nil {
+		return nil, err
+	}
+	if tokenType != TokenAttachment {
+		return nil, fmt.Errorf("next record is %s, not attachment", tokenType)
+	}
+	prefix := l.peeked
+	l.hasPeeked = false
+	record := &io.LimitedReader{R: l.reader, N: int64(prefix.recordLen)}
+	l.unreadRecord = record
+	l.lastInChunk = prefix.inChunk
+	l.lastChunkOffset = l.chunkOffset
+	l.lastRecordOffset = prefix.recordOffset
+	l.lastOpcode = prefix.opcode
+
+	crc := crc32.NewIEEE()
+	fields := io.TeeReader(record, crc)
+	buf := make([]byte, 16)
+	if _, err := io.ReadFull(fields, buf); err != nil {
+		return nil, fmt.Errorf("failed to read attachment times: %w", unexpectedEOF(err))
+	}
+	ar := &AttachmentReader{
+		LogTime:    binary.LittleEndian.Uint64(buf),
+		CreateTime: binary.LittleEndian.Uint64(buf[8:]),
+		record:     record,
+		crc:        crc,
+	}
+	if ar.Name, err = readStreamedString(fields, record.N); err != nil {
+		return nil, fmt.Errorf("failed to read attachment name: %w", err)
+	}
+	if ar.MediaType, err = readStreamedString(fields, record.N); err != nil {
+		return nil, fmt.Errorf("failed to read media type: %w", err)
+	}
+	if _, err := io.ReadFull(fields, buf[:8]); err != nil {
+		return nil, fmt.Errorf("failed to read attachment data size: %w", unexpectedEOF(err))
+	}
+	ar.DataSize = binary.LittleEndian.Uint64(buf)
+	if record.N < 4 || ar.DataSize > uint64(record.N-4) {
+		return nil, fmt.Errorf("attachment data size %d exceeds record length %d: %w",
+			ar.DataSize, prefix.recordLen, io.ErrUnexpectedEOF)
+	}
+	ar.data = &exactReader{r: fields, n: int64(ar.DataSize)}
+	return ar, nil
+}
+
+// exactReader reads n bytes from r, reporting an earlier end of r as
+// io.ErrUnexpectedEOF.
+type exactReader struct {
+	r io.Reader
+	n int64
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	if e.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > e.n {
+		p = p[:e.n]
+	}
+	n, err := e.r.Read(p)
+	e.n -= int64(n)
+	if errors.Is(err, io.EOF) && e.n > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// readStreamedString reads a length-prefixed string of at most limit bytes,
+// including its length.
+func readStreamedString(r io.Reader, limit int64) (string, error) {
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", unexpectedEOF(err)
+	}
+	length := binary.LittleEndian.Uint32(buf)
+	if int64(length) > limit-4 {
+		return "", io.ErrUnexpectedEOF
+	}
+	s := make([]byte, length)
+	if _, err := io.ReadFull(r, s); err != nil {
+		return "", unexpectedEOF(err)
+	}
+	return string(s), nil
+}
+
+// unexpectedEOF reports the end of the input within a record as
+// io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLexerAttachmentReader(t *testing.T) {
+	large := make([]byte, 1<<20)
+	for i := range large {
+		large[i] = byte(i)
+	}
+	attachments := []*Attachment{
+		{LogTime: 1, CreateTime: 2, Name: "large", MediaType: "application/octet-stream", Data: large},
+		{LogTime: 3, CreateTime: 4, Name: "small", MediaType: "text/plain", Data: []byte("hello")},
+		{LogTime: 5, CreateTime: 6, Name: "empty", MediaType: "", Data: []byte{}},
+	}
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{Chunked: true, Compression: CompressionZSTD})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	_, err = w.WriteChannel(&Channel{ID: 1, Topic: "/a", MessageEncoding: "json"})
+	assert.Nil(t, err)
+	for _, attachment := range attachments {
+		assert.Nil(t, w.WriteAttachment(attachment))
+	}
+	assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: 7, Data: []byte("{}")}))
+	assert.Nil(t, w.Close())
+	data := buf.Bytes()
+
+	t.Run("streams attachment data", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(data))
+		assert.Nil(t, err)
+		tokenType, _, err := lexer.Next(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, TokenHeader, tokenType)
+		for _, attachment := range attachments {
+			ar, err := lexer.AttachmentReader()
+			assert.Nil(t, err)
+			assert.Equal(t, attachment.LogTime, ar.LogTime)
+			assert.Equal(t, attachment.CreateTime, ar.CreateTime)
+			assert.Equal(t, attachment.Name, ar.Name)
+			assert.Equal(t, attachment.MediaType, ar.MediaType)
+			assert.Equal(t, uint64(len(attachment.Data)), ar.DataSize)
+			attachmentData, err := io.ReadAll(ar.Data())
+			assert.Nil(t, err)
+			assert.Equal(t, attachment.Data, attachmentData)
+			stored, err := ar.CRC()
+			assert.Nil(t, err)
+			computed, err := ar.ComputedCRC()
+			assert.Nil(t, err)
+			assert.NotZero(t, stored)
+			assert.Equal(t, stored, computed)
+		}
+		tokenType, _, err = lexer.Next(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, TokenChannel, tokenType)
+	})
+	t.Run("skips unread data", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(data))
+		assert.Nil(t, err)
+		var tokens []TokenType
+		for {
+			tokenType, err := lexer.Peek()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			assert.Nil(t, err)
+			if tokenType == TokenAttachment {
+				ar, err := lexer.AttachmentReader()
+				assert.Nil(t, err)
+				// read part of the data only.
+				n := ar.DataSize
+				if n > 3 {
+					n = 3
+				}
+				_, err = io.ReadFull(ar.Data(), make([]byte, n))
+				assert.Nil(t, err)
+			} else {
+				_, _, err = lexer.Next(nil)
+				assert.Nil(t, err)
+			}
+			tokens = append(tokens, tokenType)
+		}
+		var expected []TokenType
+		lexer, err = NewLexer(bytes.NewReader(data))
+		assert.Nil(t, err)
+		for {
+			tokenType, _, err := lexer.Next(nil)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			assert.Nil(t, err)
+			expected = append(expected, tokenType)
+		}
+		assert.Equal(t, expected, tokens)
+	})
+	t.Run("requires an attachment", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(data))
+		assert.Nil(t, err)
+		_, err = lexer.AttachmentReader()
+		assert.Error(t, err)
+		tokenType, _, err := lexer.Next(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, TokenHeader, tokenType)
+	})
+	t.Run("truncated data", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(data[:len(data)/2]))
+		assert.Nil(t, err)
+		_, _, err = lexer.Next(nil)
+		assert.Nil(t, err)
+		ar, err := lexer.AttachmentReader()
+		assert.Nil(t, err)
+		_, err = io.ReadAll(ar.Data())
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		_, _, err = lexer.Next(nil)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
@@ -0,0 +1,151 @@
+package mcap
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// autoCompressionChunks is the number of chunks compressed with every format
+// before AutoCompression settles on one.
+const autoCompressionChunks = 4
+
+// autoCompressionFormats are the formats sampled by AutoCompression, in order
+// of preference between formats that perform equally.
+var autoCompressionFormats = []CompressionFormat{CompressionZSTD, CompressionLZ4, CompressionNone}
+
+// CompressionSample is the result of compressing a chunk in one format, from
+// which a CompressionSelector chooses a format.
+type CompressionSample struct {
+	Compression      CompressionFormat
+	UncompressedSize int
+	CompressedSize   int
+	Duration         time.Duration
+}
+
+// CompressionSelector chooses the chunk compression format of a writer with
+// AutoCompression.
+type CompressionSelector interface {
+	// SelectCompression is called as each of the first few chunks is
+	// flushed, with a sample of each supported format for each of those
+	// chunks so far, and returns the format in which to write the chunk,
+	// which must be among those sampled. The format returned for the last of
+	// them is used for the rest of the file.
+	SelectCompression(samples []CompressionSample) CompressionFormat
+}
+
+// ratioCompressionSelector chooses the fastest format whose compression ratio
+// is within tolerance of the best.
+type ratioCompressionSelector struct {
+	tolerance float64
+}
+
+func (s ratioCompressionSelector) SelectCompression(samples []CompressionSample) CompressionFormat {
+	type total struct {
+		uncompressed, compressed int
+		duration                 time.Duration
+	}
+	totals := make(map[CompressionFormat]*total)
+	var formats []CompressionFormat
+	for _, sample := range samples {
+		t, ok := totals[sample.Compression]
+		if !ok {
+			t = &total{}
+			totals[sample.Compression] = t
+			formats = append(formats, sample.Compression)
+		}
+		t.uncompressed += sample.UncompressedSize
+		t.compressed += sample.CompressedSize
+		t.duration += sample.Duration
+	}
+	ratio := func(t *total) float64 {
+		if t.compressed == 0 {
+			return 0
+		}
+		return float64(t.uncompressed) / float64(t.compressed)
+	}
+	best := 0.0
+	for _, t := range totals {
+		if r := ratio(t); r > best {
+			best = r
+		}
+	}
+	var selected CompressionFormat
+	var fastest time.Duration
+	found := false
+	for _, format := range formats {
+		t := totals[format]
+		if ratio(t) < best*(1-s.tolerance) {
+			continue
+		}
+		if !found || t.duration < fastest {
+			selected, fastest, found = format, t.duration, true
+		}
+	}
+	return selected
+}
+
+// autoCompressor compresses chunks in every format for AutoCompression until
+// a format is chosen.
+type autoCompressor struct {
+	selector CompressionSelector
+	encoders []resettableWriteCloser
+	buffers  []*bytes.Buffer
+	samples  []CompressionSample
+	chunks   int
+	// selected is the format chosen for the most recent chunk.
+	selected CompressionFormat
+}
+
+func newAutoCompressor(opts *WriterOptions) (*autoCompressor, error) {
+	a := &autoCompressor{selector: opts.CompressionSelector}
+	if a.selector == nil {
+		a.selector = ratioCompressionSelector{tolerance: 0.1}
+	}
+	for _, format := range autoCompressionFormats {
+		buf := &bytes.Buffer{}
+		encoder, err := newChunkCompressor(format, buf, opts)
+		if err != nil {
+			return nil, err
+		}
+		a.encoders = append(a.encoders, encoder)
+		a.buffers = append(a.buffers, buf)
+	}
+	return a, nil
+}
+
+// compress compresses the records of a chunk in every format, and returns
+// the chunk in the format chosen by the selector.
+func (a *autoCompressor) compress(records []byte) (CompressionFormat, []byte, error) {
+	for i, format := range autoCompressionFormats {
+		buf := a.buffers[i]
+		buf.Reset()
+		a.encoders[i].Reset(buf)
+		start := time.Now()
+		if _, err := a.encoders[i].Write(records); err != nil {
+			return "", nil, fmt.Errorf("failed to compress chunk with %s: %w", format, err)
+		}
+		if err := a.encoders[i].Close(); err != nil {
+			return "", nil, fmt.Errorf("failed to compress chunk with %s: %w", format, err)
+		}
+		a.samples = append(a.samples, CompressionSample{
+			Compression:      format,
+			UncompressedSize: len(records),
+			CompressedSize:   buf.Len(),
+			Duration:         time.Since(start),
+		})
+	}
+	a.chunks++
+	a.selected = a.selector.SelectCompression(a.samples)
+	for i, format := range autoCompressionFormats {
+		if format == a.selected {
+			return format, a.buffers[i].Bytes(), nil
+		}
+	}
+	return "", nil, fmt.Errorf("compression selector chose unsupported compression %q", a.selected)
+}
+
+// done reports whether the format has been chosen for the rest of the file.
+func (a *autoCompressor) done() bool {
+	return a.chunks >= autoCompressionChunks
+}
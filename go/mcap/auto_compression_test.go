@@ -0,0 +1,130 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// scriptedSelector chooses formats in turn for each chunk.
+type scriptedSelector struct {
+	formats []CompressionFormat
+	calls   []int
+}
+
+func (s *scriptedSelector) SelectCompression(samples []CompressionSample) CompressionFormat {
+	s.calls = append(s.calls, len(samples))
+	return s.formats[(len(s.calls)-1)%len(s.formats)]
+}
+
+func TestAutoCompression(t *testing.T) {
+	// readBack returns the compression of each chunk of a file, checking that
+	// all of its messages can be read.
+	readBack := func(t *testing.T, data []byte, count int) []CompressionFormat {
+		lexer, err := NewLexer(bytes.NewReader(data), &LexerOptions{ValidateCRC: true})
+		assert.Nil(t, err)
+		messages := 0
+		for {
+			tokenType, _, err := lexer.Next(nil)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			assert.Nil(t, err)
+			if tokenType == TokenMessage {
+				messages++
+			}
+		}
+		assert.Equal(t, count, messages)
+		info, err := readInfo(bytes.NewReader(data), int64(len(data)))
+		assert.Nil(t, err)
+		var formats []CompressionFormat
+		for _, idx := range info.ChunkIndexes {
+			chunk, err := readChunkAt(bytes.NewReader(data), idx)
+			assert.Nil(t, err)
+			assert.Equal(t, idx.Compression, CompressionFormat(chunk.Compression))
+			formats = append(formats, idx.Compression)
+		}
+		return formats
+	}
+	t.Run("settles on a format", func(t *testing.T) {
+		data := writePoses(t, &WriterOptions{Chunked: true, ChunkSize: 1024, IncludeCRC: true, AutoCompression: true}, 200)
+		formats := readBack(t, data, 200)
+		assert.Greater(t, len(formats), autoCompressionChunks+1)
+		for _, format := range formats[autoCompressionChunks:] {
+			assert.Equal(t, formats[autoCompressionChunks-1], format)
+		}
+		// the messages compress well.
+		assert.NotEqual(t, CompressionNone, formats[len(formats)-1])
+	})
+	t.Run("custom selector", func(t *testing.T) {
+		selector := &scriptedSelector{
+			formats: []CompressionFormat{CompressionNone, CompressionLZ4, CompressionZSTD, CompressionLZ4},
+		}
+		data := writePoses(t, &WriterOptions{
+			Chunked:             true,
+			ChunkSize:           1024,
+			IncludeCRC:          true,
+			AutoCompression:     true,
+			CompressionSelector: selector,
+		}, 200)
+		formats := readBack(t, data, 200)
+		assert.Equal(t, selector.formats, formats[:autoCompressionChunks])
+		for _, format := range formats[autoCompressionChunks:] {
+			assert.Equal(t, CompressionLZ4, format)
+		}
+		// each call has a sample of each format for each chunk so far.
+		assert.Equal(t, []int{3, 6, 9, 12}, selector.calls)
+	})
+	t.Run("files shorter than the trial", func(t *testing.T) {
+		data := writePoses(t, &WriterOptions{Chunked: true, IncludeCRC: true, AutoCompression: true}, 10)
+		assert.Equal(t, 1, len(readBack(t, data, 10)))
+	})
+	t.Run("rejects unsupported formats", func(t *testing.T) {
+		w, err := NewWriter(&bytes.Buffer{}, &WriterOptions{
+			Chunked:             true,
+			AutoCompression:     true,
+			CompressionSelector: &scriptedSelector{formats: []CompressionFormat{"brotli"}},
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteHeader(&Header{}))
+		_, err = w.WriteChannel(&Channel{ID: 1, Topic: "/a"})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, Data: []byte("hello")}))
+		assert.Error(t, w.Close())
+	})
+	t.Run("option checks", func(t *testing.T) {
+		for _, opts := range []*WriterOptions{
+			{AutoCompression: true},
+			{Chunked: true, AutoCompression: true, DeterministicCompression: true},
+			{Chunked: true, AutoCompression: true, Compression: CompressionZSTD, ZSTDDictionary: readDictionary(t)},
+		} {
+			_, err := NewWriter(&bytes.Buffer{}, opts)
+			assert.Error(t, err)
+		}
+	})
+}
+
+func TestRatioCompressionSelector(t *testing.T) {
+	selector := ratioCompressionSelector{tolerance: 0.1}
+	samples := func(zstdSize, lz4Size int) []CompressionSample {
+		var samples []CompressionSample
+		for i := 0; i < 2; i++ {
+			samples = append(samples,
+				CompressionSample{CompressionZSTD, 1000, zstdSize, 3 * time.Millisecond},
+				CompressionSample{CompressionLZ4, 1000, lz4Size, time.Millisecond},
+				CompressionSample{CompressionNone, 1000, 1000, 0},
+			)
+		}
+		return samples
+	}
+	// zstd compresses much better.
+	assert.Equal(t, CompressionZSTD, selector.SelectCompression(samples(200, 400)))
+	// lz4 is faster, and nearly as good.
+	assert.Equal(t, CompressionLZ4, selector.SelectCompression(samples(200, 210)))
+	// the data is incompressible.
+	assert.Equal(t, CompressionNone, selector.SelectCompression(samples(990, 1010)))
+}
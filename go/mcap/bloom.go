@@ -0,0 +1,200 @@
+package mcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// bloomFalsePositiveRate is the false positive rate that TopicTimeBloom sizes
+// its filters for.
+const bloomFalsePositiveRate = 0.01
+
+// BloomFilter is a compact sketch of the time buckets in which a topic has
+// messages. A negative result from MayContain is definitive; a positive result
+// may be a false positive. Filters may be stored with MarshalBinary and
+// restored with UnmarshalBinary.
+type BloomFilter struct {
+	bucketNs uint64
+	hashes   uint32
+	bits     []uint64
+}
+
+func newBloomFilter(bucketNs uint64, n int) *BloomFilter {
+	m := 64.0
+	if n > 0 {
+		m = math.Max(m, math.Ceil(-float64(n)*math.Log(bloomFalsePositiveRate)/(math.Ln2*math.Ln2)))
+	}
+	words := int(math.Ceil(m / 64))
+	hashes := uint32(1)
+	if n > 0 {
+		hashes = uint32(math.Max(1, math.Round(float64(words*64)/float64(n)*math.Ln2)))
+	}
+	return &BloomFilter{
+		bucketNs: bucketNs,
+		hashes:   hashes,
+		bits:     make([]uint64, words),
+	}
+}
+
+// positions calls f with each bit position for a bucket, using double hashing
+// over a 64-bit mix of the bucket number.
+func (b *BloomFilter) positions(bucket uint64, f func(uint64) bool) bool {
+	h := bucket + 0x9e3779b97f4a7c15
+	h = (h ^ (h >> 30)) * 0xbf58476d1ce4e5b9
+	h = (h ^ (h >> 27)) * 0x94d049bb133111eb
+	h ^= h >> 31
+	h1, h2 := h&math.MaxUint32, h>>32|1
+	m := uint64(len(b.bits)) * 64
+	for i := uint64(0); i < uint64(b.hashes); i++ {
+		if !f((h1 + i*h2) % m) {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *BloomFilter) addBucket(bucket uint64) {
+	b.positions(bucket, func(pos uint64) bool {
+		b.bits[pos/64] |= 1 << (pos % 64)
+		return true
+	})
+}
+
+// MayContain reports whether the topic may have a message in the time bucket
+// containing t.
+func (b *BloomFilter) MayContain(t uint64) bool {
+	return b.positions(t/b.bucketNs, func(pos uint64) bool {
+		return b.bits[pos/64]&(1<<(pos%64)) != 0
+	})
+}
+
+// BucketNs returns the width of the filter's time buckets, in nanoseconds.
+func (b *BloomFilter) BucketNs() uint64 {
+	return b.bucketNs
+}
+
+// MarshalBinary encodes the filter as its bucket width and hash count,
+// followed by its bit array, all little-endian.
+func (b *BloomFilter) MarshalBinary() ([]byte, error) {
+	buf := make([]byte, 8+4+8*len(b.bits))
+	offset := putUint64(buf, b.bucketNs)
+	offset += putUint32(buf[offset:], b.hashes)
+	for _, word := range b.bits {
+		offset += putUint64(buf[offset:], word)
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a filter encoded by MarshalBinary.
+func (b *BloomFilter) UnmarshalBinary(data []byte) error {
+	if len(data) < 8+4+8 || (len(data)-8-4)%8 != 0 {
+		return fmt.Errorf("invalid bloom filter length %d", len(data))
+	}
+	bucketNs := binary.LittleEndian.Uint64(data)
+	hashes := binary.LittleEndian.Uint32(data[8:])
+	if bucketNs == 0 || hashes == 0 {
+		return fmt.Errorf("invalid bloom filter parameters")
+	}
+	bits := make([]uint64, (len(data)-8-4)/8)
+	for i := range bits {
+		bits[i] = binary.LittleEndian.Uint64(data[8+4+8*i:])
+	}
+	b.bucketNs = bucketNs
+	b.hashes = hashes
+	b.bits = bits
+	return nil
+}
+
+// TopicTimeBloom builds a Bloom filter over the time buckets, of width
+// bucketNs, in which the topic has messages. Log times are taken from the
+// message indexes when the file is fully indexed, and from a scan of the file
+// otherwise. If the topic has no messages, the filter contains nothing.
+func TopicTimeBloom(r io.ReaderAt, size int64, topic string, bucketNs uint64) (*BloomFilter, error) {
+	if bucketNs == 0 {
+		return nil, fmt.Errorf("bucket width must be positive")
+	}
+	info, err := readInfo(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read summary: %w", err)
+	}
+	indexed := len(info.ChunkIndexes) > 0 && !info.SummaryIncomplete
+	for _, idx := range info.ChunkIndexes {
+		if idx.MessageIndexLength == 0 {
+			indexed = false
+			break
+		}
+	}
+	buckets := make(map[uint64]struct{})
+	if indexed {
+		for channelID, channel := range info.Channels {
+			if channel.Topic != topic {
+				continue
+			}
+			for _, idx := range info.ChunkIndexes {
+				offset, ok := idx.MessageIndexOffsets[channelID]
+				if !ok {
+					continue
+				}
+				messageIndex, err := readMessageIndexAt(r, offset)
+				if err != nil {
+					return nil, err
+				}
+				for _, entry := range messageIndex.Records {
+					buckets[entry.Timestamp/bucketNs] = struct{}{}
+				}
+			}
+		}
+	} else {
+		err := scanTopicLogTimes(io.NewSectionReader(r, 0, size), topic, func(logTime uint64) {
+			buckets[logTime/bucketNs] = struct{}{}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	bloom := newBloomFilter(bucketNs, len(buckets))
+	for bucket := range buckets {
+		bloom.addBucket(bucket)
+	}
+	return bloom, nil
+}
+
+// scanTopicLogTimes calls f with the log time of each message on the topic.
+func scanTopicLogTimes(r io.Reader, topic string, f func(uint64)) error {
+	lexer, err := NewLexer(r)
+	if err != nil {
+		return err
+	}
+	channels := make(map[uint16]bool)
+	buf := make([]byte, 1024)
+	for {
+		tokenType, record, err := lexer.Next(buf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if len(record) > len(buf) {
+			buf = record
+		}
+		switch tokenType {
+		case TokenChannel:
+			channel, err := ParseChannel(record)
+			if err != nil {
+				return fmt.Errorf("failed to parse channel: %w", err)
+			}
+			channels[channel.ID] = channel.Topic == topic
+		case TokenMessage:
+			if len(record) < 2+4+8 {
+				return io.ErrShortBuffer
+			}
+			if channels[binary.LittleEndian.Uint16(record)] {
+				f(binary.LittleEndian.Uint64(record[2+4:]))
+			}
+		}
+	}
+}
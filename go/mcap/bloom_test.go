@@ -0,0 +1,65 @@
+package mcap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicTimeBloom(t *testing.T) {
+	// /a has messages in even seconds and /b in odd seconds.
+	logTimes := make([]uint64, 200)
+	for i := range logTimes {
+		logTimes[i] = uint64(i) * 1e9
+	}
+	for _, opts := range []*WriterOptions{
+		{Chunked: true, ChunkSize: 1024, Compression: CompressionZSTD},
+		{Chunked: true, Compression: CompressionLZ4, SkipMessageIndexing: true},
+		{},
+	} {
+		data := writeTestFile(t, opts, []string{"/a", "/b"}, logTimes)
+		bloom, err := TopicTimeBloom(bytes.NewReader(data), int64(len(data)), "/a", 1e9)
+		assert.Nil(t, err)
+		falsePositives := 0
+		for i := uint64(0); i < 200; i++ {
+			if i%2 == 0 {
+				assert.True(t, bloom.MayContain(i*1e9+5e8))
+			} else if bloom.MayContain(i * 1e9) {
+				falsePositives++
+			}
+		}
+		assert.Less(t, falsePositives, 10)
+		for i := uint64(200); i < 1000; i++ {
+			if bloom.MayContain(i * 1e9) {
+				falsePositives++
+			}
+		}
+		assert.Less(t, falsePositives, 30)
+	}
+	t.Run("missing topic", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{Chunked: true, Compression: CompressionZSTD}, []string{"/a"}, logTimes)
+		bloom, err := TopicTimeBloom(bytes.NewReader(data), int64(len(data)), "/c", 1e9)
+		assert.Nil(t, err)
+		for _, logTime := range logTimes {
+			assert.False(t, bloom.MayContain(logTime))
+		}
+	})
+	t.Run("round trips through binary encoding", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{Chunked: true, Compression: CompressionZSTD}, []string{"/a", "/b"}, logTimes)
+		bloom, err := TopicTimeBloom(bytes.NewReader(data), int64(len(data)), "/b", 1e9)
+		assert.Nil(t, err)
+		encoded, err := bloom.MarshalBinary()
+		assert.Nil(t, err)
+		decoded := &BloomFilter{}
+		assert.Nil(t, decoded.UnmarshalBinary(encoded))
+		assert.Equal(t, bloom, decoded)
+		assert.Equal(t, uint64(1e9), decoded.BucketNs())
+		assert.Error(t, decoded.UnmarshalBinary(encoded[:10]))
+	})
+	t.Run("zero bucket width", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{}, []string{"/a"}, logTimes)
+		_, err := TopicTimeBloom(bytes.NewReader(data), int64(len(data)), "/a", 0)
+		assert.Error(t, err)
+	})
+}
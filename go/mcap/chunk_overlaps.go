@@ -0,0 +1,49 @@
+package mcap
+
+import (
+	"io"
+	"sort"
+)
+
+// ChunkOverlap is a pair of chunks whose message time ranges intersect. First
+// is the chunk that occurs earlier in the file.
+type ChunkOverlap struct {
+	First  *ChunkIndex
+	Second *ChunkIndex
+}
+
+// ChunkOverlaps reads the chunk indexes of a file and returns every pair of
+// chunks whose [MessageStartTime, MessageEndTime] ranges intersect, ordered by
+// the file offsets of the chunks. A file written in log time order has no
+// overlapping chunks.
+func ChunkOverlaps(r io.ReaderAt, size int64) ([]ChunkOverlap, error) {
+	info, err := readInfo(r, size)
+	if err != nil {
+		return nil, err
+	}
+	chunkIndexes := make([]*ChunkIndex, len(info.ChunkIndexes))
+	copy(chunkIndexes, info.ChunkIndexes)
+	sort.Slice(chunkIndexes, func(i, j int) bool {
+		return chunkIndexes[i].MessageStartTime < chunkIndexes[j].MessageStartTime
+	})
+	var overlaps []ChunkOverlap
+	for i, a := range chunkIndexes {
+		for _, b := range chunkIndexes[i+1:] {
+			if b.MessageStartTime > a.MessageEndTime {
+				break
+			}
+			overlap := ChunkOverlap{First: a, Second: b}
+			if b.ChunkStartOffset < a.ChunkStartOffset {
+				overlap = ChunkOverlap{First: b, Second: a}
+			}
+			overlaps = append(overlaps, overlap)
+		}
+	}
+	sort.Slice(overlaps, func(i, j int) bool {
+		if overlaps[i].First.ChunkStartOffset != overlaps[j].First.ChunkStartOffset {
+			return overlaps[i].First.ChunkStartOffset < overlaps[j].First.ChunkStartOffset
+		}
+		return overlaps[i].Second.ChunkStartOffset < overlaps[j].Second.ChunkStartOffset
+	})
+	return overlaps, nil
+}
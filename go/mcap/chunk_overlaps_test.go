@@ -0,0 +1,51 @@
+package mcap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkOverlaps(t *testing.T) {
+	opts := &WriterOptions{Chunked: true, ChunkSize: 10, Compression: CompressionNone}
+	t.Run("time-sorted file has no overlaps", func(t *testing.T) {
+		data := writeTestFile(t, opts, []string{"/a"}, []uint64{1, 2, 3, 4, 5, 6})
+		overlaps, err := ChunkOverlaps(bytes.NewReader(data), int64(len(data)))
+		assert.Nil(t, err)
+		assert.Empty(t, overlaps)
+	})
+	t.Run("reports overlapping pairs in file order", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w, err := NewWriter(buf, &WriterOptions{Chunked: true, Compression: CompressionNone})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteHeader(&Header{}))
+		_, err = w.WriteSchema(&Schema{ID: 1})
+		assert.Nil(t, err)
+		_, err = w.WriteChannel(&Channel{ID: 1, SchemaID: 1, Topic: "/a"})
+		assert.Nil(t, err)
+		for _, chunk := range [][2]uint64{{10, 20}, {5, 15}, {30, 40}, {12, 35}} {
+			for _, logTime := range chunk {
+				assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: logTime}))
+			}
+			assert.Nil(t, w.Flush())
+		}
+		assert.Nil(t, w.Close())
+		data := buf.Bytes()
+		overlaps, err := ChunkOverlaps(bytes.NewReader(data), int64(len(data)))
+		assert.Nil(t, err)
+		var ranges [][4]uint64
+		for _, overlap := range overlaps {
+			ranges = append(ranges, [4]uint64{
+				overlap.First.MessageStartTime, overlap.First.MessageEndTime,
+				overlap.Second.MessageStartTime, overlap.Second.MessageEndTime,
+			})
+		}
+		assert.Equal(t, [][4]uint64{
+			{10, 20, 5, 15},
+			{10, 20, 12, 35},
+			{5, 15, 12, 35},
+			{30, 40, 12, 35},
+		}, ranges)
+	})
+}
@@ -0,0 +1,246 @@
+package mcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"reflect"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+)
+
+// readInfo reads the summary section of the file backed by r.
+func readInfo(r io.ReaderAt, size int64) (*Info, error) {
+	reader, err := NewReader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	return reader.Info()
+}
+
+// readRecordAt reads the record starting at offset, returning its opcode and
+// body.
+func readRecordAt(r io.ReaderAt, offset uint64) (OpCode, []byte, error) {
+	prefix := make([]byte, 9)
+	_, err := r.ReadAt(prefix, int64(offset))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read record prefix: %w", err)
+	}
+	recordLen := binary.LittleEndian.Uint64(prefix[1:])
+	body, err := makeSafe(recordLen)
+	if err != nil {
+		return 0, nil, err
+	}
+	_, err = r.ReadAt(body, int64(offset)+9)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read record body: %w", err)
+	}
+	return OpCode(prefix[0]), body, nil
+}
+
+// readChunkAt reads and parses the chunk record referenced by a chunk index.
+func readChunkAt(r io.ReaderAt, idx *ChunkIndex) (*Chunk, error) {
+	op, record, err := readRecordAt(r, idx.ChunkStartOffset)
+	if err != nil {
+		return nil, err
+	}
+	if op != OpChunk {
+		return nil, fmt.Errorf("unexpected %s record at chunk offset %d", op, idx.ChunkStartOffset)
+	}
+	return ParseChunk(record)
+}
+
+// readMessageIndexAt reads and parses the message index record at offset.
+func readMessageIndexAt(r io.ReaderAt, offset uint64) (*MessageIndex, error) {
+	op, record, err := readRecordAt(r, offset)
+	if err != nil {
+		return nil, err
+	}
+	if op != OpMessageIndex {
+		return nil, fmt.Errorf("unexpected %s record at message index offset %d", op, offset)
+	}
+	return ParseMessageIndex(record)
+}
+
+// decompressChunk returns the decompressed records section of a chunk.
+func decompressChunk(chunk *Chunk) ([]byte, error) {
+	d := &chunkDecompressor{}
+	defer d.close()
+	return d.decompress(chunk)
+}
+
+// decompressChunkRecord parses and decompresses a chunk record, optionally
+// validating its uncompressed CRC. If requireCRC is set, chunks with no CRC
+// are rejected with ErrMissingChunkCRC.
+func decompressChunkRecord(
+	d *chunkDecompressor,
+	record []byte,
+	validateCRC bool,
+	requireCRC bool,
+	maxDecompressedChunkSize int,
+) ([]byte, error) {
+	chunk, err := ParseChunk(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse chunk: %w", err)
+	}
+	if maxDecompressedChunkSize > 0 && chunk.UncompressedSize > uint64(maxDecompressedChunkSize) {
+		return nil, ErrChunkTooLarge
+	}
+	if requireCRC && chunk.UncompressedCRC == 0 {
+		return nil, ErrMissingChunkCRC
+	}
+	data, err := d.decompress(chunk)
+	if err != nil {
+		return nil, err
+	}
+	if validateCRC && chunk.UncompressedCRC > 0 {
+		crc := crc32.ChecksumIEEE(data)
+		if crc != chunk.UncompressedCRC {
+			return nil, &errInvalidChunkCrc{expected: chunk.UncompressedCRC, actual: crc}
+		}
+	}
+	return data, nil
+}
+
+// chunkDecompressor decompresses chunk records, reusing its decoders across
+// chunks. It is not safe for concurrent use.
+type chunkDecompressor struct {
+	zstd   *zstd.Decoder
+	lz4    *lz4.Reader
+	snappy *s2.Reader
+	// zstdDictionary is the dictionary the zstd decoder is created with.
+	zstdDictionary []byte
+	// decompressors holds the registered decompressors for formats not
+	// supported natively, as for LexerOptions.Decompressors.
+	decompressors map[string]func(io.Reader) (io.Reader, error)
+	// custom holds the registered decompressors that may be reset, by
+	// compression format.
+	custom map[CompressionFormat]io.Reader
+}
+
+// useZSTDDictionary sets the dictionary used to decompress zstd chunks,
+// replacing the zstd decoder if the dictionary differs from its own.
+func (d *chunkDecompressor) useZSTDDictionary(dict []byte) {
+	if sameBytes(d.zstdDictionary, dict) {
+		return
+	}
+	if d.zstd != nil {
+		d.zstd.Close()
+		d.zstd = nil
+	}
+	d.zstdDictionary = dict
+}
+
+func (d *chunkDecompressor) decompress(chunk *Chunk) ([]byte, error) {
+	switch CompressionFormat(chunk.Compression) {
+	case CompressionNone:
+		return chunk.Records, nil
+	case CompressionZSTD:
+		var err error
+		if d.zstd == nil {
+			d.zstd, err = newZSTDDecoder(bytes.NewReader(chunk.Records), d.zstdDictionary)
+		} else {
+			err = d.zstd.Reset(bytes.NewReader(chunk.Records))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zstd chunk: %w", err)
+		}
+		data, err := io.ReadAll(d.zstd)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress zstd chunk: %w", err)
+		}
+		return data, nil
+	case CompressionLZ4:
+		if d.lz4 == nil {
+			d.lz4 = lz4.NewReader(bytes.NewReader(chunk.Records))
+		} else {
+			d.lz4.Reset(bytes.NewReader(chunk.Records))
+		}
+		data, err := io.ReadAll(d.lz4)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress lz4 chunk: %w", lz4ChecksumError(err))
+		}
+		return data, nil
+	case CompressionSnappy:
+		if d.snappy == nil {
+			d.snappy = s2.NewReader(bytes.NewReader(chunk.Records))
+		} else {
+			d.snappy.Reset(bytes.NewReader(chunk.Records))
+		}
+		data, err := io.ReadAll(d.snappy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress snappy chunk: %w", err)
+		}
+		return data, nil
+	default:
+		return d.decompressCustom(CompressionFormat(chunk.Compression), chunk.Records)
+	}
+}
+
+// decompressCustom decompresses records with the registered decompressor for
+// their format.
+func (d *chunkDecompressor) decompressCustom(compression CompressionFormat, records []byte) ([]byte, error) {
+	decoder, ok := d.custom[compression]
+	if ok {
+		if err := decoder.(resettableDecompressor).Reset(bytes.NewReader(records)); err != nil {
+			return nil, fmt.Errorf("failed to reset %s decompressor: %w", compression, err)
+		}
+	} else {
+		newDecoder, ok := d.decompressors[string(compression)]
+		if !ok {
+			return nil, &UnsupportedCompressionError{Compression: compression}
+		}
+		var err error
+		decoder, err = newDecoder(bytes.NewReader(records))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s decompressor: %w", compression, err)
+		}
+		if _, ok := decoder.(resettableDecompressor); ok {
+			if d.custom == nil {
+				d.custom = make(map[CompressionFormat]io.Reader)
+			}
+			d.custom[compression] = decoder
+		}
+	}
+	data, err := io.ReadAll(decoder)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s chunk: %w", compression, err)
+	}
+	return data, nil
+}
+
+// useDecompressors sets the registered decompressors, discarding any
+// registered decompressors kept for reuse unless they are already in use.
+func (d *chunkDecompressor) useDecompressors(decompressors map[string]func(io.Reader) (io.Reader, error)) {
+	if reflect.ValueOf(d.decompressors).Pointer() == reflect.ValueOf(decompressors).Pointer() {
+		return
+	}
+	d.decompressors = decompressors
+	d.custom = nil
+}
+
+func (d *chunkDecompressor) close() {
+	if d.zstd != nil {
+		d.zstd.Close()
+	}
+}
+
+// messageAt parses the message record at the given offset into decompressed
+// chunk data. The returned message data aliases the chunk data.
+func messageAt(chunkData []byte, offset uint64) (*Message, error) {
+	if offset+9 > uint64(len(chunkData)) {
+		return nil, fmt.Errorf("message offset %d out of range", offset)
+	}
+	if op := OpCode(chunkData[offset]); op != OpMessage {
+		return nil, fmt.Errorf("unexpected %s record at message offset %d", op, offset)
+	}
+	length := binary.LittleEndian.Uint64(chunkData[offset+1:])
+	if offset+9+length > uint64(len(chunkData)) {
+		return nil, fmt.Errorf("message at offset %d exceeds chunk: %w", offset, io.ErrShortBuffer)
+	}
+	return ParseMessage(chunkData[offset+9 : offset+9+length])
+}
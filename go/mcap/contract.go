@@ -0,0 +1,152 @@
+package mcap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// TopicRequirement describes a topic that must be present in a file. Empty
+// expectation fields match any value.
+type TopicRequirement struct {
+	Topic           string
+	MessageEncoding string
+	SchemaName      string
+	SchemaEncoding  string
+}
+
+// Contract lists the topics a file must contain to be acceptable.
+type Contract struct {
+	Topics []TopicRequirement
+}
+
+// ContractViolation describes a single way in which a file fails a contract.
+type ContractViolation struct {
+	Topic     string
+	ChannelID uint16
+	Reason    string
+}
+
+func (v ContractViolation) String() string {
+	return fmt.Sprintf("%s: %s", v.Topic, v.Reason)
+}
+
+// ContractViolations is the error returned by ValidateContract when a file
+// does not satisfy a contract.
+type ContractViolations []ContractViolation
+
+func (v ContractViolations) Error() string {
+	reasons := make([]string, 0, len(v))
+	for _, violation := range v {
+		reasons = append(reasons, violation.String())
+	}
+	return fmt.Sprintf("file violates contract: %s", strings.Join(reasons, "; "))
+}
+
+// ValidateContract checks the channel and schema tables of a file against a
+// contract. Every required topic must be present, and every channel on a
+// required topic must match the expected encodings and schema name. If the
+// contract is not satisfied, the returned error is a ContractViolations.
+func ValidateContract(r io.ReaderAt, size int64, contract Contract) error {
+	schemas, channels, err := readSchemasAndChannels(r, size)
+	if err != nil {
+		return err
+	}
+	byTopic := make(map[string][]*Channel)
+	for _, channel := range channels {
+		byTopic[channel.Topic] = append(byTopic[channel.Topic], channel)
+	}
+	var violations ContractViolations
+	for _, requirement := range contract.Topics {
+		topicChannels := byTopic[requirement.Topic]
+		if len(topicChannels) == 0 {
+			violations = append(violations, ContractViolation{
+				Topic:  requirement.Topic,
+				Reason: "topic is missing",
+			})
+			continue
+		}
+		sort.Slice(topicChannels, func(i, j int) bool {
+			return topicChannels[i].ID < topicChannels[j].ID
+		})
+		for _, channel := range topicChannels {
+			violation := ContractViolation{Topic: channel.Topic, ChannelID: channel.ID}
+			if requirement.MessageEncoding != "" && channel.MessageEncoding != requirement.MessageEncoding {
+				violation.Reason = fmt.Sprintf("channel %d has message encoding %q, expected %q",
+					channel.ID, channel.MessageEncoding, requirement.MessageEncoding)
+				violations = append(violations, violation)
+			}
+			if requirement.SchemaName == "" && requirement.SchemaEncoding == "" {
+				continue
+			}
+			schema := schemas[channel.SchemaID]
+			if schema == nil {
+				violation.Reason = fmt.Sprintf("channel %d has no schema", channel.ID)
+				violations = append(violations, violation)
+				continue
+			}
+			if requirement.SchemaName != "" && schema.Name != requirement.SchemaName {
+				violation.Reason = fmt.Sprintf("channel %d has schema name %q, expected %q",
+					channel.ID, schema.Name, requirement.SchemaName)
+				violations = append(violations, violation)
+			}
+			if requirement.SchemaEncoding != "" && schema.Encoding != requirement.SchemaEncoding {
+				violation.Reason = fmt.Sprintf("channel %d has schema encoding %q, expected %q",
+					channel.ID, schema.Encoding, requirement.SchemaEncoding)
+				violations = append(violations, violation)
+			}
+		}
+	}
+	if len(violations) > 0 {
+		return violations
+	}
+	return nil
+}
+
+// readSchemasAndChannels returns the schemas and channels of a file. They are
+// read from the summary section if it contains channels, and otherwise from a
+// scan of the data section.
+func readSchemasAndChannels(r io.ReaderAt, size int64) (map[uint16]*Schema, map[uint16]*Channel, error) {
+	info, err := readInfo(r, size)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read summary: %w", err)
+	}
+	if len(info.Channels) > 0 {
+		return info.Schemas, info.Channels, nil
+	}
+	lexer, err := NewLexer(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, nil, err
+	}
+	schemas := make(map[uint16]*Schema)
+	channels := make(map[uint16]*Channel)
+	buf := make([]byte, 1024)
+	for {
+		tokenType, record, err := lexer.Next(buf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return schemas, channels, nil
+			}
+			return nil, nil, err
+		}
+		if len(record) > len(buf) {
+			buf = record
+		}
+		switch tokenType {
+		case TokenSchema:
+			schema, err := ParseSchema(record)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse schema: %w", err)
+			}
+			schemas[schema.ID] = schema
+		case TokenChannel:
+			channel, err := ParseChannel(record)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse channel: %w", err)
+			}
+			channels[channel.ID] = channel
+		}
+	}
+}
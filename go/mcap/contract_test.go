@@ -0,0 +1,44 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateContract(t *testing.T) {
+	for _, opts := range []*WriterOptions{
+		{Chunked: true, Compression: CompressionZSTD},
+		{SkipRepeatedChannelInfos: true, SkipRepeatedSchemas: true},
+	} {
+		data := writeTestFile(t, opts, []string{"/a", "/b"}, []uint64{1, 2})
+		r := bytes.NewReader(data)
+		t.Run("satisfied contract", func(t *testing.T) {
+			err := ValidateContract(r, int64(len(data)), Contract{
+				Topics: []TopicRequirement{
+					{Topic: "/a", MessageEncoding: "json", SchemaName: "schema", SchemaEncoding: "jsonschema"},
+					{Topic: "/b"},
+				},
+			})
+			assert.Nil(t, err)
+		})
+		t.Run("violated contract", func(t *testing.T) {
+			err := ValidateContract(r, int64(len(data)), Contract{
+				Topics: []TopicRequirement{
+					{Topic: "/a", MessageEncoding: "cdr", SchemaName: "other"},
+					{Topic: "/c"},
+				},
+			})
+			var violations ContractViolations
+			assert.True(t, errors.As(err, &violations))
+			assert.Equal(t, ContractViolations{
+				{Topic: "/a", ChannelID: 1, Reason: `channel 1 has message encoding "json", expected "cdr"`},
+				{Topic: "/a", ChannelID: 1, Reason: `channel 1 has schema name "schema", expected "other"`},
+				{Topic: "/c", Reason: "topic is missing"},
+			}, violations)
+			assert.Contains(t, err.Error(), "/c: topic is missing")
+		})
+	}
+}
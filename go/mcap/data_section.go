@@ -0,0 +1,114 @@
+package mcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNoDataEnd indicates that a file has no data end record where one is
+// expected, before the summary section or the footer.
+var ErrNoDataEnd = errors.New("data end record not found")
+
+// dataEndLength is the length of a data end record, including its opcode and
+// length prefix.
+const dataEndLength = 1 + 8 + 4
+
+// DataSectionRange returns the byte range of the data section of the file:
+// start is the offset following the header record, and end is the offset of
+// the data end record, which closes the data section. The summary section,
+// if any, begins after the data end record. The range is derived from the
+// header and the footer, and the data section is read only if the data end
+// record is longer than this library writes, in which case its records are
+// scanned to find it. A file with no data end record before the summary
+// section fails with ErrNoDataEnd. It seeks the underlying reader, and must
+// not be interleaved with a message iterator.
+func (r *Reader) DataSectionRange() (start, end uint64, err error) {
+	if r.rs == nil {
+		return 0, 0, fmt.Errorf("reading the data section range requires a seekable reader")
+	}
+	prefix := make([]byte, 9)
+	if _, err := r.rs.Seek(int64(len(Magic)), io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	if _, err := io.ReadFull(r.rs, prefix); err != nil {
+		return 0, 0, fmt.Errorf("failed to read header: %w", err)
+	}
+	if OpCode(prefix[0]) != OpHeader {
+		return 0, 0, fmt.Errorf("unexpected opcode %s in header position", OpCode(prefix[0]))
+	}
+	start = uint64(len(Magic)) + 9 + binary.LittleEndian.Uint64(prefix[1:])
+	footer, footerStart, err := r.readFooter()
+	if err != nil {
+		return 0, 0, err
+	}
+	// the data end record precedes the summary section, the summary offset
+	// section or the footer, whichever comes first.
+	next := uint64(footerStart)
+	if footer.SummaryOffsetStart != 0 {
+		next = footer.SummaryOffsetStart
+	}
+	if footer.SummaryStart != 0 {
+		next = footer.SummaryStart
+	}
+	if next > uint64(footerStart) || next < start+dataEndLength {
+		return 0, 0, fmt.Errorf("%w: summary start %d out of range", ErrNoDataEnd, next)
+	}
+	end = next - dataEndLength
+	if _, err := r.rs.Seek(int64(end), io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	if _, err := io.ReadFull(r.rs, prefix); err != nil {
+		return 0, 0, fmt.Errorf("failed to read data end: %w", err)
+	}
+	if OpCode(prefix[0]) == OpDataEnd && binary.LittleEndian.Uint64(prefix[1:]) == dataEndLength-9 {
+		return start, end, nil
+	}
+	// the data end record may carry fields added by later versions of the
+	// format, and so not be where one of its own length would be.
+	end, err = scanToDataEnd(r.rs, start, next, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// scanToDataEnd reads the records of the data section from offset, which must
+// be the start of a record, until the data end record, returning its offset.
+// Records must end by limit, the start of the summary section or footer. If
+// visit is set, it is called with the opcode, offset and length of each
+// record before the data end record, with rs positioned after the record's
+// opcode and length. Files with no data end record before limit fail with
+// ErrNoDataEnd.
+func scanToDataEnd(
+	rs io.ReadSeeker,
+	offset uint64,
+	limit uint64,
+	visit func(op OpCode, offset uint64, recordLength uint64) error,
+) (uint64, error) {
+	prefix := make([]byte, 9)
+	for offset <= limit && limit-offset >= 9 {
+		if _, err := rs.Seek(int64(offset), io.SeekStart); err != nil {
+			return 0, err
+		}
+		if _, err := io.ReadFull(rs, prefix); err != nil {
+			return 0, fmt.Errorf("failed to read record header: %w", err)
+		}
+		op := OpCode(prefix[0])
+		recordLength := binary.LittleEndian.Uint64(prefix[1:])
+		if recordLength > limit-offset-9 {
+			return 0, fmt.Errorf("record at offset %d extends past the data section", offset)
+		}
+		if op == OpDataEnd {
+			return offset, nil
+		}
+		if visit != nil {
+			if err := visit(op, offset, recordLength); err != nil {
+				return 0, err
+			}
+		}
+		offset += 9 + recordLength
+	}
+	return 0, fmt.Errorf("%w: no data end record before offset %d", ErrNoDataEnd, limit)
+}
@@ -0,0 +1,124 @@
+package mcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// extendDataEnd returns a copy of data with extra bytes appended to the data
+// end record, as a later version of the format might write, moving the
+// summary and updating the offsets that refer to it. The summary CRC is
+// cleared.
+func extendDataEnd(t *testing.T, data []byte, extra int) []byte {
+	footer, err := ReadFooter(bytes.NewReader(data))
+	assert.Nil(t, err)
+	dataEnd := footer.SummaryStart - dataEndLength
+	assert.Equal(t, OpDataEnd, OpCode(data[dataEnd]))
+	extended := flatten(
+		data[:dataEnd+1],
+		encodedUint64(dataEndLength-9+uint64(extra)),
+		data[dataEnd+9:footer.SummaryStart],
+		make([]byte, extra),
+		data[footer.SummaryStart:],
+	)
+	footerStart := len(extended) - len(Magic) - footerLength
+	putUint64(extended[footerStart+9:], footer.SummaryStart+uint64(extra))
+	if footer.SummaryOffsetStart != 0 {
+		putUint64(extended[footerStart+9+8:], footer.SummaryOffsetStart+uint64(extra))
+		// summary offset records hold an opcode and the group's start and length.
+		for offset := int(footer.SummaryOffsetStart) + extra; offset < footerStart; offset += 9 + 1 + 8 + 8 {
+			groupStart := extended[offset+9+1:]
+			putUint64(groupStart, binary.LittleEndian.Uint64(groupStart)+uint64(extra))
+		}
+	}
+	putUint32(extended[footerStart+9+8+8:], 0)
+	return extended
+}
+
+func TestDataSectionRange(t *testing.T) {
+	logTimes := []uint64{1, 2, 3, 4, 5}
+	cases := []struct {
+		opts       *WriterOptions
+		hasSummary bool
+	}{
+		{&WriterOptions{Chunked: true, ChunkSize: 64, Compression: CompressionZSTD}, true},
+		{&WriterOptions{Chunked: false}, true},
+		{&WriterOptions{
+			Chunked:                  true,
+			SkipStatistics:           true,
+			SkipRepeatedSchemas:      true,
+			SkipRepeatedChannelInfos: true,
+			SkipChunkIndex:           true,
+			SkipSummaryOffsets:       true,
+			SkipMessageIndexing:      true,
+		}, false},
+	}
+	for i, c := range cases {
+		t.Run(fmt.Sprintf("case %d", i), func(t *testing.T) {
+			data := writeTestFile(t, c.opts, []string{"/a", "/b"}, logTimes)
+			reader, err := NewReader(bytes.NewReader(data))
+			assert.Nil(t, err)
+			start, end, err := reader.DataSectionRange()
+			assert.Nil(t, err)
+			assert.Equal(t, OpDataEnd, OpCode(data[end]))
+			footer, err := readFooterAt(bytes.NewReader(data), int64(len(data)))
+			assert.Nil(t, err)
+			assert.Equal(t, c.hasSummary, footer.SummaryStart != 0)
+			if c.hasSummary {
+				assert.Equal(t, footer.SummaryStart, end+dataEndLength)
+			}
+			// the range holds exactly the records following the header.
+			lexer, err := NewLexer(bytes.NewReader(data[start:end]), &LexerOptions{SkipMagic: true})
+			assert.Nil(t, err)
+			messages := 0
+			for {
+				tokenType, _, err := lexer.Next(nil)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				assert.Nil(t, err)
+				assert.NotEqual(t, TokenHeader, tokenType)
+				assert.NotEqual(t, TokenDataEnd, tokenType)
+				if tokenType == TokenMessage {
+					messages++
+				}
+			}
+			assert.Equal(t, len(logTimes), messages)
+		})
+	}
+	t.Run("extended data end", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{Chunked: true}, []string{"/a"}, logTimes)
+		reader, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		_, expected, err := reader.DataSectionRange()
+		assert.Nil(t, err)
+		reader, err = NewReader(bytes.NewReader(extendDataEnd(t, data, 8)))
+		assert.Nil(t, err)
+		_, end, err := reader.DataSectionRange()
+		assert.Nil(t, err)
+		assert.Equal(t, expected, end)
+	})
+	t.Run("missing data end", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{Chunked: true}, []string{"/a"}, logTimes)
+		reader, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		_, end, err := reader.DataSectionRange()
+		assert.Nil(t, err)
+		data[end] = byte(OpMetadata)
+		_, _, err = reader.DataSectionRange()
+		assert.ErrorIs(t, err, ErrNoDataEnd)
+	})
+	t.Run("requires a seekable reader", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{Chunked: true}, []string{"/a"}, logTimes)
+		reader, err := NewReader(io.MultiReader(bytes.NewReader(data)))
+		assert.Nil(t, err)
+		_, _, err = reader.DataSectionRange()
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,50 @@
+package mcap
+
+// DecoderPool bounds the number of chunk decompressors in use at once, and the
+// decoders and memory they hold, by sharing them among the workers of one or
+// more parallel iterators. Workers borrow a decompressor for each chunk they
+// decompress and return it afterwards, blocking while all of the pool's
+// decompressors are borrowed. A DecoderPool is safe for concurrent use.
+type DecoderPool struct {
+	free chan *chunkDecompressor
+}
+
+// NewDecoderPool returns a pool of at most size decompressors. Sizes less than
+// one are treated as one. Decompressors are created empty and allocate their
+// decoders on first use.
+func NewDecoderPool(size int) *DecoderPool {
+	if size < 1 {
+		size = 1
+	}
+	p := &DecoderPool{free: make(chan *chunkDecompressor, size)}
+	for i := 0; i < size; i++ {
+		p.free <- &chunkDecompressor{}
+	}
+	return p
+}
+
+// get borrows a decompressor from the pool, blocking until one is available.
+// It returns false if stop is closed first.
+func (p *DecoderPool) get(stop <-chan struct{}) (*chunkDecompressor, bool) {
+	select {
+	case d := <-p.free:
+		return d, true
+	case <-stop:
+		return nil, false
+	}
+}
+
+// put returns a borrowed decompressor to the pool.
+func (p *DecoderPool) put(d *chunkDecompressor) {
+	p.free <- d
+}
+
+// Close releases the decoders held by the pool. It must only be called once
+// every iterator using the pool has been closed or run to completion.
+func (p *DecoderPool) Close() {
+	for i := 0; i < cap(p.free); i++ {
+		d := <-p.free
+		d.close()
+		p.free <- d
+	}
+}
@@ -0,0 +1,179 @@
+package mcap
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+)
+
+// FingerprintOptions select the components of a file that contribute to its
+// fingerprint.
+type FingerprintOptions struct {
+	Messages    bool
+	Schemas     bool
+	Channels    bool
+	Attachments bool
+	Metadata    bool
+}
+
+// Fingerprint computes a SHA-256 digest of the selected components of an MCAP
+// file. The digest depends only on the content of the records, not on how the
+// file is chunked or compressed, nor on its index records. Messages,
+// attachments, and metadata are hashed in the order they appear in the file,
+// each into a separate digest, so moving attachments or metadata relative to
+// messages does not change the fingerprint. Schemas and channels are hashed
+// in order of ID, once each, however often they are repeated.
+func Fingerprint(r io.Reader, opts FingerprintOptions) ([32]byte, error) {
+	var fingerprint [32]byte
+	lexer, err := NewLexer(r)
+	if err != nil {
+		return fingerprint, err
+	}
+	messages := sha256.New()
+	attachments := sha256.New()
+	metadata := sha256.New()
+	schemas := make(map[uint16]*Schema)
+	channels := make(map[uint16]*Channel)
+	buf := make([]byte, 1024)
+	for {
+		tokenType, record, err := lexer.Next(buf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fingerprint, err
+		}
+		if len(record) > len(buf) {
+			buf = record
+		}
+		switch tokenType {
+		case TokenSchema:
+			if !opts.Schemas {
+				continue
+			}
+			schema, err := ParseSchema(record)
+			if err != nil {
+				return fingerprint, fmt.Errorf("failed to parse schema: %w", err)
+			}
+			if _, ok := schemas[schema.ID]; !ok {
+				schema.Data = append([]byte{}, schema.Data...)
+				schemas[schema.ID] = schema
+			}
+		case TokenChannel:
+			if !opts.Channels {
+				continue
+			}
+			channel, err := ParseChannel(record)
+			if err != nil {
+				return fingerprint, fmt.Errorf("failed to parse channel: %w", err)
+			}
+			if _, ok := channels[channel.ID]; !ok {
+				channels[channel.ID] = channel
+			}
+		case TokenMessage:
+			if !opts.Messages {
+				continue
+			}
+			message, err := ParseMessage(record)
+			if err != nil {
+				return fingerprint, fmt.Errorf("failed to parse message: %w", err)
+			}
+			writeFingerprintUint64(messages, uint64(message.ChannelID))
+			writeFingerprintUint64(messages, uint64(message.Sequence))
+			writeFingerprintUint64(messages, message.LogTime)
+			writeFingerprintUint64(messages, message.PublishTime)
+			writeFingerprintBytes(messages, message.Data)
+		case TokenAttachment:
+			if !opts.Attachments {
+				continue
+			}
+			attachment, err := ParseAttachment(record)
+			if err != nil {
+				return fingerprint, fmt.Errorf("failed to parse attachment: %w", err)
+			}
+			writeFingerprintUint64(attachments, attachment.LogTime)
+			writeFingerprintUint64(attachments, attachment.CreateTime)
+			writeFingerprintBytes(attachments, []byte(attachment.Name))
+			writeFingerprintBytes(attachments, []byte(attachment.MediaType))
+			writeFingerprintBytes(attachments, attachment.Data)
+		case TokenMetadata:
+			if !opts.Metadata {
+				continue
+			}
+			m, err := ParseMetadata(record)
+			if err != nil {
+				return fingerprint, fmt.Errorf("failed to parse metadata: %w", err)
+			}
+			writeFingerprintBytes(metadata, []byte(m.Name))
+			writeFingerprintBytes(metadata, makePrefixedMap(m.Metadata))
+		}
+	}
+
+	digest := sha256.New()
+	if opts.Schemas {
+		section := sha256.New()
+		for _, id := range sortedIDs(schemas) {
+			schema := schemas[id]
+			writeFingerprintUint64(section, uint64(schema.ID))
+			writeFingerprintBytes(section, []byte(schema.Name))
+			writeFingerprintBytes(section, []byte(schema.Encoding))
+			writeFingerprintBytes(section, schema.Data)
+		}
+		writeFingerprintSection(digest, OpSchema, section)
+	}
+	if opts.Channels {
+		section := sha256.New()
+		for _, id := range sortedIDs(channels) {
+			channel := channels[id]
+			writeFingerprintUint64(section, uint64(channel.ID))
+			writeFingerprintUint64(section, uint64(channel.SchemaID))
+			writeFingerprintBytes(section, []byte(channel.Topic))
+			writeFingerprintBytes(section, []byte(channel.MessageEncoding))
+			writeFingerprintBytes(section, makePrefixedMap(channel.Metadata))
+		}
+		writeFingerprintSection(digest, OpChannel, section)
+	}
+	if opts.Messages {
+		writeFingerprintSection(digest, OpMessage, messages)
+	}
+	if opts.Attachments {
+		writeFingerprintSection(digest, OpAttachment, attachments)
+	}
+	if opts.Metadata {
+		writeFingerprintSection(digest, OpMetadata, metadata)
+	}
+	copy(fingerprint[:], digest.Sum(nil))
+	return fingerprint, nil
+}
+
+// writeFingerprintSection adds the digest of a component, tagged with the
+// opcode of its records, to the fingerprint.
+func writeFingerprintSection(digest hash.Hash, opcode OpCode, section hash.Hash) {
+	_, _ = digest.Write([]byte{byte(opcode)})
+	_, _ = digest.Write(section.Sum(nil))
+}
+
+func writeFingerprintUint64(h hash.Hash, v uint64) {
+	buf := make([]byte, 8)
+	putUint64(buf, v)
+	_, _ = h.Write(buf)
+}
+
+// writeFingerprintBytes writes a length-prefixed byte string, so that
+// adjacent fields cannot be confused.
+func writeFingerprintBytes(h hash.Hash, data []byte) {
+	writeFingerprintUint64(h, uint64(len(data)))
+	_, _ = h.Write(data)
+}
+
+func sortedIDs[V any](m map[uint16]V) []uint16 {
+	keys := make([]uint16, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,96 @@
+package mcap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFingerprintTestFile(t *testing.T, opts *WriterOptions, schemaData string, attachmentData string) []byte {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, opts)
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{Profile: "test"}))
+	_, err = w.WriteSchema(&Schema{ID: 1, Name: "schema", Encoding: "jsonschema", Data: []byte(schemaData)})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{
+		ID:              1,
+		SchemaID:        1,
+		Topic:           "/a",
+		MessageEncoding: "json",
+		Metadata:        map[string]string{"b": "2", "a": "1"},
+	})
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, w.WriteMessage(&Message{
+			ChannelID: 1,
+			Sequence:  uint32(i),
+			LogTime:   uint64(i),
+			Data:      []byte{byte(i)},
+		}))
+		if i == 5 {
+			assert.Nil(t, w.WriteAttachment(&Attachment{
+				Name:      "attachment",
+				MediaType: "text/plain",
+				Data:      []byte(attachmentData),
+			}))
+			assert.Nil(t, w.WriteMetadata(&Metadata{
+				Name:     "metadata",
+				Metadata: map[string]string{"key": "value"},
+			}))
+		}
+	}
+	assert.Nil(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestFingerprint(t *testing.T) {
+	all := FingerprintOptions{
+		Messages:    true,
+		Schemas:     true,
+		Channels:    true,
+		Attachments: true,
+		Metadata:    true,
+	}
+	fingerprint := func(t *testing.T, data []byte, opts FingerprintOptions) [32]byte {
+		f, err := Fingerprint(bytes.NewReader(data), opts)
+		assert.Nil(t, err)
+		return f
+	}
+	base := writeFingerprintTestFile(t, &WriterOptions{
+		Chunked:     true,
+		ChunkSize:   20,
+		Compression: CompressionZSTD,
+		IncludeCRC:  true,
+	}, "{}", "hello")
+	t.Run("independent of chunking and compression", func(t *testing.T) {
+		for _, opts := range []*WriterOptions{
+			{Chunked: false},
+			{Chunked: true, Compression: CompressionLZ4, ChunkSize: 1024},
+			{Chunked: true, Compression: CompressionNone, SkipMessageIndexing: true},
+		} {
+			other := writeFingerprintTestFile(t, opts, "{}", "hello")
+			assert.Equal(t, fingerprint(t, base, all), fingerprint(t, other, all))
+		}
+	})
+	t.Run("excludes deselected components", func(t *testing.T) {
+		changedAttachment := writeFingerprintTestFile(t, &WriterOptions{Chunked: true}, "{}", "goodbye")
+		withoutAttachments := all
+		withoutAttachments.Attachments = false
+		assert.NotEqual(t, fingerprint(t, base, all), fingerprint(t, changedAttachment, all))
+		assert.Equal(t, fingerprint(t, base, withoutAttachments), fingerprint(t, changedAttachment, withoutAttachments))
+
+		changedSchema := writeFingerprintTestFile(t, &WriterOptions{Chunked: true}, `{"type":"object"}`, "hello")
+		messagesOnly := FingerprintOptions{Messages: true}
+		assert.NotEqual(t, fingerprint(t, base, all), fingerprint(t, changedSchema, all))
+		assert.Equal(t, fingerprint(t, base, messagesOnly), fingerprint(t, changedSchema, messagesOnly))
+	})
+	t.Run("distinguishes component selections", func(t *testing.T) {
+		assert.NotEqual(t,
+			fingerprint(t, base, FingerprintOptions{Schemas: true}),
+			fingerprint(t, base, FingerprintOptions{Channels: true}),
+		)
+		assert.NotEqual(t, fingerprint(t, base, FingerprintOptions{}), fingerprint(t, base, all))
+	})
+}
@@ -0,0 +1,68 @@
+package mcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// footerScanBlockSize is the number of bytes ReadAllFooters scans per read.
+const footerScanBlockSize = 64 * 1024
+
+// ReadAllFooters scans a file of the given size for footer records and returns
+// them in the order they occur. Each footer record is followed by the magic
+// bytes, so the file is scanned for the magic, and footers are taken from the
+// footer records that immediately precede it. Files with more than one footer
+// include files concatenated together and files recovered after an
+// interrupted write, which may retain the footer of an overwritten checkpoint.
+// The scan reads the whole file, and may in principle report a footer that is
+// embedded in the data of another record.
+func ReadAllFooters(r io.ReaderAt, size int64) ([]*Footer, error) {
+	return readAllFooters(r, size, footerScanBlockSize)
+}
+
+func readAllFooters(r io.ReaderAt, size int64, blockSize int) ([]*Footer, error) {
+	footers := []*Footer{}
+	// each window holds a block, preceded by room for a footer record and
+	// followed by room for magic beginning at the end of the block.
+	window := make([]byte, footerLength+blockSize+len(Magic)-1)
+	for blockStart := int64(0); blockStart < size; blockStart += int64(blockSize) {
+		windowStart := blockStart - footerLength
+		if windowStart < 0 {
+			windowStart = 0
+		}
+		n := int64(len(window))
+		if windowStart+n > size {
+			n = size - windowStart
+		}
+		buf := window[:n]
+		if _, err := r.ReadAt(buf, windowStart); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to read at offset %d: %w", windowStart, err)
+		}
+		blockEnd := int(blockStart-windowStart) + blockSize
+		for from := int(blockStart - windowStart); from < blockEnd; {
+			i := bytes.Index(buf[from:], Magic)
+			if i < 0 || from+i >= blockEnd {
+				break
+			}
+			magicStart := from + i
+			from = magicStart + 1
+			if magicStart < footerLength {
+				continue
+			}
+			record := buf[magicStart-footerLength : magicStart]
+			if OpCode(record[0]) != OpFooter || binary.LittleEndian.Uint64(record[1:]) != footerLength-9 {
+				continue
+			}
+			footer, err := ParseFooter(record[9:])
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse footer at offset %d: %w",
+					windowStart+int64(magicStart-footerLength), err)
+			}
+			footers = append(footers, footer)
+		}
+	}
+	return footers, nil
+}
@@ -0,0 +1,64 @@
+package mcap
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAllFooters(t *testing.T) {
+	first := writeTestFile(t, &WriterOptions{Chunked: true, ChunkSize: 64, Compression: CompressionZSTD},
+		[]string{"/a", "/b"}, []uint64{1, 2, 3, 4})
+	second := writeTestFile(t, &WriterOptions{}, []string{"/c"}, []uint64{5, 6})
+	footerOf := func(data []byte) *Footer {
+		footer, err := readFooterAt(bytes.NewReader(data), int64(len(data)))
+		assert.Nil(t, err)
+		return footer
+	}
+
+	// a checkpoint partly overwritten by a write that was then interrupted
+	// leaves its footer behind.
+	f, err := os.Create(filepath.Join(t.TempDir(), "interrupted.mcap"))
+	assert.Nil(t, err)
+	defer f.Close()
+	writer, err := NewWriter(f, &WriterOptions{})
+	assert.Nil(t, err)
+	assert.Nil(t, writer.WriteHeader(&Header{}))
+	assert.Nil(t, writer.WriteMetadata(&Metadata{Name: "a"}))
+	assert.Nil(t, writer.Checkpoint())
+	checkpoint, err := os.ReadFile(f.Name())
+	assert.Nil(t, err)
+	assert.Nil(t, writer.WriteMetadata(&Metadata{Name: "b"}))
+	interrupted, err := os.ReadFile(f.Name())
+	assert.Nil(t, err)
+
+	cases := []struct {
+		assertion string
+		input     []byte
+		expected  []*Footer
+	}{
+		{"single file", first, []*Footer{footerOf(first)}},
+		{"concatenated files", flatten(first, second), []*Footer{footerOf(first), footerOf(second)}},
+		{"interrupted checkpoint", interrupted, []*Footer{footerOf(checkpoint)}},
+		{"truncated file", first[:len(first)/2], []*Footer{}},
+	}
+	for _, c := range cases {
+		for _, blockSize := range []int{1, 5, 29, 64, footerScanBlockSize} {
+			t.Run(fmt.Sprintf("%s, block size %d", c.assertion, blockSize), func(t *testing.T) {
+				footers, err := readAllFooters(bytes.NewReader(c.input), int64(len(c.input)), blockSize)
+				assert.Nil(t, err)
+				assert.Equal(t, c.expected, footers)
+			})
+		}
+	}
+	t.Run("reads the whole file", func(t *testing.T) {
+		input := flatten(first, second)
+		footers, err := ReadAllFooters(bytes.NewReader(input), int64(len(input)))
+		assert.Nil(t, err)
+		assert.Len(t, footers, 2)
+	})
+}
@@ -6,6 +6,7 @@ require (
 	github.com/klauspost/compress v1.14.1
 	github.com/pierrec/lz4/v4 v4.1.12
 	github.com/stretchr/testify v1.7.0
+	google.golang.org/protobuf v1.28.0
 )
 
 require (
@@ -0,0 +1,122 @@
+package mcap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrRangeNotSupported is returned by NewHTTPReaderAt when the server does not
+// respond to range requests with partial content.
+var ErrRangeNotSupported = errors.New("server does not support range requests")
+
+// httpReaderAt implements io.ReaderAt with HTTP range requests.
+type httpReaderAt struct {
+	ctx    context.Context
+	url    string
+	client *http.Client
+	size   int64
+}
+
+// NewHTTPReaderAt returns an io.ReaderAt that reads the resource at url with
+// HTTP range requests, along with the resource's size, so that an indexed
+// reader fetches only the parts of a remote file it needs. The size is
+// determined by requesting the first byte of the resource; if the server
+// responds with anything other than partial content, an error wrapping
+// ErrRangeNotSupported is returned. If client is nil, http.DefaultClient is
+// used. The context applies to every request made by the reader. The reader
+// also implements interface{ Size() int64 }, so it may be passed to
+// NewReaderAt without a probe.
+func NewHTTPReaderAt(ctx context.Context, url string, client *http.Client) (io.ReaderAt, int64, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	r := &httpReaderAt{ctx: ctx, url: url, client: client}
+	resp, err := r.get(0, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	size, err := contentRangeSize(resp.Header.Get("Content-Range"))
+	if err != nil {
+		return nil, 0, err
+	}
+	r.size = size
+	return r, size, nil
+}
+
+// Size returns the size of the resource.
+func (r *httpReaderAt) Size() int64 {
+	return r.size
+}
+
+func (r *httpReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	end := off + int64(len(p))
+	if end > r.size {
+		end = r.size
+	}
+	resp, err := r.get(off, end-1)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	n, err := io.ReadFull(resp.Body, p[:end-off])
+	if err != nil {
+		return n, fmt.Errorf("failed to read range response: %w", err)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// get requests the inclusive byte range [start, end] of the resource and
+// checks that the server responded with partial content.
+func (r *httpReaderAt) get(start, end int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(r.ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp, nil
+	case http.StatusOK:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s responded with %s", ErrRangeNotSupported, r.url, resp.Status)
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to read %s: %s", r.url, resp.Status)
+	}
+}
+
+// contentRangeSize parses the complete length from a Content-Range header of
+// the form "bytes start-end/size".
+func contentRangeSize(contentRange string) (int64, error) {
+	idx := strings.LastIndex(contentRange, "/")
+	if !strings.HasPrefix(contentRange, "bytes ") || idx < 0 {
+		return 0, fmt.Errorf("invalid content range %q", contentRange)
+	}
+	size, err := strconv.ParseInt(contentRange[idx+1:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid content range %q: %w", contentRange, err)
+	}
+	return size, nil
+}
@@ -0,0 +1,92 @@
+package mcap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPReaderAt(t *testing.T) {
+	logTimes := make([]uint64, 1000)
+	for i := range logTimes {
+		logTimes[i] = uint64(i)
+	}
+	data := writeTestFile(t, &WriterOptions{
+		Chunked:     true,
+		ChunkSize:   1024,
+		Compression: CompressionNone,
+	}, []string{"/a", "/b"}, logTimes)
+	var served int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter := &countingResponseWriter{ResponseWriter: w, n: &served}
+		http.ServeContent(counter, r, "test.mcap", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	t.Run("reads ranges", func(t *testing.T) {
+		ra, size, err := NewHTTPReaderAt(context.Background(), server.URL, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(len(data)), size)
+		buf := make([]byte, 16)
+		n, err := ra.ReadAt(buf, 100)
+		assert.Nil(t, err)
+		assert.Equal(t, 16, n)
+		assert.Equal(t, data[100:116], buf)
+		n, err = ra.ReadAt(buf, size-4)
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Equal(t, 4, n)
+		assert.Equal(t, data[size-4:], buf[:4])
+		_, err = ra.ReadAt(buf, size)
+		assert.ErrorIs(t, err, io.EOF)
+	})
+	t.Run("indexed reading fetches only what it needs", func(t *testing.T) {
+		served = 0
+		ra, _, err := NewHTTPReaderAt(context.Background(), server.URL, nil)
+		assert.Nil(t, err)
+		reader, err := NewReaderAt(ra, nil)
+		assert.Nil(t, err)
+		info, err := reader.Info()
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(len(logTimes)), info.Statistics.MessageCount)
+		assert.Less(t, served, int64(len(data)/2))
+	})
+	t.Run("rejects servers without range support", func(t *testing.T) {
+		noRanges := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(data)
+		}))
+		defer noRanges.Close()
+		_, _, err := NewHTTPReaderAt(context.Background(), noRanges.URL, nil)
+		assert.ErrorIs(t, err, ErrRangeNotSupported)
+	})
+	t.Run("reports request failures", func(t *testing.T) {
+		_, _, err := NewHTTPReaderAt(context.Background(), server.URL+"/missing", &http.Client{
+			Transport: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+				return nil, errors.New("connection refused")
+			}),
+		})
+		assert.Error(t, err)
+	})
+}
+
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n *int64
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	*w.n += int64(len(p))
+	return w.ResponseWriter.Write(p)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,161 @@
+package mcap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ErrBadIndexSidecar indicates that data is not an index sidecar.
+var ErrBadIndexSidecar = errors.New("not an MCAP index sidecar")
+
+// indexSidecarMagic begins an index sidecar, identifying the format and its
+// version.
+var indexSidecarMagic = []byte("MCAPIDX\x01")
+
+// IndexSidecar is a compact index of the messages of a file by topic and log
+// time, as written by reads with readopts.WritingIndexSidecar.
+type IndexSidecar struct {
+	// Topics holds the entries of each topic, in log time order.
+	Topics map[string][]IndexSidecarEntry
+}
+
+// IndexSidecarEntry locates a message in a file.
+type IndexSidecarEntry struct {
+	LogTime uint64
+	// Offset is the offset in the file of the chunk containing the message,
+	// or of the message record if InChunk is false.
+	Offset uint64
+	// RecordOffset is the offset of the message record within the chunk's
+	// decompressed records, as in message index records.
+	RecordOffset uint64
+	InChunk      bool
+}
+
+// indexSidecarBuilder accumulates the entries of an index sidecar as messages
+// are read.
+type indexSidecarBuilder struct {
+	w       io.Writer
+	topics  map[string][]IndexSidecarEntry
+	written bool
+}
+
+func newIndexSidecarBuilder(w io.Writer) *indexSidecarBuilder {
+	return &indexSidecarBuilder{w: w, topics: make(map[string][]IndexSidecarEntry)}
+}
+
+func (b *indexSidecarBuilder) add(topic string, entry IndexSidecarEntry) {
+	b.topics[topic] = append(b.topics[topic], entry)
+}
+
+// write serializes the sidecar to the builder's writer, once.
+//
+// The sidecar consists of the magic, then the number of topics and, for each
+// topic in lexical order, its length-prefixed name, the number of entries and
+// the entries in log time order. Each entry is the difference of its log time
+// from that of the previous entry, its offset, and its record offset plus one
+// if it is in a chunk or zero otherwise. All integers are unsigned varints.
+func (b *indexSidecarBuilder) write() error {
+	if b.written {
+		return nil
+	}
+	b.written = true
+	topics := make([]string, 0, len(b.topics))
+	for topic := range b.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	buf := bytes.NewBuffer(append([]byte{}, indexSidecarMagic...))
+	tmp := make([]byte, binary.MaxVarintLen64)
+	putUvarint := func(x uint64) {
+		n := binary.PutUvarint(tmp, x)
+		buf.Write(tmp[:n])
+	}
+	putUvarint(uint64(len(topics)))
+	for _, topic := range topics {
+		entries := b.topics[topic]
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].LogTime < entries[j].LogTime
+		})
+		putUvarint(uint64(len(topic)))
+		buf.WriteString(topic)
+		putUvarint(uint64(len(entries)))
+		var lastLogTime uint64
+		for _, entry := range entries {
+			putUvarint(entry.LogTime - lastLogTime)
+			lastLogTime = entry.LogTime
+			putUvarint(entry.Offset)
+			if entry.InChunk {
+				putUvarint(entry.RecordOffset + 1)
+			} else {
+				putUvarint(0)
+			}
+		}
+	}
+	if _, err := b.w.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write index sidecar: %w", err)
+	}
+	return nil
+}
+
+// ReadIndexSidecar reads an index sidecar written by a read with
+// readopts.WritingIndexSidecar.
+func ReadIndexSidecar(r io.Reader) (*IndexSidecar, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(indexSidecarMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, indexSidecarMagic) {
+		return nil, ErrBadIndexSidecar
+	}
+	readUvarint := func() (uint64, error) {
+		x, err := binary.ReadUvarint(br)
+		if errors.Is(err, io.EOF) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		return x, err
+	}
+	topicCount, err := readUvarint()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read topic count: %w", err)
+	}
+	sidecar := &IndexSidecar{Topics: make(map[string][]IndexSidecarEntry)}
+	for i := uint64(0); i < topicCount; i++ {
+		topicLen, err := readUvarint()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read topic length: %w", err)
+		}
+		topic, err := makeSafe(topicLen)
+		if err != nil {
+			return nil, fmt.Errorf("failed to allocate topic: %w", err)
+		}
+		if _, err := io.ReadFull(br, topic); err != nil {
+			return nil, fmt.Errorf("failed to read topic: %w", err)
+		}
+		entryCount, err := readUvarint()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read entry count: %w", err)
+		}
+		var entries []IndexSidecarEntry
+		var logTime uint64
+		for j := uint64(0); j < entryCount; j++ {
+			var values [3]uint64
+			for k := range values {
+				if values[k], err = readUvarint(); err != nil {
+					return nil, fmt.Errorf("failed to read entry of %s: %w", topic, err)
+				}
+			}
+			logTime += values[0]
+			entry := IndexSidecarEntry{LogTime: logTime, Offset: values[1]}
+			if values[2] > 0 {
+				entry.InChunk = true
+				entry.RecordOffset = values[2] - 1
+			}
+			entries = append(entries, entry)
+		}
+		sidecar.Topics[string(topic)] = entries
+	}
+	return sidecar, nil
+}
@@ -0,0 +1,87 @@
+package mcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/foxglove/mcap/go/mcap/readopts"
+	"github.com/stretchr/testify/assert"
+)
+
+// sidecarMessage parses the message record at an index sidecar entry's location.
+func sidecarMessage(t *testing.T, data []byte, entry IndexSidecarEntry) *Message {
+	record := data[entry.Offset:]
+	if entry.InChunk {
+		assert.Equal(t, OpChunk, OpCode(record[0]))
+		length := binary.LittleEndian.Uint64(record[1:9])
+		chunk, err := ParseChunk(record[9 : 9+length])
+		assert.Nil(t, err)
+		record = chunk.Records[entry.RecordOffset:]
+	}
+	assert.Equal(t, OpMessage, OpCode(record[0]))
+	length := binary.LittleEndian.Uint64(record[1:9])
+	message, err := ParseMessage(record[9 : 9+length])
+	assert.Nil(t, err)
+	return message
+}
+
+func TestIndexSidecar(t *testing.T) {
+	logTimes := []uint64{50, 10, 70, 20, 30, 95, 5, 40}
+	for _, chunked := range []bool{true, false} {
+		data := writeTestFile(t, &WriterOptions{
+			Chunked:     chunked,
+			ChunkSize:   64,
+			Compression: CompressionNone,
+		}, []string{"/a", "/b"}, logTimes)
+		reader, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		sidecarBuf := &bytes.Buffer{}
+		it, err := reader.Messages(readopts.UsingIndex(false), readopts.WritingIndexSidecar(sidecarBuf))
+		assert.Nil(t, err)
+		assert.Nil(t, Range(it, func(*Schema, *Channel, *Message) error { return nil }))
+
+		sidecar, err := ReadIndexSidecar(sidecarBuf)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(sidecar.Topics))
+		count := 0
+		for topic, entries := range sidecar.Topics {
+			for i, entry := range entries {
+				count++
+				assert.Equal(t, chunked, entry.InChunk)
+				if i > 0 {
+					assert.LessOrEqual(t, entries[i-1].LogTime, entry.LogTime)
+				}
+				message := sidecarMessage(t, data, entry)
+				assert.Equal(t, entry.LogTime, message.LogTime)
+				assert.Equal(t, topic, reader.channels[message.ChannelID].Topic)
+			}
+		}
+		assert.Equal(t, len(logTimes), count)
+	}
+
+	data := writeTestFile(t, &WriterOptions{Chunked: true}, []string{"/a"}, logTimes)
+	t.Run("not written by incomplete reads", func(t *testing.T) {
+		reader, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		sidecarBuf := &bytes.Buffer{}
+		it, err := reader.Messages(
+			readopts.UsingIndex(false),
+			readopts.WithMaxMessages(2),
+			readopts.WritingIndexSidecar(sidecarBuf),
+		)
+		assert.Nil(t, err)
+		assert.Nil(t, Range(it, func(*Schema, *Channel, *Message) error { return nil }))
+		assert.Equal(t, 0, sidecarBuf.Len())
+	})
+	t.Run("rejected for indexed reads", func(t *testing.T) {
+		reader, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		_, err = reader.Messages(readopts.WritingIndexSidecar(&bytes.Buffer{}))
+		assert.Error(t, err)
+	})
+	t.Run("rejects other data", func(t *testing.T) {
+		_, err := ReadIndexSidecar(bytes.NewReader(data))
+		assert.ErrorIs(t, err, ErrBadIndexSidecar)
+	})
+}
@@ -4,11 +4,10 @@ import (
 	"bytes"
 	"container/heap"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
-
-	"github.com/klauspost/compress/zstd"
-	"github.com/pierrec/lz4/v4"
+	"time"
 )
 
 // indexedMessageIterator is an iterator over an indexed mcap read seeker (as
@@ -28,10 +27,24 @@ type indexedMessageIterator struct {
 	attachmentIndexes []*AttachmentIndex
 	metadataIndexes   []*MetadataIndex
 
+	// summaryIncomplete is set if the data section contains chunks that are
+	// not covered by the chunk indexes in the summary section.
+	summaryIncomplete bool
+
 	indexHeap rangeIndexHeap
 
-	zstdDecoder *zstd.Decoder
-	lz4Reader   *lz4.Reader
+	// maxMessages, if positive, is the number of messages after which the
+	// iterator stops loading chunks.
+	maxMessages int
+	count       int
+
+	decompressor chunkDecompressor
+	deadline     time.Time
+
+	onSchema  func(*Schema)
+	onChannel func(*Channel)
+	onMessage func(*Schema, *Channel, *Message)
+	onChunk   func()
 }
 
 // parseIndexSection parses the index section of the file and populates the
@@ -76,11 +89,13 @@ func (it *indexedMessageIterator) parseSummarySection() error {
 				return fmt.Errorf("failed to parse schema: %w", err)
 			}
 			it.schemas[schema.ID] = schema
+			it.onSchema(schema)
 		case TokenChannel:
 			channelInfo, err := ParseChannel(record)
 			if err != nil {
 				return fmt.Errorf("failed to parse channel info: %w", err)
 			}
+			it.onChannel(channelInfo)
 			if len(it.topics) == 0 || it.topics[channelInfo.Topic] {
 				it.channels[channelInfo.ID] = channelInfo
 			}
@@ -123,9 +138,57 @@ func (it *indexedMessageIterator) parseSummarySection() error {
 			}
 			it.statistics = stats
 		case TokenFooter:
+			return it.reconcileUnindexedChunks(footer.SummaryStart)
+		}
+	}
+}
+
+// reconcileUnindexedChunks scans the data section following the last indexed
+// chunk for chunks that are missing from the summary, as produced by writers
+// that failed to index their final chunks. Such chunks are added to the read
+// with no message index, so that loadChunk scans their records instead. The
+// scan ends at the Data End record closing the data section; if none is found
+// before the summary, the summary is reported incomplete, as chunks may be
+// missing from it. Summaries without chunk indexes are not reconciled.
+func (it *indexedMessageIterator) reconcileUnindexedChunks(summaryStart uint64) error {
+	if len(it.chunkIndexes) == 0 {
+		return nil
+	}
+	offset := uint64(0)
+	for _, idx := range it.chunkIndexes {
+		if end := idx.ChunkStartOffset + idx.ChunkLength + idx.MessageIndexLength; end > offset {
+			offset = end
+		}
+	}
+	buf := make([]byte, 16)
+	_, err := scanToDataEnd(it.rs, offset, summaryStart, func(op OpCode, offset uint64, recordLength uint64) error {
+		if op != OpChunk {
 			return nil
 		}
+		if recordLength < uint64(len(buf)) {
+			return fmt.Errorf("chunk at offset %d is too short", offset)
+		}
+		if _, err := io.ReadFull(it.rs, buf); err != nil {
+			return fmt.Errorf("failed to read chunk header: %w", err)
+		}
+		idx := &ChunkIndex{
+			MessageStartTime:    binary.LittleEndian.Uint64(buf[0:8]),
+			MessageEndTime:      binary.LittleEndian.Uint64(buf[8:16]),
+			ChunkStartOffset:    offset,
+			ChunkLength:         1 + 8 + recordLength,
+			MessageIndexOffsets: make(map[uint16]uint64),
+		}
+		it.summaryIncomplete = true
+		if (it.end == 0 && it.start == 0) || (idx.MessageStartTime < it.end && idx.MessageEndTime >= it.start) {
+			return it.indexHeap.HeapPush(rangeIndex{chunkIndex: idx})
+		}
+		return nil
+	})
+	if errors.Is(err, ErrNoDataEnd) {
+		it.summaryIncomplete = true
+		return nil
 	}
+	return err
 }
 
 func (it *indexedMessageIterator) loadChunk(chunkIndex *ChunkIndex) error {
@@ -142,37 +205,13 @@ func (it *indexedMessageIterator) loadChunk(chunkIndex *ChunkIndex) error {
 	if err != nil {
 		return fmt.Errorf("failed to parse chunk: %w", err)
 	}
-	// decompress the chunk data
-	var chunkData []byte
-	switch CompressionFormat(parsedChunk.Compression) {
-	case CompressionNone:
-		chunkData = parsedChunk.Records
-	case CompressionZSTD:
-		var err error
-		if it.zstdDecoder == nil {
-			it.zstdDecoder, err = zstd.NewReader(bytes.NewReader(parsedChunk.Records))
-		} else {
-			err = it.zstdDecoder.Reset(bytes.NewReader(parsedChunk.Records))
-		}
-		if err != nil {
-			return fmt.Errorf("failed to read zstd chunk: %w", err)
-		}
-		chunkData, err = io.ReadAll(it.zstdDecoder)
-		if err != nil {
-			return fmt.Errorf("failed to decompress zstd chunk: %w", err)
-		}
-	case CompressionLZ4:
-		if it.lz4Reader == nil {
-			it.lz4Reader = lz4.NewReader(bytes.NewReader(parsedChunk.Records))
-		} else {
-			it.lz4Reader.Reset(bytes.NewReader(parsedChunk.Records))
-		}
-		chunkData, err = io.ReadAll(it.lz4Reader)
-		if err != nil {
-			return fmt.Errorf("failed to decompress lz4 chunk: %w", err)
-		}
-	default:
-		return fmt.Errorf("unsupported compression %s", parsedChunk.Compression)
+	chunkData, err := it.decompressor.decompress(parsedChunk)
+	if err != nil {
+		return err
+	}
+	it.onChunk()
+	if chunkIndex.MessageIndexLength == 0 {
+		return it.scanChunk(chunkIndex, chunkData)
 	}
 	// use the message index to find the messages we want from the chunk
 	messageIndexSection := chunk[chunkIndex.ChunkLength:]
@@ -211,7 +250,63 @@ func (it *indexedMessageIterator) loadChunk(chunkIndex *ChunkIndex) error {
 	return nil
 }
 
+// scanChunk finds the messages we want from a chunk with no message index by
+// reading its records, registering any schemas and channels it defines.
+func (it *indexedMessageIterator) scanChunk(chunkIndex *ChunkIndex, chunkData []byte) error {
+	var offset uint64
+	for offset+9 <= uint64(len(chunkData)) {
+		op := OpCode(chunkData[offset])
+		recordLen := binary.LittleEndian.Uint64(chunkData[offset+1:])
+		if recordLen > uint64(len(chunkData))-offset-9 {
+			return fmt.Errorf("record at chunk offset %d exceeds chunk length", offset)
+		}
+		record := chunkData[offset+9 : offset+9+recordLen]
+		switch op {
+		case OpSchema:
+			schema, err := ParseSchema(record)
+			if err != nil {
+				return fmt.Errorf("failed to parse schema: %w", err)
+			}
+			if _, ok := it.schemas[schema.ID]; !ok {
+				it.schemas[schema.ID] = schema
+				it.onSchema(schema)
+			}
+		case OpChannel:
+			channelInfo, err := ParseChannel(record)
+			if err != nil {
+				return fmt.Errorf("failed to parse channel info: %w", err)
+			}
+			if _, ok := it.channels[channelInfo.ID]; !ok {
+				it.onChannel(channelInfo)
+				if len(it.topics) == 0 || it.topics[channelInfo.Topic] {
+					it.channels[channelInfo.ID] = channelInfo
+				}
+			}
+		case OpMessage:
+			if len(record) < 2+4+8 {
+				return fmt.Errorf("message record at chunk offset %d is too short", offset)
+			}
+			if _, ok := it.channels[binary.LittleEndian.Uint16(record)]; !ok {
+				break
+			}
+			timestamp := binary.LittleEndian.Uint64(record[2+4:])
+			if timestamp >= it.start && timestamp < it.end {
+				heap.Push(&it.indexHeap, rangeIndex{
+					chunkIndex:        chunkIndex,
+					messageIndexEntry: &MessageIndexEntry{Timestamp: timestamp, Offset: offset},
+					buf:               chunkData,
+				})
+			}
+		}
+		offset += 9 + recordLen
+	}
+	return nil
+}
+
 func (it *indexedMessageIterator) Next(p []byte) (*Schema, *Channel, *Message, error) {
+	if it.maxMessages > 0 && it.count >= it.maxMessages {
+		return nil, nil, nil, io.EOF
+	}
 	if it.statistics == nil {
 		err := it.parseSummarySection()
 		if err != nil {
@@ -219,6 +314,9 @@ func (it *indexedMessageIterator) Next(p []byte) (*Schema, *Channel, *Message, e
 		}
 	}
 	for it.indexHeap.Len() > 0 {
+		if !it.deadline.IsZero() && !time.Now().Before(it.deadline) {
+			return nil, nil, nil, ErrDeadlineExceeded
+		}
 		ri, err := it.indexHeap.HeapPop()
 		if err != nil {
 			return nil, nil, nil, err
@@ -239,6 +337,8 @@ func (it *indexedMessageIterator) Next(p []byte) (*Schema, *Channel, *Message, e
 		}
 		channel := it.channels[message.ChannelID]
 		schema := it.schemas[channel.SchemaID]
+		it.onMessage(schema, channel, message)
+		it.count++
 		return schema, channel, message, nil
 	}
 	return nil, nil, nil, io.EOF
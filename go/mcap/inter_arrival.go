@@ -0,0 +1,77 @@
+package mcap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/foxglove/mcap/go/mcap/readopts"
+)
+
+// ErrOutOfOrderMessage indicates that a message's log time precedes that of
+// the previous message on its channel.
+var ErrOutOfOrderMessage = errors.New("message log time precedes previous message on channel")
+
+// InterArrivalOptions are options for Reader.InterArrivalTimes.
+type InterArrivalOptions struct {
+	// SkipOutOfOrder causes messages whose log time precedes that of the
+	// previous message on the channel to be skipped, rather than ending the
+	// iteration with an error wrapping ErrOutOfOrderMessage. Later deltas are
+	// measured from the last message that was not skipped.
+	SkipOutOfOrder bool
+}
+
+// InterArrivalTimes returns an iterator over the differences in log time, in
+// nanoseconds, between consecutive messages on a channel, in the order the
+// messages appear in the file. The iterator has the signature of
+// iter.Seq2[uint64, error] and may be used as one; if reading fails, or a
+// message is out of order and SkipOutOfOrder is not set, it yields the error
+// and stops. The file is read with its index if the reader is seekable.
+func (r *Reader) InterArrivalTimes(channelID uint16, opts ...*InterArrivalOptions) func(yield func(uint64, error) bool) {
+	interArrivalOpts := InterArrivalOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		interArrivalOpts = *opts[0]
+	}
+	return func(yield func(uint64, error) bool) {
+		var readOpts []readopts.ReadOpt
+		if _, ok := r.r.(io.ReadSeeker); !ok {
+			readOpts = append(readOpts, readopts.UsingIndex(false))
+		}
+		it, err := r.Messages(readOpts...)
+		if err != nil {
+			yield(0, err)
+			return
+		}
+		var last uint64
+		seen := false
+		for {
+			_, channel, message, err := it.Next(nil)
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					yield(0, fmt.Errorf("failed to read record: %w", err))
+				}
+				return
+			}
+			if channel.ID != channelID {
+				continue
+			}
+			if !seen {
+				last = message.LogTime
+				seen = true
+				continue
+			}
+			if message.LogTime < last {
+				if interArrivalOpts.SkipOutOfOrder {
+					continue
+				}
+				yield(0, fmt.Errorf("%w: log time %d follows %d", ErrOutOfOrderMessage, message.LogTime, last))
+				return
+			}
+			delta := message.LogTime - last
+			last = message.LogTime
+			if !yield(delta, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package mcap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderInterArrivalTimes(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{Chunked: true, ChunkSize: 64, Compression: CompressionZSTD})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	for _, id := range []uint16{1, 2} {
+		_, err = w.WriteChannel(&Channel{ID: id, Topic: fmt.Sprintf("/topic%d", id), MessageEncoding: "raw"})
+		assert.Nil(t, err)
+	}
+	for _, m := range []struct {
+		channelID uint16
+		logTime   uint64
+	}{
+		{1, 100},
+		{2, 105},
+		{1, 110},
+		{1, 130},
+		{2, 90},
+		{1, 125},
+		{1, 160},
+	} {
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: m.channelID, LogTime: m.logTime}))
+	}
+	assert.Nil(t, w.Close())
+
+	readers := map[string]func() io.Reader{
+		"indexed":   func() io.Reader { return bytes.NewReader(buf.Bytes()) },
+		"unindexed": func() io.Reader { return bytes.NewBuffer(buf.Bytes()) },
+	}
+	collect := func(t *testing.T, r io.Reader, channelID uint16, opts ...*InterArrivalOptions) ([]uint64, error) {
+		reader, err := NewReader(r)
+		assert.Nil(t, err)
+		var deltas []uint64
+		var iterErr error
+		reader.InterArrivalTimes(channelID, opts...)(func(delta uint64, err error) bool {
+			if err != nil {
+				iterErr = err
+				return false
+			}
+			deltas = append(deltas, delta)
+			return true
+		})
+		return deltas, iterErr
+	}
+	for name, newReader := range readers {
+		t.Run(name, func(t *testing.T) {
+			t.Run("skips out of order messages", func(t *testing.T) {
+				deltas, err := collect(t, newReader(), 1, &InterArrivalOptions{SkipOutOfOrder: true})
+				assert.Nil(t, err)
+				assert.Equal(t, []uint64{10, 20, 30}, deltas)
+			})
+			t.Run("reports out of order messages", func(t *testing.T) {
+				deltas, err := collect(t, newReader(), 1)
+				assert.ErrorIs(t, err, ErrOutOfOrderMessage)
+				assert.Equal(t, []uint64{10, 20}, deltas)
+			})
+			t.Run("yields nothing when every later message is out of order", func(t *testing.T) {
+				_, err := collect(t, newReader(), 2)
+				assert.ErrorIs(t, err, ErrOutOfOrderMessage)
+				deltas, err := collect(t, newReader(), 2, &InterArrivalOptions{SkipOutOfOrder: true})
+				assert.Nil(t, err)
+				assert.Empty(t, deltas)
+			})
+			t.Run("stops when yield returns false", func(t *testing.T) {
+				reader, err := NewReader(newReader())
+				assert.Nil(t, err)
+				calls := 0
+				reader.InterArrivalTimes(1)(func(uint64, error) bool {
+					calls++
+					return false
+				})
+				assert.Equal(t, 1, calls)
+			})
+		})
+	}
+}
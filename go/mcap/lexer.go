@@ -1,13 +1,18 @@
 package mcap
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"hash/crc32"
 	"io"
+	"time"
 
+	"github.com/klauspost/compress/s2"
 	"github.com/klauspost/compress/zstd"
 	"github.com/pierrec/lz4/v4"
 )
@@ -17,6 +22,22 @@ var ErrNestedChunk = errors.New("detected nested chunk")
 var ErrChunkTooLarge = errors.New("chunk exceeds configured maximum size")
 var ErrRecordTooLarge = errors.New("record exceeds configured maximum size")
 
+// ErrDecompressionBudgetExceeded indicates that the chunks read by the lexer
+// decompress to more than the configured total.
+var ErrDecompressionBudgetExceeded = errors.New("decompressed chunks exceed configured total size")
+
+// ErrInvalidLZ4Checksum indicates that an LZ4-compressed chunk failed the
+// block or content checksum embedded in its LZ4 frame.
+var ErrInvalidLZ4Checksum = errors.New("invalid lz4 checksum")
+
+// ErrDeadlineExceeded indicates a read did not complete before the configured
+// deadline.
+var ErrDeadlineExceeded = errors.New("read deadline exceeded")
+
+// ErrInvalidChunkCRC indicates that a chunk's records do not match the
+// uncompressed CRC in its header. ChunkCRCMismatch reports the CRCs involved.
+var ErrInvalidChunkCRC = errors.New("invalid chunk CRC")
+
 type errInvalidChunkCrc struct {
 	expected uint32
 	actual   uint32
@@ -26,9 +47,63 @@ func (e *errInvalidChunkCrc) Error() string {
 	return fmt.Sprintf("invalid chunk CRC: %x != %x", e.actual, e.expected)
 }
 
+func (e *errInvalidChunkCrc) Is(target error) bool {
+	return target == ErrInvalidChunkCRC
+}
+
+// ChunkCRCMismatch reports whether err indicates that a chunk failed CRC
+// validation, and if so returns the CRC stored in the chunk's header and the
+// CRC computed over its records.
+func ChunkCRCMismatch(err error) (expected uint32, actual uint32, ok bool) {
+	var invalidCrc *errInvalidChunkCrc
+	if !errors.As(err, &invalidCrc) {
+		return 0, 0, false
+	}
+	return invalidCrc.expected, invalidCrc.actual, true
+}
+
+// ErrMissingChunkCRC indicates that a chunk has no uncompressed CRC, which is
+// an error only with LexerOptions.RequireChunkCRC.
+var ErrMissingChunkCRC = errors.New("chunk has no CRC")
+
+// ErrUnsupportedCompression indicates that a chunk is compressed with a format
+// the reader does not support. The error returned is an
+// *UnsupportedCompressionError carrying the format.
+var ErrUnsupportedCompression = errors.New("unsupported compression")
+
+// UnsupportedCompressionError is returned for chunks compressed with a format
+// the reader does not support. It matches ErrUnsupportedCompression.
+type UnsupportedCompressionError struct {
+	Compression CompressionFormat
+}
+
+func (e *UnsupportedCompressionError) Error() string {
+	return fmt.Sprintf("unsupported compression: %s", string(e.Compression))
+}
+
+func (e *UnsupportedCompressionError) Is(target error) bool {
+	return target == ErrUnsupportedCompression
+}
+
+// ErrTruncatedChunk indicates that a chunk ends before its header or its
+// records are complete.
+var ErrTruncatedChunk = errors.New("truncated chunk")
+
+// ErrInvalidRecordsLength indicates that the records length in a chunk's
+// header disagrees with the length of the chunk record.
+var ErrInvalidRecordsLength = errors.New("chunk records length does not match record length")
+
+// ErrCompressionMismatch indicates that a chunk's data is compressed with a
+// format other than the one its header declares.
+var ErrCompressionMismatch = errors.New("chunk compression does not match its data")
+
 // ErrBadMagic indicates the lexer has detected invalid magic bytes.
 var ErrBadMagic = errors.New("not an MCAP file")
 
+// ErrMissingTrailingMagic indicates that the footer record is not followed by
+// exactly the magic bytes and the end of the input.
+var ErrMissingTrailingMagic = errors.New("footer is not followed by trailing magic")
+
 const (
 	// TokenHeader represents a header token.
 	TokenHeader TokenType = iota
@@ -64,6 +139,10 @@ const (
 	TokenError
 	// TokenInvalidChunk represents a chunk token that failed CRC validation.
 	TokenInvalidChunk
+	// TokenUnknown represents a record with an unrecognized opcode, returned
+	// if LexerOptions.EmitUnknownRecords is set. Its opcode is available from
+	// Lexer.LastOpcode.
+	TokenUnknown
 )
 
 // TokenType encodes a type of token from the lexer.
@@ -104,6 +183,8 @@ func (t TokenType) String() string {
 		return "error"
 	case TokenInvalidChunk:
 		return "invalid chunk"
+	case TokenUnknown:
+		return "unknown record"
 	default:
 		return "unknown"
 	}
@@ -122,9 +203,78 @@ type Lexer struct {
 	buf                      []byte
 	uncompressedChunk        []byte
 	validateCRC              bool
+	requireChunkCRC          bool
+	strictParsing            bool
 	emitInvalidChunks        bool
 	maxRecordSize            int
 	maxDecompressedChunkSize int
+	// maxTotalDecompressedBytes bounds decompressedBytes, the sum of the
+	// uncompressed sizes of the chunks loaded so far.
+	maxTotalDecompressedBytes int
+	decompressedBytes         uint64
+	retainChunkBuffers        bool
+	validateTrailingMagic     bool
+	chunkBuffer               []byte
+	maxChunkBufferSize        int
+	deadline                  time.Time
+	onChunkCRC                func(offset uint64, stored uint32, computed uint32, validated bool)
+	onDecompressedChunk       func(data []byte)
+	decompressors             map[string]func(io.Reader) (io.Reader, error)
+	onChunkBoundary           func(info ChunkInfo)
+	streamingCRC              bool
+	// chunkCRC checksums the records of the current chunk, if CRCs are
+	// validated as they are read.
+	chunkCRC crcReader
+	// chunkRecords reads the compressed records of the current chunk from
+	// the input.
+	chunkRecords *io.LimitedReader
+	// readAhead reads and decompresses chunks ahead of the lexer, if
+	// ReadAheadChunks is set.
+	readAhead *readAheadReader
+	// zstdDictionary is the dictionary zstd chunks are decompressed with.
+	zstdDictionary []byte
+	// deadlineReader is the input the deadline was set on, if it supports
+	// SetReadDeadline. Its deadline is cleared by Close and Reset.
+	deadlineReader interface{ SetReadDeadline(time.Time) error }
+	// outerZSTD decompresses the input, if DetectOuterCompression found it
+	// to be a zstd stream. It is closed by Close and Reset.
+	outerZSTD *zstd.Decoder
+	// unreadRecord reads the remainder of a record streamed by
+	// AttachmentReader, which is discarded before the next record is read.
+	unreadRecord *io.LimitedReader
+	// counter counts the bytes read from the base reader.
+	counter *countingReader
+	// chunkOffset is the offset of the current chunk in the input, and
+	// chunkPosition the number of decompressed bytes consumed from it.
+	chunkOffset   uint64
+	chunkPosition uint64
+	// lastInChunk, lastChunkOffset and lastRecordOffset describe the location
+	// of the record most recently returned by Next.
+	lastInChunk      bool
+	lastChunkOffset  uint64
+	lastRecordOffset uint64
+	lastOpcode       OpCode
+	// peeked holds the prefix of the next record, if hasPeeked is set.
+	peeked    recordPrefix
+	hasPeeked bool
+	// err is the error that ended iteration with All, if any.
+	err error
+	// skipTokens is a bit set of the token types to skip.
+	skipTokens         uint32
+	emitUnknownRecords bool
+	// validateCompression and autoDetectCompression control the checking of
+	// chunk compression against compressionPrefix, the first bytes of the
+	// chunk data.
+	validateCompression   bool
+	autoDetectCompression bool
+	compressionPrefix     [4]byte
+
+	// onChunk is called when the lexer begins de-chunking a chunk.
+	onChunk func()
+	// onUnrecognized, if set, is called with the opcode and length of each
+	// record with an unrecognized opcode, and returns the writer its body is
+	// copied to in place of being discarded.
+	onUnrecognized func(opcode OpCode, recordLen uint64) (io.Writer, error)
 }
 
 // Next returns the next token from the lexer as a byte array. The result will
@@ -132,96 +282,553 @@ type Lexer struct {
 // not have adequate space, a new buffer with sufficient size is allocated for
 // the result.
 func (l *Lexer) Next(p []byte) (TokenType, []byte, error) {
+	if !l.hasPeeked {
+		if tokenType, err := l.readPrefix(); err != nil {
+			return tokenType, nil, err
+		}
+	}
+	prefix := l.peeked
+	l.hasPeeked = false
+	if l.pastDeadline() {
+		return TokenError, nil, ErrDeadlineExceeded
+	}
+	var record []byte
+	var err error
+	if prefix.inChunk && l.retainChunkBuffers {
+		record, err = l.nextChunkRecord(prefix.recordLen)
+	} else if len(prefix.chunkHeader) > 0 {
+		// the chunk header has been consumed by PeekChunkHeader.
+		r := io.MultiReader(bytes.NewReader(prefix.chunkHeader), l.reader)
+		record, err = readRecord(r, p, prefix.recordLen, prefix.opcode)
+	} else {
+		record, err = readRecord(l.reader, p, prefix.recordLen, prefix.opcode)
+	}
+	if err != nil {
+		if l.pastDeadline() {
+			return TokenError, nil, ErrDeadlineExceeded
+		}
+		return TokenError, nil, lz4ChecksumError(err)
+	}
+	l.lastInChunk = prefix.inChunk
+	l.lastChunkOffset = l.chunkOffset
+	l.lastRecordOffset = prefix.recordOffset
+	l.lastOpcode = prefix.opcode
+	if l.strictParsing {
+		if err := checkRecordLength(prefix.opcode, record); err != nil {
+			return TokenError, nil, err
+		}
+	}
+	if prefix.opcode == OpFooter && l.validateTrailingMagic && !l.inChunk {
+		if err := l.readTrailingMagic(); err != nil {
+			return TokenError, nil, err
+		}
+	}
+	return prefix.tokenType, record, nil
+}
+
+// All returns an iterator over the lexer's tokens, reading them with Next
+// into buf. The iterator has the signature of iter.Seq2[TokenType, []byte] and
+// may be used as one. Each token's data is valid only until the iterator
+// proceeds, as with Next. Iteration stops at the end of the input or at the
+// first error, including CRC mismatches reported with TokenInvalidChunk; the
+// error is then available from Err.
+func (l *Lexer) All(buf []byte) func(yield func(TokenType, []byte) bool) {
+	return func(yield func(TokenType, []byte) bool) {
+		for {
+			tokenType, data, err := l.Next(buf)
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					l.err = err
+				}
+				return
+			}
+			// records sliced from retained chunk buffers must not be
+			// overwritten, so only buffers allocated by Next are reused.
+			if len(data) > len(buf) && !(l.lastInChunk && l.retainChunkBuffers) {
+				buf = data
+			}
+			if !yield(tokenType, data) {
+				return
+			}
+		}
+	}
+}
+
+// Err returns the error that ended iteration with All, or nil if the end of
+// the input was reached or iteration was stopped by the caller.
+func (l *Lexer) Err() error {
+	return l.err
+}
+
+// Close stops the goroutines reading and decompressing chunks ahead of the
+// lexer with ReadAheadChunks, and waits for them to exit. It also releases the
+// decoder of an input found to be zstd compressed with DetectOuterCompression,
+// and clears the read deadline set on the input for LexerOptions.Deadline.
+// The lexer must not be used after Close until it is reset. Close has no
+// effect on lexers that do none of these, and is safe to call more than once.
+func (l *Lexer) Close() {
+	if l.readAhead != nil {
+		l.readAhead.close()
+	}
+	if l.deadlineReader != nil {
+		_ = l.deadlineReader.SetReadDeadline(time.Time{})
+		l.deadlineReader = nil
+	}
+	if l.outerZSTD != nil {
+		l.outerZSTD.Close()
+		l.outerZSTD = nil
+	}
+}
+
+// Peek returns the type of the next token without consuming it. The opcode
+// and length of the record are read and retained, and the following call to
+// Next returns the record. Like Next, Peek de-chunks chunks and skips records
+// with unrecognized opcodes, so it may read past the end of a chunk or load
+// the next one. Successive calls to Peek return the same token type.
+func (l *Lexer) Peek() (TokenType, error) {
+	if l.hasPeeked {
+		return l.peeked.tokenType, nil
+	}
+	return l.readPrefix()
+}
+
+// PeekChunkHeader returns the fields of the next record, which must be a
+// chunk, other than its records, without consuming the record. It is
+// available when the lexer emits chunks rather than de-chunking them. Only the
+// chunk's header is read, so that a following call to SkipRecord passes over
+// the compressed records without decompressing or buffering them; this allows
+// a coarse time index of a file to be built in a single pass over a
+// non-seekable stream. A following call to Next returns the whole chunk record
+// as usual.
+func (l *Lexer) PeekChunkHeader() (*Chunk, error) {
+	tokenType, err := l.Peek()
+	if err != nil {
+		return nil, err
+	}
+	if tokenType != TokenChunk {
+		return nil, fmt.Errorf("next record is %s, not chunk", tokenType)
+	}
+	prefix := &l.peeked
+	if len(prefix.chunkHeader) == 0 {
+		// start, end, uncompressed size, uncompressed crc, compression
+		// length.
+		headerLen := uint64(8 + 8 + 8 + 4 + 4)
+		if prefix.recordLen < headerLen {
+			return nil, io.ErrUnexpectedEOF
+		}
+		header := make([]byte, headerLen, headerLen+16)
+		if _, err := io.ReadFull(l.reader, header); err != nil {
+			return nil, l.peekError(err)
+		}
+		compressionLen := uint64(binary.LittleEndian.Uint32(header[28:]))
+		if compressionLen+8 > prefix.recordLen-headerLen {
+			return nil, l.peekError(io.ErrUnexpectedEOF)
+		}
+		header = append(header, make([]byte, compressionLen+8)...)
+		if _, err := io.ReadFull(l.reader, header[headerLen:]); err != nil {
+			return nil, l.peekError(err)
+		}
+		prefix.chunkHeader = header
+	}
+	header := prefix.chunkHeader
+	compressionLen := binary.LittleEndian.Uint32(header[28:])
+	return &Chunk{
+		MessageStartTime: binary.LittleEndian.Uint64(header),
+		MessageEndTime:   binary.LittleEndian.Uint64(header[8:]),
+		UncompressedSize: binary.LittleEndian.Uint64(header[16:]),
+		UncompressedCRC:  binary.LittleEndian.Uint32(header[24:]),
+		Compression:      string(header[32 : 32+compressionLen]),
+	}, nil
+}
+
+// peekError discards the peeked record after a failure to read part of it,
+// since the lexer's position within it is unknown.
+func (l *Lexer) peekError(err error) error {
+	l.hasPeeked = false
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// discardedRecordError returns the error for a record body that could not be
+// read in full while it was being discarded, reporting the input ending
+// within the record as io.ErrUnexpectedEOF rather than as the end of the file.
+func discardedRecordError(inChunk bool, err error) error {
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	if inChunk {
+		return truncatedChunkError("read record", lz4ChecksumError(err))
+	}
+	return lz4ChecksumError(err)
+}
+
+// SkipRecord consumes the next record without returning it, and returns its
+// token type. The record's body is discarded as it is read, rather than being
+// buffered.
+func (l *Lexer) SkipRecord() (TokenType, error) {
+	if !l.hasPeeked {
+		if tokenType, err := l.readPrefix(); err != nil {
+			return tokenType, err
+		}
+	}
+	prefix := l.peeked
+	l.hasPeeked = false
+	remaining := prefix.recordLen - uint64(len(prefix.chunkHeader))
+	if _, err := io.CopyN(io.Discard, l.reader, int64(remaining)); err != nil {
+		if errors.Is(err, io.EOF) {
+			return TokenError, io.ErrUnexpectedEOF
+		}
+		return TokenError, lz4ChecksumError(err)
+	}
+	l.lastInChunk = prefix.inChunk
+	l.lastChunkOffset = l.chunkOffset
+	l.lastRecordOffset = prefix.recordOffset
+	l.lastOpcode = prefix.opcode
+	if prefix.opcode == OpFooter && l.validateTrailingMagic && !l.inChunk {
+		if err := l.readTrailingMagic(); err != nil {
+			return TokenError, err
+		}
+	}
+	return prefix.tokenType, nil
+}
+
+// recordPrefix is the opcode and length of a record read by Peek, along with
+// its location.
+type recordPrefix struct {
+	opcode       OpCode
+	tokenType    TokenType
+	recordLen    uint64
+	inChunk      bool
+	recordOffset uint64
+	// chunkHeader holds the bytes of the record consumed by PeekChunkHeader.
+	chunkHeader []byte
+}
+
+// readPrefix reads records until it finds one that Next returns, de-chunking
+// chunks and discarding records with unrecognized opcodes, and stashes the
+// prefix of that record in l.peeked, leaving the reader at its body. It
+// returns the record's token type, or the token type and error that Next
+// should return.
+func (l *Lexer) readPrefix() (TokenType, error) {
+	if l.unreadRecord != nil {
+		_, err := io.Copy(io.Discard, l.unreadRecord)
+		if err == nil && l.unreadRecord.N > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		l.unreadRecord = nil
+		if err != nil {
+			return TokenError, lz4ChecksumError(err)
+		}
+	}
 	for {
+		if l.pastDeadline() {
+			return TokenError, ErrDeadlineExceeded
+		}
 		_, err := io.ReadFull(l.reader, l.buf[:9])
 		if err != nil {
+			if l.pastDeadline() {
+				return TokenError, ErrDeadlineExceeded
+			}
+			err = lz4ChecksumError(err)
 			unexpectedEOF := errors.Is(err, io.ErrUnexpectedEOF)
 			eof := errors.Is(err, io.EOF)
 			if l.inChunk && (eof || unexpectedEOF) {
 				l.inChunk = false
 				l.reader = l.basereader
+				l.releaseChunkBuffer()
+				if err := l.discardChunkRecords(); err != nil {
+					return TokenError, err
+				}
+				if l.chunkCRC.pending {
+					if err := l.chunkCRC.validate(); err != nil {
+						if l.emitInvalidChunks {
+							return TokenInvalidChunk, err
+						}
+						return TokenError, err
+					}
+				}
 				continue
 			}
 			if unexpectedEOF || eof {
-				return TokenError, nil, io.EOF
+				return TokenError, io.EOF
 			}
-			return TokenError, nil, err
+			return TokenError, err
 		}
 		opcode := OpCode(l.buf[0])
 		recordLen := binary.LittleEndian.Uint64(l.buf[1:9])
+		inChunk := l.inChunk
+		recordOffset := l.chunkPosition
+		if inChunk {
+			l.chunkPosition += 9 + recordLen
+		}
+		if l.skipTokens != 0 && opcode != OpReserved && opcode <= OpDataEnd &&
+			l.skipTokens&(1<<opcodeTokenType(opcode)) != 0 {
+			// chunks that are skipped are not de-chunked.
+			if _, err := io.CopyN(io.Discard, l.reader, int64(recordLen)); err != nil {
+				return TokenError, discardedRecordError(inChunk, err)
+			}
+			if opcode == OpFooter && l.validateTrailingMagic && !inChunk {
+				if err := l.readTrailingMagic(); err != nil {
+					return TokenError, err
+				}
+			}
+			continue
+		}
 		if l.maxRecordSize > 0 && recordLen > uint64(l.maxRecordSize) {
-			return TokenError, nil, ErrRecordTooLarge
+			return TokenError, ErrRecordTooLarge
 		}
 		if opcode == OpChunk && !l.emitChunks {
-			err := loadChunk(l)
+			err := loadChunk(l, recordLen)
 			if err != nil {
 				if l.emitInvalidChunks {
 					var invalidCrc *errInvalidChunkCrc
 					if errors.As(err, &invalidCrc) {
-						return TokenInvalidChunk, nil, err
+						return TokenInvalidChunk, err
 					}
 				}
-				return TokenError, nil, err
+				return TokenError, err
 			}
 			continue
 		}
-
-		if recordLen > uint64(len(p)) {
-			p, err = makeSafe(recordLen)
+		// Padding and other records with unrecognized opcodes are discarded
+		// without buffering them, unless they are emitted.
+		if opcode > OpDataEnd && l.emitUnknownRecords {
+			l.hasPeeked = true
+			l.peeked = recordPrefix{
+				opcode:       opcode,
+				tokenType:    TokenUnknown,
+				recordLen:    recordLen,
+				inChunk:      inChunk,
+				recordOffset: recordOffset,
+			}
+			return TokenUnknown, nil
+		}
+		if opcode > OpDataEnd {
+			var dst io.Writer = io.Discard
+			if l.onUnrecognized != nil {
+				if dst, err = l.onUnrecognized(opcode, recordLen); err != nil {
+					return TokenError, err
+				}
+			}
+			_, err := io.CopyN(dst, l.reader, int64(recordLen))
 			if err != nil {
-				return TokenError, nil, fmt.Errorf("failed to allocate %d bytes for %s token: %w", recordLen, opcode, err)
+				return TokenError, discardedRecordError(inChunk, err)
 			}
+			continue
 		}
+		if opcode == OpReserved {
+			return TokenError, fmt.Errorf("invalid zero opcode")
+		}
+		l.hasPeeked = true
+		l.peeked = recordPrefix{
+			opcode:       opcode,
+			tokenType:    opcodeTokenType(opcode),
+			recordLen:    recordLen,
+			inChunk:      inChunk,
+			recordOffset: recordOffset,
+		}
+		return l.peeked.tokenType, nil
+	}
+}
 
-		record := p[:recordLen]
-		_, err = io.ReadFull(l.reader, record)
+// opcodeTokenType returns the token type of records with a recognized opcode.
+func opcodeTokenType(opcode OpCode) TokenType {
+	switch opcode {
+	case OpMessage:
+		return TokenMessage
+	case OpHeader:
+		return TokenHeader
+	case OpSchema:
+		return TokenSchema
+	case OpDataEnd:
+		return TokenDataEnd
+	case OpChannel:
+		return TokenChannel
+	case OpFooter:
+		return TokenFooter
+	case OpAttachment:
+		return TokenAttachment
+	case OpAttachmentIndex:
+		return TokenAttachmentIndex
+	case OpChunkIndex:
+		return TokenChunkIndex
+	case OpStatistics:
+		return TokenStatistics
+	case OpMessageIndex:
+		return TokenMessageIndex
+	case OpChunk:
+		return TokenChunk
+	case OpMetadata:
+		return TokenMetadata
+	case OpMetadataIndex:
+		return TokenMetadataIndex
+	case OpSummaryOffset:
+		return TokenSummaryOffset
+	default:
+		return TokenError
+	}
+}
+
+// Record is a token emitted by Lexer.Stream. Its Data is owned by the
+// receiver and remains valid after later records are read.
+type Record struct {
+	TokenType TokenType
+	Data      []byte
+}
+
+// Stream reads tokens from the lexer and sends them to out until the end of
+// the input, applying backpressure by blocking while out is full. Each record
+// carries a copy of its token's bytes. Stream closes out when it returns. It
+// returns nil at the end of the input, the context's error if ctx is canceled,
+// and otherwise the error that stopped the lexer.
+func (l *Lexer) Stream(ctx context.Context, out chan<- Record) error {
+	defer close(out)
+	var buf []byte
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		tokenType, data, err := l.Next(buf)
 		if err != nil {
-			return TokenError, nil, err
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
 		}
+		if len(data) > len(buf) {
+			buf = data
+		}
+		record := Record{TokenType: tokenType, Data: append([]byte{}, data...)}
+		select {
+		case out <- record:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
 
-		switch opcode {
-		case OpMessage:
-			return TokenMessage, record, nil
-		case OpHeader:
-			return TokenHeader, record, nil
-		case OpSchema:
-			return TokenSchema, record, nil
-		case OpDataEnd:
-			return TokenDataEnd, record, nil
-		case OpChannel:
-			return TokenChannel, record, nil
-		case OpFooter:
-			return TokenFooter, record, nil
-		case OpAttachment:
-			return TokenAttachment, record, nil
-		case OpAttachmentIndex:
-			return TokenAttachmentIndex, record, nil
-		case OpChunkIndex:
-			return TokenChunkIndex, record, nil
-		case OpStatistics:
-			return TokenStatistics, record, nil
-		case OpMessageIndex:
-			return TokenMessageIndex, record, nil
-		case OpChunk:
-			return TokenChunk, record, nil
-		case OpMetadata:
-			return TokenMetadata, record, nil
-		case OpMetadataIndex:
-			return TokenMetadataIndex, record, nil
-		case OpSummaryOffset:
-			return TokenSummaryOffset, record, nil
-		case OpReserved:
-			return TokenError, nil, fmt.Errorf("invalid zero opcode")
-		default:
-			continue // skip unrecognized opcodes
+// lz4ChecksumError converts checksum failures reported by the lz4 reader into
+// errors wrapping ErrInvalidLZ4Checksum, and returns other errors unchanged.
+func lz4ChecksumError(err error) error {
+	if errors.Is(err, lz4.ErrInvalidFrameChecksum) || errors.Is(err, lz4.ErrInvalidBlockChecksum) {
+		return fmt.Errorf("%w: %s", ErrInvalidLZ4Checksum, err)
+	}
+	return err
+}
+
+// ChunkOffsets reports the location of the record most recently returned by
+// Next. If the record was read from within a chunk, inChunk is true and
+// recordOffset is the offset of the record from the start of the chunk's
+// decompressed records, as recorded in message index records. chunkOffset is
+// then the offset of the chunk in the input. Offsets in the input include the
+// leading magic, unless SkipMagic is set.
+func (l *Lexer) ChunkOffsets() (chunkOffset uint64, recordOffset uint64, inChunk bool) {
+	if !l.lastInChunk {
+		return 0, 0, false
+	}
+	return l.lastChunkOffset, l.lastRecordOffset, true
+}
+
+// LastOpcode returns the opcode of the record most recently returned by Next
+// or consumed by SkipRecord. It identifies records returned as TokenUnknown.
+func (l *Lexer) LastOpcode() OpCode {
+	return l.lastOpcode
+}
+
+// Offset returns the offset in the input of the next record the lexer will
+// read, including the leading magic unless SkipMagic is set. While the lexer
+// is de-chunking a chunk, it returns the offset of the chunk record instead,
+// and InChunkOffset reports the position within the chunk; the lexer leaves
+// the chunk once it reads past the chunk's last record. Offsets may be
+// compared with those of chunk index entries, or used to locate corruption
+// reported by Next.
+func (l *Lexer) Offset() int64 {
+	if l.inChunk {
+		return int64(l.chunkOffset)
+	}
+	offset := l.counter.n
+	if l.hasPeeked && !l.peeked.inChunk {
+		offset -= 9 + uint64(len(l.peeked.chunkHeader))
+	}
+	return int64(offset)
+}
+
+// InChunkOffset reports whether the lexer is de-chunking a chunk, and if so
+// the offset of the next record within the chunk's decompressed records, as
+// recorded in message index records.
+func (l *Lexer) InChunkOffset() (int64, bool) {
+	if !l.inChunk {
+		return 0, false
+	}
+	if l.hasPeeked && l.peeked.inChunk {
+		return int64(l.peeked.recordOffset), true
+	}
+	return int64(l.chunkPosition), true
+}
+
+// readTrailingMagic reads the input following the footer record and checks
+// that it consists of exactly the magic bytes.
+func (l *Lexer) readTrailingMagic() error {
+	buf := make([]byte, len(Magic)+1)
+	n, err := io.ReadFull(l.reader, buf)
+	switch {
+	case err == nil:
+		return fmt.Errorf("%w: unexpected data after trailing magic", ErrMissingTrailingMagic)
+	case !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF):
+		return err
+	case n != len(Magic) || !bytes.Equal(buf[:n], Magic):
+		return ErrMissingTrailingMagic
+	}
+	return nil
+}
+
+// pastDeadline reports whether the lexer's deadline, if any, has passed.
+func (l *Lexer) pastDeadline() bool {
+	return !l.deadline.IsZero() && !time.Now().Before(l.deadline)
+}
+
+// readRecord reads a record body of length recordLen from r, slicing it out of
+// p if p has adequate space.
+func readRecord(r io.Reader, p []byte, recordLen uint64, opcode OpCode) ([]byte, error) {
+	if recordLen > uint64(len(p)) {
+		var err error
+		p, err = makeSafe(recordLen)
+		if err != nil {
+			return nil, fmt.Errorf("failed to allocate %d bytes for %s token: %w", recordLen, opcode, err)
 		}
 	}
+	record := p[:recordLen]
+	_, err := io.ReadFull(r, record)
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// nextChunkRecord returns the next record body of the current chunk as a slice
+// of the retained chunk buffer.
+func (l *Lexer) nextChunkRecord(recordLen uint64) ([]byte, error) {
+	start := len(l.chunkBuffer) - l.decoders.none.Len()
+	if recordLen > uint64(l.decoders.none.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	end := start + int(recordLen)
+	if _, err := l.decoders.none.Seek(int64(recordLen), io.SeekCurrent); err != nil {
+		return nil, err
+	}
+	return l.chunkBuffer[start:end], nil
 }
 
 type decoders struct {
-	zstd *zstd.Decoder
-	lz4  *lz4.Reader
-	none *bytes.Reader
+	zstd   *zstd.Decoder
+	lz4    *lz4.Reader
+	snappy *s2.Reader
+	none   *bytes.Reader
+	// custom holds the registered decompressors that may be reset, by
+	// compression format.
+	custom map[CompressionFormat]io.Reader
 }
 
 func validateMagic(r io.Reader) error {
@@ -235,6 +842,126 @@ func validateMagic(r io.Reader) error {
 	return nil
 }
 
+// Magic numbers identifying compressed streams, sniffed by
+// LexerOptions.DetectOuterCompression.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	lz4Magic  = []byte{0x04, 0x22, 0x4d, 0x18}
+)
+
+// decompressOuterStream returns a reader of the decompressed input if it
+// begins with a gzip, zstd or lz4 frame magic number, or of the input as is
+// otherwise.
+func decompressOuterStream(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	prefix, err := br.Peek(len(zstdMagic))
+	if err != nil {
+		// short or unreadable inputs fail the magic check that follows.
+		return br, nil
+	}
+	switch {
+	case bytes.HasPrefix(prefix, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip stream: %w", err)
+		}
+		return gz, nil
+	case bytes.Equal(prefix, zstdMagic):
+		decoder, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zstd stream: %w", err)
+		}
+		return decoder, nil
+	case bytes.Equal(prefix, lz4Magic):
+		return lz4.NewReader(br), nil
+	}
+	return br, nil
+}
+
+// snappyMagic begins the stream identifier of the snappy framing format.
+var snappyMagic = []byte{0xff, 0x06, 0x00, 0x00}
+
+// lz4LegacyMagic begins an lz4 frame in the legacy frame format.
+var lz4LegacyMagic = []byte{0x02, 0x21, 0x4c, 0x18}
+
+func isStandardCompression(compression CompressionFormat) bool {
+	switch compression {
+	case CompressionNone, CompressionZSTD, CompressionLZ4, CompressionSnappy:
+		return true
+	}
+	return false
+}
+
+// sniffCompression returns the compression format that data beginning with
+// prefix is in, if it can be told: compressed data begins with the magic
+// number of its format, and uncompressed records with an opcode.
+func sniffCompression(prefix []byte) (CompressionFormat, bool) {
+	switch {
+	case bytes.Equal(prefix, zstdMagic):
+		return CompressionZSTD, true
+	case bytes.Equal(prefix, lz4Magic), bytes.Equal(prefix, lz4LegacyMagic):
+		return CompressionLZ4, true
+	case bytes.Equal(prefix, snappyMagic):
+		return CompressionSnappy, true
+	case len(prefix) > 0 && prefix[0] >= byte(OpHeader) && prefix[0] <= byte(OpDataEnd):
+		return CompressionNone, true
+	}
+	return "", false
+}
+
+// checkCompression reads the first bytes of the chunk data from r and checks
+// that they agree with the declared compression, returning a reader of the
+// whole chunk data and the compression to decompress it with.
+func (l *Lexer) checkCompression(r io.Reader, declared CompressionFormat) (io.Reader, CompressionFormat, error) {
+	n, err := io.ReadFull(r, l.compressionPrefix[:])
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, "", truncatedChunkError("read chunk data", err)
+	}
+	r = io.MultiReader(bytes.NewReader(l.compressionPrefix[:n]), r)
+	if n < len(l.compressionPrefix) {
+		// too short to tell; the decoder reports malformed data.
+		return r, declared, nil
+	}
+	detected, ok := sniffCompression(l.compressionPrefix[:])
+	if !ok || detected == declared {
+		return r, declared, nil
+	}
+	if l.autoDetectCompression {
+		return r, detected, nil
+	}
+	return nil, "", fmt.Errorf("%w: chunk declares %s but data is %s", ErrCompressionMismatch,
+		compressionName(declared), compressionName(detected))
+}
+
+// compressionName returns the name of a compression format for display.
+func compressionName(compression CompressionFormat) string {
+	if compression == CompressionNone {
+		return "uncompressed"
+	}
+	return compression.String()
+}
+
+// ValidateTrailingMagic checks that an input of the given size ends with the
+// trailing magic bytes, returning ErrMissingTrailingMagic if it does not. A
+// file truncated mid-write lacks them, so checking before lexing the file
+// distinguishes truncation from a clean end of input up front. Inputs too
+// short to hold the leading magic, a footer and the trailing magic are
+// reported as missing it.
+func ValidateTrailingMagic(r io.ReaderAt, size int64) error {
+	if size < int64(len(Magic)+footerLength+len(Magic)) {
+		return ErrMissingTrailingMagic
+	}
+	magic := make([]byte, len(Magic))
+	if _, err := r.ReadAt(magic, size-int64(len(Magic))); err != nil {
+		return fmt.Errorf("failed to read trailing magic: %w", err)
+	}
+	if !bytes.Equal(magic, Magic) {
+		return ErrMissingTrailingMagic
+	}
+	return nil
+}
+
 func (l *Lexer) setNoneDecoder(buf []byte) {
 	if l.decoders.none == nil {
 		l.decoders.none = bytes.NewReader(buf)
@@ -244,9 +971,29 @@ func (l *Lexer) setNoneDecoder(buf []byte) {
 	l.reader = l.decoders.none
 }
 
+// setZSTDDictionary sets the dictionary zstd chunks are decompressed with,
+// discarding the zstd decoder if it was created with another.
+func (l *Lexer) setZSTDDictionary(dict []byte) {
+	if sameBytes(l.zstdDictionary, dict) {
+		return
+	}
+	if l.decoders.zstd != nil {
+		l.decoders.zstd.Close()
+		l.decoders.zstd = nil
+	}
+	l.zstdDictionary = dict
+}
+
+// setDecompressors sets the registered decompressors, discarding any
+// registered decompressors kept for reuse.
+func (l *Lexer) setDecompressors(decompressors map[string]func(io.Reader) (io.Reader, error)) {
+	l.decompressors = decompressors
+	l.decoders.custom = nil
+}
+
 func (l *Lexer) setZSTDDecoder(r io.Reader) error {
 	if l.decoders.zstd == nil {
-		decoder, err := zstd.NewReader(r)
+		decoder, err := newZSTDDecoder(r, l.zstdDictionary)
 		if err != nil {
 			return err
 		}
@@ -261,6 +1008,9 @@ func (l *Lexer) setZSTDDecoder(r io.Reader) error {
 	return nil
 }
 
+// setLZ4Decoder sets an lz4 frame decoder for r. The decoder recognizes both
+// the standard frame format and the legacy frame format written by older
+// encoders from the frame's magic number.
 func (l *Lexer) setLZ4Decoder(r io.Reader) {
 	if l.decoders.lz4 == nil {
 		l.decoders.lz4 = lz4.NewReader(r)
@@ -270,19 +1020,100 @@ func (l *Lexer) setLZ4Decoder(r io.Reader) {
 	l.reader = l.decoders.lz4
 }
 
-func loadChunk(l *Lexer) error {
+func (l *Lexer) setSnappyDecoder(r io.Reader) {
+	if l.decoders.snappy == nil {
+		l.decoders.snappy = s2.NewReader(r)
+	} else {
+		l.decoders.snappy.Reset(r)
+	}
+	l.reader = l.decoders.snappy
+}
+
+// resettableDecompressor is implemented by registered decompressors that
+// may be reused across chunks.
+type resettableDecompressor interface {
+	io.Reader
+	Reset(r io.Reader) error
+}
+
+func (l *Lexer) setCustomDecoder(compression CompressionFormat, r io.Reader) error {
+	if decoder, ok := l.decoders.custom[compression]; ok {
+		err := decoder.(resettableDecompressor).Reset(r)
+		if err != nil {
+			return fmt.Errorf("failed to reset %s decompressor: %w", compression, err)
+		}
+		l.reader = decoder
+		return nil
+	}
+	newDecoder, ok := l.decompressors[string(compression)]
+	if !ok {
+		return &UnsupportedCompressionError{Compression: compression}
+	}
+	decoder, err := newDecoder(r)
+	if err != nil {
+		return fmt.Errorf("failed to create %s decompressor: %w", compression, err)
+	}
+	if _, ok := decoder.(resettableDecompressor); ok {
+		if l.decoders.custom == nil {
+			l.decoders.custom = make(map[CompressionFormat]io.Reader)
+		}
+		l.decoders.custom[compression] = decoder
+	}
+	l.reader = decoder
+	return nil
+}
+
+// errTruncatedChunk is returned when the input ends within a chunk. It matches
+// ErrTruncatedChunk as well as the underlying read error.
+type errTruncatedChunk struct {
+	context string
+	err     error
+}
+
+func (e *errTruncatedChunk) Error() string {
+	return fmt.Sprintf("truncated chunk: failed to %s: %s", e.context, e.err)
+}
+
+func (e *errTruncatedChunk) Unwrap() error {
+	return e.err
+}
+
+func (e *errTruncatedChunk) Is(target error) bool {
+	return target == ErrTruncatedChunk
+}
+
+// truncatedChunkError wraps an error reading part of a chunk, reporting
+// premature ends of the input as ErrTruncatedChunk.
+func truncatedChunkError(context string, err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &errTruncatedChunk{context: context, err: err}
+	}
+	return fmt.Errorf("failed to %s: %w", context, err)
+}
+
+func loadChunk(l *Lexer, recordLen uint64) error {
 	if l.inChunk {
 		return ErrNestedChunk
 	}
+	// the opcode and length of the chunk have been read.
+	chunkOffset := l.counter.n - 9
+	l.chunkOffset = chunkOffset
+	l.chunkPosition = 0
+	// start, end, uncompressed size, uncompressed crc, compression length,
+	// and records length.
+	const fixedHeaderLen = 8 + 8 + 8 + 4 + 4 + 8
+	if recordLen < fixedHeaderLen {
+		return fmt.Errorf("%w: record length %d is shorter than chunk header", ErrTruncatedChunk, recordLen)
+	}
 	_, err := io.ReadFull(l.reader, l.buf[:8+8+8+4+4])
 	if err != nil {
-		return err
+		return truncatedChunkError("read chunk header", err)
 	}
-	_, offset, err := getUint64(l.buf, 0) // start
+	start, offset, err := getUint64(l.buf, 0)
 	if err != nil {
 		return fmt.Errorf("failed to read start: %w", err)
 	}
-	_, offset, err = getUint64(l.buf, offset) // end
+	end, offset, err := getUint64(l.buf, offset)
 	if err != nil {
 		return fmt.Errorf("failed to read end: %w", err)
 	}
@@ -299,45 +1130,114 @@ func loadChunk(l *Lexer) error {
 		return fmt.Errorf("failed to read compression length: %w", err)
 	}
 
+	if uint64(compressionLen) > recordLen-fixedHeaderLen {
+		return fmt.Errorf("%w: compression length %d exceeds chunk record", ErrTruncatedChunk, compressionLen)
+	}
+	if int(compressionLen)+8 > len(l.buf) {
+		l.buf, err = makeSafe(uint64(compressionLen) + 8)
+		if err != nil {
+			return fmt.Errorf("failed to allocate compression buffer: %w", err)
+		}
+	}
+
 	// read compression and records length into buffer
 	_, err = io.ReadFull(l.reader, l.buf[:compressionLen+8])
 	if err != nil {
-		return fmt.Errorf("failed to read compression from chunk: %w", err)
+		return truncatedChunkError("read compression from chunk", err)
 	}
 	compression := CompressionFormat(l.buf[:compressionLen])
 	recordsLength, _, err := getUint64(l.buf, int(compressionLen))
 	if err != nil {
 		return fmt.Errorf("failed to read records length: %w", err)
 	}
+	if recordsLength != recordLen-fixedHeaderLen-uint64(compressionLen) {
+		return fmt.Errorf("%w: records length %d in chunk record of length %d",
+			ErrInvalidRecordsLength, recordsLength, recordLen)
+	}
+
+	if l.onChunkBoundary != nil {
+		l.onChunkBoundary(ChunkInfo{
+			MessageStartTime: start,
+			MessageEndTime:   end,
+			UncompressedSize: uncompressedSize,
+			UncompressedCRC:  uncompressedCRC,
+			Compression:      compression,
+		})
+	}
+	if l.requireChunkCRC && uncompressedCRC == 0 {
+		return fmt.Errorf("%w: chunk at offset %d", ErrMissingChunkCRC, chunkOffset)
+	}
+
+	if l.maxTotalDecompressedBytes > 0 {
+		if uncompressedSize > uint64(l.maxTotalDecompressedBytes)-l.decompressedBytes {
+			return fmt.Errorf("%w: chunk of %d bytes after %d bytes", ErrDecompressionBudgetExceeded,
+				uncompressedSize, l.decompressedBytes)
+		}
+		l.decompressedBytes += uncompressedSize
+	}
 
 	// remaining bytes in the record are the chunk data
-	lr := io.LimitReader(l.reader, int64(recordsLength))
+	l.chunkRecords = &io.LimitedReader{R: l.reader, N: int64(recordsLength)}
+	var lr io.Reader = l.chunkRecords
+	if l.validateCompression && isStandardCompression(compression) {
+		lr, compression, err = l.checkCompression(lr, compression)
+		if err != nil {
+			return err
+		}
+	}
+	if l.readAhead != nil {
+		data, crc, ok := l.readAhead.decompressedChunk()
+		if ok && uint64(len(data)) == uncompressedSize {
+			return l.useDecompressedChunk(chunkOffset, data, uncompressedCRC, crc)
+		}
+	}
 	switch compression {
 	case CompressionNone:
 		l.reader = lr
 	case CompressionZSTD:
 		err = l.setZSTDDecoder(lr)
 		if err != nil {
-			return err
+			return truncatedChunkError("initialize zstd decoder", err)
 		}
 	case CompressionLZ4:
 		l.setLZ4Decoder(lr)
+	case CompressionSnappy:
+		l.setSnappyDecoder(lr)
 	default:
-		return fmt.Errorf("unsupported compression: %s", string(compression))
+		err = l.setCustomDecoder(compression, lr)
+		if err != nil {
+			return err
+		}
+	}
+	if l.maxTotalDecompressedBytes > 0 {
+		// only the chunk's declared size is charged to the budget.
+		l.reader = &declaredSizeReader{r: l.reader, remaining: uncompressedSize}
 	}
 	l.inChunk = true
+	if l.onChunk != nil {
+		l.onChunk()
+	}
 
-	// if we are validating the CRC, we need to fully decompress the chunk right
-	// here, then rewrap the decompressed data in a compatible reader after
-	// validation. If we are not validating CRCs, we can use incremental
-	// decompression for the chunk's data, which may be beneficial to streaming
-	// readers.
-	if l.validateCRC {
+	// if we are validating or reporting the CRC, or retaining chunk buffers,
+	// we need to fully decompress the chunk right here, then rewrap the
+	// decompressed data in a compatible reader. Otherwise, we can use
+	// incremental decompression for the chunk's data, which may be beneficial
+	// to streaming readers. With streaming CRC validation, the records are
+	// checksummed as they are read instead.
+	if l.streamingCRC && !l.retainChunkBuffers && l.onChunkCRC == nil && l.onDecompressedChunk == nil {
+		l.chunkCRC.reset(l.reader, uncompressedCRC)
+		l.reader = &l.chunkCRC
+		return nil
+	}
+	if l.validateCRC || l.retainChunkBuffers || l.onChunkCRC != nil || l.onDecompressedChunk != nil {
+		if l.pastDeadline() {
+			return ErrDeadlineExceeded
+		}
 		if l.maxDecompressedChunkSize > 0 && uncompressedSize > uint64(l.maxDecompressedChunkSize) {
 			return ErrChunkTooLarge
 		}
 		if uint64(len(l.uncompressedChunk)) < uncompressedSize {
-			l.uncompressedChunk, err = makeSafe(uncompressedSize * 2)
+			l.uncompressedChunk, err = makeSafe(l.chunkBufferSize(uncompressedSize))
 			if err != nil {
 				return fmt.Errorf("failed to allocate chunk buffer: %w", err)
 			}
@@ -345,56 +1245,382 @@ func loadChunk(l *Lexer) error {
 
 		_, err := io.ReadFull(l.reader, l.uncompressedChunk[:uncompressedSize])
 		if err != nil {
-			return fmt.Errorf("failed to decompress chunk: %w", err)
+			return truncatedChunkError("decompress chunk", lz4ChecksumError(err))
 		}
 
-		// LZ4 chunks may have some crc data at the end that is not required to
-		// fill a buffer, meaning the ReadFull call above does not consume it.
-		// Therefore we have to do an empty read. If we get any data out of
-		// this, it's an error.
-		if compression == CompressionLZ4 {
+		// LZ4 and snappy chunks may have some crc data or empty frames at the
+		// end that are not required to fill a buffer, meaning the ReadFull
+		// call above does not consume them, and the same may be true of
+		// registered decompressors. Legacy LZ4 frames have no end mark and
+		// instead end with the chunk's data. Therefore we have to do an empty
+		// read. If we get any data out of this, it's an error.
+		if compression != CompressionNone && compression != CompressionZSTD {
 			extraBytes, err := io.ReadAll(l.reader)
 			if err != nil {
-				return fmt.Errorf("failed to read extra bytes: %w", err)
+				return fmt.Errorf("failed to read extra bytes: %w", lz4ChecksumError(err))
 			}
 			if len(extraBytes) > 0 {
 				return fmt.Errorf("encountered unexpected bytes after chunk: %q", extraBytes)
 			}
 		}
 
-		crc := crc32.ChecksumIEEE(l.uncompressedChunk[:uncompressedSize])
-		if uncompressedCRC > 0 && crc != uncompressedCRC {
-			return &errInvalidChunkCrc{expected: uncompressedCRC, actual: crc}
+		if l.validateCRC || l.onChunkCRC != nil {
+			crc := crc32.ChecksumIEEE(l.uncompressedChunk[:uncompressedSize])
+			if err := l.checkChunkCRC(chunkOffset, uncompressedCRC, crc); err != nil {
+				return l.skipInvalidChunk(err)
+			}
+		}
+		l.chunkBuffer = l.uncompressedChunk[:uncompressedSize]
+		if l.onDecompressedChunk != nil {
+			l.onDecompressedChunk(l.chunkBuffer)
 		}
-		l.setNoneDecoder(l.uncompressedChunk[:uncompressedSize])
+		l.setNoneDecoder(l.chunkBuffer)
 	}
 	return nil
 }
 
+// checkChunkCRC reports the CRC computed over a chunk's records to
+// OnChunkCRC, and validates it against the stored CRC if CRCs are validated.
+func (l *Lexer) checkChunkCRC(chunkOffset uint64, stored uint32, computed uint32) error {
+	if l.onChunkCRC != nil {
+		l.onChunkCRC(chunkOffset, stored, computed, stored > 0 && computed == stored)
+	}
+	if l.validateCRC && stored > 0 && computed != stored {
+		return &errInvalidChunkCrc{expected: stored, actual: computed}
+	}
+	return nil
+}
+
+// chunkBufferSize returns the size of buffer to allocate for decompressing a
+// chunk of the given size. Buffers are allocated with room to grow, unless
+// that would take them beyond MaxChunkBufferSize.
+func (l *Lexer) chunkBufferSize(uncompressedSize uint64) uint64 {
+	limit := uint64(l.maxChunkBufferSize)
+	if limit == 0 || uncompressedSize*2 <= limit {
+		return uncompressedSize * 2
+	}
+	if uncompressedSize < limit {
+		return limit
+	}
+	return uncompressedSize
+}
+
+// releaseChunkBuffer drops the buffer chunks are decompressed into once a
+// chunk's records are exhausted, if it is larger than
+// MaxChunkBufferSize, so that its memory can be reclaimed.
+func (l *Lexer) releaseChunkBuffer() {
+	if l.maxChunkBufferSize <= 0 || len(l.uncompressedChunk) <= l.maxChunkBufferSize {
+		return
+	}
+	l.uncompressedChunk = nil
+	l.chunkBuffer = nil
+	if l.decoders.none != nil {
+		l.decoders.none.Reset(nil)
+	}
+}
+
+// skipInvalidChunk discards the remainder of a chunk that failed CRC
+// validation, none of whose records are returned, so that lexing resumes at
+// the record following the chunk. It returns the CRC error, unless the chunk
+// cannot be skipped.
+func (l *Lexer) skipInvalidChunk(crcErr error) error {
+	l.inChunk = false
+	l.reader = l.basereader
+	l.releaseChunkBuffer()
+	if err := l.discardChunkRecords(); err != nil {
+		return err
+	}
+	return crcErr
+}
+
+// discardChunkRecords discards the compressed records of the current chunk
+// that have not been consumed, such as those following the end of the
+// decompressed stream, so that the input is positioned at the record
+// following the chunk. Compressed records that end before the chunk's
+// records length is reached are reported as a truncated chunk.
+func (l *Lexer) discardChunkRecords() error {
+	records := l.chunkRecords
+	if records == nil {
+		return nil
+	}
+	l.chunkRecords = nil
+	_, err := io.Copy(io.Discard, records)
+	if err == nil && records.N > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return truncatedChunkError("read chunk", err)
+	}
+	return nil
+}
+
+// useDecompressedChunk de-chunks a chunk whose records were decompressed
+// ahead of the lexer, discarding its compressed records. CRCs are checked as
+// when the lexer decompresses chunks in full.
+func (l *Lexer) useDecompressedChunk(chunkOffset uint64, data []byte, stored uint32, computed uint32) error {
+	if err := l.discardChunkRecords(); err != nil {
+		return err
+	}
+	l.inChunk = true
+	if l.onChunk != nil {
+		l.onChunk()
+	}
+	if l.validateCRC || l.onChunkCRC != nil {
+		if err := l.checkChunkCRC(chunkOffset, stored, computed); err != nil {
+			return l.skipInvalidChunk(err)
+		}
+	}
+	l.chunkBuffer = data
+	if l.onDecompressedChunk != nil {
+		l.onDecompressedChunk(l.chunkBuffer)
+	}
+	l.setNoneDecoder(l.chunkBuffer)
+	return nil
+}
+
+// declaredSizeReader reads a chunk's decompressed records, failing with
+// ErrDecompressionBudgetExceeded if they exceed the chunk's declared
+// uncompressed size.
+type declaredSizeReader struct {
+	r         io.Reader
+	remaining uint64
+}
+
+func (d *declaredSizeReader) Read(p []byte) (int, error) {
+	if d.remaining == 0 {
+		var probe [1]byte
+		n, err := d.r.Read(probe[:])
+		if n > 0 {
+			return 0, fmt.Errorf("%w: chunk exceeds its declared uncompressed size", ErrDecompressionBudgetExceeded)
+		}
+		return 0, err
+	}
+	if uint64(len(p)) > d.remaining {
+		p = p[:d.remaining]
+	}
+	n, err := d.r.Read(p)
+	d.remaining -= uint64(n)
+	return n, err
+}
+
 // LexerOptions holds options for the lexer.
 type LexerOptions struct {
-	// SkipMagic instructs the lexer not to perform validation of the leading magic bytes.
+	// SkipMagic instructs the lexer not to perform validation of the leading magic bytes,
+	// or of the trailing magic bytes following the footer.
 	SkipMagic bool
 	// ValidateCRC instructs the lexer to validate CRC checksums for chunks.
+	// A stored uncompressed CRC of zero means that the chunk has no CRC, and
+	// such chunks are not validated.
 	ValidateCRC bool
+	// RequireChunkCRC instructs the lexer to fail with ErrMissingChunkCRC on
+	// chunks with no uncompressed CRC, rather than reading them unvalidated.
+	// It implies ValidateCRC.
+	RequireChunkCRC bool
+	// StrictParsing instructs the lexer to check that the fields of each
+	// record it returns with a known opcode occupy exactly the record's
+	// declared length, as the Parse functions read them, and to fail with
+	// ErrRecordLengthMismatch otherwise. Records whose fields are shorter
+	// than the record, such as a footer or statistics record padded with
+	// trailing bytes, would otherwise be parsed without error. Chunks that
+	// are de-chunked are checked as they are loaded regardless, and the
+	// records of attachments read with AttachmentReader are not checked.
+	StrictParsing bool
 	// EmitChunks instructs the lexer to emit chunk records without de-chunking.
 	// It is incompatible with ValidateCRC.
 	EmitChunks bool
 	// EmitChunks instructs the lexer to emit TokenInvalidChunk rather than TokenError when CRC
-	// validation fails.
+	// validation fails. The lexer then skips the rest of the invalid chunk, and the following
+	// call to Next returns the record after it.
 	EmitInvalidChunks bool
 	// MaxDecompressedChunkSize defines the maximum size chunk the lexer will
 	// decompress. Chunks larger than this will result in an error.
 	MaxDecompressedChunkSize int
+	// MaxTotalDecompressedBytes bounds the total size the lexer will
+	// decompress across all chunks, as a guard against crafted files with
+	// many chunks. Each chunk's declared uncompressed size is counted against
+	// it before the chunk is decompressed, and chunks that decompress to more
+	// than their declared size are rejected. Exceeding it results in an error
+	// wrapping ErrDecompressionBudgetExceeded. Zero means no limit.
+	MaxTotalDecompressedBytes int
+	// MaxChunkBufferSize bounds the size of the buffer the lexer
+	// keeps for decompressing chunks in full, as it does to validate CRCs.
+	// The buffer grows to fit the largest chunk read; if it grows beyond
+	// this size, it is released once the chunk's records are exhausted, and
+	// a buffer of at most this size is allocated for the next chunk, so that
+	// one unusually large chunk does not inflate the lexer's memory use for
+	// the rest of the file. Zero, the default, keeps the buffer however
+	// large it grows. Chunks decompressed by ReadAheadChunks are not affected.
+	MaxChunkBufferSize int
 	// MaxRecordSize defines the maximum size record the lexer will read.
 	// Records larger than this will result in an error.
 	MaxRecordSize int
+	// RetainChunkBuffers instructs the lexer to decompress each chunk in full
+	// and return the records within it as slices of the decompressed chunk,
+	// rather than copying them into the buffer passed to Next. These slices
+	// remain valid until the lexer advances past the chunk: the chunk buffer
+	// is reused for the next chunk, so slices must not be used after the
+	// call to Next that returns the first record following the chunk.
+	// Records outside of chunks are read into the buffer passed to Next as
+	// usual.
+	RetainChunkBuffers bool
+	// Deadline bounds the time the lexer may spend reading. Once it passes,
+	// Next returns ErrDeadlineExceeded. The deadline is checked before each
+	// record and chunk is read, and is also set on the underlying reader if it
+	// supports `SetReadDeadline`, so that blocked reads are interrupted. The
+	// reader's deadline is left in place until the lexer is closed or reset,
+	// which clear it.
+	Deadline time.Time
+	// OnChunkCRC, if set, is called for each chunk the lexer de-chunks with
+	// the chunk's offset in the input, its stored uncompressed CRC, the CRC
+	// computed over its decompressed records, and whether the stored CRC was
+	// present (nonzero) and matched, so that chunks that were validated can
+	// be told from those that were skipped for lack of a CRC. Setting it causes every chunk to be
+	// decompressed in full and checksummed, even if ValidateCRC is not set.
+	// It is not called for chunks emitted with EmitChunks.
+	OnChunkCRC func(offset uint64, stored uint32, computed uint32, validated bool)
+	// OnDecompressedChunk, if set, is called with the decompressed records of
+	// each chunk the lexer de-chunks, as one buffer, before any of the
+	// chunk's records are returned. Setting it causes every chunk to be
+	// decompressed in full. The buffer is reused for later chunks, so it is
+	// valid only for the duration of the call. It is not called for chunks
+	// that fail CRC validation, or for chunks emitted with EmitChunks.
+	OnDecompressedChunk func(data []byte)
+	// Decompressors registers decompressors for chunk compression formats
+	// the lexer does not support natively, keyed by the compression named
+	// in the chunk records. Each is called with a reader of a chunk's
+	// compressed records and returns a reader of the decompressed records.
+	// If the returned reader also implements `Reset(io.Reader) error`, it is
+	// reset and reused for later chunks of the same format rather than
+	// created anew. The built-in decompressors take precedence, so
+	// registering the standard formats ("", "zstd", "lz4" and "snappy") has
+	// no effect.
+	Decompressors map[string]func(io.Reader) (io.Reader, error)
+	// OnChunkBoundary, if set, is called with the header fields of each chunk
+	// the lexer de-chunks, before any records from the chunk are returned.
+	// It is not called for chunks emitted with EmitChunks.
+	OnChunkBoundary func(info ChunkInfo)
+	// StreamingCRC instructs the lexer to validate chunk CRCs incrementally,
+	// checksumming each chunk's records as they are read rather than
+	// decompressing the chunk in full first, so that memory use does not
+	// grow with the size of chunks. It implies ValidateCRC. A mismatch is
+	// reported once the chunk's records are exhausted, so the records of an
+	// invalid chunk are returned before the error; it is returned with
+	// TokenInvalidChunk if EmitInvalidChunks is set. If chunks are
+	// decompressed in full anyway, for RetainChunkBuffers, OnChunkCRC or
+	// OnDecompressedChunk, their CRCs are validated as with ValidateCRC.
+	StreamingCRC bool
+	// DetectOuterCompression instructs the lexer to check whether the input
+	// as a whole is a gzip, zstd or lz4 frame compressed stream, such as a
+	// file compressed with gzip, and if so to decompress it transparently.
+	// The magic bytes are then validated, and offsets counted, against the
+	// decompressed stream. Inputs that are not compressed are read as usual.
+	DetectOuterCompression bool
+	// RetryPolicy, if set, causes reads from the input that fail with a
+	// transient error to be retried.
+	RetryPolicy *RetryPolicy
+	// ReadAheadChunks, if positive, instructs the lexer to read up to this
+	// many records ahead of Next in a background goroutine and to decompress
+	// the chunks among them concurrently, with up to this many workers bounded
+	// by GOMAXPROCS. Tokens are returned in the same order, and with the same
+	// offsets, as without it; only decompression is parallel. Chunks are then
+	// decompressed in full, and their CRCs checked as with ValidateCRC, so
+	// memory use grows with the size and number of chunks read ahead. Chunks
+	// that the workers cannot decompress, such as those in formats registered
+	// with Decompressors, are decompressed by the lexer as usual. It has no
+	// effect with EmitChunks. Lexers reading ahead must be closed with Close
+	// once they are no longer needed, unless they were read to io.EOF.
+	ReadAheadChunks int
+	// ZSTDDictionary is a zstd dictionary with which to decompress zstd
+	// chunks compressed with it, such as those written with
+	// WriterOptions.ZSTDDictionary. The writer records the ID of the
+	// dictionary in a metadata record named ZSTDDictionaryMetadataName, which
+	// may be compared with ZSTDDictionaryID to find the dictionary to supply.
+	// Chunks compressed without a dictionary are decompressed as usual.
+	ZSTDDictionary []byte
+	// ValidateCompression instructs the lexer to check that the data of each
+	// chunk declaring one of the standard compression formats begins as that
+	// format does, and to fail with ErrCompressionMismatch if it instead
+	// begins as another of them, such as lz4 data in a chunk declared zstd.
+	// Chunks declaring formats registered with Decompressors are not checked.
+	ValidateCompression bool
+	// AutoDetectCompression is like ValidateCompression, but instead of
+	// failing on a mismatch, the lexer decompresses the chunk with the format
+	// its data is detected to be in. This salvages files from writers that
+	// mislabel chunk compression.
+	AutoDetectCompression bool
+	// EmitUnknownRecords causes records with opcodes the lexer does not
+	// recognize, such as records from later versions of the specification,
+	// to be returned as TokenUnknown rather than skipped. Their opcode is
+	// available from Lexer.LastOpcode.
+	EmitUnknownRecords bool
+	// Skip lists token types the lexer skips over without reading them into
+	// a buffer, such as TokenAttachment when only messages are of interest.
+	// Skipping TokenChunk skips chunks without de-chunking them, and with
+	// them the records they contain. The trailing magic is still validated
+	// if TokenFooter is skipped.
+	Skip []TokenType
+}
+
+// RetryPolicy configures the retry of reads that fail with transient errors.
+// Retries happen beneath the lexer: data returned alongside an error is kept,
+// and only the remainder of the read is retried, so a record interrupted by a
+// transient error resumes where it left off.
+type RetryPolicy struct {
+	// MaxRetries is the number of consecutive failed reads retried before
+	// the error is returned.
+	MaxRetries int
+	// Backoff is the delay before the first retry of a read. It doubles with
+	// each further retry, up to MaxBackoff if that is set. Retries that would
+	// wait past the lexer's deadline are not attempted.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// IsTransient reports whether a read error may succeed on retry. If it is
+	// nil, errors with a Temporary method returning true, such as temporary
+	// network errors, are retried. End of input is never retried.
+	IsTransient func(error) bool
+}
+
+// ChunkInfo describes a chunk de-chunked by the lexer. See
+// LexerOptions.OnChunkBoundary.
+type ChunkInfo struct {
+	MessageStartTime uint64
+	MessageEndTime   uint64
+	UncompressedSize uint64
+	UncompressedCRC  uint32
+	Compression      CompressionFormat
 }
 
 // NewLexer returns a new lexer for the given reader.
 func NewLexer(r io.Reader, opts ...*LexerOptions) (*Lexer, error) {
-	var maxRecordSize, maxDecompressedChunkSize int
-	var validateCRC, emitChunks, emitInvalidChunks, skipMagic bool
+	l := &Lexer{buf: make([]byte, 32)}
+	if err := l.Reset(r, opts...); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reset discards the lexer's state and prepares it to read from r with the
+// given options, as if newly returned by NewLexer. Its decoders and buffers
+// are retained and reused, so that a lexer may be reused across many files
+// without reallocating them. As with NewLexer, the leading magic bytes are
+// validated unless SkipMagic is set; if Reset returns an error, the lexer must
+// be reset successfully before further use. Records returned by the lexer
+// before the reset may alias its buffers, and must not be used after it.
+func (l *Lexer) Reset(r io.Reader, opts ...*LexerOptions) error {
+	l.Close()
+	var maxRecordSize, maxDecompressedChunkSize, maxTotalDecompressedBytes, maxChunkBufferSize int
+	var validateCRC, requireChunkCRC, strictParsing, emitChunks, emitInvalidChunks, skipMagic, retainChunkBuffers bool
+	var deadline time.Time
+	var onChunkCRC func(uint64, uint32, uint32, bool)
+	var onDecompressedChunk func([]byte)
+	var decompressors map[string]func(io.Reader) (io.Reader, error)
+	var onChunkBoundary func(ChunkInfo)
+	var streamingCRC, detectOuterCompression bool
+	var validateCompression, autoDetectCompression, emitUnknownRecords bool
+	var retryPolicy *RetryPolicy
+	var skipTokens uint32
+	var readAheadChunks int
+	var zstdDictionary []byte
 	if len(opts) > 0 {
 		validateCRC = opts[0].ValidateCRC
 		emitChunks = opts[0].EmitChunks
@@ -402,21 +1628,194 @@ func NewLexer(r io.Reader, opts ...*LexerOptions) (*Lexer, error) {
 		skipMagic = opts[0].SkipMagic
 		maxRecordSize = opts[0].MaxRecordSize
 		maxDecompressedChunkSize = opts[0].MaxDecompressedChunkSize
+		maxTotalDecompressedBytes = opts[0].MaxTotalDecompressedBytes
+		maxChunkBufferSize = opts[0].MaxChunkBufferSize
+		retainChunkBuffers = opts[0].RetainChunkBuffers
+		deadline = opts[0].Deadline
+		onChunkCRC = opts[0].OnChunkCRC
+		onDecompressedChunk = opts[0].OnDecompressedChunk
+		decompressors = opts[0].Decompressors
+		onChunkBoundary = opts[0].OnChunkBoundary
+		streamingCRC = opts[0].StreamingCRC
+		requireChunkCRC = opts[0].RequireChunkCRC
+		strictParsing = opts[0].StrictParsing
+		validateCRC = validateCRC || streamingCRC || requireChunkCRC
+		detectOuterCompression = opts[0].DetectOuterCompression
+		retryPolicy = opts[0].RetryPolicy
+		validateCompression = opts[0].ValidateCompression
+		autoDetectCompression = opts[0].AutoDetectCompression
+		emitUnknownRecords = opts[0].EmitUnknownRecords
+		readAheadChunks = opts[0].ReadAheadChunks
+		zstdDictionary = opts[0].ZSTDDictionary
+		for _, tokenType := range opts[0].Skip {
+			if tokenType >= 0 && tokenType < TokenError {
+				skipTokens |= 1 << tokenType
+			}
+		}
+	}
+	if !deadline.IsZero() {
+		if !time.Now().Before(deadline) {
+			return ErrDeadlineExceeded
+		}
+		if dr, ok := r.(interface{ SetReadDeadline(time.Time) error }); ok {
+			// readers that do not support deadlines, such as regular files,
+			// return an error here and are bounded by the checks in Next.
+			if dr.SetReadDeadline(deadline) == nil {
+				l.deadlineReader = dr
+			}
+		}
+	}
+	if retryPolicy != nil {
+		r = &retryingReader{r: r, policy: *retryPolicy, deadline: deadline}
 	}
+	if detectOuterCompression {
+		var err error
+		r, err = decompressOuterStream(r)
+		if err != nil {
+			return err
+		}
+		if decoder, ok := r.(*zstd.Decoder); ok {
+			// retained now, so that it is released even if Reset fails.
+			l.outerZSTD = decoder
+		}
+	}
+	counter := &countingReader{r: r}
+	r = counter
 	if !skipMagic {
 		err := validateMagic(r)
 		if err != nil {
-			return nil, err
-		}
-	}
-	return &Lexer{
-		basereader:               r,
-		reader:                   r,
-		buf:                      make([]byte, 32),
-		validateCRC:              validateCRC,
-		emitChunks:               emitChunks,
-		emitInvalidChunks:        emitInvalidChunks,
-		maxRecordSize:            maxRecordSize,
-		maxDecompressedChunkSize: maxDecompressedChunkSize,
-	}, nil
+			return err
+		}
+	}
+	var readAhead *readAheadReader
+	if readAheadChunks > 0 && !emitChunks {
+		readAhead = newReadAheadReader(counter.r, readAheadChunks, maxRecordSize, maxDecompressedChunkSize,
+			maxTotalDecompressedBytes, validateCRC || onChunkCRC != nil, zstdDictionary)
+		counter.r = readAhead
+	}
+	l.setZSTDDictionary(zstdDictionary)
+	decoders := l.decoders
+	// registered decompressors may differ between uses of the lexer.
+	decoders.custom = nil
+	*l = Lexer{
+		basereader:                r,
+		reader:                    r,
+		decoders:                  decoders,
+		buf:                       l.buf,
+		uncompressedChunk:         l.uncompressedChunk,
+		validateCRC:               validateCRC,
+		requireChunkCRC:           requireChunkCRC,
+		strictParsing:             strictParsing,
+		emitChunks:                emitChunks,
+		emitInvalidChunks:         emitInvalidChunks,
+		maxRecordSize:             maxRecordSize,
+		maxDecompressedChunkSize:  maxDecompressedChunkSize,
+		maxTotalDecompressedBytes: maxTotalDecompressedBytes,
+		maxChunkBufferSize:        maxChunkBufferSize,
+		retainChunkBuffers:        retainChunkBuffers,
+		validateTrailingMagic:     !skipMagic,
+		deadline:                  deadline,
+		onChunkCRC:                onChunkCRC,
+		onDecompressedChunk:       onDecompressedChunk,
+		decompressors:             decompressors,
+		onChunkBoundary:           onChunkBoundary,
+		streamingCRC:              streamingCRC,
+		skipTokens:                skipTokens,
+		validateCompression:       validateCompression || autoDetectCompression,
+		autoDetectCompression:     autoDetectCompression,
+		emitUnknownRecords:        emitUnknownRecords,
+		readAhead:                 readAhead,
+		zstdDictionary:            zstdDictionary,
+		deadlineReader:            l.deadlineReader,
+		outerZSTD:                 l.outerZSTD,
+		counter:                   counter,
+	}
+	l.releaseChunkBuffer()
+	return nil
+}
+
+// crcReader computes the CRC of the decompressed records of a chunk as they
+// are read, for validation against the chunk's stored CRC.
+type crcReader struct {
+	r        io.Reader
+	crc      uint32
+	expected uint32
+	pending  bool
+}
+
+func (c *crcReader) reset(r io.Reader, expected uint32) {
+	*c = crcReader{r: r, expected: expected, pending: true}
+}
+
+func (c *crcReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.crc = crc32.Update(c.crc, crc32.IEEETable, p[:n])
+	return n, err
+}
+
+// validate checks the CRC of the records read against the stored CRC, if the
+// chunk has one.
+func (c *crcReader) validate() error {
+	c.pending = false
+	if c.expected > 0 && c.crc != c.expected {
+		return &errInvalidChunkCrc{expected: c.expected, actual: c.crc}
+	}
+	return nil
+}
+
+// retryingReader retries reads from r that fail with transient errors, as set
+// out by its policy, backing off between attempts and giving up once the
+// retries are exhausted or the deadline would be passed.
+type retryingReader struct {
+	r        io.Reader
+	policy   RetryPolicy
+	deadline time.Time
+}
+
+func (rr *retryingReader) Read(p []byte) (int, error) {
+	backoff := rr.policy.Backoff
+	for retries := 0; ; retries++ {
+		n, err := rr.r.Read(p)
+		if err == nil || !rr.transient(err) {
+			return n, err
+		}
+		if n > 0 {
+			// deliver what was read; the remainder is read by the next call.
+			return n, nil
+		}
+		if retries >= rr.policy.MaxRetries {
+			return 0, err
+		}
+		if !rr.deadline.IsZero() && time.Now().Add(backoff).After(rr.deadline) {
+			return 0, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		if rr.policy.MaxBackoff > 0 && backoff > rr.policy.MaxBackoff {
+			backoff = rr.policy.MaxBackoff
+		}
+	}
+}
+
+func (rr *retryingReader) transient(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return false
+	}
+	if rr.policy.IsTransient != nil {
+		return rr.policy.IsTransient(err)
+	}
+	var temporary interface{ Temporary() bool }
+	return errors.As(err, &temporary) && temporary.Temporary()
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n uint64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += uint64(n)
+	return n, err
 }
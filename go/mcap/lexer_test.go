@@ -2,15 +2,20 @@ package mcap
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -57,6 +62,163 @@ func TestRejectsUnsupportedCompression(t *testing.T) {
 	assert.Equal(t, "unsupported compression: unknown", err.Error())
 }
 
+// xorReader is a toy decompressor that XORs each byte with a key.
+type xorReader struct {
+	r      io.Reader
+	key    byte
+	resets int
+}
+
+func (x *xorReader) Read(p []byte) (int, error) {
+	n, err := x.r.Read(p)
+	for i := range p[:n] {
+		p[i] ^= x.key
+	}
+	return n, err
+}
+
+func (x *xorReader) Reset(r io.Reader) error {
+	x.r = r
+	x.resets++
+	return nil
+}
+
+func TestRegisteredDecompressors(t *testing.T) {
+	xorChunk := func(records ...[]byte) []byte {
+		data := flatten(records...)
+		compressed := make([]byte, len(data))
+		for i, b := range data {
+			compressed[i] = b ^ 0x5a
+		}
+		return chunkRecord(t, CompressionFormat("xor"), true, data, compressed)
+	}
+	xorFile := file(
+		header(),
+		xorChunk(channelInfo(), message(), message()),
+		xorChunk(channelInfo(), message()),
+		footer(),
+	)
+	for _, validateCRC := range []bool{true, false} {
+		t.Run(fmt.Sprintf("crc validation %v", validateCRC), func(t *testing.T) {
+			var decoders []*xorReader
+			lexer, err := NewLexer(bytes.NewReader(xorFile), &LexerOptions{
+				ValidateCRC: validateCRC,
+				Decompressors: map[string]func(io.Reader) (io.Reader, error){
+					"xor": func(r io.Reader) (io.Reader, error) {
+						decoder := &xorReader{r: r, key: 0x5a}
+						decoders = append(decoders, decoder)
+						return decoder, nil
+					},
+				},
+			})
+			assert.Nil(t, err)
+			for _, expected := range []TokenType{
+				TokenHeader,
+				TokenChannel,
+				TokenMessage,
+				TokenMessage,
+				TokenChannel,
+				TokenMessage,
+				TokenFooter,
+			} {
+				tokenType, _, err := lexer.Next(nil)
+				assert.Nil(t, err)
+				assert.Equal(t, expected, tokenType)
+			}
+			assert.Equal(t, 1, len(decoders))
+			assert.Equal(t, 1, decoders[0].resets)
+		})
+	}
+	t.Run("built-in decompressors take precedence", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(file(
+			header(),
+			chunk(t, CompressionZSTD, true, channelInfo(), message()),
+			footer(),
+		)), &LexerOptions{
+			Decompressors: map[string]func(io.Reader) (io.Reader, error){
+				string(CompressionZSTD): func(r io.Reader) (io.Reader, error) {
+					return nil, errors.New("not called")
+				},
+			},
+		})
+		assert.Nil(t, err)
+		for _, expected := range []TokenType{TokenHeader, TokenChannel, TokenMessage, TokenFooter} {
+			tokenType, _, err := lexer.Next(nil)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, tokenType)
+		}
+	})
+	t.Run("reports decompressor errors", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(xorFile), &LexerOptions{
+			Decompressors: map[string]func(io.Reader) (io.Reader, error){
+				"xor": func(r io.Reader) (io.Reader, error) {
+					return nil, errors.New("bad key")
+				},
+			},
+		})
+		assert.Nil(t, err)
+		_, _, err = lexer.Next(nil)
+		assert.Nil(t, err)
+		_, _, err = lexer.Next(nil)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "bad key")
+	})
+}
+
+func TestChunkErrors(t *testing.T) {
+	lexAll := func(data []byte, opts *LexerOptions) error {
+		lexer, err := NewLexer(bytes.NewReader(data), opts)
+		if err != nil {
+			return err
+		}
+		for {
+			_, _, err := lexer.Next(nil)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	t.Run("unsupported compression", func(t *testing.T) {
+		err := lexAll(file(header(), chunk(t, CompressionFormat("brotli"), true, message()), footer()), &LexerOptions{})
+		assert.ErrorIs(t, err, ErrUnsupportedCompression)
+		var unsupported *UnsupportedCompressionError
+		assert.True(t, errors.As(err, &unsupported))
+		assert.Equal(t, CompressionFormat("brotli"), unsupported.Compression)
+	})
+	t.Run("truncated chunk", func(t *testing.T) {
+		data := file(header(), chunk(t, CompressionZSTD, true, channelInfo(), message()))
+		chunkStart := len(Magic) + len(header())
+		// within the fixed header, the compression and the records.
+		for _, length := range []int{chunkStart + 9 + 20, chunkStart + 9 + 34, len(data) - 10} {
+			for _, opts := range []LexerOptions{{ValidateCRC: true}, {}, {ReadAheadChunks: 2}} {
+				err := lexAll(data[:length], &opts)
+				assert.ErrorIs(t, err, ErrTruncatedChunk, "length %d, options %+v", length, opts)
+				assert.ErrorIs(t, err, io.ErrUnexpectedEOF, "length %d, options %+v", length, opts)
+			}
+		}
+	})
+	t.Run("invalid records length", func(t *testing.T) {
+		c := chunk(t, CompressionNone, true, channelInfo(), message())
+		// the records length follows the opcode, record length, the fixed
+		// size header fields and the empty compression string.
+		offset := 9 + 8 + 8 + 8 + 4 + 4
+		binary.LittleEndian.PutUint64(c[offset:], binary.LittleEndian.Uint64(c[offset:])-1)
+		err := lexAll(file(header(), c, footer()), &LexerOptions{})
+		assert.ErrorIs(t, err, ErrInvalidRecordsLength)
+	})
+	t.Run("crc mismatch", func(t *testing.T) {
+		c := chunk(t, CompressionNone, true, channelInfo(), message())
+		c[len(c)-1] ^= 0xff
+		err := lexAll(file(header(), c, footer()), &LexerOptions{ValidateCRC: true})
+		assert.ErrorIs(t, err, ErrInvalidChunkCRC)
+		expected, actual, ok := ChunkCRCMismatch(err)
+		assert.True(t, ok)
+		assert.NotEqual(t, expected, actual)
+		_, _, ok = ChunkCRCMismatch(io.EOF)
+		assert.False(t, ok)
+	})
+}
+
 func TestRejectsTooLargeRecords(t *testing.T) {
 	bigHeader := header()
 	binary.LittleEndian.PutUint64(bigHeader[1:], 1000)
@@ -84,6 +246,100 @@ func TestRejectsTooLargeChunks(t *testing.T) {
 	assert.ErrorIs(t, err, ErrChunkTooLarge)
 }
 
+func TestMaxTotalDecompressedBytes(t *testing.T) {
+	records := flatten(channelInfo(), message(), message())
+	for _, validateCRC := range []bool{true, false} {
+		t.Run(fmt.Sprintf("validate crc %v", validateCRC), func(t *testing.T) {
+			t.Run("rejects chunks beyond the budget", func(t *testing.T) {
+				c := chunk(t, CompressionLZ4, true, channelInfo(), message(), message())
+				lexer, err := NewLexer(bytes.NewReader(file(header(), c, c, c, footer())), &LexerOptions{
+					MaxTotalDecompressedBytes: 2 * len(records),
+					ValidateCRC:               validateCRC,
+				})
+				assert.Nil(t, err)
+				var tokens []TokenType
+				for {
+					tokenType, _, err := lexer.Next(nil)
+					if err != nil {
+						assert.ErrorIs(t, err, ErrDecompressionBudgetExceeded)
+						break
+					}
+					tokens = append(tokens, tokenType)
+				}
+				assert.Equal(t, []TokenType{
+					TokenHeader,
+					TokenChannel, TokenMessage, TokenMessage,
+					TokenChannel, TokenMessage, TokenMessage,
+				}, tokens)
+			})
+			t.Run("rejects chunks exceeding their declared size", func(t *testing.T) {
+				c := chunk(t, CompressionLZ4, false, channelInfo(), message(), message())
+				binary.LittleEndian.PutUint64(c[1+8+8+8:], uint64(len(records)-1))
+				lexer, err := NewLexer(bytes.NewReader(file(header(), c, footer())), &LexerOptions{
+					MaxTotalDecompressedBytes: 1000,
+					ValidateCRC:               validateCRC,
+				})
+				assert.Nil(t, err)
+				for err == nil {
+					_, _, err = lexer.Next(nil)
+				}
+				assert.ErrorIs(t, err, ErrDecompressionBudgetExceeded)
+			})
+		})
+	}
+}
+
+func TestMaxChunkBufferSize(t *testing.T) {
+	small := chunk(t, CompressionZSTD, true, channelInfo(), message())
+	records := [][]byte{channelInfo()}
+	for i := 0; i < 20; i++ {
+		records = append(records, message())
+	}
+	large := chunk(t, CompressionZSTD, true, records...)
+	largeSize := len(flatten(records...))
+	data := file(header(), small, large, small, footer())
+	// lexUntil lexes tokens until the given number of messages have been read.
+	lexUntil := func(t *testing.T, lexer *Lexer, messages int) {
+		for messages > 0 {
+			tokenType, _, err := lexer.Next(nil)
+			assert.Nil(t, err)
+			if tokenType == TokenMessage {
+				messages--
+			}
+		}
+	}
+	t.Run("releases oversized buffers after the chunk", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(data), &LexerOptions{ValidateCRC: true, MaxChunkBufferSize: 64})
+		assert.Nil(t, err)
+		smallSize := len(flatten(channelInfo(), message()))
+		lexUntil(t, lexer, 1)
+		assert.Equal(t, 2*smallSize, len(lexer.uncompressedChunk))
+		lexUntil(t, lexer, 20)
+		assert.Equal(t, largeSize, len(lexer.uncompressedChunk))
+		tokenType, _, err := lexer.Next(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, TokenChannel, tokenType)
+		assert.Equal(t, 2*smallSize, len(lexer.uncompressedChunk))
+		lexUntil(t, lexer, 1)
+		tokenType, _, err = lexer.Next(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, TokenFooter, tokenType)
+	})
+	t.Run("keeps buffers by default", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(data), &LexerOptions{ValidateCRC: true})
+		assert.Nil(t, err)
+		lexUntil(t, lexer, 22)
+		assert.Equal(t, 2*largeSize, len(lexer.uncompressedChunk))
+	})
+	t.Run("releases oversized buffers on reset", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(data), &LexerOptions{ValidateCRC: true})
+		assert.Nil(t, err)
+		lexUntil(t, lexer, 22)
+		assert.Nil(t, lexer.Reset(bytes.NewReader(data), &LexerOptions{ValidateCRC: true, MaxChunkBufferSize: 64}))
+		assert.Nil(t, lexer.uncompressedChunk)
+	})
+}
+
 func TestLargeChunksOKIfNotCheckingCRC(t *testing.T) {
 	bigChunk := chunk(t, CompressionZSTD, true, channelInfo(), message(), message())
 	binary.LittleEndian.PutUint64(bigChunk[1+8+8+8:], 1000)
@@ -136,6 +392,98 @@ func TestBadMagic(t *testing.T) {
 	}
 }
 
+func TestTrailingMagic(t *testing.T) {
+	valid := file(header(), footer())
+	withoutMagic := valid[:len(valid)-len(Magic)]
+	cases := []struct {
+		assertion string
+		input     []byte
+	}{
+		{
+			"missing magic",
+			withoutMagic,
+		},
+		{
+			"truncated magic",
+			valid[:len(valid)-1],
+		},
+		{
+			"invalid magic",
+			flatten(withoutMagic, make([]byte, len(Magic))),
+		},
+		{
+			"data after magic",
+			flatten(valid, []byte{0}),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.assertion, func(t *testing.T) {
+			lexer, err := NewLexer(bytes.NewReader(c.input))
+			assert.Nil(t, err)
+			tokenType, _, err := lexer.Next(nil)
+			assert.Nil(t, err)
+			assert.Equal(t, TokenHeader, tokenType)
+			_, _, err = lexer.Next(nil)
+			assert.ErrorIs(t, err, ErrMissingTrailingMagic)
+		})
+	}
+	t.Run("valid magic", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(valid))
+		assert.Nil(t, err)
+		expected := []TokenType{TokenHeader, TokenFooter}
+		for _, tokenType := range expected {
+			actual, _, err := lexer.Next(nil)
+			assert.Nil(t, err)
+			assert.Equal(t, tokenType, actual)
+		}
+		_, _, err = lexer.Next(nil)
+		assert.ErrorIs(t, err, io.EOF)
+	})
+	t.Run("skipped with SkipMagic", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(withoutMagic[len(Magic):]), &LexerOptions{SkipMagic: true})
+		assert.Nil(t, err)
+		for _, tokenType := range []TokenType{TokenHeader, TokenFooter} {
+			actual, _, err := lexer.Next(nil)
+			assert.Nil(t, err)
+			assert.Equal(t, tokenType, actual)
+		}
+	})
+}
+
+func TestValidateTrailingMagic(t *testing.T) {
+	valid := writeTestFile(t, &WriterOptions{Chunked: true}, []string{"/a"}, []uint64{1, 2})
+	cases := []struct {
+		assertion string
+		input     []byte
+	}{
+		{
+			"truncated file",
+			valid[:len(valid)-3],
+		},
+		{
+			"invalid magic",
+			flatten(valid[:len(valid)-len(Magic)], make([]byte, len(Magic))),
+		},
+		{
+			"only leading magic",
+			Magic,
+		},
+		{
+			"empty file",
+			[]byte{},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.assertion, func(t *testing.T) {
+			err := ValidateTrailingMagic(bytes.NewReader(c.input), int64(len(c.input)))
+			assert.ErrorIs(t, err, ErrMissingTrailingMagic)
+		})
+	}
+	t.Run("valid magic", func(t *testing.T) {
+		assert.Nil(t, ValidateTrailingMagic(bytes.NewReader(valid), int64(len(valid))))
+	})
+}
+
 func TestReturnsEOFOnSuccessiveCalls(t *testing.T) {
 	lexer, err := NewLexer(bytes.NewReader(file()))
 	assert.Nil(t, err)
@@ -154,6 +502,7 @@ func TestLexChunkedFile(t *testing.T) {
 			for _, compression := range []CompressionFormat{
 				CompressionZSTD,
 				CompressionLZ4,
+				CompressionSnappy,
 				CompressionNone,
 			} {
 				t.Run(fmt.Sprintf("chunked %s", compression), func(t *testing.T) {
@@ -196,6 +545,411 @@ func TestLexChunkedFile(t *testing.T) {
 	}
 }
 
+func TestOnChunkCRC(t *testing.T) {
+	type report struct {
+		offset    uint64
+		stored    uint32
+		computed  uint32
+		validated bool
+	}
+	lexAll := func(t *testing.T, data []byte, validateCRC bool) ([]report, error) {
+		var reports []report
+		lexer, err := NewLexer(bytes.NewReader(data), &LexerOptions{
+			ValidateCRC: validateCRC,
+			OnChunkCRC: func(offset uint64, stored uint32, computed uint32, validated bool) {
+				reports = append(reports, report{offset, stored, computed, validated})
+			},
+		})
+		assert.Nil(t, err)
+		for {
+			_, _, err := lexer.Next(nil)
+			if errors.Is(err, io.EOF) {
+				return reports, nil
+			}
+			if err != nil {
+				return reports, err
+			}
+		}
+	}
+	for _, includeCRC := range []bool{true, false} {
+		t.Run(fmt.Sprintf("include CRC %v", includeCRC), func(t *testing.T) {
+			data := writeTestFile(t, &WriterOptions{
+				Chunked:     true,
+				ChunkSize:   100,
+				Compression: CompressionLZ4,
+				IncludeCRC:  includeCRC,
+			}, []string{"/a"}, []uint64{1, 2, 3, 4, 5, 6})
+			info, err := readInfo(bytes.NewReader(data), int64(len(data)))
+			assert.Nil(t, err)
+			reports, err := lexAll(t, data, false)
+			assert.Nil(t, err)
+			assert.Equal(t, len(info.ChunkIndexes), len(reports))
+			for i, idx := range info.ChunkIndexes {
+				chunk, err := readChunkAt(bytes.NewReader(data), idx)
+				assert.Nil(t, err)
+				assert.Equal(t, idx.ChunkStartOffset, reports[i].offset)
+				assert.Equal(t, chunk.UncompressedCRC, reports[i].stored)
+				assert.NotZero(t, reports[i].computed)
+				assert.Equal(t, includeCRC, reports[i].validated)
+				if includeCRC {
+					assert.Equal(t, reports[i].stored, reports[i].computed)
+				}
+			}
+		})
+	}
+	t.Run("reports mismatch before failing validation", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{
+			Chunked:     true,
+			Compression: CompressionNone,
+			IncludeCRC:  true,
+		}, []string{"/a"}, []uint64{1, 2, 3})
+		info, err := readInfo(bytes.NewReader(data), int64(len(data)))
+		assert.Nil(t, err)
+		data[info.ChunkIndexes[0].ChunkStartOffset+9+8+8+8] ^= 0xff // uncompressed CRC
+		reports, err := lexAll(t, data, false)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(reports))
+		assert.False(t, reports[0].validated)
+		reports, err = lexAll(t, data, true)
+		assert.Error(t, err)
+		assert.Equal(t, 1, len(reports))
+		assert.False(t, reports[0].validated)
+	})
+}
+
+func TestOnDecompressedChunk(t *testing.T) {
+	data := writeTestFile(t, &WriterOptions{
+		Chunked:     true,
+		ChunkSize:   100,
+		Compression: CompressionZSTD,
+		IncludeCRC:  true,
+	}, []string{"/a"}, []uint64{1, 2, 3, 4, 5, 6})
+	info, err := readInfo(bytes.NewReader(data), int64(len(data)))
+	assert.Nil(t, err)
+	assert.Greater(t, len(info.ChunkIndexes), 1)
+	type chunkData struct {
+		size uint64
+		crc  uint32
+	}
+	var expected []chunkData
+	for _, idx := range info.ChunkIndexes {
+		chunk, err := readChunkAt(bytes.NewReader(data), idx)
+		assert.Nil(t, err)
+		expected = append(expected, chunkData{chunk.UncompressedSize, chunk.UncompressedCRC})
+	}
+	for _, c := range []struct {
+		name string
+		opts LexerOptions
+	}{
+		{"default", LexerOptions{}},
+		{"validate crc", LexerOptions{ValidateCRC: true}},
+		{"streaming crc", LexerOptions{StreamingCRC: true}},
+		{"read ahead", LexerOptions{ReadAheadChunks: 2}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			opts := c.opts
+			var chunks []chunkData
+			messages := 0
+			opts.OnDecompressedChunk = func(data []byte) {
+				chunks = append(chunks, chunkData{uint64(len(data)), crc32.ChecksumIEEE(data)})
+			}
+			lexer, err := NewLexer(bytes.NewReader(data), &opts)
+			assert.Nil(t, err)
+			defer lexer.Close()
+			for {
+				tokenType, _, err := lexer.Next(nil)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				assert.Nil(t, err)
+				if tokenType == TokenMessage {
+					// records are returned after the callback.
+					assert.NotEmpty(t, chunks)
+					messages++
+				}
+			}
+			assert.Equal(t, 6, messages)
+			assert.Equal(t, expected, chunks)
+		})
+	}
+	t.Run("not called for invalid chunks", func(t *testing.T) {
+		corrupt := chunk(t, CompressionZSTD, true, channelInfo(), message())
+		corrupt[9+8+8+8] ^= 0xff // uncompressed CRC
+		valid := chunk(t, CompressionZSTD, true, channelInfo(), message(), message())
+		calls := 0
+		lexer, err := NewLexer(bytes.NewReader(file(header(), corrupt, valid, footer())), &LexerOptions{
+			ValidateCRC:         true,
+			EmitInvalidChunks:   true,
+			OnDecompressedChunk: func(data []byte) { calls++ },
+		})
+		assert.Nil(t, err)
+		for {
+			tokenType, _, err := lexer.Next(nil)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if tokenType != TokenInvalidChunk {
+				assert.Nil(t, err)
+			}
+		}
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestLexerChunkOffsets(t *testing.T) {
+	logTimes := make([]uint64, 40)
+	for i := range logTimes {
+		logTimes[i] = uint64(i)
+	}
+	data := writeTestFile(t, &WriterOptions{
+		Chunked:     true,
+		ChunkSize:   200,
+		Compression: CompressionZSTD,
+	}, []string{"/a", "/b"}, logTimes)
+	info, err := readInfo(bytes.NewReader(data), int64(len(data)))
+	assert.Nil(t, err)
+	type location struct {
+		chunkOffset  uint64
+		recordOffset uint64
+	}
+	expected := make(map[location]bool)
+	for _, idx := range info.ChunkIndexes {
+		for _, offset := range idx.MessageIndexOffsets {
+			messageIndex, err := readMessageIndexAt(bytes.NewReader(data), offset)
+			assert.Nil(t, err)
+			for _, entry := range messageIndex.Records {
+				expected[location{idx.ChunkStartOffset, entry.Offset}] = true
+			}
+		}
+	}
+	assert.Equal(t, len(logTimes), len(expected))
+
+	lexer, err := NewLexer(bytes.NewReader(data), &LexerOptions{})
+	assert.Nil(t, err)
+	actual := make(map[location]bool)
+	for {
+		tokenType, _, err := lexer.Next(nil)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.Nil(t, err)
+		chunkOffset, recordOffset, inChunk := lexer.ChunkOffsets()
+		switch tokenType {
+		case TokenMessage:
+			assert.True(t, inChunk)
+			actual[location{chunkOffset, recordOffset}] = true
+		case TokenHeader, TokenFooter, TokenDataEnd, TokenMessageIndex, TokenChunkIndex, TokenStatistics:
+			assert.False(t, inChunk)
+		}
+	}
+	assert.Equal(t, expected, actual)
+}
+
+func TestStreamingCRC(t *testing.T) {
+	for _, compression := range []CompressionFormat{CompressionZSTD, CompressionLZ4, CompressionSnappy, CompressionNone} {
+		t.Run(fmt.Sprintf("%q", compression), func(t *testing.T) {
+			valid := chunk(t, compression, true, channelInfo(), message(), message())
+			corrupt := chunk(t, compression, true, channelInfo(), message())
+			// corrupt the uncompressed CRC in the chunk header.
+			corrupt[9+8+8+8] ^= 0xff
+			t.Run("validates valid chunks without buffering", func(t *testing.T) {
+				lexer, err := NewLexer(bytes.NewReader(file(header(), valid, valid, footer())), &LexerOptions{
+					StreamingCRC: true,
+				})
+				assert.Nil(t, err)
+				for _, expected := range []TokenType{
+					TokenHeader,
+					TokenChannel,
+					TokenMessage,
+					TokenMessage,
+					TokenChannel,
+					TokenMessage,
+					TokenMessage,
+					TokenFooter,
+				} {
+					tokenType, _, err := lexer.Next(nil)
+					assert.Nil(t, err)
+					assert.Equal(t, expected, tokenType)
+				}
+				assert.Nil(t, lexer.uncompressedChunk)
+			})
+			for _, emitInvalidChunks := range []bool{true, false} {
+				t.Run(fmt.Sprintf("reports mismatches after records, emit invalid %v", emitInvalidChunks), func(t *testing.T) {
+					lexer, err := NewLexer(bytes.NewReader(file(header(), valid, corrupt, footer())), &LexerOptions{
+						StreamingCRC:      true,
+						EmitInvalidChunks: emitInvalidChunks,
+					})
+					assert.Nil(t, err)
+					for _, expected := range []TokenType{
+						TokenHeader,
+						TokenChannel,
+						TokenMessage,
+						TokenMessage,
+						TokenChannel,
+						TokenMessage,
+					} {
+						tokenType, _, err := lexer.Next(nil)
+						assert.Nil(t, err)
+						assert.Equal(t, expected, tokenType)
+					}
+					tokenType, _, err := lexer.Next(nil)
+					assert.ErrorIs(t, err, ErrInvalidChunkCRC)
+					if emitInvalidChunks {
+						assert.Equal(t, TokenInvalidChunk, tokenType)
+					} else {
+						assert.Equal(t, TokenError, tokenType)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestLexerRecoversFromInvalidChunk(t *testing.T) {
+	for _, compression := range []CompressionFormat{CompressionZSTD, CompressionLZ4, CompressionSnappy, CompressionNone} {
+		t.Run(fmt.Sprintf("%q", compression), func(t *testing.T) {
+			valid := chunk(t, compression, true, channelInfo(), message(), message())
+			corrupt := chunk(t, compression, true, channelInfo(), message())
+			corrupt[9+8+8+8] ^= 0xff // uncompressed CRC
+			data := file(header(), valid, corrupt, valid, attachment(), footer())
+			for _, c := range []struct {
+				name string
+				opts LexerOptions
+				// records of the invalid chunk returned before the error.
+				invalid []TokenType
+			}{
+				{"validate crc", LexerOptions{ValidateCRC: true}, nil},
+				{"read ahead", LexerOptions{ValidateCRC: true, ReadAheadChunks: 2}, nil},
+				{"retained buffers", LexerOptions{ValidateCRC: true, RetainChunkBuffers: true}, nil},
+				{"streaming crc", LexerOptions{StreamingCRC: true}, []TokenType{TokenChannel, TokenMessage}},
+			} {
+				t.Run(c.name, func(t *testing.T) {
+					opts := c.opts
+					opts.EmitInvalidChunks = true
+					lexer, err := NewLexer(bytes.NewReader(data), &opts)
+					assert.Nil(t, err)
+					defer lexer.Close()
+					expected := []TokenType{TokenHeader, TokenChannel, TokenMessage, TokenMessage}
+					expected = append(expected, c.invalid...)
+					expected = append(expected, TokenInvalidChunk,
+						TokenChannel, TokenMessage, TokenMessage, TokenAttachment, TokenFooter)
+					var tokens []TokenType
+					for {
+						tokenType, _, err := lexer.Next(nil)
+						if errors.Is(err, io.EOF) {
+							break
+						}
+						if tokenType == TokenInvalidChunk {
+							assert.ErrorIs(t, err, ErrInvalidChunkCRC)
+						} else if !assert.Nil(t, err) {
+							break
+						}
+						tokens = append(tokens, tokenType)
+					}
+					assert.Equal(t, expected, tokens)
+				})
+			}
+		})
+	}
+	t.Run("corrupt records", func(t *testing.T) {
+		corrupt := chunk(t, CompressionNone, true, channelInfo(), message())
+		corrupt[len(corrupt)-1] ^= 0xff
+		valid := chunk(t, CompressionNone, true, channelInfo(), message())
+		lexer, err := NewLexer(bytes.NewReader(file(header(), corrupt, valid, footer())), &LexerOptions{
+			ValidateCRC:       true,
+			EmitInvalidChunks: true,
+		})
+		assert.Nil(t, err)
+		for _, expected := range []TokenType{TokenHeader, TokenInvalidChunk, TokenChannel, TokenMessage, TokenFooter} {
+			tokenType, _, err := lexer.Next(nil)
+			if expected == TokenInvalidChunk {
+				assert.ErrorIs(t, err, ErrInvalidChunkCRC)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, expected, tokenType)
+		}
+		_, _, err = lexer.Next(nil)
+		assert.ErrorIs(t, err, io.EOF)
+	})
+	t.Run("understated uncompressed size", func(t *testing.T) {
+		// the chunk's records extend past its declared uncompressed size.
+		corrupt := chunk(t, CompressionNone, true, channelInfo(), message())
+		binary.LittleEndian.PutUint64(corrupt[9+8+8:], 9)
+		valid := chunk(t, CompressionNone, true, channelInfo())
+		lexer, err := NewLexer(bytes.NewReader(file(header(), corrupt, valid, footer())), &LexerOptions{
+			ValidateCRC:       true,
+			EmitInvalidChunks: true,
+		})
+		assert.Nil(t, err)
+		for _, expected := range []TokenType{TokenHeader, TokenInvalidChunk, TokenChannel, TokenFooter} {
+			tokenType, _, err := lexer.Next(nil)
+			if expected == TokenInvalidChunk {
+				assert.ErrorIs(t, err, ErrInvalidChunkCRC)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, expected, tokenType)
+		}
+	})
+	t.Run("truncated invalid chunk", func(t *testing.T) {
+		corrupt := chunk(t, CompressionNone, true, channelInfo(), message())
+		corrupt[len(corrupt)-1] ^= 0xff
+		data := file(header(), corrupt)
+		lexer, err := NewLexer(bytes.NewReader(data[:len(data)-1]), &LexerOptions{
+			ValidateCRC:       true,
+			EmitInvalidChunks: true,
+		})
+		assert.Nil(t, err)
+		tokenType, _, err := lexer.Next(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, TokenHeader, tokenType)
+		_, _, err = lexer.Next(nil)
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, io.EOF)
+	})
+}
+
+func TestRequireChunkCRC(t *testing.T) {
+	withCRC := chunk(t, CompressionZSTD, true, channelInfo(), message())
+	withoutCRC := chunk(t, CompressionZSTD, false, channelInfo(), message())
+	lexAll := func(data []byte, opts *LexerOptions) error {
+		lexer, err := NewLexer(bytes.NewReader(data), opts)
+		assert.Nil(t, err)
+		for {
+			_, _, err := lexer.Next(nil)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	t.Run("chunks without CRC are skipped by default", func(t *testing.T) {
+		data := file(header(), withCRC, withoutCRC, footer())
+		assert.Nil(t, lexAll(data, &LexerOptions{ValidateCRC: true}))
+		assert.Nil(t, lexAll(data, &LexerOptions{StreamingCRC: true}))
+	})
+	t.Run("chunks without CRC are rejected when required", func(t *testing.T) {
+		data := file(header(), withCRC, withoutCRC, footer())
+		for _, opts := range []*LexerOptions{
+			{RequireChunkCRC: true},
+			{RequireChunkCRC: true, StreamingCRC: true},
+			{RequireChunkCRC: true, OnChunkCRC: func(uint64, uint32, uint32, bool) {}},
+		} {
+			assert.ErrorIs(t, lexAll(data, opts), ErrMissingChunkCRC)
+		}
+		assert.Nil(t, lexAll(file(header(), withCRC, withCRC, footer()), &LexerOptions{RequireChunkCRC: true}))
+	})
+	t.Run("required CRCs are still validated", func(t *testing.T) {
+		corrupt := chunk(t, CompressionZSTD, true, channelInfo(), message())
+		corrupt[9+8+8+8] ^= 0xff
+		err := lexAll(file(header(), corrupt, footer()), &LexerOptions{RequireChunkCRC: true})
+		assert.ErrorIs(t, err, ErrInvalidChunkCRC)
+	})
+}
+
 func TestSkipsUnknownOpcodes(t *testing.T) {
 	unrecognized := make([]byte, 9)
 	unrecognized[0] = 0x99 // zero-length unknown record
@@ -318,6 +1072,7 @@ func TestChunkEmission(t *testing.T) {
 			for _, compression := range []CompressionFormat{
 				CompressionLZ4,
 				CompressionZSTD,
+				CompressionSnappy,
 				CompressionNone,
 			} {
 				t.Run(fmt.Sprintf("chunked %s", compression), func(t *testing.T) {
@@ -406,3 +1161,1098 @@ func BenchmarkLexer(b *testing.B) {
 		}
 	}
 }
+
+func padding(n int) []byte {
+	buf := make([]byte, 9+n)
+	buf[0] = 0x80 // private-range opcode used as padding
+	putUint64(buf[1:], uint64(n))
+	return buf
+}
+
+func TestEmitUnknownRecords(t *testing.T) {
+	unknown := func(opcode OpCode, body string) []byte {
+		buf := make([]byte, 9, 9+len(body))
+		buf[0] = byte(opcode)
+		putUint64(buf[1:], uint64(len(body)))
+		return append(buf, body...)
+	}
+	file := file(
+		header(),
+		unknown(0x90, "future"),
+		chunk(t, CompressionZSTD, true, channelInfo(), unknown(0x91, "in chunk"), message()),
+		padding(4),
+		footer(),
+	)
+	expected := []struct {
+		tokenType TokenType
+		opcode    OpCode
+		data      string
+	}{
+		{TokenHeader, OpHeader, ""},
+		{TokenUnknown, 0x90, "future"},
+		{TokenChannel, OpChannel, ""},
+		{TokenUnknown, 0x91, "in chunk"},
+		{TokenMessage, OpMessage, ""},
+		{TokenUnknown, 0x80, "\x00\x00\x00\x00"},
+		{TokenFooter, OpFooter, ""},
+	}
+	for _, retainChunkBuffers := range []bool{true, false} {
+		t.Run(fmt.Sprintf("retain chunk buffers %v", retainChunkBuffers), func(t *testing.T) {
+			lexer, err := NewLexer(bytes.NewReader(file), &LexerOptions{
+				EmitUnknownRecords: true,
+				RetainChunkBuffers: retainChunkBuffers,
+			})
+			assert.Nil(t, err)
+			for i, e := range expected {
+				tokenType, data, err := lexer.Next(nil)
+				assert.Nil(t, err)
+				assert.Equal(t, e.tokenType, tokenType, fmt.Sprintf("mismatch element %d", i))
+				assert.Equal(t, e.opcode, lexer.LastOpcode())
+				if e.tokenType == TokenUnknown {
+					assert.Equal(t, e.data, string(data))
+				}
+			}
+			_, _, err = lexer.Next(nil)
+			assert.ErrorIs(t, err, io.EOF)
+		})
+	}
+	t.Run("skipped unknown records", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(file), &LexerOptions{EmitUnknownRecords: true})
+		assert.Nil(t, err)
+		for i, e := range expected {
+			tokenType, err := lexer.SkipRecord()
+			assert.Nil(t, err)
+			assert.Equal(t, e.tokenType, tokenType, fmt.Sprintf("mismatch element %d", i))
+			assert.Equal(t, e.opcode, lexer.LastOpcode())
+		}
+	})
+}
+
+func TestSkipsPaddingRecords(t *testing.T) {
+	t.Run("top-level padding", func(t *testing.T) {
+		file := file(
+			header(),
+			padding(0),
+			channelInfo(),
+			padding(16),
+			message(),
+			padding(1024),
+			message(),
+			footer(),
+		)
+		lexer, err := NewLexer(bytes.NewReader(file))
+		assert.Nil(t, err)
+		expected := []TokenType{TokenHeader, TokenChannel, TokenMessage, TokenMessage, TokenFooter}
+		for i, expectedTokenType := range expected {
+			tokenType, _, err := lexer.Next(nil)
+			assert.Nil(t, err)
+			assert.Equal(t, expectedTokenType, tokenType, fmt.Sprintf("mismatch element %d", i))
+		}
+		_, _, err = lexer.Next(nil)
+		assert.ErrorIs(t, err, io.EOF)
+	})
+	for _, validateCRC := range []bool{true, false} {
+		t.Run(fmt.Sprintf("padding within chunks, crc validation %v", validateCRC), func(t *testing.T) {
+			file := file(
+				header(),
+				padding(8),
+				chunk(t, CompressionZSTD, true, channelInfo(), padding(32), message(), padding(0), message()),
+				padding(8),
+				footer(),
+			)
+			lexer, err := NewLexer(bytes.NewReader(file), &LexerOptions{ValidateCRC: validateCRC})
+			assert.Nil(t, err)
+			expected := []TokenType{TokenHeader, TokenChannel, TokenMessage, TokenMessage, TokenFooter}
+			for i, expectedTokenType := range expected {
+				tokenType, _, err := lexer.Next(nil)
+				assert.Nil(t, err)
+				assert.Equal(t, expectedTokenType, tokenType, fmt.Sprintf("mismatch element %d", i))
+			}
+			_, _, err = lexer.Next(nil)
+			assert.ErrorIs(t, err, io.EOF)
+		})
+	}
+	t.Run("padding with emitted chunks", func(t *testing.T) {
+		file := file(
+			header(),
+			padding(8),
+			chunk(t, CompressionLZ4, true, channelInfo(), padding(32), message()),
+			padding(8),
+			footer(),
+		)
+		lexer, err := NewLexer(bytes.NewReader(file), &LexerOptions{EmitChunks: true})
+		assert.Nil(t, err)
+		expected := []TokenType{TokenHeader, TokenChunk, TokenFooter}
+		for i, expectedTokenType := range expected {
+			tokenType, _, err := lexer.Next(nil)
+			assert.Nil(t, err)
+			assert.Equal(t, expectedTokenType, tokenType, fmt.Sprintf("mismatch element %d", i))
+		}
+	})
+	t.Run("truncated padding", func(t *testing.T) {
+		file := flatten(Magic, header(), padding(16)[:12])
+		lexer, err := NewLexer(bytes.NewReader(file))
+		assert.Nil(t, err)
+		_, _, err = lexer.Next(nil)
+		assert.Nil(t, err)
+		_, _, err = lexer.Next(nil)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+	t.Run("truncated padding in chunk", func(t *testing.T) {
+		records := flatten(channelInfo(), padding(16))
+		file := flatten(Magic, header(), chunk(t, CompressionNone, false, records[:len(records)-4]), footer())
+		lexer, err := NewLexer(bytes.NewReader(file))
+		assert.Nil(t, err)
+		tokenType, _, err := lexer.Next(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, TokenHeader, tokenType)
+		tokenType, _, err = lexer.Next(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, TokenChannel, tokenType)
+		_, _, err = lexer.Next(nil)
+		assert.ErrorIs(t, err, ErrTruncatedChunk)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
+
+func TestLexerDeadline(t *testing.T) {
+	t.Run("deadline already passed", func(t *testing.T) {
+		_, err := NewLexer(bytes.NewReader(file(header(), footer())), &LexerOptions{
+			Deadline: time.Now().Add(-time.Second),
+		})
+		assert.ErrorIs(t, err, ErrDeadlineExceeded)
+	})
+	t.Run("interrupts blocked reads", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		assert.Nil(t, err)
+		defer r.Close()
+		defer w.Close()
+		if err := r.SetReadDeadline(time.Time{}); err != nil {
+			t.Skipf("pipe does not support deadlines: %s", err)
+		}
+		// write the magic and a header, then stall.
+		go func() {
+			_, _ = w.Write(file(header())[:len(Magic)+len(header())])
+		}()
+		lexer, err := NewLexer(r, &LexerOptions{Deadline: time.Now().Add(100 * time.Millisecond)})
+		assert.Nil(t, err)
+		tokenType, _, err := lexer.Next(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, TokenHeader, tokenType)
+		_, _, err = lexer.Next(nil)
+		assert.ErrorIs(t, err, ErrDeadlineExceeded)
+	})
+	t.Run("checked between records", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(file(header(), message(), footer())), &LexerOptions{
+			Deadline: time.Now().Add(50 * time.Millisecond),
+		})
+		assert.Nil(t, err)
+		_, _, err = lexer.Next(nil)
+		assert.Nil(t, err)
+		time.Sleep(60 * time.Millisecond)
+		_, _, err = lexer.Next(nil)
+		assert.ErrorIs(t, err, ErrDeadlineExceeded)
+	})
+	t.Run("cleared on close and reset", func(t *testing.T) {
+		deadline := time.Now().Add(time.Minute)
+		r := &deadlineReader{Reader: bytes.NewReader(file(header(), footer()))}
+		lexer, err := NewLexer(r, &LexerOptions{Deadline: deadline})
+		assert.Nil(t, err)
+		assert.Equal(t, []time.Time{deadline}, r.deadlines)
+		lexer.Close()
+		lexer.Close()
+		assert.Equal(t, []time.Time{deadline, {}}, r.deadlines)
+
+		r = &deadlineReader{Reader: bytes.NewReader(file(header(), footer()))}
+		assert.Nil(t, lexer.Reset(r, &LexerOptions{Deadline: deadline}))
+		assert.Nil(t, lexer.Reset(bytes.NewReader(file(header(), footer()))))
+		assert.Equal(t, []time.Time{deadline, {}}, r.deadlines)
+	})
+}
+
+// deadlineReader records the read deadlines set on it.
+type deadlineReader struct {
+	*bytes.Reader
+	deadlines []time.Time
+}
+
+func (d *deadlineReader) SetReadDeadline(deadline time.Time) error {
+	d.deadlines = append(d.deadlines, deadline)
+	return nil
+}
+
+func TestLZ4ContentChecksum(t *testing.T) {
+	for _, validateCRC := range []bool{true, false} {
+		t.Run(fmt.Sprintf("crc validation %v", validateCRC), func(t *testing.T) {
+			lz4Chunk := chunk(t, CompressionLZ4, true, channelInfo(), message(), message())
+			t.Run("valid content checksum", func(t *testing.T) {
+				lexer, err := NewLexer(bytes.NewReader(file(header(), lz4Chunk, footer())), &LexerOptions{
+					ValidateCRC: validateCRC,
+				})
+				assert.Nil(t, err)
+				for _, expected := range []TokenType{TokenHeader, TokenChannel, TokenMessage, TokenMessage, TokenFooter} {
+					tokenType, _, err := lexer.Next(nil)
+					assert.Nil(t, err)
+					assert.Equal(t, expected, tokenType)
+				}
+			})
+			t.Run("invalid content checksum", func(t *testing.T) {
+				corrupt := append([]byte{}, lz4Chunk...)
+				// the lz4 frame, and so the chunk record, ends with the
+				// content checksum.
+				corrupt[len(corrupt)-1] ^= 0xff
+				lexer, err := NewLexer(bytes.NewReader(file(header(), corrupt, footer())), &LexerOptions{
+					ValidateCRC: validateCRC,
+				})
+				assert.Nil(t, err)
+				for {
+					tokenType, _, err := lexer.Next(nil)
+					if err != nil {
+						assert.ErrorIs(t, err, ErrInvalidLZ4Checksum)
+						break
+					}
+					assert.NotEqual(t, TokenFooter, tokenType)
+				}
+			})
+		})
+	}
+}
+
+func TestLZ4LegacyFrame(t *testing.T) {
+	records := flatten(channelInfo(), message(), message())
+	// records compressed by "lz4 -l", which writes the legacy frame format:
+	// the legacy magic number followed by size-prefixed blocks, with no frame
+	// descriptor, end mark or checksums.
+	legacy := []byte{
+		0x02, 0x21, 0x4c, 0x18, 0x14, 0x00, 0x00, 0x00, 0x23, 0x04, 0x00, 0x01,
+		0x00, 0x13, 0x05, 0x08, 0x00, 0xa0, 0x00, 0x05, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	legacyChunk := chunkRecord(t, CompressionLZ4, true, records, legacy)
+	for _, validateCRC := range []bool{true, false} {
+		t.Run(fmt.Sprintf("crc validation %v", validateCRC), func(t *testing.T) {
+			// the standard frame after the legacy one is read with the same
+			// decoder.
+			lexer, err := NewLexer(bytes.NewReader(file(
+				header(),
+				legacyChunk,
+				chunk(t, CompressionLZ4, true, message()),
+				footer(),
+			)), &LexerOptions{
+				ValidateCRC: validateCRC,
+			})
+			assert.Nil(t, err)
+			for _, expected := range []TokenType{
+				TokenHeader,
+				TokenChannel,
+				TokenMessage,
+				TokenMessage,
+				TokenMessage,
+				TokenFooter,
+			} {
+				tokenType, _, err := lexer.Next(nil)
+				assert.Nil(t, err)
+				assert.Equal(t, expected, tokenType)
+			}
+		})
+	}
+	t.Run("unexpected bytes after chunk", func(t *testing.T) {
+		understated := append([]byte{}, legacyChunk...)
+		binary.LittleEndian.PutUint64(understated[25:], uint64(len(records)-1))
+		lexer, err := NewLexer(bytes.NewReader(file(header(), understated, footer())), &LexerOptions{
+			ValidateCRC: true,
+		})
+		assert.Nil(t, err)
+		_, _, err = lexer.Next(nil)
+		assert.Nil(t, err)
+		_, _, err = lexer.Next(nil)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "unexpected bytes after chunk")
+	})
+}
+
+func TestChunkCompressionMismatch(t *testing.T) {
+	records := [][]byte{channelInfo(), message(), message()}
+	data := flatten(records...)
+	mislabeled := func(declared, actual CompressionFormat) []byte {
+		return file(header(), chunkRecord(t, declared, true, data, compress(t, actual, data)), footer())
+	}
+	expected := []TokenType{TokenHeader, TokenChannel, TokenMessage, TokenMessage, TokenFooter}
+	t.Run("mislabeled chunks fail to decode by default", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(mislabeled(CompressionZSTD, CompressionLZ4)), &LexerOptions{})
+		assert.Nil(t, err)
+		_, _, err = lexer.Next(nil)
+		assert.Nil(t, err)
+		_, _, err = lexer.Next(nil)
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrCompressionMismatch)
+	})
+	t.Run("validation reports mismatches", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(mislabeled(CompressionZSTD, CompressionLZ4)), &LexerOptions{
+			ValidateCompression: true,
+		})
+		assert.Nil(t, err)
+		_, _, err = lexer.Next(nil)
+		assert.Nil(t, err)
+		_, _, err = lexer.Next(nil)
+		assert.ErrorIs(t, err, ErrCompressionMismatch)
+		assert.Contains(t, err.Error(), "chunk declares zstd but data is lz4")
+	})
+	formats := []CompressionFormat{CompressionNone, CompressionZSTD, CompressionLZ4, CompressionSnappy}
+	t.Run("validation accepts correctly labeled chunks", func(t *testing.T) {
+		for _, compression := range formats {
+			lexer, err := NewLexer(bytes.NewReader(mislabeled(compression, compression)), &LexerOptions{
+				ValidateCompression: true,
+			})
+			assert.Nil(t, err)
+			for _, tokenType := range expected {
+				actual, _, err := lexer.Next(nil)
+				assert.Nil(t, err)
+				assert.Equal(t, tokenType, actual)
+			}
+		}
+	})
+	t.Run("auto-detection decodes with the detected format", func(t *testing.T) {
+		for _, declared := range formats {
+			for _, actual := range formats {
+				for _, validateCRC := range []bool{true, false} {
+					lexer, err := NewLexer(bytes.NewReader(mislabeled(declared, actual)), &LexerOptions{
+						AutoDetectCompression: true,
+						ValidateCRC:           validateCRC,
+					})
+					assert.Nil(t, err)
+					for _, tokenType := range expected {
+						token, _, err := lexer.Next(nil)
+						assert.Nil(t, err, "declared %q, actual %q", declared, actual)
+						assert.Equal(t, tokenType, token)
+					}
+				}
+			}
+		}
+	})
+}
+
+func TestSnappyUnexpectedBytes(t *testing.T) {
+	snappyChunk := chunk(t, CompressionSnappy, false, channelInfo(), message(), message())
+	// understate the uncompressed size so that decompressed bytes remain
+	// after the records are read.
+	uncompressedSize := binary.LittleEndian.Uint64(snappyChunk[25:])
+	binary.LittleEndian.PutUint64(snappyChunk[25:], uncompressedSize-1)
+	lexer, err := NewLexer(bytes.NewReader(file(header(), snappyChunk, footer())), &LexerOptions{
+		ValidateCRC: true,
+	})
+	assert.Nil(t, err)
+	tokenType, _, err := lexer.Next(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, TokenHeader, tokenType)
+	_, _, err = lexer.Next(nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unexpected bytes after chunk")
+}
+
+func TestZSTDMultiFrameChunks(t *testing.T) {
+	records := [][]byte{channelInfo(), message(), message(), message()}
+	encoder, err := zstd.NewWriter(nil)
+	assert.Nil(t, err)
+	defer encoder.Close()
+	// compress each record as its own frame, as some streaming encoders do.
+	compressed := []byte{}
+	for _, record := range records {
+		compressed = encoder.EncodeAll(record, compressed)
+	}
+	multiFrameChunk := chunkRecord(t, CompressionZSTD, true, flatten(records...), compressed)
+	for _, validateCRC := range []bool{true, false} {
+		t.Run(fmt.Sprintf("crc validation %v", validateCRC), func(t *testing.T) {
+			lexer, err := NewLexer(bytes.NewReader(file(header(), multiFrameChunk, footer())), &LexerOptions{
+				ValidateCRC: validateCRC,
+			})
+			assert.Nil(t, err)
+			for _, expected := range []TokenType{
+				TokenHeader,
+				TokenChannel,
+				TokenMessage,
+				TokenMessage,
+				TokenMessage,
+				TokenFooter,
+			} {
+				tokenType, _, err := lexer.Next(nil)
+				assert.Nil(t, err)
+				assert.Equal(t, expected, tokenType)
+			}
+		})
+	}
+	t.Run("indexed decompression", func(t *testing.T) {
+		chunk, err := ParseChunk(multiFrameChunk[9:])
+		assert.Nil(t, err)
+		decompressor := &chunkDecompressor{}
+		defer decompressor.close()
+		data, err := decompressor.decompress(chunk)
+		assert.Nil(t, err)
+		assert.Equal(t, flatten(records...), data)
+	})
+}
+
+func TestLexerReset(t *testing.T) {
+	zstdFile := file(header(), chunk(t, CompressionZSTD, true, channelInfo(), message(), message()), footer())
+	lz4File := file(header(), chunk(t, CompressionLZ4, true, channelInfo(), message()), footer())
+	expectTokens := func(t *testing.T, lexer *Lexer, expected ...TokenType) {
+		for _, expectedTokenType := range expected {
+			tokenType, _, err := lexer.Next(nil)
+			assert.Nil(t, err)
+			assert.Equal(t, expectedTokenType, tokenType)
+		}
+		_, _, err := lexer.Next(nil)
+		assert.ErrorIs(t, err, io.EOF)
+	}
+	lexer, err := NewLexer(bytes.NewReader(zstdFile), &LexerOptions{ValidateCRC: true})
+	assert.Nil(t, err)
+	expectTokens(t, lexer, TokenHeader, TokenChannel, TokenMessage, TokenMessage, TokenFooter)
+	zstdDecoder := lexer.decoders.zstd
+	uncompressedChunk := lexer.uncompressedChunk
+
+	t.Run("reuses decoders and buffers", func(t *testing.T) {
+		assert.Nil(t, lexer.Reset(bytes.NewReader(lz4File), &LexerOptions{ValidateCRC: true}))
+		expectTokens(t, lexer, TokenHeader, TokenChannel, TokenMessage, TokenFooter)
+		assert.Nil(t, lexer.Reset(bytes.NewReader(zstdFile)))
+		expectTokens(t, lexer, TokenHeader, TokenChannel, TokenMessage, TokenMessage, TokenFooter)
+		assert.Same(t, zstdDecoder, lexer.decoders.zstd)
+		assert.Equal(t, &uncompressedChunk[0], &lexer.uncompressedChunk[0])
+	})
+	t.Run("resets mid-chunk", func(t *testing.T) {
+		assert.Nil(t, lexer.Reset(bytes.NewReader(zstdFile)))
+		for _, expected := range []TokenType{TokenHeader, TokenChannel} {
+			tokenType, _, err := lexer.Next(nil)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, tokenType)
+		}
+		assert.Nil(t, lexer.Reset(bytes.NewReader(lz4File)))
+		expectTokens(t, lexer, TokenHeader, TokenChannel, TokenMessage, TokenFooter)
+	})
+	t.Run("validates magic", func(t *testing.T) {
+		err := lexer.Reset(bytes.NewReader([]byte("not an mcap file")))
+		assert.ErrorIs(t, err, ErrBadMagic)
+		assert.Nil(t, lexer.Reset(bytes.NewReader(zstdFile[len(Magic):]), &LexerOptions{SkipMagic: true}))
+		expectTokens(t, lexer, TokenHeader, TokenChannel, TokenMessage, TokenMessage, TokenFooter)
+	})
+}
+
+func TestDetectOuterCompression(t *testing.T) {
+	data := writeTestFile(t, &WriterOptions{Chunked: true, ChunkSize: 64, Compression: CompressionLZ4}, []string{"/a", "/b"}, []uint64{1, 2, 3, 4, 5})
+	compressors := map[string]func(io.Writer) (io.WriteCloser, error){
+		"gzip": func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+		"zstd": func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w) },
+		"lz4":  func(w io.Writer) (io.WriteCloser, error) { return lz4.NewWriter(w), nil },
+	}
+	lex := func(t *testing.T, input []byte, opts *LexerOptions) ([]TokenType, error) {
+		lexer, err := NewLexer(bytes.NewReader(input), opts)
+		if err != nil {
+			return nil, err
+		}
+		var tokens []TokenType
+		for {
+			tokenType, _, err := lexer.Next(nil)
+			if errors.Is(err, io.EOF) {
+				return tokens, nil
+			}
+			if err != nil {
+				return tokens, err
+			}
+			tokens = append(tokens, tokenType)
+		}
+	}
+	expected, err := lex(t, data, &LexerOptions{})
+	assert.Nil(t, err)
+	for name, compress := range compressors {
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			w, err := compress(buf)
+			assert.Nil(t, err)
+			_, err = w.Write(data)
+			assert.Nil(t, err)
+			assert.Nil(t, w.Close())
+			tokens, err := lex(t, buf.Bytes(), &LexerOptions{DetectOuterCompression: true, ValidateCRC: true})
+			assert.Nil(t, err)
+			assert.Equal(t, expected, tokens)
+
+			_, err = lex(t, buf.Bytes(), &LexerOptions{})
+			assert.ErrorIs(t, err, ErrBadMagic)
+		})
+	}
+	t.Run("uncompressed input", func(t *testing.T) {
+		tokens, err := lex(t, data, &LexerOptions{DetectOuterCompression: true})
+		assert.Nil(t, err)
+		assert.Equal(t, expected, tokens)
+	})
+	t.Run("short input", func(t *testing.T) {
+		_, err := lex(t, Magic[:2], &LexerOptions{DetectOuterCompression: true})
+		assert.ErrorIs(t, err, ErrBadMagic)
+	})
+	t.Run("close releases the zstd decoder", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w, err := zstd.NewWriter(buf)
+		assert.Nil(t, err)
+		_, err = w.Write(data)
+		assert.Nil(t, err)
+		assert.Nil(t, w.Close())
+		lexer, err := NewLexer(bytes.NewReader(buf.Bytes()), &LexerOptions{DetectOuterCompression: true})
+		assert.Nil(t, err)
+		decoder := lexer.outerZSTD
+		assert.NotNil(t, decoder)
+		assert.Nil(t, lexer.Reset(bytes.NewReader(data), &LexerOptions{DetectOuterCompression: true}))
+		assert.Nil(t, lexer.outerZSTD)
+		_, err = decoder.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, zstd.ErrDecoderClosed)
+
+		assert.Nil(t, lexer.Reset(bytes.NewReader(buf.Bytes()), &LexerOptions{DetectOuterCompression: true}))
+		decoder = lexer.outerZSTD
+		lexer.Close()
+		lexer.Close()
+		_, err = decoder.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, zstd.ErrDecoderClosed)
+	})
+}
+
+func TestLexerPeek(t *testing.T) {
+	for _, validateCRC := range []bool{true, false} {
+		t.Run(fmt.Sprintf("crc validation %v", validateCRC), func(t *testing.T) {
+			lexer, err := NewLexer(bytes.NewReader(file(
+				header(),
+				chunk(t, CompressionZSTD, true, channelInfo(), message(), padding(8)),
+				padding(4),
+				chunk(t, CompressionLZ4, true, message()),
+				attachment(),
+				footer(),
+			)), &LexerOptions{ValidateCRC: validateCRC})
+			assert.Nil(t, err)
+			for i, expected := range []TokenType{
+				TokenHeader,
+				TokenChannel,
+				TokenMessage,
+				TokenMessage,
+				TokenAttachment,
+				TokenFooter,
+			} {
+				// peek a varying number of times before each read.
+				for j := 0; j < i%3; j++ {
+					tokenType, err := lexer.Peek()
+					assert.Nil(t, err)
+					assert.Equal(t, expected, tokenType)
+				}
+				tokenType, _, err := lexer.Next(nil)
+				assert.Nil(t, err)
+				assert.Equal(t, expected, tokenType)
+			}
+			_, err = lexer.Peek()
+			assert.ErrorIs(t, err, io.EOF)
+			_, _, err = lexer.Next(nil)
+			assert.ErrorIs(t, err, io.EOF)
+		})
+	}
+	t.Run("next reads the peeked record", func(t *testing.T) {
+		msg := make([]byte, 9+5)
+		msg[0] = byte(OpMessage)
+		binary.LittleEndian.PutUint64(msg[1:], 5)
+		copy(msg[9:], "hello")
+		lexer, err := NewLexer(bytes.NewReader(file(
+			header(),
+			chunk(t, CompressionZSTD, true, msg),
+			footer(),
+		)))
+		assert.Nil(t, err)
+		_, _, err = lexer.Next(nil)
+		assert.Nil(t, err)
+		tokenType, err := lexer.Peek()
+		assert.Nil(t, err)
+		assert.Equal(t, TokenMessage, tokenType)
+		tokenType, record, err := lexer.Next(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, TokenMessage, tokenType)
+		assert.Equal(t, msg[9:], record)
+	})
+}
+
+func TestLexerChunkHeaders(t *testing.T) {
+	logTimes := make([]uint64, 200)
+	for i := range logTimes {
+		logTimes[i] = uint64(i * 10)
+	}
+	data := writeTestFile(t, &WriterOptions{
+		Chunked:     true,
+		ChunkSize:   512,
+		Compression: CompressionZSTD,
+	}, []string{"/a"}, logTimes)
+	reader, err := NewReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	info, err := reader.Info()
+	assert.Nil(t, err)
+	assert.Greater(t, len(info.ChunkIndexes), 1)
+
+	t.Run("builds a time index without decompressing", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(data), &LexerOptions{EmitChunks: true})
+		assert.Nil(t, err)
+		var chunks []*Chunk
+		for {
+			tokenType, err := lexer.Peek()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			assert.Nil(t, err)
+			if tokenType == TokenChunk {
+				chunk, err := lexer.PeekChunkHeader()
+				assert.Nil(t, err)
+				chunks = append(chunks, chunk)
+			}
+			skipped, err := lexer.SkipRecord()
+			assert.Nil(t, err)
+			assert.Equal(t, tokenType, skipped)
+		}
+		assert.Equal(t, len(info.ChunkIndexes), len(chunks))
+		for i, idx := range info.ChunkIndexes {
+			assert.Equal(t, idx.MessageStartTime, chunks[i].MessageStartTime)
+			assert.Equal(t, idx.MessageEndTime, chunks[i].MessageEndTime)
+			assert.Equal(t, idx.UncompressedSize, chunks[i].UncompressedSize)
+			assert.Equal(t, string(idx.Compression), chunks[i].Compression)
+			assert.Nil(t, chunks[i].Records)
+		}
+	})
+	t.Run("next returns the whole chunk after its header is peeked", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(data), &LexerOptions{EmitChunks: true})
+		assert.Nil(t, err)
+		_, err = lexer.PeekChunkHeader()
+		assert.Error(t, err)
+		for {
+			tokenType, err := lexer.Peek()
+			assert.Nil(t, err)
+			if tokenType == TokenChunk {
+				break
+			}
+			_, err = lexer.SkipRecord()
+			assert.Nil(t, err)
+		}
+		header, err := lexer.PeekChunkHeader()
+		assert.Nil(t, err)
+		tokenType, record, err := lexer.Next(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, TokenChunk, tokenType)
+		chunk, err := ParseChunk(record)
+		assert.Nil(t, err)
+		assert.Equal(t, header.MessageStartTime, chunk.MessageStartTime)
+		assert.Equal(t, header.MessageEndTime, chunk.MessageEndTime)
+		decompressor := &chunkDecompressor{}
+		defer decompressor.close()
+		_, err = decompressor.decompress(chunk)
+		assert.Nil(t, err)
+	})
+}
+
+func TestOnChunkBoundary(t *testing.T) {
+	logTimes := make([]uint64, 100)
+	for i := range logTimes {
+		logTimes[i] = uint64(i * 10)
+	}
+	data := writeTestFile(t, &WriterOptions{
+		Chunked:     true,
+		ChunkSize:   256,
+		Compression: CompressionLZ4,
+		IncludeCRC:  true,
+	}, []string{"/a"}, logTimes)
+	reader, err := NewReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	info, err := reader.Info()
+	assert.Nil(t, err)
+	assert.Greater(t, len(info.ChunkIndexes), 1)
+
+	var chunks []ChunkInfo
+	var messages int
+	lexer, err := NewLexer(bytes.NewReader(data), &LexerOptions{
+		OnChunkBoundary: func(info ChunkInfo) {
+			chunks = append(chunks, info)
+		},
+	})
+	assert.Nil(t, err)
+	for {
+		tokenType, record, err := lexer.Next(nil)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.Nil(t, err)
+		if tokenType == TokenMessage {
+			message, err := ParseMessage(record)
+			assert.Nil(t, err)
+			current := chunks[len(chunks)-1]
+			assert.GreaterOrEqual(t, message.LogTime, current.MessageStartTime)
+			assert.LessOrEqual(t, message.LogTime, current.MessageEndTime)
+			messages++
+		}
+	}
+	assert.Equal(t, len(logTimes), messages)
+	assert.Equal(t, len(info.ChunkIndexes), len(chunks))
+	for i, idx := range info.ChunkIndexes {
+		assert.Equal(t, idx.MessageStartTime, chunks[i].MessageStartTime)
+		assert.Equal(t, idx.MessageEndTime, chunks[i].MessageEndTime)
+		assert.Equal(t, idx.UncompressedSize, chunks[i].UncompressedSize)
+		assert.NotZero(t, chunks[i].UncompressedCRC)
+		assert.Equal(t, CompressionLZ4, chunks[i].Compression)
+	}
+}
+
+func TestLexerStream(t *testing.T) {
+	input := file(
+		header(),
+		chunk(t, CompressionZSTD, true, channelInfo(), message(), message()),
+		attachment(),
+		footer(),
+	)
+	t.Run("streams owned records", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(input))
+		assert.Nil(t, err)
+		out := make(chan Record)
+		errs := make(chan error, 1)
+		go func() {
+			errs <- lexer.Stream(context.Background(), out)
+		}()
+		tokenTypes := []TokenType{}
+		for record := range out {
+			tokenTypes = append(tokenTypes, record.TokenType)
+		}
+		assert.Nil(t, <-errs)
+		assert.Equal(t, []TokenType{
+			TokenHeader, TokenChannel, TokenMessage, TokenMessage, TokenAttachment, TokenFooter,
+		}, tokenTypes)
+	})
+	t.Run("records remain valid after receipt", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{Chunked: true, Compression: CompressionLZ4}, []string{"/a"}, []uint64{1, 2, 3})
+		lexer, err := NewLexer(bytes.NewReader(data))
+		assert.Nil(t, err)
+		out := make(chan Record, 100)
+		assert.Nil(t, lexer.Stream(context.Background(), out))
+		var payloads [][]byte
+		for record := range out {
+			if record.TokenType == TokenMessage {
+				message, err := ParseMessage(record.Data)
+				assert.Nil(t, err)
+				payloads = append(payloads, message.Data)
+			}
+		}
+		assert.Equal(t, [][]byte{{0}, {1}, {2}}, payloads)
+	})
+	t.Run("stops on cancellation", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(input))
+		assert.Nil(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		out := make(chan Record, 1)
+		errs := make(chan error, 1)
+		go func() {
+			errs <- lexer.Stream(ctx, out)
+		}()
+		record := <-out
+		assert.Equal(t, TokenHeader, record.TokenType)
+		cancel()
+		assert.ErrorIs(t, <-errs, context.Canceled)
+		// the channel is closed once any buffered record is drained.
+		for range out {
+		}
+	})
+	t.Run("returns lexer errors", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(input), &LexerOptions{MaxRecordSize: 1})
+		assert.Nil(t, err)
+		out := make(chan Record, 10)
+		assert.ErrorIs(t, lexer.Stream(context.Background(), out), ErrRecordTooLarge)
+		// the channel is closed after the records read before the error.
+		for range out {
+		}
+	})
+}
+
+func TestLexerAll(t *testing.T) {
+	c := chunk(t, CompressionZSTD, true, channelInfo(), message(), message())
+	valid := file(header(), c, attachment(), c, footer())
+	for _, retain := range []bool{true, false} {
+		t.Run(fmt.Sprintf("retain chunk buffers %v", retain), func(t *testing.T) {
+			lexer, err := NewLexer(bytes.NewReader(valid), &LexerOptions{RetainChunkBuffers: retain})
+			assert.Nil(t, err)
+			var tokens []TokenType
+			lexer.All(make([]byte, 4))(func(tokenType TokenType, _ []byte) bool {
+				tokens = append(tokens, tokenType)
+				return true
+			})
+			assert.Nil(t, lexer.Err())
+			assert.Equal(t, []TokenType{
+				TokenHeader,
+				TokenChannel, TokenMessage, TokenMessage,
+				TokenAttachment,
+				TokenChannel, TokenMessage, TokenMessage,
+				TokenFooter,
+			}, tokens)
+		})
+	}
+	t.Run("stops when yield returns false", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(valid), &LexerOptions{})
+		assert.Nil(t, err)
+		calls := 0
+		lexer.All(nil)(func(TokenType, []byte) bool {
+			calls++
+			return calls < 2
+		})
+		assert.Equal(t, 2, calls)
+		assert.Nil(t, lexer.Err())
+		tokenType, _, err := lexer.Next(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, TokenMessage, tokenType)
+	})
+	t.Run("reports errors", func(t *testing.T) {
+		corrupt := chunk(t, CompressionNone, true, channelInfo(), message())
+		corrupt[len(corrupt)-1] ^= 0xff
+		lexer, err := NewLexer(bytes.NewReader(file(header(), corrupt, footer())), &LexerOptions{
+			ValidateCRC:       true,
+			EmitInvalidChunks: true,
+		})
+		assert.Nil(t, err)
+		var tokens []TokenType
+		lexer.All(nil)(func(tokenType TokenType, _ []byte) bool {
+			tokens = append(tokens, tokenType)
+			return true
+		})
+		assert.Equal(t, []TokenType{TokenHeader}, tokens)
+		assert.ErrorIs(t, lexer.Err(), ErrInvalidChunkCRC)
+	})
+}
+
+var errFlaky = errors.New("flaky read")
+
+// flakyReader returns short reads from r, failing every third read after
+// returning some data and every fifth read without returning any.
+type flakyReader struct {
+	r     io.Reader
+	calls int
+}
+
+func (f *flakyReader) Read(p []byte) (int, error) {
+	f.calls++
+	if f.calls%5 == 0 {
+		return 0, errFlaky
+	}
+	if len(p) > 7 {
+		p = p[:7]
+	}
+	n, err := f.r.Read(p)
+	if err == nil && f.calls%3 == 0 {
+		return n, errFlaky
+	}
+	return n, err
+}
+
+func TestRetryPolicy(t *testing.T) {
+	data := writeTestFile(t, &WriterOptions{Chunked: true, ChunkSize: 64, Compression: CompressionZSTD}, []string{"/a", "/b"}, []uint64{1, 2, 3, 4, 5})
+	lex := func(r io.Reader, opts *LexerOptions) ([][]byte, error) {
+		lexer, err := NewLexer(r, opts)
+		if err != nil {
+			return nil, err
+		}
+		var records [][]byte
+		for {
+			_, record, err := lexer.Next(nil)
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+			if err != nil {
+				return records, err
+			}
+			records = append(records, record)
+		}
+	}
+	expected, err := lex(bytes.NewReader(data), &LexerOptions{})
+	assert.Nil(t, err)
+	isTransient := func(err error) bool { return errors.Is(err, errFlaky) }
+	for _, validateCRC := range []bool{true, false} {
+		t.Run(fmt.Sprintf("resumes interrupted reads, validate crc %v", validateCRC), func(t *testing.T) {
+			records, err := lex(&flakyReader{r: bytes.NewReader(data)}, &LexerOptions{
+				ValidateCRC: validateCRC,
+				RetryPolicy: &RetryPolicy{MaxRetries: 1, IsTransient: isTransient},
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, expected, records)
+		})
+	}
+	t.Run("returns permanent errors", func(t *testing.T) {
+		_, err := lex(&flakyReader{r: bytes.NewReader(data)}, &LexerOptions{
+			RetryPolicy: &RetryPolicy{MaxRetries: 1, IsTransient: func(error) bool { return false }},
+		})
+		assert.ErrorIs(t, err, errFlaky)
+	})
+	t.Run("gives up after max retries", func(t *testing.T) {
+		calls := 0
+		failing := readerFunc(func(p []byte) (int, error) {
+			calls++
+			return 0, errFlaky
+		})
+		_, err := lex(failing, &LexerOptions{
+			RetryPolicy: &RetryPolicy{MaxRetries: 3, IsTransient: isTransient},
+		})
+		assert.ErrorIs(t, err, ErrBadMagic)
+		assert.Equal(t, 4, calls)
+	})
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestLexerSkip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{Chunked: true, Compression: CompressionZSTD})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	_, err = w.WriteChannel(&Channel{ID: 1, Topic: "/a"})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: 1}))
+	assert.Nil(t, w.WriteAttachment(&Attachment{Name: "big", Data: make([]byte, 10000)}))
+	assert.Nil(t, w.WriteMetadata(&Metadata{Name: "meta"}))
+	assert.Nil(t, w.Close())
+	data := buf.Bytes()
+
+	lex := func(t *testing.T, input []byte, opts *LexerOptions) []TokenType {
+		lexer, err := NewLexer(bytes.NewReader(input), opts)
+		assert.Nil(t, err)
+		var tokens []TokenType
+		for {
+			tokenType, _, err := lexer.Next(nil)
+			if errors.Is(err, io.EOF) {
+				return tokens
+			}
+			assert.Nil(t, err)
+			if err != nil {
+				return tokens
+			}
+			tokens = append(tokens, tokenType)
+		}
+	}
+	all := lex(t, data, &LexerOptions{})
+	assert.Contains(t, all, TokenAttachment)
+	assert.Contains(t, all, TokenMetadata)
+
+	t.Run("skips records of the given types", func(t *testing.T) {
+		skip := []TokenType{TokenAttachment, TokenMetadata, TokenAttachmentIndex, TokenMetadataIndex}
+		var expected []TokenType
+		for _, tokenType := range all {
+			if tokenType != TokenAttachment && tokenType != TokenMetadata &&
+				tokenType != TokenAttachmentIndex && tokenType != TokenMetadataIndex {
+				expected = append(expected, tokenType)
+			}
+		}
+		for _, retain := range []bool{true, false} {
+			tokens := lex(t, data, &LexerOptions{
+				Skip:               skip,
+				RetainChunkBuffers: retain,
+				// skipped records are not subject to the record size limit.
+				MaxRecordSize: 1000,
+			})
+			assert.Equal(t, expected, tokens)
+		}
+	})
+	t.Run("skips records within chunks", func(t *testing.T) {
+		tokens := lex(t, data, &LexerOptions{Skip: []TokenType{TokenMessage}, StreamingCRC: true})
+		assert.NotContains(t, tokens, TokenMessage)
+		assert.Contains(t, tokens, TokenChannel)
+	})
+	t.Run("skips chunks whole", func(t *testing.T) {
+		tokens := lex(t, data, &LexerOptions{Skip: []TokenType{TokenChunk}})
+		assert.Contains(t, tokens, TokenMessageIndex)
+		assert.NotContains(t, tokens, TokenMessage)
+	})
+	t.Run("validates trailing magic of skipped footer", func(t *testing.T) {
+		truncated := data[:len(data)-1]
+		lexer, err := NewLexer(bytes.NewReader(truncated), &LexerOptions{Skip: []TokenType{TokenFooter}})
+		assert.Nil(t, err)
+		for err == nil {
+			_, _, err = lexer.Next(nil)
+		}
+		assert.ErrorIs(t, err, ErrMissingTrailingMagic)
+	})
+	t.Run("reports truncated skipped records", func(t *testing.T) {
+		record := flatten([]byte{byte(OpAttachment)}, encodedUint64(16), make([]byte, 16))
+		truncated := flatten(Magic, header(), record[:len(record)-4])
+		lexer, err := NewLexer(bytes.NewReader(truncated), &LexerOptions{Skip: []TokenType{TokenAttachment}})
+		assert.Nil(t, err)
+		tokenType, _, err := lexer.Next(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, TokenHeader, tokenType)
+		_, _, err = lexer.Next(nil)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+	t.Run("reports truncated skipped records in chunks", func(t *testing.T) {
+		records := flatten(channelInfo(), []byte{byte(OpMessage)}, encodedUint64(16), make([]byte, 16))
+		truncated := flatten(Magic, header(), chunk(t, CompressionNone, false, records[:len(records)-4]), footer())
+		lexer, err := NewLexer(bytes.NewReader(truncated), &LexerOptions{Skip: []TokenType{TokenMessage}})
+		assert.Nil(t, err)
+		for _, expected := range []TokenType{TokenHeader, TokenChannel} {
+			tokenType, _, err := lexer.Next(nil)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, tokenType)
+		}
+		_, _, err = lexer.Next(nil)
+		assert.ErrorIs(t, err, ErrTruncatedChunk)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
+
+func TestLexerOffset(t *testing.T) {
+	data := writeTestFile(t, &WriterOptions{Chunked: true, ChunkSize: 64, Compression: CompressionLZ4}, []string{"/a", "/b"}, []uint64{1, 2, 3, 4, 5, 6})
+	reader, err := NewReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	info, err := reader.Info()
+	assert.Nil(t, err)
+	chunkStarts := make(map[int64]bool)
+	for _, idx := range info.ChunkIndexes {
+		chunkStarts[int64(idx.ChunkStartOffset)] = true
+	}
+	assert.Greater(t, len(chunkStarts), 1)
+
+	lexer, err := NewLexer(bytes.NewReader(data), &LexerOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(Magic)), lexer.Offset())
+	seenChunks := make(map[int64]bool)
+	for {
+		offset := lexer.Offset()
+		inChunkOffset, inChunk := lexer.InChunkOffset()
+		tokenType, err := lexer.Peek()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.Nil(t, err)
+		if _, peekedInChunk := lexer.InChunkOffset(); !peekedInChunk {
+			// the offset of a peeked record is that of its start. The lexer
+			// leaves a chunk only once it reads past its end.
+			if !inChunk {
+				assert.Equal(t, offset, lexer.Offset())
+			}
+			assert.Equal(t, OpCode(data[lexer.Offset()]), opcodeFor(tokenType))
+		} else {
+			assert.True(t, chunkStarts[lexer.Offset()])
+			seenChunks[lexer.Offset()] = true
+		}
+		_, _, err = lexer.Next(nil)
+		assert.Nil(t, err)
+		chunkOffset, recordOffset, inChunk := lexer.ChunkOffsets()
+		if inChunk {
+			assert.Equal(t, int64(chunkOffset), lexer.Offset())
+			if int64(chunkOffset) == offset {
+				assert.Equal(t, inChunkOffset, int64(recordOffset))
+			}
+		}
+	}
+	assert.Equal(t, chunkStarts, seenChunks)
+	assert.Equal(t, int64(len(data)), lexer.Offset())
+}
+
+// opcodeFor returns the opcode of records of the given token type.
+func opcodeFor(tokenType TokenType) OpCode {
+	for opcode := OpHeader; opcode <= OpDataEnd; opcode++ {
+		if opcodeTokenType(opcode) == tokenType {
+			return opcode
+		}
+	}
+	return OpReserved
+}
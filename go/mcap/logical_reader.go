@@ -0,0 +1,207 @@
+package mcap
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// LogicalReader provides random access to the logical record stream of a
+// file: the file as the lexer sees it, with each chunk record replaced inline by
+// its decompressed records. Logical offsets are mapped to physical offsets
+// using the file's chunk indexes, and chunks are decompressed on demand, with
+// recently used chunks kept in an LRU cache. A LogicalReader is safe for
+// concurrent use.
+type LogicalReader struct {
+	r        io.ReaderAt
+	segments []logicalSegment
+	size     int64
+
+	mtx   sync.Mutex
+	cache *chunkCache
+}
+
+// logicalSegment maps a range of the logical stream either to an identical
+// range of the file or, if chunk is set, to a decompressed chunk.
+type logicalSegment struct {
+	logicalStart  int64
+	physicalStart int64
+	length        int64
+	chunk         *ChunkIndex
+}
+
+// NewLogicalReader returns a LogicalReader over the file backed by r, which
+// must have chunk indexes for each of its chunks. Up to cacheSize decompressed
+// chunks are cached; values less than one are treated as one.
+func NewLogicalReader(r io.ReaderAt, size int64, cacheSize int) (*LogicalReader, error) {
+	info, err := readInfo(r, size)
+	if err != nil {
+		return nil, err
+	}
+	chunkIndexes := make([]*ChunkIndex, len(info.ChunkIndexes))
+	copy(chunkIndexes, info.ChunkIndexes)
+	sort.Slice(chunkIndexes, func(i, j int) bool {
+		return chunkIndexes[i].ChunkStartOffset < chunkIndexes[j].ChunkStartOffset
+	})
+	var segments []logicalSegment
+	var logical, physical int64
+	for _, idx := range chunkIndexes {
+		chunkStart := int64(idx.ChunkStartOffset)
+		if chunkStart < physical || chunkStart+int64(idx.ChunkLength) > size {
+			return nil, fmt.Errorf("invalid chunk index at offset %d", idx.ChunkStartOffset)
+		}
+		if chunkStart > physical {
+			segments = append(segments, logicalSegment{
+				logicalStart:  logical,
+				physicalStart: physical,
+				length:        chunkStart - physical,
+			})
+			logical += chunkStart - physical
+		}
+		segments = append(segments, logicalSegment{
+			logicalStart:  logical,
+			physicalStart: chunkStart,
+			length:        int64(idx.UncompressedSize),
+			chunk:         idx,
+		})
+		logical += int64(idx.UncompressedSize)
+		physical = chunkStart + int64(idx.ChunkLength)
+	}
+	if physical < size {
+		segments = append(segments, logicalSegment{
+			logicalStart:  logical,
+			physicalStart: physical,
+			length:        size - physical,
+		})
+		logical += size - physical
+	}
+	if cacheSize < 1 {
+		cacheSize = 1
+	}
+	return &LogicalReader{
+		r:        r,
+		segments: segments,
+		size:     logical,
+		cache:    newChunkCache(cacheSize),
+	}, nil
+}
+
+// Size returns the length of the logical record stream.
+func (l *LogicalReader) Size() int64 {
+	return l.size
+}
+
+// SectionReader returns an io.SectionReader over n bytes of the logical record
+// stream, starting at logical offset off.
+func (l *LogicalReader) SectionReader(off int64, n int64) *io.SectionReader {
+	return io.NewSectionReader(l, off, n)
+}
+
+// ReadAt reads len(p) bytes of the logical record stream starting at logical
+// offset off, decompressing chunks as required.
+func (l *LogicalReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+	i := sort.Search(len(l.segments), func(i int) bool {
+		return l.segments[i].logicalStart+l.segments[i].length > off
+	})
+	n := 0
+	for ; n < len(p) && i < len(l.segments); i++ {
+		segment := l.segments[i]
+		segmentOffset := off + int64(n) - segment.logicalStart
+		want := len(p) - n
+		if remaining := segment.length - segmentOffset; int64(want) > remaining {
+			want = int(remaining)
+		}
+		if segment.chunk == nil {
+			read, err := l.r.ReadAt(p[n:n+want], segment.physicalStart+segmentOffset)
+			n += read
+			if err != nil {
+				return n, err
+			}
+			continue
+		}
+		data, err := l.chunkData(segment.chunk)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:n+want], data[segmentOffset:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// chunkData returns the decompressed records of a chunk, from the cache if
+// possible.
+func (l *LogicalReader) chunkData(idx *ChunkIndex) ([]byte, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if data, ok := l.cache.get(idx.ChunkStartOffset); ok {
+		return data, nil
+	}
+	chunk, err := readChunkAt(l.r, idx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := decompressChunk(chunk)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != idx.UncompressedSize {
+		return nil, fmt.Errorf(
+			"chunk at offset %d decompressed to %d bytes, expected %d",
+			idx.ChunkStartOffset, len(data), idx.UncompressedSize,
+		)
+	}
+	l.cache.add(idx.ChunkStartOffset, data)
+	return data, nil
+}
+
+// chunkCache is a least-recently-used cache of decompressed chunks, keyed by
+// chunk start offset.
+type chunkCache struct {
+	capacity int
+	entries  map[uint64]*list.Element
+	order    *list.List
+}
+
+type chunkCacheEntry struct {
+	offset uint64
+	data   []byte
+}
+
+func newChunkCache(capacity int) *chunkCache {
+	return &chunkCache{
+		capacity: capacity,
+		entries:  make(map[uint64]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *chunkCache) get(offset uint64) ([]byte, bool) {
+	elem, ok := c.entries[offset]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*chunkCacheEntry).data, true
+}
+
+func (c *chunkCache) add(offset uint64, data []byte) {
+	if elem, ok := c.entries[offset]; ok {
+		elem.Value.(*chunkCacheEntry).data = data
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[offset] = c.order.PushFront(&chunkCacheEntry{offset: offset, data: data})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*chunkCacheEntry).offset)
+	}
+}
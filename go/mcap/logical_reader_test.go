@@ -0,0 +1,89 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogicalReader(t *testing.T) {
+	logTimes := make([]uint64, 100)
+	for i := range logTimes {
+		logTimes[i] = uint64(i)
+	}
+	data := writeTestFile(t, &WriterOptions{
+		Chunked:     true,
+		ChunkSize:   300,
+		Compression: CompressionZSTD,
+	}, []string{"/a", "/b"}, logTimes)
+	info, err := readInfo(bytes.NewReader(data), int64(len(data)))
+	assert.Nil(t, err)
+	assert.Greater(t, len(info.ChunkIndexes), 3)
+
+	// build the expected logical stream by replacing each chunk with its
+	// decompressed records.
+	expected := []byte{}
+	physical := uint64(0)
+	for _, idx := range info.ChunkIndexes {
+		expected = append(expected, data[physical:idx.ChunkStartOffset]...)
+		chunk, err := readChunkAt(bytes.NewReader(data), idx)
+		assert.Nil(t, err)
+		records, err := decompressChunk(chunk)
+		assert.Nil(t, err)
+		expected = append(expected, records...)
+		physical = idx.ChunkStartOffset + idx.ChunkLength
+	}
+	expected = append(expected, data[physical:]...)
+
+	reader, err := NewLogicalReader(bytes.NewReader(data), int64(len(data)), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(expected)), reader.Size())
+
+	t.Run("reads whole stream", func(t *testing.T) {
+		actual, err := io.ReadAll(reader.SectionReader(0, reader.Size()))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, actual)
+	})
+	t.Run("reads across chunk boundaries", func(t *testing.T) {
+		for _, idx := range info.ChunkIndexes[1:] {
+			chunk, err := readChunkAt(bytes.NewReader(data), idx)
+			assert.Nil(t, err)
+			records, err := decompressChunk(chunk)
+			assert.Nil(t, err)
+			start := int64(bytes.Index(expected, records)) - 20
+			buf := make([]byte, 40)
+			n, err := reader.ReadAt(buf, start)
+			assert.Nil(t, err)
+			assert.Equal(t, 40, n)
+			assert.Equal(t, expected[start:start+40], buf)
+		}
+	})
+	t.Run("short read at end", func(t *testing.T) {
+		buf := make([]byte, 10)
+		n, err := reader.ReadAt(buf, reader.Size()-4)
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Equal(t, 4, n)
+		assert.Equal(t, expected[len(expected)-4:], buf[:n])
+	})
+	t.Run("logical stream can be lexed without chunks", func(t *testing.T) {
+		lexer, err := NewLexer(reader.SectionReader(0, reader.Size()))
+		assert.Nil(t, err)
+		messages := 0
+		for {
+			tokenType, _, err := lexer.Next(nil)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			assert.Nil(t, err)
+			assert.NotEqual(t, TokenChunk, tokenType)
+			if tokenType == TokenMessage {
+				messages++
+			}
+		}
+		assert.Equal(t, len(logTimes), messages)
+	})
+	assert.LessOrEqual(t, reader.cache.order.Len(), 2)
+}
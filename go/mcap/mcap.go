@@ -1,3 +1,33 @@
+// Package mcap reads and writes MCAP files.
+//
+// Files may be read at two levels. The Lexer returns the body of each record
+// as a raw token, leaving parsing to the caller with functions such as
+// ParseChannel and ParseMessage. Most programs should use the Reader instead,
+// which parses records into typed structs: its message iterators return each
+// Message along with its Channel and the Schema the channel references,
+// resolved from the records read earlier or from the summary section.
+// Messages on schemaless channels are returned with a nil schema.
+//
+//	reader, err := mcap.NewReader(f)
+//	if err != nil {
+//		return err
+//	}
+//	it, err := reader.Messages()
+//	if err != nil {
+//		return err
+//	}
+//	for {
+//		_, channel, message, err := it.Next(nil)
+//		if errors.Is(err, io.EOF) {
+//			break
+//		}
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(channel.Topic, message.LogTime, len(message.Data))
+//	}
+//
+// Files are written with the Writer.
 package mcap
 
 import (
@@ -16,6 +46,9 @@ const (
 	CompressionZSTD CompressionFormat = "zstd"
 	// CompressionLZ4 represents lz4 compression.
 	CompressionLZ4 CompressionFormat = "lz4"
+	// CompressionSnappy represents snappy compression, in the snappy framing
+	// format.
+	CompressionSnappy CompressionFormat = "snappy"
 	// CompressionNone represents no compression.
 	CompressionNone CompressionFormat = ""
 )
@@ -28,6 +61,24 @@ func (c CompressionFormat) String() string {
 	return string(c)
 }
 
+// CompressionLevel selects the tradeoff between speed and compression ratio of
+// chunk compression.
+type CompressionLevel int
+
+const (
+	// CompressionLevelDefault keeps the writer's default level, which is the
+	// fastest.
+	CompressionLevelDefault CompressionLevel = iota
+	// CompressionLevelFastest favors speed over compression ratio.
+	CompressionLevelFastest
+	// CompressionLevelBalanced balances speed and compression ratio.
+	CompressionLevelBalanced
+	// CompressionLevelBetter favors compression ratio over speed.
+	CompressionLevelBetter
+	// CompressionLevelBest favors compression ratio regardless of speed.
+	CompressionLevelBest
+)
+
 const (
 	OpReserved        OpCode = 0x00
 	OpHeader          OpCode = 0x01
@@ -285,6 +336,13 @@ type Info struct {
 	MetadataIndexes   []*MetadataIndex
 	AttachmentIndexes []*AttachmentIndex
 	Header            *Header
+	// SummaryIncomplete is set if the data section contains chunks that are
+	// missing from the chunk indexes in the summary section. Indexed reads
+	// find the messages in those chunks by scanning them. It is also set if
+	// no data end record follows the last indexed chunk, as the end of the
+	// data section, and so any chunks missing from the summary, cannot then
+	// be found.
+	SummaryIncomplete bool
 }
 
 // ChannelCounts counts the number of messages on each channel in an Info.
@@ -0,0 +1,57 @@
+package mcap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNoMessageDecoder is returned when no decoder is registered for a
+// channel's message encoding.
+var ErrNoMessageDecoder = errors.New("no decoder registered for message encoding")
+
+var (
+	messageDecodersMtx sync.RWMutex
+	messageDecoders    = map[string]func(*Schema, []byte) (interface{}, error){
+		"json": decodeJSONMessage,
+	}
+)
+
+// RegisterMessageDecoder registers a decoder for messages of the given
+// encoding, replacing any decoder previously registered for it. The decoder is
+// called with the schema of the message's channel, which is nil for
+// schemaless channels, and the message data, and returns the decoded message,
+// such as a struct or a map[string]interface{}. It must not retain the data.
+// A decoder for the "json" encoding, decoding messages into
+// map[string]interface{}, is registered by default.
+func RegisterMessageDecoder(encoding string, decode func(schema *Schema, data []byte) (interface{}, error)) {
+	messageDecodersMtx.Lock()
+	defer messageDecodersMtx.Unlock()
+	messageDecoders[encoding] = decode
+}
+
+// DecodeMessage decodes a message on the given channel with the decoder
+// registered for the channel's message encoding. If there is none, it returns
+// an error wrapping ErrNoMessageDecoder.
+func DecodeMessage(schema *Schema, channel *Channel, message *Message) (interface{}, error) {
+	messageDecodersMtx.RLock()
+	decode, ok := messageDecoders[channel.MessageEncoding]
+	messageDecodersMtx.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNoMessageDecoder, channel.MessageEncoding)
+	}
+	decoded, err := decode(schema, message.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s message on %s: %w", channel.MessageEncoding, channel.Topic, err)
+	}
+	return decoded, nil
+}
+
+func decodeJSONMessage(_ *Schema, data []byte) (interface{}, error) {
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
@@ -0,0 +1,62 @@
+package mcap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNoMessageEncoder is returned when no encoder is registered for a
+// channel's message encoding.
+var ErrNoMessageEncoder = errors.New("no encoder registered for message encoding")
+
+var (
+	messageEncodersMtx sync.RWMutex
+	messageEncoders    = map[string]func(*Schema, interface{}) ([]byte, error){
+		"json": encodeJSONMessage,
+	}
+)
+
+// RegisterMessageEncoder registers an encoder for messages of the given
+// encoding, replacing any encoder previously registered for it. The encoder is
+// the inverse of a decoder registered with RegisterMessageDecoder: it is
+// called with the schema of the message's channel, which is nil for
+// schemaless channels, and a decoded message, and returns the message data.
+// An encoder for the "json" encoding, encoding messages with json.Marshal, is
+// registered by default.
+func RegisterMessageEncoder(encoding string, encode func(schema *Schema, decoded interface{}) ([]byte, error)) {
+	messageEncodersMtx.Lock()
+	defer messageEncodersMtx.Unlock()
+	messageEncoders[encoding] = encode
+}
+
+// EncodeMessage encodes a decoded message on the given channel with the
+// encoder registered for the channel's message encoding. If there is none, it
+// returns an error wrapping ErrNoMessageEncoder.
+func EncodeMessage(schema *Schema, channel *Channel, decoded interface{}) ([]byte, error) {
+	messageEncodersMtx.RLock()
+	encode, ok := messageEncoders[channel.MessageEncoding]
+	messageEncodersMtx.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNoMessageEncoder, channel.MessageEncoding)
+	}
+	data, err := encode(schema, decoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s message on %s: %w", channel.MessageEncoding, channel.Topic, err)
+	}
+	return data, nil
+}
+
+// hasMessageEncoder reports whether an encoder is registered for the given
+// message encoding.
+func hasMessageEncoder(encoding string) bool {
+	messageEncodersMtx.RLock()
+	defer messageEncodersMtx.RUnlock()
+	_, ok := messageEncoders[encoding]
+	return ok
+}
+
+func encodeJSONMessage(_ *Schema, decoded interface{}) ([]byte, error) {
+	return json.Marshal(decoded)
+}
@@ -0,0 +1,43 @@
+package mcap
+
+import (
+	"io"
+)
+
+// MessageRates returns the average rate, in messages per second, of each topic
+// over the span of the file, from the first message's log time to the last.
+// Message counts are taken from the statistics record, or from a scan of the
+// file if it has none. If the file spans zero time, as when it contains a
+// single message, every rate is zero.
+func MessageRates(r io.ReaderAt, size int64) (map[string]float64, error) {
+	info, err := readInfo(r, size)
+	if err != nil {
+		return nil, err
+	}
+	stats := info.Statistics
+	channels := info.Channels
+	if stats == nil {
+		var scanned map[uint16]*Channel
+		stats, scanned, err = scanStatistics(io.NewSectionReader(r, 0, size))
+		if err != nil {
+			return nil, err
+		}
+		if len(channels) == 0 {
+			channels = scanned
+		}
+	}
+	counts := make(map[string]uint64)
+	for _, channel := range channels {
+		counts[channel.Topic] += stats.ChannelMessageCounts[channel.ID]
+	}
+	seconds := float64(stats.MessageEndTime-stats.MessageStartTime) / 1e9
+	rates := make(map[string]float64, len(counts))
+	for topic, count := range counts {
+		if seconds > 0 {
+			rates[topic] = float64(count) / seconds
+		} else {
+			rates[topic] = 0
+		}
+	}
+	return rates, nil
+}
@@ -0,0 +1,33 @@
+package mcap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageRates(t *testing.T) {
+	// 9 messages over two seconds, alternating between topics /a and /b.
+	logTimes := make([]uint64, 9)
+	for i := range logTimes {
+		logTimes[i] = 1e9 + uint64(i)*250e6
+	}
+	expected := map[string]float64{"/a": 2.5, "/b": 2}
+	for _, opts := range []*WriterOptions{
+		{Chunked: true, Compression: CompressionLZ4},
+		{SkipStatistics: true},
+		{SkipStatistics: true, SkipRepeatedChannelInfos: true},
+	} {
+		data := writeTestFile(t, opts, []string{"/a", "/b"}, logTimes)
+		rates, err := MessageRates(bytes.NewReader(data), int64(len(data)))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, rates)
+	}
+	t.Run("single message", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{}, []string{"/a", "/b"}, []uint64{100})
+		rates, err := MessageRates(bytes.NewReader(data), int64(len(data)))
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]float64{"/a": 0, "/b": 0}, rates)
+	})
+}
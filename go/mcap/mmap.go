@@ -0,0 +1,81 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+)
+
+// ErrMmapClosed is returned when reading from a memory mapping that has been
+// unmapped.
+var ErrMmapClosed = errors.New("read from unmapped file")
+
+// mmapReader presents a memory-mapped file as an io.ReadSeeker and io.ReaderAt.
+// Reads after the mapping has been released fail with ErrMmapClosed rather
+// than faulting.
+type mmapReader struct {
+	mtx    sync.RWMutex
+	r      *bytes.Reader
+	unmap  func() error
+	closed bool
+}
+
+func (m *mmapReader) Read(p []byte) (int, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	if m.closed {
+		return 0, ErrMmapClosed
+	}
+	return m.r.Read(p)
+}
+
+func (m *mmapReader) ReadAt(p []byte, off int64) (int, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	if m.closed {
+		return 0, ErrMmapClosed
+	}
+	return m.r.ReadAt(p, off)
+}
+
+func (m *mmapReader) Seek(offset int64, whence int) (int64, error) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	if m.closed {
+		return 0, ErrMmapClosed
+	}
+	return m.r.Seek(offset, whence)
+}
+
+func (m *mmapReader) Close() error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	m.r = nil
+	return m.unmap()
+}
+
+// NewMmapReader memory-maps the file at path and returns a Reader over the
+// mapping, along with a function that releases it. Indexed reads then access
+// mapped memory directly rather than issuing a syscall per read. Reading
+// after the release function has been called fails with ErrMmapClosed;
+// message data returned by the reader must not be retained past release.
+func NewMmapReader(path string) (*Reader, func() error, error) {
+	data, unmap, err := mmapFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	m := &mmapReader{
+		r:     bytes.NewReader(data),
+		unmap: unmap,
+	}
+	reader, err := NewReader(m)
+	if err != nil {
+		_ = m.Close()
+		return nil, nil, err
+	}
+	return reader, m.Close, nil
+}
@@ -0,0 +1,40 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package mcap
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/foxglove/mcap/go/mcap/readopts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMmapReader(t *testing.T) {
+	data := writeTestFile(t, &WriterOptions{Chunked: true, ChunkSize: 40, Compression: CompressionZSTD},
+		[]string{"/a", "/b"}, []uint64{1, 2, 3, 4, 5, 6})
+	path := filepath.Join(t.TempDir(), "test.mcap")
+	assert.Nil(t, os.WriteFile(path, data, 0600))
+
+	reader, unmap, err := NewMmapReader(path)
+	assert.Nil(t, err)
+	info, err := reader.Info()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(6), info.Statistics.MessageCount)
+
+	it, err := reader.Messages(readopts.UsingIndex(true), readopts.InOrder(readopts.LogTimeOrder))
+	assert.Nil(t, err)
+	count := 0
+	assert.Nil(t, Range(it, func(_ *Schema, _ *Channel, message *Message) error {
+		count++
+		assert.Equal(t, uint64(count), message.LogTime)
+		return nil
+	}))
+	assert.Equal(t, 6, count)
+
+	assert.Nil(t, unmap())
+	assert.Nil(t, unmap())
+	_, err = reader.Info()
+	assert.ErrorIs(t, err, ErrMmapClosed)
+}
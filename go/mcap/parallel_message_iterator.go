@@ -0,0 +1,338 @@
+package mcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ParallelMessageIterator is a MessageIterator that decompresses chunks on a
+// pool of worker goroutines while yielding messages in file order. Message data
+// returned by the iterator is not reused and may be retained.
+type ParallelMessageIterator struct {
+	items    chan *parallelItem
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+
+	schemas  map[uint16]*Schema
+	channels map[uint16]*Channel
+
+	chunk  []byte
+	offset int
+	err    error
+
+	validateCRC              bool
+	requireChunkCRC          bool
+	maxDecompressedChunkSize int
+	zstdDictionary           []byte
+	decompressors            map[string]func(io.Reader) (io.Reader, error)
+	pool                     *DecoderPool
+
+	// maxTotalDecompressedBytes bounds decompressedBytes, the sum of the
+	// declared sizes of the chunks dispatched to the workers.
+	maxTotalDecompressedBytes int
+	decompressedBytes         uint64
+}
+
+// parallelItem is a top-level record in the order it appears in the file. For
+// chunks, the record is replaced by the decompressed chunk data once done is
+// closed.
+type parallelItem struct {
+	tokenType TokenType
+	record    []byte
+	err       error
+	done      chan struct{}
+}
+
+// ParallelMessages returns an iterator over every message in the file that
+// decompresses up to `workers` chunks concurrently. Messages are yielded in the
+// order they appear in the file. The first error encountered, by the reader or
+// any worker, is returned from Next and stops the workers. Callers that stop
+// iterating before reaching io.EOF or an error must call Close to release the
+// workers. Lexer options are respected, except that EmitChunks is implied.
+// With MaxTotalDecompressedBytes, each chunk's declared size is charged to
+// the budget before the chunk is dispatched to a worker.
+func ParallelMessages(r io.ReaderAt, size int64, workers int, opts ...*LexerOptions) (*ParallelMessageIterator, error) {
+	return ParallelMessagesWithPool(r, size, workers, nil, opts...)
+}
+
+// ParallelMessagesWithPool is like ParallelMessages, but the workers borrow
+// decompressors from the given pool for each chunk rather than each holding
+// its own, so that the number of live decoders is bounded by the size of the
+// pool however many workers there are. The pool may be shared with other
+// iterators. If pool is nil, it behaves as ParallelMessages.
+func ParallelMessagesWithPool(
+	r io.ReaderAt,
+	size int64,
+	workers int,
+	pool *DecoderPool,
+	opts ...*LexerOptions,
+) (*ParallelMessageIterator, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	lexerOpts := LexerOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		lexerOpts = *opts[0]
+	}
+	lexerOpts.EmitChunks = true
+	lexer, err := NewLexer(io.NewSectionReader(r, 0, size), &lexerOpts)
+	if err != nil {
+		return nil, err
+	}
+	it := &ParallelMessageIterator{
+		items:                    make(chan *parallelItem, 2*workers),
+		stop:                     make(chan struct{}),
+		schemas:                  make(map[uint16]*Schema),
+		channels:                 make(map[uint16]*Channel),
+		validateCRC:              lexerOpts.ValidateCRC || lexerOpts.RequireChunkCRC,
+		requireChunkCRC:          lexerOpts.RequireChunkCRC,
+		maxDecompressedChunkSize: lexerOpts.MaxDecompressedChunkSize,
+		zstdDictionary:           lexerOpts.ZSTDDictionary,
+		decompressors:            lexerOpts.Decompressors,
+		pool:                     pool,
+
+		maxTotalDecompressedBytes: lexerOpts.MaxTotalDecompressedBytes,
+	}
+	jobs := make(chan *parallelItem, workers)
+	it.wg.Add(1 + workers)
+	go it.produce(lexer, jobs)
+	for i := 0; i < workers; i++ {
+		go it.work(jobs)
+	}
+	return it, nil
+}
+
+// produce lexes top-level records, dispatching chunks to the workers and
+// queueing every record in file order.
+func (it *ParallelMessageIterator) produce(lexer *Lexer, jobs chan<- *parallelItem) {
+	defer it.wg.Done()
+	defer close(it.items)
+	defer close(jobs)
+	for {
+		tokenType, record, err := lexer.Next(nil)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			item := &parallelItem{err: err, done: make(chan struct{})}
+			close(item.done)
+			select {
+			case it.items <- item:
+			case <-it.stop:
+			}
+			return
+		}
+		item := &parallelItem{tokenType: tokenType, record: record, done: make(chan struct{})}
+		switch tokenType {
+		case TokenChunk:
+			if err := it.chargeChunk(record); err != nil {
+				item.err = err
+				close(item.done)
+				select {
+				case it.items <- item:
+				case <-it.stop:
+				}
+				return
+			}
+			select {
+			case jobs <- item:
+			case <-it.stop:
+				return
+			}
+		case TokenSchema, TokenChannel, TokenMessage:
+			close(item.done)
+		default:
+			continue
+		}
+		select {
+		case it.items <- item:
+		case <-it.stop:
+			return
+		}
+	}
+}
+
+// chargeChunk charges the declared uncompressed size of a chunk record to
+// the decompression budget, as the lexer does for the chunks it reads.
+func (it *ParallelMessageIterator) chargeChunk(record []byte) error {
+	if it.maxTotalDecompressedBytes <= 0 || len(record) < 24 {
+		// chunks too short to declare a size fail to parse in the workers.
+		return nil
+	}
+	uncompressedSize := binary.LittleEndian.Uint64(record[16:])
+	if uncompressedSize > uint64(it.maxTotalDecompressedBytes)-it.decompressedBytes {
+		return fmt.Errorf("%w: chunk of %d bytes after %d bytes", ErrDecompressionBudgetExceeded,
+			uncompressedSize, it.decompressedBytes)
+	}
+	it.decompressedBytes += uncompressedSize
+	return nil
+}
+
+func (it *ParallelMessageIterator) work(jobs <-chan *parallelItem) {
+	defer it.wg.Done()
+	var decompressor *chunkDecompressor
+	if it.pool == nil {
+		decompressor = &chunkDecompressor{decompressors: it.decompressors}
+		defer decompressor.close()
+	}
+	for item := range jobs {
+		select {
+		case <-it.stop:
+			item.err = io.EOF
+		default:
+			item.record, item.err = it.decompress(decompressor, item.record)
+		}
+		close(item.done)
+	}
+}
+
+// decompress decompresses a chunk record with the worker's decompressor, or
+// one borrowed from the pool if the iterator has one.
+func (it *ParallelMessageIterator) decompress(decompressor *chunkDecompressor, record []byte) ([]byte, error) {
+	if it.pool != nil {
+		var ok bool
+		decompressor, ok = it.pool.get(it.stop)
+		if !ok {
+			return nil, io.EOF
+		}
+		defer it.pool.put(decompressor)
+		// pooled decompressors may last have been used by another iterator.
+		decompressor.useDecompressors(it.decompressors)
+	}
+	decompressor.useZSTDDictionary(it.zstdDictionary)
+	data, err := decompressChunkRecord(decompressor, record, it.validateCRC, it.requireChunkCRC,
+		it.maxDecompressedChunkSize)
+	if err != nil {
+		return nil, err
+	}
+	if it.maxTotalDecompressedBytes > 0 && uint64(len(data)) > binary.LittleEndian.Uint64(record[16:]) {
+		return nil, fmt.Errorf("%w: chunk exceeds its declared uncompressed size", ErrDecompressionBudgetExceeded)
+	}
+	return data, nil
+}
+
+// Next returns the next message in the file. The buffer argument is unused, as
+// message data is never reused.
+func (it *ParallelMessageIterator) Next(_ []byte) (*Schema, *Channel, *Message, error) {
+	for {
+		if it.chunk != nil {
+			if it.offset >= len(it.chunk) {
+				it.chunk = nil
+				continue
+			}
+			if len(it.chunk)-it.offset < 9 {
+				return it.fail(fmt.Errorf("truncated record in chunk: %w", io.ErrUnexpectedEOF))
+			}
+			opcode := OpCode(it.chunk[it.offset])
+			recordLen := binary.LittleEndian.Uint64(it.chunk[it.offset+1:])
+			start := it.offset + 9
+			if recordLen > uint64(len(it.chunk)-start) {
+				return it.fail(fmt.Errorf("truncated %s record in chunk: %w", opcode, io.ErrUnexpectedEOF))
+			}
+			it.offset = start + int(recordLen)
+			var tokenType TokenType
+			switch opcode {
+			case OpSchema:
+				tokenType = TokenSchema
+			case OpChannel:
+				tokenType = TokenChannel
+			case OpMessage:
+				tokenType = TokenMessage
+			case OpChunk:
+				return it.fail(ErrNestedChunk)
+			default:
+				continue
+			}
+			schema, channel, message, err := it.handle(tokenType, it.chunk[start:it.offset])
+			if err != nil {
+				return it.fail(err)
+			}
+			if message != nil {
+				return schema, channel, message, nil
+			}
+			continue
+		}
+		if it.err != nil {
+			return nil, nil, nil, it.err
+		}
+		item, ok := <-it.items
+		if !ok {
+			it.err = io.EOF
+			it.Close()
+			return nil, nil, nil, io.EOF
+		}
+		<-item.done
+		if item.err != nil {
+			return it.fail(item.err)
+		}
+		if item.tokenType == TokenChunk {
+			it.chunk = item.record
+			it.offset = 0
+			continue
+		}
+		schema, channel, message, err := it.handle(item.tokenType, item.record)
+		if err != nil {
+			return it.fail(err)
+		}
+		if message != nil {
+			return schema, channel, message, nil
+		}
+	}
+}
+
+// handle processes a schema, channel, or message record, returning a non-nil
+// message if the record is a message on a known channel.
+func (it *ParallelMessageIterator) handle(tokenType TokenType, record []byte) (*Schema, *Channel, *Message, error) {
+	switch tokenType {
+	case TokenSchema:
+		schema, err := ParseSchema(record)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to parse schema: %w", err)
+		}
+		if _, ok := it.schemas[schema.ID]; !ok {
+			it.schemas[schema.ID] = schema
+		}
+	case TokenChannel:
+		channel, err := ParseChannel(record)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to parse channel info: %w", err)
+		}
+		if _, ok := it.channels[channel.ID]; !ok {
+			it.channels[channel.ID] = channel
+		}
+	case TokenMessage:
+		message, err := ParseMessage(record)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		channel, ok := it.channels[message.ChannelID]
+		if !ok {
+			return nil, nil, nil, nil
+		}
+		return it.schemas[channel.SchemaID], channel, message, nil
+	}
+	return nil, nil, nil, nil
+}
+
+func (it *ParallelMessageIterator) fail(err error) (*Schema, *Channel, *Message, error) {
+	it.err = err
+	it.chunk = nil
+	it.Close()
+	return nil, nil, nil, err
+}
+
+// Close stops the reader and worker goroutines and waits for them to exit. It
+// is safe to call more than once.
+func (it *ParallelMessageIterator) Close() {
+	it.stopOnce.Do(func() {
+		close(it.stop)
+	})
+	if it.err == nil {
+		it.err = io.EOF
+	}
+	it.wg.Wait()
+}
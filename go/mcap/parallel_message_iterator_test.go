@@ -0,0 +1,209 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParallelMessages(t *testing.T) {
+	logTimes := make([]uint64, 200)
+	for i := range logTimes {
+		logTimes[i] = uint64(i)
+	}
+	cases := []struct {
+		assertion string
+		opts      *WriterOptions
+	}{
+		{"unchunked", &WriterOptions{}},
+		{"zstd chunks", &WriterOptions{Chunked: true, ChunkSize: 100, Compression: CompressionZSTD, IncludeCRC: true}},
+		{"lz4 chunks", &WriterOptions{Chunked: true, ChunkSize: 100, Compression: CompressionLZ4, IncludeCRC: true}},
+		{"uncompressed chunks", &WriterOptions{Chunked: true, ChunkSize: 100, Compression: CompressionNone}},
+	}
+	for _, c := range cases {
+		t.Run(c.assertion, func(t *testing.T) {
+			data := writeTestFile(t, c.opts, []string{"/a", "/b", "/c"}, logTimes)
+			it, err := ParallelMessages(bytes.NewReader(data), int64(len(data)), 4, &LexerOptions{ValidateCRC: true})
+			assert.Nil(t, err)
+			var messages []*Message
+			for {
+				schema, channel, message, err := it.Next(nil)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				assert.Nil(t, err)
+				assert.Equal(t, "schema", schema.Name)
+				assert.Equal(t, message.ChannelID, channel.ID)
+				messages = append(messages, message)
+			}
+			assert.Equal(t, len(logTimes), len(messages))
+			for i, message := range messages {
+				assert.Equal(t, uint32(i), message.Sequence)
+				assert.Equal(t, []byte{byte(i)}, message.Data)
+			}
+			_, _, _, err = it.Next(nil)
+			assert.ErrorIs(t, err, io.EOF)
+		})
+	}
+	t.Run("surfaces chunk errors", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{Chunked: true, ChunkSize: 100, Compression: CompressionZSTD, IncludeCRC: true}, []string{"/a"}, logTimes)
+		info, err := readInfo(bytes.NewReader(data), int64(len(data)))
+		assert.Nil(t, err)
+		assert.Greater(t, len(info.ChunkIndexes), 2)
+		// corrupt the uncompressed CRC of the second chunk
+		data[info.ChunkIndexes[1].ChunkStartOffset+9+8+8+8] ^= 0xff
+		// log times are sequential, so the first chunk's time range gives its message count
+		firstChunkMessages := int(info.ChunkIndexes[0].MessageEndTime-info.ChunkIndexes[0].MessageStartTime) + 1
+		it, err := ParallelMessages(bytes.NewReader(data), int64(len(data)), 2, &LexerOptions{ValidateCRC: true})
+		assert.Nil(t, err)
+		count := 0
+		for {
+			_, _, _, err = it.Next(nil)
+			if err != nil {
+				break
+			}
+			count++
+		}
+		assert.Equal(t, firstChunkMessages, count)
+		assert.Contains(t, err.Error(), "invalid chunk CRC")
+		_, _, _, nextErr := it.Next(nil)
+		assert.Equal(t, err, nextErr)
+	})
+	t.Run("requires chunk CRCs if asked", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{Chunked: true, ChunkSize: 100, Compression: CompressionZSTD}, []string{"/a"}, logTimes)
+		it, err := ParallelMessages(bytes.NewReader(data), int64(len(data)), 2, &LexerOptions{RequireChunkCRC: true})
+		assert.Nil(t, err)
+		_, _, _, err = it.Next(nil)
+		assert.ErrorIs(t, err, ErrMissingChunkCRC)
+	})
+	t.Run("close before exhausting", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{Chunked: true, ChunkSize: 100, Compression: CompressionZSTD}, []string{"/a"}, logTimes)
+		it, err := ParallelMessages(bytes.NewReader(data), int64(len(data)), 2)
+		assert.Nil(t, err)
+		_, _, _, err = it.Next(nil)
+		assert.Nil(t, err)
+		it.Close()
+		_, _, _, err = it.Next(nil)
+		assert.ErrorIs(t, err, io.EOF)
+	})
+}
+
+func TestParallelMessagesWithPool(t *testing.T) {
+	logTimes := make([]uint64, 500)
+	for i := range logTimes {
+		logTimes[i] = uint64(i)
+	}
+	data := writeTestFile(t, &WriterOptions{
+		Chunked:     true,
+		ChunkSize:   100,
+		Compression: CompressionZSTD,
+		IncludeCRC:  true,
+	}, []string{"/a", "/b"}, logTimes)
+	pool := NewDecoderPool(2)
+	defer pool.Close()
+
+	t.Run("iterators share the pool", func(t *testing.T) {
+		errs := make(chan error, 3)
+		for i := 0; i < cap(errs); i++ {
+			go func() {
+				it, err := ParallelMessagesWithPool(bytes.NewReader(data), int64(len(data)), 8, pool)
+				if err != nil {
+					errs <- err
+					return
+				}
+				count := 0
+				for {
+					_, _, message, err := it.Next(nil)
+					if errors.Is(err, io.EOF) {
+						break
+					}
+					if err != nil {
+						errs <- err
+						return
+					}
+					if message.Sequence != uint32(count) {
+						errs <- fmt.Errorf("message %d out of order", message.Sequence)
+						return
+					}
+					count++
+				}
+				if count != len(logTimes) {
+					errs <- fmt.Errorf("read %d messages", count)
+					return
+				}
+				errs <- nil
+			}()
+		}
+		for i := 0; i < cap(errs); i++ {
+			assert.Nil(t, <-errs)
+		}
+		assert.Equal(t, 2, len(pool.free))
+	})
+	t.Run("close does not wait for an exhausted pool", func(t *testing.T) {
+		borrowed := []*chunkDecompressor{}
+		for i := 0; i < 2; i++ {
+			d, ok := pool.get(nil)
+			assert.True(t, ok)
+			borrowed = append(borrowed, d)
+		}
+		it, err := ParallelMessagesWithPool(bytes.NewReader(data), int64(len(data)), 2, pool)
+		assert.Nil(t, err)
+		it.Close()
+		for _, d := range borrowed {
+			pool.put(d)
+		}
+		assert.Equal(t, 2, len(pool.free))
+	})
+	t.Run("respects registered decompressors", func(t *testing.T) {
+		data, expected := writeCompressedChunks(t, "xor", func(w io.Writer) resettableWriteCloser {
+			return &xorWriter{w: w, key: 0x5a}
+		})
+		opts := &LexerOptions{
+			ValidateCRC: true,
+			Decompressors: map[string]func(io.Reader) (io.Reader, error){
+				"xor": func(r io.Reader) (io.Reader, error) {
+					return &xorReader{r: r, key: 0x5a}, nil
+				},
+			},
+		}
+		for _, p := range []*DecoderPool{nil, pool} {
+			it, err := ParallelMessagesWithPool(bytes.NewReader(data), int64(len(data)), 2, p, opts)
+			assert.Nil(t, err)
+			var messages []string
+			assert.Nil(t, Range(it, func(_ *Schema, _ *Channel, m *Message) error {
+				messages = append(messages, string(m.Data))
+				return nil
+			}))
+			assert.Equal(t, expected, messages)
+		}
+	})
+	t.Run("respects the decompression budget", func(t *testing.T) {
+		info, err := readInfo(bytes.NewReader(data), int64(len(data)))
+		assert.Nil(t, err)
+		assert.Greater(t, len(info.ChunkIndexes), 2)
+		budget := 0
+		for _, idx := range info.ChunkIndexes[:2] {
+			budget += int(idx.UncompressedSize)
+		}
+		for _, p := range []*DecoderPool{nil, pool} {
+			it, err := ParallelMessagesWithPool(bytes.NewReader(data), int64(len(data)), 8, p,
+				&LexerOptions{MaxTotalDecompressedBytes: budget})
+			assert.Nil(t, err)
+			count := 0
+			for {
+				_, _, _, err = it.Next(nil)
+				if err != nil {
+					break
+				}
+				count++
+			}
+			assert.ErrorIs(t, err, ErrDecompressionBudgetExceeded)
+			// log times are sequential, so the chunks' time ranges give their message counts.
+			assert.Equal(t, int(info.ChunkIndexes[1].MessageEndTime-info.ChunkIndexes[0].MessageStartTime)+1, count)
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package mcap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ParsedRecord is a record parsed by Lexer.ParseConcurrently. Record holds a
+// pointer to the parsed struct for the token type, such as a *Schema for
+// TokenSchema. Records with unrecognized opcodes, returned as TokenUnknown with
+// LexerOptions.EmitUnknownRecords, are not parsed, and Record holds a copy of
+// their bytes.
+type ParsedRecord struct {
+	TokenType TokenType
+	Record    any
+}
+
+type parseJob struct {
+	tokenType TokenType
+	data      []byte
+	result    chan<- parseResult
+}
+
+type parseResult struct {
+	record ParsedRecord
+	err    error
+}
+
+// ParseConcurrently reads tokens from the lexer and parses them on a pool of
+// worker goroutines, sending the parsed records to out in the order they were
+// read. Each token's bytes are copied before being handed to a worker, so the
+// lexer's buffer may be reused while parsing is in progress. At most workers
+// records are in flight at once. ParseConcurrently closes out when it
+// returns. It returns nil at the end of the input, the context's error if ctx
+// is canceled, and otherwise the first lexing or parsing error encountered.
+// Chunks that fail CRC validation end parsing with their error, even if they
+// are reported as TokenInvalidChunk with LexerOptions.EmitInvalidChunks.
+func (l *Lexer) ParseConcurrently(ctx context.Context, workers int, out chan<- ParsedRecord) error {
+	defer close(out)
+	if workers < 1 {
+		return fmt.Errorf("worker count must be positive, got %d", workers)
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan parseJob)
+	// pending holds the result channel of each job in the order the tokens
+	// were read, and bounds the number of records in flight.
+	pending := make(chan chan parseResult, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				record, err := parseToken(job.tokenType, job.data)
+				job.result <- parseResult{
+					record: ParsedRecord{TokenType: job.tokenType, Record: record},
+					err:    err,
+				}
+			}
+		}()
+	}
+	lexErr := make(chan error, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(jobs)
+		defer close(pending)
+		lexErr <- l.dispatch(ctx, jobs, pending)
+	}()
+
+	for resultChan := range pending {
+		var result parseResult
+		select {
+		case result = <-resultChan:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if result.err != nil {
+			return result.err
+		}
+		select {
+		case out <- result.record:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return <-lexErr
+}
+
+// dispatch copies each token read from the lexer into a job, registering the
+// job's result channel in pending before handing it to the workers.
+func (l *Lexer) dispatch(ctx context.Context, jobs chan<- parseJob, pending chan<- chan parseResult) error {
+	var buf []byte
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		tokenType, data, err := l.Next(buf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if len(data) > len(buf) {
+			buf = data
+		}
+		result := make(chan parseResult, 1)
+		job := parseJob{
+			tokenType: tokenType,
+			data:      append([]byte{}, data...),
+			result:    result,
+		}
+		select {
+		case pending <- result:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		select {
+		case jobs <- job:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// parseToken parses the bytes of a token into the struct for its type.
+// Records with unrecognized opcodes are returned as is.
+func parseToken(tokenType TokenType, data []byte) (any, error) {
+	if tokenType == TokenUnknown {
+		return data, nil
+	}
+	rt, ok := recordTypes[tokenType]
+	if !ok {
+		return nil, fmt.Errorf("unexpected %s token", tokenType)
+	}
+	record, err := rt.parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", tokenType, err)
+	}
+	return record, nil
+}
@@ -0,0 +1,118 @@
+package mcap
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLexerParseConcurrently(t *testing.T) {
+	logTimes := make([]uint64, 200)
+	for i := range logTimes {
+		logTimes[i] = uint64(i)
+	}
+	data := writeTestFile(t, &WriterOptions{
+		Chunked:     true,
+		ChunkSize:   100,
+		Compression: CompressionLZ4,
+	}, []string{"/a", "/b"}, logTimes)
+	t.Run("preserves token order", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(data))
+		assert.Nil(t, err)
+		var expected []TokenType
+		for {
+			tokenType, _, err := lexer.Next(nil)
+			if err != nil {
+				break
+			}
+			expected = append(expected, tokenType)
+		}
+
+		lexer, err = NewLexer(bytes.NewReader(data))
+		assert.Nil(t, err)
+		out := make(chan ParsedRecord)
+		errs := make(chan error, 1)
+		go func() {
+			errs <- lexer.ParseConcurrently(context.Background(), 8, out)
+		}()
+		var tokenTypes []TokenType
+		var messageLogTimes []uint64
+		for record := range out {
+			tokenTypes = append(tokenTypes, record.TokenType)
+			if message, ok := record.Record.(*Message); ok {
+				assert.Equal(t, []byte{byte(message.LogTime)}, message.Data)
+				messageLogTimes = append(messageLogTimes, message.LogTime)
+			}
+		}
+		assert.Nil(t, <-errs)
+		assert.Equal(t, expected, tokenTypes)
+		assert.Equal(t, logTimes, messageLogTimes)
+	})
+	t.Run("returns parse errors", func(t *testing.T) {
+		// a header with empty profile and library, followed by an empty schema
+		validHeader := append([]byte{byte(OpHeader), 8, 0, 0, 0, 0, 0, 0, 0}, make([]byte, 8)...)
+		input := file(validHeader, record(OpSchema), footer())
+		lexer, err := NewLexer(bytes.NewReader(input))
+		assert.Nil(t, err)
+		out := make(chan ParsedRecord, 10)
+		err = lexer.ParseConcurrently(context.Background(), 2, out)
+		assert.Contains(t, err.Error(), "failed to parse schema")
+		var tokenTypes []TokenType
+		for record := range out {
+			tokenTypes = append(tokenTypes, record.TokenType)
+		}
+		assert.Equal(t, []TokenType{TokenHeader}, tokenTypes)
+	})
+	t.Run("stops on cancellation", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(data))
+		assert.Nil(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		out := make(chan ParsedRecord)
+		errs := make(chan error, 1)
+		go func() {
+			errs <- lexer.ParseConcurrently(ctx, 4, out)
+		}()
+		record := <-out
+		assert.Equal(t, TokenHeader, record.TokenType)
+		cancel()
+		for range out {
+		}
+		assert.ErrorIs(t, <-errs, context.Canceled)
+	})
+	t.Run("passes on unknown records", func(t *testing.T) {
+		unknown := flatten([]byte{0x80}, encodedUint64(3), []byte{1, 2, 3})
+		lexer, err := NewLexer(bytes.NewReader(unknown), &LexerOptions{
+			SkipMagic:          true,
+			EmitUnknownRecords: true,
+		})
+		assert.Nil(t, err)
+		out := make(chan ParsedRecord, 10)
+		assert.Nil(t, lexer.ParseConcurrently(context.Background(), 2, out))
+		var records []ParsedRecord
+		for record := range out {
+			records = append(records, record)
+		}
+		assert.Equal(t, []ParsedRecord{{TokenType: TokenUnknown, Record: []byte{1, 2, 3}}}, records)
+	})
+	t.Run("returns invalid chunk errors", func(t *testing.T) {
+		corrupt := chunk(t, CompressionLZ4, true, channelInfo(), message())
+		corrupt[9+8+8+8] ^= 0xff // uncompressed CRC
+		lexer, err := NewLexer(bytes.NewReader(flatten(corrupt, footer())), &LexerOptions{
+			SkipMagic:         true,
+			ValidateCRC:       true,
+			EmitInvalidChunks: true,
+		})
+		assert.Nil(t, err)
+		out := make(chan ParsedRecord, 10)
+		err = lexer.ParseConcurrently(context.Background(), 2, out)
+		assert.ErrorIs(t, err, ErrInvalidChunkCRC)
+	})
+	t.Run("rejects invalid worker count", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(data))
+		assert.Nil(t, err)
+		err = lexer.ParseConcurrently(context.Background(), 0, make(chan ParsedRecord))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,352 @@
+package mcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Passthrough copies an MCAP file from r to w, reproducing the records of its
+// data section byte for byte: chunks are copied verbatim with their original
+// chunking and compression, and records keep their order, including padding
+// and records with unrecognized opcodes. If regenSummary is false, the summary
+// section and footer are copied verbatim too, and the output is identical to
+// the input. Otherwise, everything following the Data End record is replaced
+// by a summary section rebuilt from the data section, with CRCs.
+func Passthrough(w io.Writer, r io.Reader, regenSummary bool) error {
+	p := &passthrough{}
+	return p.copy(w, r, regenSummary)
+}
+
+// ChunkTimeRepair describes a chunk or chunk index record whose message start
+// time was found after its message end time by RepairChunkTimes.
+type ChunkTimeRepair struct {
+	// ChunkStartOffset is the offset of the chunk, in both input and output.
+	ChunkStartOffset uint64
+	// Index is true if the times were found in a chunk index record of the
+	// summary section, and false if in the chunk record itself.
+	Index        bool
+	OldStartTime uint64
+	OldEndTime   uint64
+	StartTime    uint64
+	EndTime      uint64
+}
+
+// RepairChunkTimes copies an MCAP file from r to w as Passthrough does with a
+// regenerated summary, repairing chunks whose message start time is after
+// their message end time. The times in the chunk record are recomputed from
+// the log times of the chunk's messages, or swapped if the chunk holds no
+// messages, without changing the length of the record or the offsets of the
+// file. The chunk indexes of the regenerated summary are built from the
+// repaired chunks. Each repaired chunk, and each chunk index record of the
+// input's summary that had its times inverted, is reported.
+func RepairChunkTimes(w io.Writer, r io.Reader) ([]ChunkTimeRepair, error) {
+	p := &passthrough{repairChunkTimes: true}
+	err := p.copy(w, r, true)
+	return p.repairs, err
+}
+
+func (p *passthrough) copy(w io.Writer, r io.Reader, regenSummary bool) error {
+	lexer, err := NewLexer(r, &LexerOptions{EmitChunks: true})
+	if err != nil {
+		return err
+	}
+	writer, err := NewWriter(w, &WriterOptions{IncludeCRC: true})
+	if err != nil {
+		return err
+	}
+	p.writer = writer
+	defer p.decompressor.close()
+	dataEnded := false
+	lexer.onUnrecognized = func(opcode OpCode, recordLen uint64) (io.Writer, error) {
+		if regenSummary && dataEnded {
+			return io.Discard, nil
+		}
+		prefix := make([]byte, 9)
+		prefix[0] = byte(opcode)
+		putUint64(prefix[1:], recordLen)
+		if _, err := writer.w.Write(prefix); err != nil {
+			return nil, err
+		}
+		return writer.w, nil
+	}
+	var buf []byte
+	for {
+		tokenType, record, err := lexer.Next(buf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		if len(record) > len(buf) {
+			buf = record
+		}
+		if regenSummary && dataEnded {
+			if p.repairChunkTimes && tokenType == TokenChunkIndex {
+				if err := p.checkChunkIndexTimes(record); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		rt, ok := recordTypes[tokenType]
+		if !ok {
+			return fmt.Errorf("unexpected %s token", tokenType)
+		}
+		opcode := rt.opcode
+		offset := writer.w.Size()
+		if p.repairChunkTimes && tokenType == TokenChunk {
+			if err := p.repairChunk(offset, record); err != nil {
+				return err
+			}
+		}
+		if tokenType == TokenDataEnd && len(p.repairs) > 0 {
+			// the repaired chunks invalidate the input's data section CRC.
+			dataEnd, err := ParseDataEnd(record)
+			if err != nil {
+				return fmt.Errorf("failed to parse data end: %w", err)
+			}
+			if dataEnd.DataSectionCRC != 0 {
+				putUint32(record, writer.w.Checksum())
+			}
+		}
+		if _, err := writer.writeRecord(writer.w, opcode, record); err != nil {
+			return err
+		}
+		if tokenType == TokenDataEnd {
+			dataEnded = true
+			continue
+		}
+		if tokenType == TokenFooter {
+			if regenSummary {
+				return fmt.Errorf("file has no data end record")
+			}
+			_, err := writer.w.Write(Magic)
+			return err
+		}
+		if regenSummary {
+			if err := p.observe(tokenType, offset, record); err != nil {
+				return err
+			}
+		}
+	}
+	if !dataEnded {
+		return fmt.Errorf("file has no data end record")
+	}
+	if !regenSummary {
+		return fmt.Errorf("file has no footer")
+	}
+	writer.closed = true
+	return writer.writeSummaryAndFooter()
+}
+
+// passthrough accumulates the state of the summary section in its writer from
+// the records copied to the data section.
+type passthrough struct {
+	writer       *Writer
+	decompressor chunkDecompressor
+	// chunkIndex is the index of the last chunk, while its message indexes
+	// are being copied.
+	chunkIndex *ChunkIndex
+
+	repairChunkTimes bool
+	repairs          []ChunkTimeRepair
+}
+
+// repairChunk rewrites the message start and end times in a chunk record in
+// place if the start time is after the end time.
+func (p *passthrough) repairChunk(offset uint64, record []byte) error {
+	chunk, err := ParseChunk(record)
+	if err != nil {
+		return fmt.Errorf("failed to parse chunk: %w", err)
+	}
+	if chunk.MessageStartTime <= chunk.MessageEndTime {
+		return nil
+	}
+	data, err := p.decompressor.decompress(chunk)
+	if err != nil {
+		return err
+	}
+	start, end := chunk.MessageEndTime, chunk.MessageStartTime
+	found := false
+	err = forEachRecord(data, func(opcode OpCode, record []byte) error {
+		if opcode != OpMessage {
+			return nil
+		}
+		if len(record) < 2+4+8 {
+			return io.ErrShortBuffer
+		}
+		logTime := binary.LittleEndian.Uint64(record[2+4:])
+		if !found || logTime < start {
+			start = logTime
+		}
+		if !found || logTime > end {
+			end = logTime
+		}
+		found = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	p.repairs = append(p.repairs, ChunkTimeRepair{
+		ChunkStartOffset: offset,
+		OldStartTime:     chunk.MessageStartTime,
+		OldEndTime:       chunk.MessageEndTime,
+		StartTime:        start,
+		EndTime:          end,
+	})
+	putUint64(record, start)
+	putUint64(record[8:], end)
+	return nil
+}
+
+// checkChunkIndexTimes reports a chunk index record of the input's summary
+// with inverted times, along with the times of the repaired chunk.
+func (p *passthrough) checkChunkIndexTimes(record []byte) error {
+	idx, err := ParseChunkIndex(record)
+	if err != nil {
+		return fmt.Errorf("failed to parse chunk index: %w", err)
+	}
+	if idx.MessageStartTime <= idx.MessageEndTime {
+		return nil
+	}
+	repair := ChunkTimeRepair{
+		ChunkStartOffset: idx.ChunkStartOffset,
+		Index:            true,
+		OldStartTime:     idx.MessageStartTime,
+		OldEndTime:       idx.MessageEndTime,
+		StartTime:        idx.MessageEndTime,
+		EndTime:          idx.MessageStartTime,
+	}
+	for _, chunkIndex := range p.writer.ChunkIndexes {
+		if chunkIndex.ChunkStartOffset == idx.ChunkStartOffset {
+			repair.StartTime = chunkIndex.MessageStartTime
+			repair.EndTime = chunkIndex.MessageEndTime
+			break
+		}
+	}
+	p.repairs = append(p.repairs, repair)
+	return nil
+}
+
+func (p *passthrough) observe(tokenType TokenType, offset uint64, record []byte) error {
+	length := uint64(1 + 8 + len(record))
+	if tokenType == TokenMessageIndex && p.chunkIndex != nil {
+		if len(record) < 2 {
+			return io.ErrShortBuffer
+		}
+		p.chunkIndex.MessageIndexOffsets[binary.LittleEndian.Uint16(record)] = offset
+		p.chunkIndex.MessageIndexLength += length
+		return nil
+	}
+	p.chunkIndex = nil
+	switch tokenType {
+	case TokenChunk:
+		chunk, err := ParseChunk(record)
+		if err != nil {
+			return fmt.Errorf("failed to parse chunk: %w", err)
+		}
+		data, err := p.decompressor.decompress(chunk)
+		if err != nil {
+			return err
+		}
+		if err := p.observeChunkRecords(data); err != nil {
+			return err
+		}
+		p.chunkIndex = &ChunkIndex{
+			MessageStartTime:    chunk.MessageStartTime,
+			MessageEndTime:      chunk.MessageEndTime,
+			ChunkStartOffset:    offset,
+			ChunkLength:         length,
+			MessageIndexOffsets: make(map[uint16]uint64),
+			Compression:         CompressionFormat(chunk.Compression),
+			CompressedSize:      uint64(len(chunk.Records)),
+			UncompressedSize:    chunk.UncompressedSize,
+		}
+		p.writer.ChunkIndexes = append(p.writer.ChunkIndexes, p.chunkIndex)
+		p.writer.Statistics.ChunkCount++
+	case TokenAttachment:
+		attachment, err := ParseAttachment(record)
+		if err != nil {
+			return fmt.Errorf("failed to parse attachment: %w", err)
+		}
+		p.writer.AttachmentIndexes = append(p.writer.AttachmentIndexes, &AttachmentIndex{
+			Offset:     offset,
+			Length:     length,
+			LogTime:    attachment.LogTime,
+			CreateTime: attachment.CreateTime,
+			DataSize:   uint64(len(attachment.Data)),
+			Name:       attachment.Name,
+			MediaType:  attachment.MediaType,
+		})
+		p.writer.Statistics.AttachmentCount++
+	case TokenMetadata:
+		metadata, err := ParseMetadata(record)
+		if err != nil {
+			return fmt.Errorf("failed to parse metadata: %w", err)
+		}
+		p.writer.MetadataIndexes = append(p.writer.MetadataIndexes, &MetadataIndex{
+			Offset: offset,
+			Length: length,
+			Name:   metadata.Name,
+		})
+		p.writer.Statistics.MetadataCount++
+	default:
+		return p.observeRecord(recordTypes[tokenType].opcode, record)
+	}
+	return nil
+}
+
+// observeChunkRecords observes the records in the decompressed contents of a
+// chunk.
+func (p *passthrough) observeChunkRecords(data []byte) error {
+	return forEachRecord(data, p.observeRecord)
+}
+
+// forEachRecord calls f with the opcode and body of each record in the
+// decompressed contents of a chunk.
+func forEachRecord(data []byte, f func(opcode OpCode, record []byte) error) error {
+	var offset uint64
+	for offset < uint64(len(data)) {
+		if uint64(len(data))-offset < 9 {
+			return io.ErrShortBuffer
+		}
+		recordLen := binary.LittleEndian.Uint64(data[offset+1:])
+		if recordLen > uint64(len(data))-offset-9 {
+			return io.ErrShortBuffer
+		}
+		if err := f(OpCode(data[offset]), data[offset+9:offset+9+recordLen]); err != nil {
+			return err
+		}
+		offset += 9 + recordLen
+	}
+	return nil
+}
+
+// observeRecord observes the schemas, channels, and messages that may occur
+// both inside and outside of chunks.
+func (p *passthrough) observeRecord(opcode OpCode, record []byte) error {
+	switch opcode {
+	case OpSchema:
+		schema, err := ParseSchema(record)
+		if err != nil {
+			return fmt.Errorf("failed to parse schema: %w", err)
+		}
+		p.writer.registerSchema(schema)
+	case OpChannel:
+		channel, err := ParseChannel(record)
+		if err != nil {
+			return fmt.Errorf("failed to parse channel: %w", err)
+		}
+		p.writer.registerChannel(channel)
+	case OpMessage:
+		if len(record) < 2+4+8 {
+			return io.ErrShortBuffer
+		}
+		p.writer.observeMessage(binary.LittleEndian.Uint16(record), binary.LittleEndian.Uint64(record[2+4:]))
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package mcap
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writePassthroughTestFile(t *testing.T, opts *WriterOptions) []byte {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, opts)
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{Profile: "test"}))
+	_, err = w.WriteSchema(&Schema{ID: 1, Name: "schema", Encoding: "jsonschema", Data: []byte("{}")})
+	assert.Nil(t, err)
+	for _, channelID := range []uint16{1, 2} {
+		_, err = w.WriteChannel(&Channel{ID: channelID, SchemaID: 1, Topic: string(rune('a' + channelID)), MessageEncoding: "json"})
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: uint16(i%2 + 1), LogTime: uint64(i), Data: []byte("hello")}))
+		if i == 50 {
+			assert.Nil(t, w.WriteAttachment(&Attachment{Name: "a.txt", MediaType: "text/plain", Data: []byte{1, 2, 3}}))
+			assert.Nil(t, w.WriteMetadata(&Metadata{Name: "meta", Metadata: map[string]string{"k": "v"}}))
+		}
+	}
+	assert.Nil(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestPassthrough(t *testing.T) {
+	for _, compression := range []CompressionFormat{CompressionZSTD, CompressionLZ4, CompressionNone} {
+		input := writePassthroughTestFile(t, &WriterOptions{
+			Chunked:     true,
+			ChunkSize:   256,
+			Compression: compression,
+			IncludeCRC:  true,
+		})
+		t.Run(string(compression)+" verbatim", func(t *testing.T) {
+			output := &bytes.Buffer{}
+			assert.Nil(t, Passthrough(output, bytes.NewReader(input), false))
+			assert.Equal(t, input, output.Bytes())
+		})
+		t.Run(string(compression)+" regenerated summary", func(t *testing.T) {
+			output := &bytes.Buffer{}
+			assert.Nil(t, Passthrough(output, bytes.NewReader(input), true))
+			assert.Equal(t, input, output.Bytes())
+		})
+	}
+	t.Run("unchunked", func(t *testing.T) {
+		input := writePassthroughTestFile(t, &WriterOptions{IncludeCRC: true})
+		output := &bytes.Buffer{}
+		assert.Nil(t, Passthrough(output, bytes.NewReader(input), true))
+		assert.Equal(t, input, output.Bytes())
+	})
+	t.Run("regenerates a missing summary", func(t *testing.T) {
+		input := writePassthroughTestFile(t, &WriterOptions{
+			Chunked:                  true,
+			ChunkSize:                256,
+			Compression:              CompressionZSTD,
+			SkipStatistics:           true,
+			SkipRepeatedSchemas:      true,
+			SkipRepeatedChannelInfos: true,
+			SkipAttachmentIndex:      true,
+			SkipMetadataIndex:        true,
+			SkipChunkIndex:           true,
+			SkipSummaryOffsets:       true,
+		})
+		output := &bytes.Buffer{}
+		assert.Nil(t, Passthrough(output, bytes.NewReader(input), true))
+		dataEnd := len(input) - len(Magic) - (1 + 8 + 20) - (1 + 8 + 4)
+		assert.Equal(t, input[:dataEnd], output.Bytes()[:dataEnd])
+
+		reader, err := NewReader(bytes.NewReader(output.Bytes()))
+		assert.Nil(t, err)
+		info, err := reader.Info()
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(100), info.Statistics.MessageCount)
+		assert.Equal(t, uint64(50), info.Statistics.ChannelMessageCounts[1])
+		assert.Equal(t, uint32(1), info.Statistics.AttachmentCount)
+		assert.Equal(t, uint32(1), info.Statistics.MetadataCount)
+		assert.Equal(t, int(info.Statistics.ChunkCount), len(info.ChunkIndexes))
+		assert.Equal(t, 2, len(info.Channels))
+		assert.Equal(t, 1, len(info.AttachmentIndexes))
+		assert.Equal(t, 1, len(info.MetadataIndexes))
+		assert.False(t, info.SummaryIncomplete)
+		it, err := reader.Messages()
+		assert.Nil(t, err)
+		count := 0
+		assert.Nil(t, Range(it, func(*Schema, *Channel, *Message) error {
+			count++
+			return nil
+		}))
+		assert.Equal(t, 100, count)
+	})
+	t.Run("preserves unrecognized records", func(t *testing.T) {
+		input := writePassthroughTestFile(t, &WriterOptions{IncludeCRC: true})
+		// insert a padding record after the header.
+		headerEnd := len(Magic) + 1 + 8 + 4 + len("test") + 4 + len("mcap go "+Version)
+		padded := append([]byte{}, input[:headerEnd]...)
+		padded = append(padded, 0xff, 3, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3)
+		padded = append(padded, input[headerEnd:]...)
+		output := &bytes.Buffer{}
+		assert.Nil(t, Passthrough(output, bytes.NewReader(padded), false))
+		assert.Equal(t, padded, output.Bytes())
+	})
+	t.Run("truncated file", func(t *testing.T) {
+		input := writePassthroughTestFile(t, &WriterOptions{Chunked: true, Compression: CompressionZSTD})
+		assert.Error(t, Passthrough(&bytes.Buffer{}, bytes.NewReader(input[:len(input)/2]), true))
+	})
+}
+
+func TestRepairChunkTimes(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{
+		Chunked:     true,
+		ChunkSize:   256,
+		Compression: CompressionZSTD,
+		IncludeCRC:  true,
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{Profile: "test"}))
+	_, err = w.WriteSchema(&Schema{ID: 1, Name: "schema", Encoding: "jsonschema", Data: []byte("{}")})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 1, SchemaID: 1, Topic: "a", MessageEncoding: "json"})
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: uint64(i), Data: []byte("hello")}))
+	}
+	// invert the times of the first chunk in its summary index only.
+	assert.Nil(t, w.Flush())
+	expected := make([]ChunkIndex, len(w.ChunkIndexes))
+	for i, idx := range w.ChunkIndexes {
+		expected[i] = *idx
+	}
+	first := w.ChunkIndexes[0]
+	first.MessageStartTime, first.MessageEndTime = first.MessageEndTime, first.MessageStartTime
+	assert.Nil(t, w.Close())
+	input := buf.Bytes()
+	// invert the times of the second chunk in the chunk record only.
+	second := expected[1]
+	putUint64(input[second.ChunkStartOffset+9:], second.MessageEndTime)
+	putUint64(input[second.ChunkStartOffset+9+8:], second.MessageStartTime)
+
+	output := &bytes.Buffer{}
+	repairs, err := RepairChunkTimes(output, bytes.NewReader(input))
+	assert.Nil(t, err)
+	assert.Equal(t, []ChunkTimeRepair{
+		{
+			ChunkStartOffset: second.ChunkStartOffset,
+			OldStartTime:     second.MessageEndTime,
+			OldEndTime:       second.MessageStartTime,
+			StartTime:        second.MessageStartTime,
+			EndTime:          second.MessageEndTime,
+		},
+		{
+			ChunkStartOffset: expected[0].ChunkStartOffset,
+			Index:            true,
+			OldStartTime:     expected[0].MessageEndTime,
+			OldEndTime:       expected[0].MessageStartTime,
+			StartTime:        expected[0].MessageStartTime,
+			EndTime:          expected[0].MessageEndTime,
+		},
+	}, repairs)
+
+	info, err := readInfo(bytes.NewReader(output.Bytes()), int64(output.Len()))
+	assert.Nil(t, err)
+	assert.Equal(t, len(expected), len(info.ChunkIndexes))
+	for i, idx := range info.ChunkIndexes {
+		assert.Equal(t, expected[i].MessageStartTime, idx.MessageStartTime)
+		assert.Equal(t, expected[i].MessageEndTime, idx.MessageEndTime)
+	}
+	chunk, err := readChunkAt(bytes.NewReader(output.Bytes()), info.ChunkIndexes[1])
+	assert.Nil(t, err)
+	assert.Equal(t, second.MessageStartTime, chunk.MessageStartTime)
+	assert.Equal(t, second.MessageEndTime, chunk.MessageEndTime)
+
+	t.Run("updates the data section CRC", func(t *testing.T) {
+		// make the input's data section CRC consistent with its inverted
+		// chunk times.
+		footer, err := ReadFooter(bytes.NewReader(input))
+		assert.Nil(t, err)
+		dataEndOffset := footer.SummaryStart - 9 - 4
+		assert.Equal(t, byte(OpDataEnd), input[dataEndOffset])
+		putUint32(input[dataEndOffset+9:], crc32.ChecksumIEEE(input[:dataEndOffset]))
+		assert.Nil(t, TeeValidate(io.Discard, io.Discard, bytes.NewReader(input)))
+
+		output := &bytes.Buffer{}
+		_, err = RepairChunkTimes(output, bytes.NewReader(input))
+		assert.Nil(t, err)
+		assert.Nil(t, TeeValidate(io.Discard, io.Discard, bytes.NewReader(output.Bytes())))
+	})
+}
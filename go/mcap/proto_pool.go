@@ -0,0 +1,90 @@
+package mcap
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// BuildProtoPool parses the FileDescriptorSet of every schema with protobuf
+// encoding in a file and registers the descriptors in a single pool, so that
+// any message type in the file may be resolved by its full name. Files shared
+// between schemas, such as common dependencies, are registered once; an error
+// is returned if two schemas carry different descriptors under the same file
+// name. Dependencies absent from the file, such as the well-known types, are
+// taken from the global registry if they are linked into the program.
+func BuildProtoPool(r io.ReaderAt, size int64) (*protoregistry.Files, error) {
+	schemas, _, err := readSchemasAndChannels(r, size)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint16, 0, len(schemas))
+	for id := range schemas {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	descriptors := make(map[string]*descriptorpb.FileDescriptorProto)
+	for _, id := range ids {
+		schema := schemas[id]
+		if schema.Encoding != "protobuf" {
+			continue
+		}
+		set := &descriptorpb.FileDescriptorSet{}
+		if err := proto.Unmarshal(schema.Data, set); err != nil {
+			return nil, fmt.Errorf("failed to parse descriptor set of schema %q: %w", schema.Name, err)
+		}
+		for _, file := range set.File {
+			existing, ok := descriptors[file.GetName()]
+			if ok && !proto.Equal(existing, file) {
+				return nil, fmt.Errorf("schema %q has conflicting definition of %s", schema.Name, file.GetName())
+			}
+			descriptors[file.GetName()] = file
+		}
+	}
+	names := make([]string, 0, len(descriptors))
+	for name := range descriptors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pool := &protoregistry.Files{}
+	registering := make(map[string]bool)
+	var register func(name string) error
+	register = func(name string) error {
+		if _, err := pool.FindFileByPath(name); err == nil {
+			return nil
+		}
+		file, ok := descriptors[name]
+		if !ok {
+			global, err := protoregistry.GlobalFiles.FindFileByPath(name)
+			if err != nil {
+				return fmt.Errorf("file %s not found", name)
+			}
+			return pool.RegisterFile(global)
+		}
+		if registering[name] {
+			return fmt.Errorf("import cycle in %s", name)
+		}
+		registering[name] = true
+		for _, dependency := range file.GetDependency() {
+			if err := register(dependency); err != nil {
+				return fmt.Errorf("failed to resolve dependency of %s: %w", name, err)
+			}
+		}
+		fd, err := protodesc.NewFile(file, pool)
+		if err != nil {
+			return fmt.Errorf("failed to build descriptor of %s: %w", name, err)
+		}
+		return pool.RegisterFile(fd)
+	}
+	for _, name := range names {
+		if err := register(name); err != nil {
+			return nil, err
+		}
+	}
+	return pool, nil
+}
@@ -0,0 +1,96 @@
+package mcap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func protoFile(name string, dependencies []string, message string, fields ...*descriptorpb.FieldDescriptorProto) *descriptorpb.FileDescriptorProto {
+	return &descriptorpb.FileDescriptorProto{
+		Name:       proto.String(name),
+		Package:    proto.String("pkg"),
+		Dependency: dependencies,
+		Syntax:     proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String(message), Field: fields},
+		},
+	}
+}
+
+func protoField(name string, number int32, typeName string) *descriptorpb.FieldDescriptorProto {
+	field := &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:   descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+	}
+	if typeName != "" {
+		field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		field.TypeName = proto.String(typeName)
+	}
+	return field
+}
+
+func writeProtoFile(t *testing.T, sets ...*descriptorpb.FileDescriptorSet) []byte {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{Chunked: true})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	for i, set := range sets {
+		data, err := proto.Marshal(set)
+		assert.Nil(t, err)
+		id := uint16(i + 1)
+		name := set.File[0].GetMessageType()[0].GetName()
+		_, err = w.WriteSchema(&Schema{ID: id, Name: "pkg." + name, Encoding: "protobuf", Data: data})
+		assert.Nil(t, err)
+		_, err = w.WriteChannel(&Channel{ID: id, SchemaID: id, Topic: name, MessageEncoding: "protobuf"})
+		assert.Nil(t, err)
+	}
+	_, err = w.WriteSchema(&Schema{ID: 100, Name: "other", Encoding: "jsonschema", Data: []byte("{}")})
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestBuildProtoPool(t *testing.T) {
+	common := protoFile("common.proto", nil, "Common", protoField("name", 1, ""))
+	a := protoFile("a.proto", []string{"common.proto"}, "A", protoField("common", 1, ".pkg.Common"))
+	b := protoFile("b.proto", []string{"common.proto", "google/protobuf/timestamp.proto"}, "B",
+		protoField("common", 1, ".pkg.Common"),
+		protoField("stamp", 2, ".google.protobuf.Timestamp"),
+	)
+	t.Run("merges schemas", func(t *testing.T) {
+		data := writeProtoFile(t,
+			&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{a, common}},
+			&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{b, common}},
+		)
+		pool, err := BuildProtoPool(bytes.NewReader(data), int64(len(data)))
+		assert.Nil(t, err)
+		assert.Equal(t, 4, pool.NumFiles())
+		for _, name := range []string{"pkg.A", "pkg.B", "pkg.Common", "google.protobuf.Timestamp"} {
+			descriptor, err := pool.FindDescriptorByName(protoreflect.FullName(name))
+			assert.Nil(t, err)
+			assert.Equal(t, name, string(descriptor.FullName()))
+		}
+	})
+	t.Run("rejects conflicting definitions", func(t *testing.T) {
+		conflicting := protoFile("common.proto", nil, "Common", protoField("id", 1, ""))
+		data := writeProtoFile(t,
+			&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{a, common}},
+			&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{b, conflicting}},
+		)
+		_, err := BuildProtoPool(bytes.NewReader(data), int64(len(data)))
+		assert.Contains(t, err.Error(), "conflicting definition of common.proto")
+	})
+	t.Run("reports missing dependencies", func(t *testing.T) {
+		data := writeProtoFile(t, &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{a}})
+		_, err := BuildProtoPool(bytes.NewReader(data), int64(len(data)))
+		assert.Contains(t, err.Error(), "file common.proto not found")
+	})
+}
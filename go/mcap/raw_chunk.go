@@ -0,0 +1,54 @@
+package mcap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrChunkNotFound indicates that no chunk matched a lookup.
+var ErrChunkNotFound = errors.New("chunk not found")
+
+// RawChunkForTime returns the raw chunk record, including its opcode and
+// length prefix, of the first chunk in the file whose message time range
+// contains t and which contains messages on the given channel. The chunk is
+// returned still compressed, along with its chunk index. Chunks are matched to
+// channels using the message index offsets in their chunk index, so files
+// written without message indexes have no matching chunks. If no chunk
+// matches, ErrChunkNotFound is returned.
+func RawChunkForTime(r io.ReaderAt, size int64, channelID uint16, t uint64) ([]byte, *ChunkIndex, error) {
+	info, err := readInfo(r, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	var match *ChunkIndex
+	for _, idx := range info.ChunkIndexes {
+		if t < idx.MessageStartTime || t > idx.MessageEndTime {
+			continue
+		}
+		if _, ok := idx.MessageIndexOffsets[channelID]; !ok {
+			continue
+		}
+		if match == nil || idx.ChunkStartOffset < match.ChunkStartOffset {
+			match = idx
+		}
+	}
+	if match == nil {
+		return nil, nil, fmt.Errorf("%w: no chunk on channel %d contains time %d", ErrChunkNotFound, channelID, t)
+	}
+	if match.ChunkLength < 9 {
+		return nil, nil, fmt.Errorf("invalid chunk length %d at chunk offset %d", match.ChunkLength, match.ChunkStartOffset)
+	}
+	record, err := makeSafe(match.ChunkLength)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = r.ReadAt(record, int64(match.ChunkStartOffset))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read chunk: %w", err)
+	}
+	if OpCode(record[0]) != OpChunk {
+		return nil, nil, fmt.Errorf("unexpected %s record at chunk offset %d", OpCode(record[0]), match.ChunkStartOffset)
+	}
+	return record, match, nil
+}
@@ -0,0 +1,82 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRawChunkForTime(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{Chunked: true, Compression: CompressionZSTD})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	_, err = w.WriteSchema(&Schema{ID: 1})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 1, SchemaID: 1, Topic: "/a"})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 2, SchemaID: 1, Topic: "/b"})
+	assert.Nil(t, err)
+	// chunk 0 covers [10, 20] on channel 1; chunk 1 covers [15, 30] on both.
+	assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: 10}))
+	assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: 20}))
+	assert.Nil(t, w.Flush())
+	assert.Nil(t, w.WriteMessage(&Message{ChannelID: 2, LogTime: 15}))
+	assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: 30, Data: []byte("last")}))
+	assert.Nil(t, w.Close())
+	data := buf.Bytes()
+
+	cases := []struct {
+		assertion string
+		channelID uint16
+		time      uint64
+		chunk     int
+	}{
+		{"first matching chunk in file order", 1, 17, 0},
+		{"chunk containing channel", 2, 17, 1},
+		{"inclusive end time", 1, 30, 1},
+	}
+	for _, c := range cases {
+		t.Run(c.assertion, func(t *testing.T) {
+			record, idx, err := RawChunkForTime(bytes.NewReader(data), int64(len(data)), c.channelID, c.time)
+			assert.Nil(t, err)
+			assert.Equal(t, w.ChunkIndexes[c.chunk], idx)
+			assert.Equal(t, data[idx.ChunkStartOffset:idx.ChunkStartOffset+idx.ChunkLength], record)
+			// the record can be decompressed by the lexer
+			lexer, err := NewLexer(bytes.NewReader(record), &LexerOptions{SkipMagic: true, ValidateCRC: true})
+			assert.Nil(t, err)
+			messages := 0
+			for {
+				tokenType, _, err := lexer.Next(nil)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				assert.Nil(t, err)
+				if tokenType == TokenMessage {
+					messages++
+				}
+			}
+			assert.Equal(t, 2, messages)
+		})
+	}
+	t.Run("no matching chunk", func(t *testing.T) {
+		_, _, err := RawChunkForTime(bytes.NewReader(data), int64(len(data)), 2, 5)
+		assert.ErrorIs(t, err, ErrChunkNotFound)
+	})
+	t.Run("rejects chunk lengths too short for a record", func(t *testing.T) {
+		footer, err := ReadFooter(bytes.NewReader(data))
+		assert.Nil(t, err)
+		idx := w.ChunkIndexes[0]
+		fields := flatten(encodedUint64(idx.ChunkStartOffset), encodedUint64(idx.ChunkLength))
+		offset := bytes.Index(data[footer.SummaryStart:], fields)
+		assert.Greater(t, offset, 0)
+		corrupt := append([]byte{}, data...)
+		putUint64(corrupt[int(footer.SummaryStart)+offset+8:], 0)
+		_, _, err = RawChunkForTime(bytes.NewReader(corrupt), int64(len(corrupt)), 1, 17)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid chunk length 0")
+	})
+}
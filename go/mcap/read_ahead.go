@@ -0,0 +1,240 @@
+package mcap
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// readAheadItem is a top-level record read ahead of the lexer. Chunk records
+// are decompressed by the workers, which close done once they are finished.
+type readAheadItem struct {
+	// record holds the bytes of the record as read, including its opcode
+	// and length. It is incomplete if reading the record failed.
+	record []byte
+	// err is an error reading the record that is not reproduced by further
+	// reads of the input, returned once the record's bytes are consumed.
+	err  error
+	done chan struct{}
+
+	chunk         bool
+	decompressed  []byte
+	crc           uint32
+	decompressErr error
+}
+
+// readAheadReader reads the top-level records of an input ahead of the lexer,
+// decompressing chunk records concurrently in worker goroutines, and returns
+// the bytes of the input unchanged and in order. The lexer takes the records
+// of each chunk from the worker that decompressed it, rather than
+// decompressing the chunk itself. Reading ahead stops at the footer or at the
+// first record that cannot be read in full, after which reads are passed to
+// the input directly.
+type readAheadReader struct {
+	r     io.Reader
+	items chan *readAheadItem
+
+	current   *readAheadItem
+	offset    int
+	exhausted bool
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// newReadAheadReader starts reading records from r ahead of the lexer, up to
+// depth records, decompressing chunks with up to depth workers. If checksum
+// is set, the workers also compute the CRC of each decompressed chunk. If
+// maxTotalDecompressedBytes is positive, reading ahead stops at the first
+// chunk whose declared size would exceed it, leaving the lexer to reject it.
+func newReadAheadReader(
+	r io.Reader,
+	depth int,
+	maxRecordSize int,
+	maxDecompressedChunkSize int,
+	maxTotalDecompressedBytes int,
+	checksum bool,
+	zstdDictionary []byte,
+) *readAheadReader {
+	ra := &readAheadReader{
+		r:     r,
+		items: make(chan *readAheadItem, depth),
+		stop:  make(chan struct{}),
+	}
+	workers := depth
+	if procs := runtime.GOMAXPROCS(0); workers > procs {
+		workers = procs
+	}
+	jobs := make(chan *readAheadItem, depth)
+	ra.wg.Add(1 + workers)
+	go ra.produce(jobs, maxRecordSize, maxTotalDecompressedBytes)
+	for i := 0; i < workers; i++ {
+		go ra.work(jobs, maxDecompressedChunkSize, checksum, zstdDictionary)
+	}
+	return ra
+}
+
+// produce reads records from the input, dispatching chunks to the workers and
+// queueing every record in file order.
+func (ra *readAheadReader) produce(jobs chan<- *readAheadItem, maxRecordSize int, maxTotalDecompressedBytes int) {
+	defer ra.wg.Done()
+	defer close(ra.items)
+	defer close(jobs)
+	var dispatched uint64
+	for {
+		item := &readAheadItem{done: make(chan struct{})}
+		prefix := make([]byte, 9)
+		n, err := io.ReadFull(ra.r, prefix)
+		if err != nil {
+			item.record = prefix[:n]
+			ra.finish(item, err)
+			return
+		}
+		opcode := OpCode(prefix[0])
+		recordLen := binary.LittleEndian.Uint64(prefix[1:])
+		if maxRecordSize > 0 && recordLen > uint64(maxRecordSize) {
+			// the lexer fails on the record, so it is not read.
+			item.record = prefix
+			ra.finish(item, nil)
+			return
+		}
+		record, err := makeSafe(9 + recordLen)
+		if err != nil {
+			item.record = prefix
+			ra.finish(item, nil)
+			return
+		}
+		copy(record, prefix)
+		n, err = io.ReadFull(ra.r, record[9:])
+		item.record = record[:9+n]
+		if err != nil {
+			ra.finish(item, err)
+			return
+		}
+		if opcode == OpChunk {
+			if maxTotalDecompressedBytes > 0 {
+				// charge the chunk's declared size as the lexer will, so
+				// the workers never decompress beyond the budget.
+				if len(record) < 9+24 {
+					ra.finish(item, nil)
+					return
+				}
+				uncompressedSize := binary.LittleEndian.Uint64(record[9+16:])
+				if uncompressedSize > uint64(maxTotalDecompressedBytes)-dispatched {
+					ra.finish(item, nil)
+					return
+				}
+				dispatched += uncompressedSize
+			}
+			item.chunk = true
+			select {
+			case jobs <- item:
+			case <-ra.stop:
+				return
+			}
+		} else {
+			close(item.done)
+		}
+		select {
+		case ra.items <- item:
+		case <-ra.stop:
+			return
+		}
+		if opcode == OpFooter {
+			return
+		}
+	}
+}
+
+// finish queues the last item read ahead. The end of the input is reproduced
+// by reading it again, but other errors are returned with the item.
+func (ra *readAheadReader) finish(item *readAheadItem, err error) {
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		item.err = err
+	}
+	close(item.done)
+	select {
+	case ra.items <- item:
+	case <-ra.stop:
+	}
+}
+
+func (ra *readAheadReader) work(
+	jobs <-chan *readAheadItem,
+	maxDecompressedChunkSize int,
+	checksum bool,
+	zstdDictionary []byte,
+) {
+	defer ra.wg.Done()
+	decompressor := &chunkDecompressor{zstdDictionary: zstdDictionary}
+	defer decompressor.close()
+	for item := range jobs {
+		select {
+		case <-ra.stop:
+			item.decompressErr = io.EOF
+		default:
+			item.decompressed, item.decompressErr = decompressChunkRecord(
+				decompressor, item.record[9:], false, false, maxDecompressedChunkSize)
+			if item.decompressErr == nil && checksum {
+				item.crc = crc32.ChecksumIEEE(item.decompressed)
+			}
+		}
+		close(item.done)
+	}
+}
+
+func (ra *readAheadReader) Read(p []byte) (int, error) {
+	for {
+		if ra.current != nil {
+			if ra.offset < len(ra.current.record) {
+				n := copy(p, ra.current.record[ra.offset:])
+				ra.offset += n
+				return n, nil
+			}
+			err := ra.current.err
+			ra.current = nil
+			if err != nil {
+				return 0, err
+			}
+		}
+		if ra.exhausted {
+			return ra.r.Read(p)
+		}
+		item, ok := <-ra.items
+		if !ok {
+			ra.exhausted = true
+			continue
+		}
+		ra.current, ra.offset = item, 0
+	}
+}
+
+// decompressedChunk returns the decompressed records of the chunk record
+// being read, and their CRC if the workers compute it, waiting for the worker
+// decompressing it. It returns false if the record being read is not a chunk
+// read ahead or could not be decompressed, in which case the lexer
+// decompresses it itself.
+func (ra *readAheadReader) decompressedChunk() ([]byte, uint32, bool) {
+	item := ra.current
+	if item == nil || !item.chunk {
+		return nil, 0, false
+	}
+	<-item.done
+	if item.decompressErr != nil {
+		return nil, 0, false
+	}
+	return item.decompressed, item.crc, true
+}
+
+// close stops reading ahead and waits for the goroutines to exit. It is safe
+// to call more than once.
+func (ra *readAheadReader) close() {
+	ra.stopOnce.Do(func() {
+		close(ra.stop)
+	})
+	ra.wg.Wait()
+}
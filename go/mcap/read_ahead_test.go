@@ -0,0 +1,198 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type lexedToken struct {
+	tokenType    TokenType
+	record       []byte
+	offset       int64
+	chunkOffset  uint64
+	recordOffset uint64
+	inChunk      bool
+	err          error
+}
+
+// lexTokens lexes data to the end, recording each token and where it was
+// found.
+func lexTokens(t *testing.T, data []byte, opts *LexerOptions) []lexedToken {
+	lexer, err := NewLexer(bytes.NewReader(data), opts)
+	assert.Nil(t, err)
+	defer lexer.Close()
+	var tokens []lexedToken
+	for {
+		tokenType, record, err := lexer.Next(nil)
+		if errors.Is(err, io.EOF) {
+			return tokens
+		}
+		chunkOffset, recordOffset, inChunk := lexer.ChunkOffsets()
+		tokens = append(tokens, lexedToken{
+			tokenType:    tokenType,
+			record:       append([]byte(nil), record...),
+			offset:       lexer.Offset(),
+			chunkOffset:  chunkOffset,
+			recordOffset: recordOffset,
+			inChunk:      inChunk,
+			err:          err,
+		})
+		if err != nil && tokenType != TokenInvalidChunk {
+			return tokens
+		}
+	}
+}
+
+func TestReadAheadChunks(t *testing.T) {
+	logTimes := make([]uint64, 200)
+	for i := range logTimes {
+		logTimes[i] = uint64(i)
+	}
+	for _, compression := range []CompressionFormat{CompressionZSTD, CompressionLZ4, CompressionNone} {
+		data := writeTestFile(t, &WriterOptions{
+			Chunked:     true,
+			ChunkSize:   200,
+			Compression: compression,
+			IncludeCRC:  true,
+		}, []string{"/a", "/b"}, logTimes)
+		for _, opts := range []LexerOptions{
+			{},
+			{ValidateCRC: true},
+			{RetainChunkBuffers: true},
+			{StreamingCRC: true},
+		} {
+			t.Run(fmt.Sprintf("%q %+v", compression, opts), func(t *testing.T) {
+				expected := lexTokens(t, data, &opts)
+				assert.Equal(t, TokenFooter, expected[len(expected)-1].tokenType)
+				for _, depth := range []int{1, 4, 64} {
+					readAheadOpts := opts
+					readAheadOpts.ReadAheadChunks = depth
+					assert.Equal(t, expected, lexTokens(t, data, &readAheadOpts))
+				}
+			})
+		}
+	}
+	t.Run("decompresses chunks in the workers", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{
+			Chunked:     true,
+			ChunkSize:   200,
+			Compression: CompressionZSTD,
+			IncludeCRC:  true,
+		}, []string{"/a"}, logTimes)
+		lexer, err := NewLexer(bytes.NewReader(data), &LexerOptions{ValidateCRC: true, ReadAheadChunks: 4})
+		assert.Nil(t, err)
+		defer lexer.Close()
+		for {
+			_, _, err := lexer.Next(nil)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			assert.Nil(t, err)
+		}
+		// chunks decompressed by the lexer are decompressed into this buffer.
+		assert.Nil(t, lexer.uncompressedChunk)
+	})
+	t.Run("reports invalid chunks in order", func(t *testing.T) {
+		corrupt := chunk(t, CompressionZSTD, true, channelInfo(), message())
+		corrupt[9+8+8+8] ^= 0xff // uncompressed CRC
+		valid := chunk(t, CompressionZSTD, true, channelInfo(), message(), message())
+		data := file(header(), valid, corrupt, valid, footer())
+		for _, emitInvalidChunks := range []bool{true, false} {
+			opts := LexerOptions{ValidateCRC: true, EmitInvalidChunks: emitInvalidChunks}
+			expected := lexTokens(t, data, &opts)
+			invalid := 0
+			for _, token := range expected {
+				if errors.Is(token.err, ErrInvalidChunkCRC) {
+					invalid++
+				}
+			}
+			assert.Equal(t, 1, invalid)
+			opts.ReadAheadChunks = 4
+			assert.Equal(t, expected, lexTokens(t, data, &opts))
+		}
+	})
+	t.Run("falls back to the lexer's decompressors", func(t *testing.T) {
+		records := flatten(channelInfo(), message())
+		compressed := make([]byte, len(records))
+		for i, b := range records {
+			compressed[i] = b ^ 0x5a
+		}
+		data := file(
+			header(),
+			chunkRecord(t, CompressionFormat("xor"), true, records, compressed),
+			chunk(t, CompressionZSTD, true, channelInfo(), message()),
+			footer(),
+		)
+		opts := LexerOptions{
+			ValidateCRC: true,
+			Decompressors: map[string]func(io.Reader) (io.Reader, error){
+				"xor": func(r io.Reader) (io.Reader, error) {
+					return &xorReader{r: r, key: 0x5a}, nil
+				},
+			},
+		}
+		expected := lexTokens(t, data, &opts)
+		assert.Equal(t, TokenFooter, expected[len(expected)-1].tokenType)
+		opts.ReadAheadChunks = 2
+		assert.Equal(t, expected, lexTokens(t, data, &opts))
+	})
+	t.Run("charges the decompression budget before decompressing", func(t *testing.T) {
+		records := flatten(channelInfo(), message(), message())
+		c := chunk(t, CompressionLZ4, true, channelInfo(), message(), message())
+		data := file(header(), c, c, c, footer())
+		budget := 2 * len(records)
+		ra := newReadAheadReader(bytes.NewReader(data[len(Magic):]), 4, 0, 0, budget, false, nil)
+		var decompressed int
+		for item := range ra.items {
+			<-item.done
+			if item.chunk {
+				assert.Nil(t, item.decompressErr)
+				decompressed += len(item.decompressed)
+			}
+		}
+		ra.close()
+		assert.Equal(t, budget, decompressed)
+
+		opts := LexerOptions{MaxTotalDecompressedBytes: budget, ValidateCRC: true}
+		expected := lexTokens(t, data, &opts)
+		assert.ErrorIs(t, expected[len(expected)-1].err, ErrDecompressionBudgetExceeded)
+		opts.ReadAheadChunks = 4
+		assert.Equal(t, expected, lexTokens(t, data, &opts))
+	})
+	t.Run("truncated input", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{
+			Chunked:     true,
+			ChunkSize:   200,
+			Compression: CompressionZSTD,
+		}, []string{"/a"}, logTimes)
+		for _, size := range []int{len(data) / 3, len(data) / 2, len(data) - 3} {
+			expected := lexTokens(t, data[:size], &LexerOptions{})
+			assert.Error(t, expected[len(expected)-1].err)
+			actual := lexTokens(t, data[:size], &LexerOptions{ReadAheadChunks: 4})
+			assert.Equal(t, len(expected), len(actual))
+			assert.Equal(t, expected[len(expected)-1].err.Error(), actual[len(actual)-1].err.Error())
+		}
+	})
+	t.Run("close before exhausting", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{
+			Chunked:     true,
+			ChunkSize:   200,
+			Compression: CompressionZSTD,
+		}, []string{"/a"}, logTimes)
+		lexer, err := NewLexer(bytes.NewReader(data), &LexerOptions{ReadAheadChunks: 2})
+		assert.Nil(t, err)
+		_, _, err = lexer.Next(nil)
+		assert.Nil(t, err)
+		lexer.Close()
+		lexer.Close()
+		assert.Nil(t, lexer.Reset(bytes.NewReader(data)))
+		tokenType, _, err := lexer.Next(nil)
+		assert.Nil(t, err)
+		assert.Equal(t, TokenHeader, tokenType)
+	})
+}
@@ -0,0 +1,77 @@
+package mcap
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrNoChunkIndex is returned when a read cannot be planned because the file
+// has no chunk index.
+var ErrNoChunkIndex = errors.New("file has no chunk index")
+
+// ReadPlan lists the chunks to load to read the messages on a set of topics
+// within a time range, as planned by PlanRead.
+type ReadPlan struct {
+	// Chunks lists the chunks to load, in the order the indexed reader loads
+	// them when reading in log time order.
+	Chunks []PlannedChunk
+}
+
+// PlannedChunk is a chunk to load in a ReadPlan.
+type PlannedChunk struct {
+	ChunkIndex *ChunkIndex
+	// ChannelIDs lists the channels to extract from the chunk, in ascending
+	// order. Their messages are located by the chunk's message indexes, at
+	// the offsets in ChunkIndex.MessageIndexOffsets.
+	ChannelIDs []uint16
+}
+
+// PlanRead plans the reads needed to read the messages on the given topics,
+// or on all topics if none are given, with log times from start up to but not
+// including end, from a file with the given summary. An end of zero means no
+// upper bound. The chunks planned are those the indexed reader loads: each
+// overlaps the time range and has a message index for one of the channels
+// selected. They are ordered by the earliest log time in each chunk, then by
+// their position in the file; chunks whose time ranges overlap must be read
+// together to yield their messages in log time order. This lets callers
+// execute the reads themselves, such as by distributing them. Chunks missing
+// from the summary, as reported by Info.SummaryIncomplete, are not planned.
+func PlanRead(info *Info, topics []string, start, end uint64) (*ReadPlan, error) {
+	if len(info.ChunkIndexes) == 0 && (info.Statistics == nil || info.Statistics.MessageCount > 0) {
+		return nil, ErrNoChunkIndex
+	}
+	topicSet := make(map[string]bool)
+	for _, topic := range topics {
+		topicSet[topic] = true
+	}
+	selected := make(map[uint16]bool)
+	for id, channel := range info.Channels {
+		if len(topicSet) == 0 || topicSet[channel.Topic] {
+			selected[id] = true
+		}
+	}
+	plan := &ReadPlan{Chunks: []PlannedChunk{}}
+	for _, idx := range info.ChunkIndexes {
+		if idx.MessageEndTime < start || (end > 0 && idx.MessageStartTime >= end) {
+			continue
+		}
+		var channelIDs []uint16
+		for _, id := range sortedIDs(idx.MessageIndexOffsets) {
+			if selected[id] && idx.MessageIndexOffsets[id] > 0 {
+				channelIDs = append(channelIDs, id)
+			}
+		}
+		if len(channelIDs) == 0 {
+			continue
+		}
+		plan.Chunks = append(plan.Chunks, PlannedChunk{ChunkIndex: idx, ChannelIDs: channelIDs})
+	}
+	sort.SliceStable(plan.Chunks, func(i, j int) bool {
+		a, b := plan.Chunks[i].ChunkIndex, plan.Chunks[j].ChunkIndex
+		if a.MessageStartTime != b.MessageStartTime {
+			return a.MessageStartTime < b.MessageStartTime
+		}
+		return a.ChunkStartOffset < b.ChunkStartOffset
+	})
+	return plan, nil
+}
@@ -0,0 +1,158 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"testing"
+
+	"github.com/foxglove/mcap/go/mcap/readopts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanRead(t *testing.T) {
+	info := &Info{
+		Statistics: &Statistics{MessageCount: 10},
+		Channels: map[uint16]*Channel{
+			1: {ID: 1, Topic: "/a"},
+			2: {ID: 2, Topic: "/b"},
+			3: {ID: 3, Topic: "/c"},
+		},
+		ChunkIndexes: []*ChunkIndex{
+			{ChunkStartOffset: 100, MessageStartTime: 20, MessageEndTime: 30, MessageIndexOffsets: map[uint16]uint64{1: 150, 2: 160}},
+			{ChunkStartOffset: 200, MessageStartTime: 10, MessageEndTime: 25, MessageIndexOffsets: map[uint16]uint64{2: 250}},
+			{ChunkStartOffset: 300, MessageStartTime: 40, MessageEndTime: 50, MessageIndexOffsets: map[uint16]uint64{3: 350, 1: 360}},
+			{ChunkStartOffset: 400, MessageStartTime: 20, MessageEndTime: 20, MessageIndexOffsets: map[uint16]uint64{1: 450}},
+		},
+	}
+	plan := func(topics []string, start, end uint64) map[uint64][]uint16 {
+		p, err := PlanRead(info, topics, start, end)
+		assert.Nil(t, err)
+		chunks := make(map[uint64][]uint16)
+		var offsets []uint64
+		for _, chunk := range p.Chunks {
+			chunks[chunk.ChunkIndex.ChunkStartOffset] = chunk.ChannelIDs
+			offsets = append(offsets, chunk.ChunkIndex.ChunkStartOffset)
+		}
+		// chunks are ordered by start time, then position.
+		assert.True(t, sort.SliceIsSorted(p.Chunks, func(i, j int) bool {
+			a, b := p.Chunks[i].ChunkIndex, p.Chunks[j].ChunkIndex
+			return a.MessageStartTime < b.MessageStartTime ||
+				a.MessageStartTime == b.MessageStartTime && a.ChunkStartOffset < b.ChunkStartOffset
+		}), offsets)
+		return chunks
+	}
+	t.Run("all topics", func(t *testing.T) {
+		assert.Equal(t, map[uint64][]uint16{
+			100: {1, 2},
+			200: {2},
+			300: {1, 3},
+			400: {1},
+		}, plan(nil, 0, 0))
+	})
+	t.Run("selects topics", func(t *testing.T) {
+		assert.Equal(t, map[uint64][]uint16{
+			100: {1},
+			300: {1},
+			400: {1},
+		}, plan([]string{"/a"}, 0, 0))
+		assert.Equal(t, map[uint64][]uint16{
+			100: {2},
+			200: {2},
+			300: {3},
+		}, plan([]string{"/b", "/c"}, 0, 0))
+		assert.Empty(t, plan([]string{"/missing"}, 0, 0))
+	})
+	t.Run("selects time range", func(t *testing.T) {
+		assert.Equal(t, map[uint64][]uint16{
+			100: {1, 2},
+			200: {2},
+			400: {1},
+		}, plan(nil, 0, 40))
+		assert.Equal(t, map[uint64][]uint16{
+			100: {1, 2},
+			300: {1, 3},
+		}, plan(nil, 26, 0))
+		assert.Equal(t, map[uint64][]uint16{
+			100: {1},
+			400: {1},
+		}, plan([]string{"/a"}, 20, 21))
+	})
+	t.Run("requires chunk indexes", func(t *testing.T) {
+		_, err := PlanRead(&Info{Statistics: &Statistics{MessageCount: 1}}, nil, 0, 0)
+		assert.ErrorIs(t, err, ErrNoChunkIndex)
+		p, err := PlanRead(&Info{Statistics: &Statistics{}}, nil, 0, 0)
+		assert.Nil(t, err)
+		assert.Empty(t, p.Chunks)
+	})
+}
+
+func TestExecuteReadPlan(t *testing.T) {
+	logTimes := make([]uint64, 100)
+	for i := range logTimes {
+		logTimes[i] = uint64(i)
+	}
+	data := writeTestFile(t, &WriterOptions{
+		Chunked:     true,
+		ChunkSize:   200,
+		Compression: CompressionZSTD,
+	}, []string{"/a", "/b", "/c"}, logTimes)
+	reader, err := NewReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	info, err := reader.Info()
+	assert.Nil(t, err)
+	topics := []string{"/a", "/c"}
+	start, end := uint64(20), uint64(60)
+	plan, err := PlanRead(info, topics, start, end)
+	assert.Nil(t, err)
+
+	// execute the plan, loading each chunk and extracting the messages of the
+	// channels planned from it.
+	var planned []*Message
+	decompressor := &chunkDecompressor{}
+	defer decompressor.close()
+	for _, chunk := range plan.Chunks {
+		record, err := readChunkAt(bytes.NewReader(data), chunk.ChunkIndex)
+		assert.Nil(t, err)
+		chunkData, err := decompressor.decompress(record)
+		assert.Nil(t, err)
+		for _, channelID := range chunk.ChannelIDs {
+			offset := chunk.ChunkIndex.MessageIndexOffsets[channelID]
+			messageIndex, err := readMessageIndexAt(bytes.NewReader(data), offset)
+			assert.Nil(t, err)
+			for _, entry := range messageIndex.Records {
+				if entry.Timestamp < start || entry.Timestamp >= end {
+					continue
+				}
+				message, err := messageAt(chunkData, entry.Offset)
+				assert.Nil(t, err)
+				planned = append(planned, message)
+			}
+		}
+	}
+	sort.SliceStable(planned, func(i, j int) bool { return planned[i].LogTime < planned[j].LogTime })
+
+	it, err := reader.Messages(
+		readopts.WithTopics(topics),
+		readopts.After(int64(start)),
+		readopts.Before(int64(end)),
+	)
+	assert.Nil(t, err)
+	var expected []*Message
+	for {
+		_, _, message, err := it.Next(nil)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.Nil(t, err)
+		expected = append(expected, message)
+	}
+	assert.NotEmpty(t, expected)
+	assert.Equal(t, len(expected), len(planned))
+	for i := range expected {
+		assert.Equal(t, expected[i].LogTime, planned[i].LogTime)
+		assert.Equal(t, expected[i].ChannelID, planned[i].ChannelID)
+		assert.Equal(t, expected[i].Data, planned[i].Data)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"sort"
 
 	"github.com/foxglove/mcap/go/mcap/readopts"
 )
@@ -54,14 +55,37 @@ func readPrefixedMap(data []byte, offset int) (result map[string]string, newoffs
 	return m, offset + inset, nil
 }
 
+// Reader reads MCAP files, parsing their records into typed structs. See
+// Reader.Messages.
 type Reader struct {
 	l        *Lexer
 	r        io.Reader
 	rs       io.ReadSeeker
 	channels map[uint16]*Channel
+	schemas  map[uint16]*Schema
+
+	parsedSchemas    map[uint16]ParsedSchema
+	messageEncodings map[string]bool
+	schemaEncodings  map[string]bool
+	statistics       *Statistics
+	// countedSchemas and countedChannels hold the IDs of the schemas and
+	// channels counted in the statistics, those of messages returned by the
+	// reader's iterators.
+	countedSchemas  map[uint16]bool
+	countedChannels map[uint16]bool
+	// timeSkew holds the publish time skew statistics of each channel, if
+	// they are being collected.
+	timeSkew map[uint16]*TimeSkew
 }
 
+// MessageIterator iterates over the messages in a file.
 type MessageIterator interface {
+	// Next returns the next message, along with its channel and the schema
+	// referenced by the channel's schema ID. Messages on schemaless channels
+	// are returned with a nil schema. Schemas are parsed once, when first
+	// encountered, and the same *Schema is returned for every message that
+	// references it, so its raw Data is shared across all of those messages
+	// and must not be modified.
 	Next([]byte) (*Schema, *Channel, *Message, error)
 }
 
@@ -81,19 +105,28 @@ func Range(it MessageIterator, f func(*Schema, *Channel, *Message) error) error
 	}
 }
 
-func (r *Reader) unindexedIterator(topics []string, start uint64, end uint64) *unindexedMessageIterator {
+func (r *Reader) unindexedIterator(
+	topics []string,
+	start uint64,
+	end uint64,
+	retainChunkBuffers bool,
+) *unindexedMessageIterator {
 	topicMap := make(map[string]bool)
 	for _, topic := range topics {
 		topicMap[topic] = true
 	}
 	r.l.emitChunks = false
+	r.l.retainChunkBuffers = retainChunkBuffers
 	return &unindexedMessageIterator{
-		lexer:    r.l,
-		channels: make(map[uint16]*Channel),
-		schemas:  make(map[uint16]*Schema),
-		topics:   topicMap,
-		start:    start,
-		end:      end,
+		lexer:     r.l,
+		channels:  make(map[uint16]*Channel),
+		schemas:   make(map[uint16]*Schema),
+		topics:    topicMap,
+		start:     start,
+		end:       end,
+		onSchema:  r.observeSchema,
+		onChannel: r.observeChannel,
+		onMessage: r.observeMessage,
 	}
 }
 
@@ -117,7 +150,91 @@ func (r *Reader) indexedMessageIterator(
 		start:     start,
 		end:       end,
 		indexHeap: rangeIndexHeap{order: order},
+		onSchema:  r.observeSchema,
+		onChannel: r.observeChannel,
+		onMessage: r.observeMessage,
+		onChunk:   r.observeChunk,
+	}
+}
+
+func (r *Reader) observeSchema(schema *Schema) {
+	if _, ok := r.schemas[schema.ID]; !ok {
+		r.schemas[schema.ID] = schema
+	}
+	r.schemaEncodings[schema.Encoding] = true
+}
+
+func (r *Reader) observeChannel(channel *Channel) {
+	if _, ok := r.channels[channel.ID]; !ok {
+		r.channels[channel.ID] = channel
+	}
+	r.messageEncodings[channel.MessageEncoding] = true
+}
+
+func (r *Reader) observeMessage(schema *Schema, channel *Channel, message *Message) {
+	stats := r.statistics
+	if schema != nil && !r.countedSchemas[schema.ID] {
+		r.countedSchemas[schema.ID] = true
+		stats.SchemaCount++
+	}
+	if !r.countedChannels[channel.ID] {
+		r.countedChannels[channel.ID] = true
+		stats.ChannelCount++
+	}
+	if stats.MessageCount == 0 || message.LogTime < stats.MessageStartTime {
+		stats.MessageStartTime = message.LogTime
+	}
+	if message.LogTime > stats.MessageEndTime {
+		stats.MessageEndTime = message.LogTime
 	}
+	stats.MessageCount++
+	stats.ChannelMessageCounts[message.ChannelID]++
+	if r.timeSkew != nil {
+		r.observeTimeSkew(message)
+	}
+}
+
+func (r *Reader) observeChunk() {
+	r.statistics.ChunkCount++
+}
+
+// CurrentStatistics returns a snapshot of the statistics accumulated from the
+// records the reader has processed so far. Messages are counted as they are
+// returned by the reader's iterators, schemas and channels as the first
+// message on them is returned, and chunks as they are decompressed. Records
+// read from the summary section, such as by Info, are not counted. Unlike the
+// statistics record in the summary section, this is available for files that
+// are still being written or lack a summary.
+func (r *Reader) CurrentStatistics() Statistics {
+	stats := *r.statistics
+	stats.ChannelMessageCounts = make(map[uint16]uint64, len(r.statistics.ChannelMessageCounts))
+	for k, v := range r.statistics.ChannelMessageCounts {
+		stats.ChannelMessageCounts[k] = v
+	}
+	return stats
+}
+
+// MessageEncodings returns the sorted set of distinct message encodings on
+// channels the reader has encountered so far, either through message iteration
+// or through Info.
+func (r *Reader) MessageEncodings() []string {
+	return sortedKeys(r.messageEncodings)
+}
+
+// SchemaEncodings returns the sorted set of distinct schema encodings the
+// reader has encountered so far, either through message iteration or through
+// Info.
+func (r *Reader) SchemaEncodings() []string {
+	return sortedKeys(r.schemaEncodings)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func (r *Reader) Messages(
@@ -130,15 +247,69 @@ func (r *Reader) Messages(
 			return nil, err
 		}
 	}
+	if ro.CollectTimeSkew && r.timeSkew == nil {
+		r.timeSkew = make(map[uint16]*TimeSkew)
+	}
 	if ro.UseIndex {
+		if ro.IndexSidecar != nil {
+			return nil, fmt.Errorf("index sidecars are only written by reads without the index")
+		}
 		if rs, ok := r.r.(io.ReadSeeker); ok {
 			r.rs = rs
 		} else {
 			return nil, fmt.Errorf("indexed reader requires a seekable reader")
 		}
-		return r.indexedMessageIterator(ro.Topics, uint64(ro.Start), uint64(ro.End), ro.Order), nil
+		it := r.indexedMessageIterator(ro.Topics, uint64(ro.Start), uint64(ro.End), ro.Order)
+		it.deadline = ro.Deadline
+		it.maxMessages = ro.MaxMessages
+		it.decompressor.useZSTDDictionary(ro.ZSTDDictionary)
+		it.decompressor.useDecompressors(ro.Decompressors)
+		return it, nil
+	}
+	r.l.deadline = ro.Deadline
+	r.l.setZSTDDictionary(ro.ZSTDDictionary)
+	r.l.setDecompressors(ro.Decompressors)
+	it := r.unindexedIterator(ro.Topics, uint64(ro.Start), uint64(ro.End), ro.RetainChunkBuffers)
+	it.maxMessages = ro.MaxMessages
+	if ro.IndexSidecar != nil {
+		it.sidecar = newIndexSidecarBuilder(ro.IndexSidecar)
+	}
+	return it, nil
+}
+
+// MessagesFunc calls fn with each message selected by the options, without
+// copying message data: the data may alias a decompressed chunk or a buffer
+// that is reused once fn returns. If fn returns retain as true, the message's
+// Data is replaced with a copy before the buffer is reused, so that the
+// message may be kept; callers retaining a message must keep the *Message,
+// not the original Data slice. Errors returned by fn stop the iteration and
+// are returned wrapped. The options select messages as for Messages; chunk
+// buffers are always retained rather than copied.
+func (r *Reader) MessagesFunc(
+	fn func(*Schema, *Channel, *Message) (retain bool, err error),
+	opts ...readopts.ReadOpt,
+) error {
+	it, err := r.Messages(append(opts, readopts.RetainingChunkBuffers(true))...)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 1024)
+	for {
+		schema, channel, message, err := it.Next(buf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to read record: %w", err)
+		}
+		retain, err := fn(schema, channel, message)
+		if err != nil {
+			return fmt.Errorf("failed to process record: %w", err)
+		}
+		if retain {
+			message.Data = append([]byte(nil), message.Data...)
+		}
 	}
-	return r.unindexedIterator(ro.Topics, uint64(ro.Start), uint64(ro.End)), nil
 }
 
 func (r *Reader) readHeader() (*Header, error) {
@@ -181,9 +352,57 @@ func (r *Reader) Info() (*Info, error) {
 		MetadataIndexes:   it.metadataIndexes,
 		Schemas:           it.schemas,
 		Header:            header,
+		SummaryIncomplete: it.summaryIncomplete,
 	}, nil
 }
 
+// ErrNoAttachmentIndex is returned by Reader.AttachmentIndexes when the
+// summary section of a file contains no attachment index records.
+var ErrNoAttachmentIndex = errors.New("file has no attachment index")
+
+// AttachmentIndexes returns the attachment index records from the summary
+// section, in the order they appear. These carry the name, media type, log and
+// create times, and location of each attachment, and may be used to catalog
+// attachments without reading their data. If the summary contains no
+// attachment index records, an empty slice is returned along with
+// ErrNoAttachmentIndex. The reader must be seekable.
+func (r *Reader) AttachmentIndexes() ([]*AttachmentIndex, error) {
+	if r.rs == nil {
+		return nil, fmt.Errorf("reading attachment indexes requires a seekable reader")
+	}
+	it := r.indexedMessageIterator(nil, 0, math.MaxUint64, readopts.FileOrder)
+	err := it.parseSummarySection()
+	if err != nil {
+		return nil, err
+	}
+	if len(it.attachmentIndexes) == 0 {
+		return []*AttachmentIndex{}, ErrNoAttachmentIndex
+	}
+	return it.attachmentIndexes, nil
+}
+
+// AttachmentsByMediaType returns the attachment index records from the summary
+// section whose media type is exactly mediaType, in the order they appear. No
+// attachment data is read. As with AttachmentIndexes, if the summary contains
+// no attachment index records, an empty slice is returned along with
+// ErrNoAttachmentIndex.
+func (r *Reader) AttachmentsByMediaType(mediaType string) ([]*AttachmentIndex, error) {
+	indexes, err := r.AttachmentIndexes()
+	if err != nil {
+		return indexes, err
+	}
+	matches := []*AttachmentIndex{}
+	for _, idx := range indexes {
+		if idx.MediaType == mediaType {
+			matches = append(matches, idx)
+		}
+	}
+	return matches, nil
+}
+
+// NewReader returns a Reader of r, validating its leading magic. Readers
+// implementing io.ReadSeeker may be read using the index in the summary
+// section, and others only in order.
 func NewReader(r io.Reader) (*Reader, error) {
 	var rs io.ReadSeeker
 	if readseeker, ok := r.(io.ReadSeeker); ok {
@@ -195,10 +414,22 @@ func NewReader(r io.Reader) (*Reader, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Reader{
+	reader := &Reader{
 		l:        lexer,
 		r:        r,
 		rs:       rs,
 		channels: make(map[uint16]*Channel),
-	}, nil
+		schemas:  make(map[uint16]*Schema),
+
+		parsedSchemas:    make(map[uint16]ParsedSchema),
+		messageEncodings: make(map[string]bool),
+		schemaEncodings:  make(map[string]bool),
+		statistics: &Statistics{
+			ChannelMessageCounts: make(map[uint16]uint64),
+		},
+		countedSchemas:  make(map[uint16]bool),
+		countedChannels: make(map[uint16]bool),
+	}
+	lexer.onChunk = reader.observeChunk
+	return reader, nil
 }
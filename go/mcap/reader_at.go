@@ -0,0 +1,68 @@
+package mcap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// ErrUnknownSize is returned when the size of an io.ReaderAt cannot be
+// determined.
+var ErrUnknownSize = errors.New("cannot determine size of reader")
+
+// ReaderAtSize determines the size of r, for use with functions that locate
+// the footer relative to the end of the file. It probes r for the following
+// interfaces, in order:
+//
+//   - interface{ Size() int64 }, implemented by *bytes.Reader, *strings.Reader
+//     and *io.SectionReader.
+//   - interface{ Stat() (fs.FileInfo, error) }, implemented by *os.File.
+//   - io.Seeker. The size is found by seeking to the end, after which the
+//     original position is restored.
+//
+// If r implements none of these, ErrUnknownSize is returned.
+func ReaderAtSize(r io.ReaderAt) (int64, error) {
+	switch v := r.(type) {
+	case interface{ Size() int64 }:
+		return v.Size(), nil
+	case interface{ Stat() (fs.FileInfo, error) }:
+		info, err := v.Stat()
+		if err != nil {
+			return 0, fmt.Errorf("failed to stat reader: %w", err)
+		}
+		return info.Size(), nil
+	case io.Seeker:
+		pos, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, err
+		}
+		size, err := v.Seek(0, io.SeekEnd)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := v.Seek(pos, io.SeekStart); err != nil {
+			return 0, err
+		}
+		return size, nil
+	}
+	return 0, ErrUnknownSize
+}
+
+// NewReaderAt creates a Reader over an io.ReaderAt, so that indexed reading is
+// available without an io.ReadSeeker. If probe is non-nil, it is called to
+// obtain the size of the file, for instance with a HEAD request to an object
+// store. Otherwise, the size is determined by ReaderAtSize.
+func NewReaderAt(r io.ReaderAt, probe func() (int64, error)) (*Reader, error) {
+	var size int64
+	var err error
+	if probe != nil {
+		size, err = probe()
+	} else {
+		size, err = ReaderAtSize(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(io.NewSectionReader(r, 0, size))
+}
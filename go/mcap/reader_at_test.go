@@ -0,0 +1,100 @@
+package mcap
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readerAtOnly hides all methods of the wrapped reader other than ReadAt.
+type readerAtOnly struct {
+	r io.ReaderAt
+}
+
+func (r readerAtOnly) ReadAt(p []byte, off int64) (int, error) {
+	return r.r.ReadAt(p, off)
+}
+
+// seekingReaderAt exposes ReadAt and Seek, but no Size method.
+type seekingReaderAt struct {
+	r *bytes.Reader
+}
+
+func (r seekingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return r.r.ReadAt(p, off)
+}
+
+func (r seekingReaderAt) Seek(offset int64, whence int) (int64, error) {
+	return r.r.Seek(offset, whence)
+}
+
+func TestReaderAtSize(t *testing.T) {
+	data := writeTestFile(t, &WriterOptions{Chunked: true}, []string{"/a"}, []uint64{1, 2, 3})
+	t.Run("size method", func(t *testing.T) {
+		size, err := ReaderAtSize(io.NewSectionReader(bytes.NewReader(data), 0, 10))
+		assert.Nil(t, err)
+		assert.Equal(t, int64(10), size)
+	})
+	t.Run("stat method", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.mcap")
+		assert.Nil(t, os.WriteFile(path, data, 0o600))
+		f, err := os.Open(path)
+		assert.Nil(t, err)
+		defer f.Close()
+		size, err := ReaderAtSize(f)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(len(data)), size)
+	})
+	t.Run("seeker restores position", func(t *testing.T) {
+		r := seekingReaderAt{bytes.NewReader(data)}
+		_, err := r.Seek(5, io.SeekStart)
+		assert.Nil(t, err)
+		size, err := ReaderAtSize(r)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(len(data)), size)
+		pos, err := r.Seek(0, io.SeekCurrent)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(5), pos)
+	})
+	t.Run("unknown size", func(t *testing.T) {
+		_, err := ReaderAtSize(readerAtOnly{bytes.NewReader(data)})
+		assert.ErrorIs(t, err, ErrUnknownSize)
+	})
+}
+
+func TestNewReaderAt(t *testing.T) {
+	data := writeTestFile(t, &WriterOptions{Chunked: true}, []string{"/a", "/b"}, []uint64{1, 2, 3})
+	t.Run("uses probe", func(t *testing.T) {
+		probed := false
+		r, err := NewReaderAt(readerAtOnly{bytes.NewReader(data)}, func() (int64, error) {
+			probed = true
+			return int64(len(data)), nil
+		})
+		assert.Nil(t, err)
+		assert.True(t, probed)
+		info, err := r.Info()
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(3), info.Statistics.MessageCount)
+		assert.Equal(t, 2, len(info.Channels))
+	})
+	t.Run("probes reader without probe function", func(t *testing.T) {
+		r, err := NewReaderAt(seekingReaderAt{bytes.NewReader(data)}, nil)
+		assert.Nil(t, err)
+		it, err := r.Messages()
+		assert.Nil(t, err)
+		count := 0
+		assert.Nil(t, Range(it, func(*Schema, *Channel, *Message) error {
+			count++
+			return nil
+		}))
+		assert.Equal(t, 3, count)
+	})
+	t.Run("fails for unknown size", func(t *testing.T) {
+		_, err := NewReaderAt(readerAtOnly{bytes.NewReader(data)}, nil)
+		assert.ErrorIs(t, err, ErrUnknownSize)
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/foxglove/mcap/go/mcap/readopts"
+	"github.com/klauspost/compress/s2"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -20,13 +21,14 @@ func TestIndexedReaderBreaksTiesOnChunkOffset(t *testing.T) {
 	})
 	assert.Nil(t, err)
 	assert.Nil(t, writer.WriteHeader(&Header{}))
-	assert.Nil(t, writer.WriteSchema(&Schema{
+	_, err = writer.WriteSchema(&Schema{
 		ID:       0,
 		Name:     "",
 		Encoding: "",
 		Data:     []byte{},
-	}))
-	assert.Nil(t, writer.WriteChannel(&Channel{
+	})
+	assert.Nil(t, err)
+	_, err = writer.WriteChannel(&Channel{
 		ID:              0,
 		SchemaID:        0,
 		Topic:           "/foo",
@@ -34,8 +36,9 @@ func TestIndexedReaderBreaksTiesOnChunkOffset(t *testing.T) {
 		Metadata: map[string]string{
 			"": "",
 		},
-	}))
-	assert.Nil(t, writer.WriteChannel(&Channel{
+	})
+	assert.Nil(t, err)
+	_, err = writer.WriteChannel(&Channel{
 		ID:              1,
 		SchemaID:        0,
 		Topic:           "/bar",
@@ -43,7 +46,8 @@ func TestIndexedReaderBreaksTiesOnChunkOffset(t *testing.T) {
 		Metadata: map[string]string{
 			"": "",
 		},
-	}))
+	})
+	assert.Nil(t, err)
 	assert.Nil(t, writer.WriteMessage(&Message{
 		ChannelID:   0,
 		Sequence:    0,
@@ -240,24 +244,27 @@ func TestMessageReading(t *testing.T) {
 						Profile: "ros1",
 					})
 					assert.Nil(t, err)
-					assert.Nil(t, w.WriteSchema(&Schema{
+					_, err = w.WriteSchema(&Schema{
 						ID:       1,
 						Name:     "foo",
 						Encoding: "msg",
 						Data:     []byte{},
-					}))
-					assert.Nil(t, w.WriteChannel(&Channel{
+					})
+					assert.Nil(t, err)
+					_, err = w.WriteChannel(&Channel{
 						ID:              0,
 						Topic:           "/test1",
 						SchemaID:        1,
 						MessageEncoding: "ros1",
-					}))
-					assert.Nil(t, w.WriteChannel(&Channel{
+					})
+					assert.Nil(t, err)
+					_, err = w.WriteChannel(&Channel{
 						ID:              1,
 						Topic:           "/test2",
 						MessageEncoding: "ros1",
 						SchemaID:        1,
-					}))
+					})
+					assert.Nil(t, err)
 					for i := 0; i < 1000; i++ {
 						err := w.WriteMessage(&Message{
 							ChannelID:   uint16(i % 2),
@@ -499,10 +506,12 @@ func TestMCAPInfo(t *testing.T) {
 			assert.Nil(t, err)
 			assert.Nil(t, w.WriteHeader(&Header{}))
 			for _, schema := range c.schemas {
-				assert.Nil(t, w.WriteSchema(schema))
+				_, err = w.WriteSchema(schema)
+				assert.Nil(t, err)
 			}
 			for _, channel := range c.channels {
-				assert.Nil(t, w.WriteChannel(channel))
+				_, err = w.WriteChannel(channel)
+				assert.Nil(t, err)
 			}
 			for _, message := range c.messages {
 				assert.Nil(t, w.WriteMessage(message))
@@ -584,13 +593,14 @@ func TestReadingMessageOrderWithOverlappingChunks(t *testing.T) {
 	})
 	assert.Nil(t, err)
 	assert.Nil(t, writer.WriteHeader(&Header{}))
-	assert.Nil(t, writer.WriteSchema(&Schema{
+	_, err = writer.WriteSchema(&Schema{
 		ID:       0,
 		Name:     "",
 		Encoding: "",
 		Data:     []byte{},
-	}))
-	assert.Nil(t, writer.WriteChannel(&Channel{
+	})
+	assert.Nil(t, err)
+	_, err = writer.WriteChannel(&Channel{
 		ID:              0,
 		Topic:           "",
 		SchemaID:        0,
@@ -598,7 +608,8 @@ func TestReadingMessageOrderWithOverlappingChunks(t *testing.T) {
 		Metadata: map[string]string{
 			"": "",
 		},
-	}))
+	})
+	assert.Nil(t, err)
 	msgCount := 0
 	addMsg := func(timestamp uint64) {
 		assert.Nil(t, writer.WriteMessage(&Message{
@@ -672,3 +683,558 @@ func TestReadingMessageOrderWithOverlappingChunks(t *testing.T) {
 	assert.Nil(t, msg)
 	assert.Error(t, io.EOF, err)
 }
+
+func TestReaderEncodings(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{
+		Chunked:     true,
+		Compression: CompressionZSTD,
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	_, err = w.WriteSchema(&Schema{ID: 1, Name: "foo", Encoding: "jsonschema", Data: []byte("{}")})
+	assert.Nil(t, err)
+	_, err = w.WriteSchema(&Schema{ID: 2, Name: "bar", Encoding: "ros1msg", Data: []byte{}})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 1, SchemaID: 1, Topic: "/foo", MessageEncoding: "json"})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 2, SchemaID: 2, Topic: "/bar", MessageEncoding: "ros1"})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 3, SchemaID: 1, Topic: "/baz", MessageEncoding: "json"})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, Data: []byte("{}")}))
+	assert.Nil(t, w.Close())
+
+	t.Run("populated during iteration", func(t *testing.T) {
+		r, err := NewReader(bytes.NewReader(buf.Bytes()))
+		assert.Nil(t, err)
+		assert.Empty(t, r.MessageEncodings())
+		it, err := r.Messages(readopts.UsingIndex(false), readopts.WithTopics([]string{"/foo"}))
+		assert.Nil(t, err)
+		assert.Nil(t, Range(it, func(*Schema, *Channel, *Message) error { return nil }))
+		assert.Equal(t, []string{"json", "ros1"}, r.MessageEncodings())
+		assert.Equal(t, []string{"jsonschema", "ros1msg"}, r.SchemaEncodings())
+	})
+	t.Run("populated from summary", func(t *testing.T) {
+		r, err := NewReader(bytes.NewReader(buf.Bytes()))
+		assert.Nil(t, err)
+		_, err = r.Info()
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"json", "ros1"}, r.MessageEncodings())
+		assert.Equal(t, []string{"jsonschema", "ros1msg"}, r.SchemaEncodings())
+	})
+}
+
+func TestReaderCurrentStatistics(t *testing.T) {
+	data := writeTestFile(t, &WriterOptions{Chunked: true, ChunkSize: 40, Compression: CompressionLZ4},
+		[]string{"/a", "/b"}, []uint64{5, 6, 7, 8, 9})
+	for _, useIndex := range []bool{true, false} {
+		t.Run(fmt.Sprintf("indexed %v", useIndex), func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(data))
+			assert.Nil(t, err)
+			it, err := r.Messages(readopts.UsingIndex(useIndex))
+			assert.Nil(t, err)
+			_, _, _, err = it.Next(nil)
+			assert.Nil(t, err)
+			stats := r.CurrentStatistics()
+			assert.Equal(t, uint64(1), stats.MessageCount)
+			assert.Equal(t, uint16(1), stats.SchemaCount)
+			assert.Equal(t, uint64(5), stats.MessageStartTime)
+			assert.Equal(t, uint64(5), stats.MessageEndTime)
+			assert.Equal(t, uint32(1), stats.ChunkCount)
+
+			assert.Nil(t, Range(it, func(*Schema, *Channel, *Message) error { return nil }))
+			stats = r.CurrentStatistics()
+			assert.Equal(t, uint64(5), stats.MessageCount)
+			assert.Equal(t, uint32(2), stats.ChannelCount)
+			assert.Equal(t, uint64(9), stats.MessageEndTime)
+			assert.Equal(t, map[uint16]uint64{1: 3, 2: 2}, stats.ChannelMessageCounts)
+			assert.Greater(t, stats.ChunkCount, uint32(1))
+		})
+	}
+	t.Run("summary reads are not counted", func(t *testing.T) {
+		r, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		info, err := r.Info()
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(info.Channels))
+		_, err = r.AttachmentIndexes()
+		assert.ErrorIs(t, err, ErrNoAttachmentIndex)
+		assert.Equal(t, Statistics{ChannelMessageCounts: map[uint16]uint64{}}, r.CurrentStatistics())
+		// encodings seen in the summary are still reported.
+		assert.Equal(t, []string{"json"}, r.MessageEncodings())
+	})
+}
+
+func TestReaderMaxMessages(t *testing.T) {
+	logTimes := make([]uint64, 20)
+	for i := range logTimes {
+		logTimes[i] = uint64(i)
+	}
+	// each chunk holds a single message.
+	data := writeTestFile(t, &WriterOptions{Chunked: true, ChunkSize: 1, Compression: CompressionZSTD},
+		[]string{"/a", "/b"}, logTimes)
+	for _, useIndex := range []bool{true, false} {
+		t.Run(fmt.Sprintf("indexed %v", useIndex), func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(data))
+			assert.Nil(t, err)
+			it, err := r.Messages(readopts.UsingIndex(useIndex), readopts.WithMaxMessages(3))
+			assert.Nil(t, err)
+			var seen []uint64
+			assert.Nil(t, Range(it, func(_ *Schema, _ *Channel, message *Message) error {
+				seen = append(seen, message.LogTime)
+				return nil
+			}))
+			assert.Equal(t, []uint64{0, 1, 2}, seen)
+			_, _, _, err = it.Next(nil)
+			assert.ErrorIs(t, err, io.EOF)
+			assert.Equal(t, uint32(3), r.CurrentStatistics().ChunkCount)
+		})
+	}
+	t.Run("rejects negative limit", func(t *testing.T) {
+		r, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		_, err = r.Messages(readopts.WithMaxMessages(-1))
+		assert.Error(t, err)
+	})
+}
+
+func TestIndexedReadLoadsOnlyOverlappingChunks(t *testing.T) {
+	logTimes := make([]uint64, 20)
+	for i := range logTimes {
+		logTimes[i] = uint64(i)
+	}
+	// each chunk holds a single message, alternating between the topics.
+	data := writeTestFile(t, &WriterOptions{Chunked: true, ChunkSize: 1, Compression: CompressionZSTD},
+		[]string{"/a", "/b"}, logTimes)
+	r, err := NewReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	it, err := r.Messages(
+		readopts.After(5),
+		readopts.Before(12),
+		readopts.WithTopics([]string{"/a"}),
+		readopts.InOrder(readopts.LogTimeOrder),
+	)
+	assert.Nil(t, err)
+	var seen []uint64
+	assert.Nil(t, Range(it, func(_ *Schema, channel *Channel, message *Message) error {
+		assert.Equal(t, "/a", channel.Topic)
+		seen = append(seen, message.LogTime)
+		return nil
+	}))
+	assert.Equal(t, []uint64{6, 8, 10}, seen)
+	// chunks outside the range are not decompressed. The writer records a
+	// message index in each chunk for every channel it has written to, so
+	// the chunks of /b in the range are selected as well.
+	assert.Equal(t, uint32(7), r.CurrentStatistics().ChunkCount)
+}
+
+func TestReaderRetainingChunkBuffers(t *testing.T) {
+	logTimes := make([]uint64, 50)
+	for i := range logTimes {
+		logTimes[i] = uint64(i)
+	}
+	data := writeTestFile(t, &WriterOptions{Chunked: true, Compression: CompressionZSTD}, []string{"/a"}, logTimes)
+	reader, err := NewReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	it, err := reader.Messages(readopts.UsingIndex(false), readopts.RetainingChunkBuffers(true))
+	assert.Nil(t, err)
+	buf := make([]byte, 1024)
+	var messages []*Message
+	for {
+		_, _, message, err := it.Next(buf)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.Nil(t, err)
+		messages = append(messages, message)
+	}
+	// all messages are in a single chunk, so their data remains valid even
+	// though the same buffer was passed to every call.
+	assert.Equal(t, len(logTimes), len(messages))
+	for i, message := range messages {
+		assert.Equal(t, []byte{byte(i)}, message.Data)
+	}
+}
+
+func TestReaderAttachmentIndexes(t *testing.T) {
+	t.Run("returns attachment indexes from summary", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w, err := NewWriter(buf, &WriterOptions{})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteHeader(&Header{}))
+		assert.Nil(t, w.WriteAttachment(&Attachment{
+			Name:       "calibration.yaml",
+			MediaType:  "application/yaml",
+			LogTime:    20,
+			CreateTime: 10,
+			Data:       []byte("k: v"),
+		}))
+		assert.Nil(t, w.WriteAttachment(&Attachment{
+			Name:       "map.png",
+			MediaType:  "image/png",
+			LogTime:    5,
+			CreateTime: 1,
+			Data:       []byte{1, 2, 3},
+		}))
+		assert.Nil(t, w.Close())
+		reader, err := NewReader(bytes.NewReader(buf.Bytes()))
+		assert.Nil(t, err)
+		indexes, err := reader.AttachmentIndexes()
+		assert.Nil(t, err)
+		assert.Equal(t, w.AttachmentIndexes, indexes)
+		assert.Equal(t, "map.png", indexes[1].Name)
+		assert.Equal(t, uint64(1), indexes[1].CreateTime)
+		assert.Equal(t, uint64(5), indexes[1].LogTime)
+	})
+	t.Run("sentinel without attachment index", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{}, []string{"/a"}, []uint64{1})
+		reader, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		indexes, err := reader.AttachmentIndexes()
+		assert.ErrorIs(t, err, ErrNoAttachmentIndex)
+		assert.NotNil(t, indexes)
+		assert.Empty(t, indexes)
+	})
+}
+
+func TestReaderAttachmentsByMediaType(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	for _, attachment := range []*Attachment{
+		{Name: "front.png", MediaType: "image/png", Data: []byte{1}},
+		{Name: "calibration.yaml", MediaType: "application/yaml", Data: []byte("k: v")},
+		{Name: "rear.png", MediaType: "image/png", Data: []byte{2}},
+	} {
+		assert.Nil(t, w.WriteAttachment(attachment))
+	}
+	assert.Nil(t, w.Close())
+	reader, err := NewReader(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+	images, err := reader.AttachmentsByMediaType("image/png")
+	assert.Nil(t, err)
+	assert.Equal(t, []*AttachmentIndex{w.AttachmentIndexes[0], w.AttachmentIndexes[2]}, images)
+	videos, err := reader.AttachmentsByMediaType("video/mp4")
+	assert.Nil(t, err)
+	assert.NotNil(t, videos)
+	assert.Empty(t, videos)
+
+	t.Run("sentinel without attachment index", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{}, []string{"/a"}, []uint64{1})
+		reader, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		indexes, err := reader.AttachmentsByMediaType("image/png")
+		assert.ErrorIs(t, err, ErrNoAttachmentIndex)
+		assert.Empty(t, indexes)
+	})
+}
+
+func TestMessageIteratorSharesSchemas(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{Chunked: true, ChunkSize: 100, Compression: CompressionZSTD})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	_, err = w.WriteSchema(&Schema{ID: 1, Name: "schema", Encoding: "jsonschema", Data: []byte("{}")})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 1, SchemaID: 1, Topic: "/a", MessageEncoding: "json"})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 2, SchemaID: 0, Topic: "/b", MessageEncoding: "json"})
+	assert.Nil(t, err)
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: uint16(i%2 + 1), LogTime: uint64(i)}))
+	}
+	assert.Nil(t, w.Close())
+	for _, useIndex := range []bool{true, false} {
+		t.Run(fmt.Sprintf("indexed %v", useIndex), func(t *testing.T) {
+			reader, err := NewReader(bytes.NewReader(buf.Bytes()))
+			assert.Nil(t, err)
+			it, err := reader.Messages(readopts.UsingIndex(useIndex))
+			assert.Nil(t, err)
+			var first *Schema
+			count := 0
+			for {
+				schema, channel, _, err := it.Next(nil)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				assert.Nil(t, err)
+				count++
+				if channel.SchemaID == 0 {
+					assert.Nil(t, schema)
+					continue
+				}
+				assert.Equal(t, []byte("{}"), schema.Data)
+				if first == nil {
+					first = schema
+				}
+				assert.Same(t, first, schema)
+			}
+			assert.Equal(t, 20, count)
+		})
+	}
+}
+
+func TestReaderUnindexedTailChunks(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{Chunked: true, ChunkSize: 1024, Compression: CompressionLZ4})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	_, err = w.WriteSchema(&Schema{ID: 1, Name: "schema", Encoding: "jsonschema", Data: []byte("{}")})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 1, SchemaID: 1, Topic: "/a", MessageEncoding: "json"})
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: uint64(i)}))
+	}
+	assert.Nil(t, w.Flush())
+	indexed := len(w.ChunkIndexes)
+	// the tail chunk defines a channel that is also missing from the summary.
+	_, err = w.WriteChannel(&Channel{ID: 2, SchemaID: 1, Topic: "/b", MessageEncoding: "json"})
+	assert.Nil(t, err)
+	for i := 10; i < 20; i++ {
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: uint16(i%2 + 1), LogTime: uint64(i)}))
+	}
+	assert.Nil(t, w.Flush())
+	w.ChunkIndexes = w.ChunkIndexes[:indexed]
+	delete(w.channels, 2)
+	assert.Nil(t, w.Close())
+
+	t.Run("info reports incomplete summary", func(t *testing.T) {
+		reader, err := NewReader(bytes.NewReader(buf.Bytes()))
+		assert.Nil(t, err)
+		info, err := reader.Info()
+		assert.Nil(t, err)
+		assert.True(t, info.SummaryIncomplete)
+		assert.Equal(t, indexed, len(info.ChunkIndexes))
+	})
+	t.Run("indexed read includes unindexed chunks", func(t *testing.T) {
+		reader, err := NewReader(bytes.NewReader(buf.Bytes()))
+		assert.Nil(t, err)
+		it, err := reader.Messages(readopts.UsingIndex(true))
+		assert.Nil(t, err)
+		var logTimes []uint64
+		for {
+			schema, channel, message, err := it.Next(nil)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "schema", schema.Name)
+			if message.LogTime >= 10 {
+				assert.Equal(t, uint16(message.LogTime%2+1), channel.ID)
+			}
+			logTimes = append(logTimes, message.LogTime)
+		}
+		assert.Equal(t, 20, len(logTimes))
+		for i, logTime := range logTimes {
+			assert.Equal(t, uint64(i), logTime)
+		}
+	})
+	t.Run("indexed read filters unindexed chunks", func(t *testing.T) {
+		reader, err := NewReader(bytes.NewReader(buf.Bytes()))
+		assert.Nil(t, err)
+		it, err := reader.Messages(
+			readopts.UsingIndex(true),
+			readopts.WithTopics([]string{"/b"}),
+			readopts.After(12),
+		)
+		assert.Nil(t, err)
+		count := 0
+		for {
+			_, channel, _, err := it.Next(nil)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "/b", channel.Topic)
+			count++
+		}
+		assert.Equal(t, 4, count)
+	})
+	t.Run("finds extended data end records", func(t *testing.T) {
+		reader, err := NewReader(bytes.NewReader(extendDataEnd(t, buf.Bytes(), 8)))
+		assert.Nil(t, err)
+		info, err := reader.Info()
+		assert.Nil(t, err)
+		assert.True(t, info.SummaryIncomplete)
+		it, err := reader.Messages(readopts.UsingIndex(true))
+		assert.Nil(t, err)
+		count := 0
+		for {
+			_, _, _, err := it.Next(nil)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			assert.Nil(t, err)
+			count++
+		}
+		assert.Equal(t, 20, count)
+	})
+	t.Run("missing data end is flagged", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{Chunked: true, ChunkSize: 50, Compression: CompressionZSTD}, []string{"/a"}, []uint64{1, 2, 3})
+		footer, err := ReadFooter(bytes.NewReader(data))
+		assert.Nil(t, err)
+		data[footer.SummaryStart-dataEndLength] = byte(OpMetadata)
+		reader, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		info, err := reader.Info()
+		assert.Nil(t, err)
+		assert.True(t, info.SummaryIncomplete)
+	})
+	t.Run("complete summary is not flagged", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{Chunked: true, ChunkSize: 50, Compression: CompressionZSTD}, []string{"/a"}, []uint64{1, 2, 3})
+		reader, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		info, err := reader.Info()
+		assert.Nil(t, err)
+		assert.False(t, info.SummaryIncomplete)
+		info, err = readInfo(bytes.NewReader(extendDataEnd(t, data, 8)), int64(len(data)+8))
+		assert.Nil(t, err)
+		assert.False(t, info.SummaryIncomplete)
+	})
+}
+
+func TestReaderMessagesFunc(t *testing.T) {
+	logTimes := make([]uint64, 50)
+	for i := range logTimes {
+		logTimes[i] = uint64(i)
+	}
+	for _, opts := range []*WriterOptions{
+		{Chunked: true, ChunkSize: 64, Compression: CompressionZSTD},
+		{Chunked: false},
+	} {
+		data := writeTestFile(t, opts, []string{"/a"}, logTimes)
+		for _, useIndex := range []bool{true, false} {
+			reader, err := NewReader(bytes.NewReader(data))
+			assert.Nil(t, err)
+			var retained []*Message
+			err = reader.MessagesFunc(func(_ *Schema, _ *Channel, message *Message) (bool, error) {
+				if message.LogTime%2 == 0 {
+					retained = append(retained, message)
+					return true, nil
+				}
+				return false, nil
+			}, readopts.UsingIndex(useIndex && opts.Chunked))
+			assert.Nil(t, err)
+			assert.Equal(t, len(logTimes)/2, len(retained))
+			for i, message := range retained {
+				assert.Equal(t, []byte{byte(2 * i)}, message.Data)
+			}
+		}
+	}
+	t.Run("stops on callback error", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{Chunked: true}, []string{"/a"}, logTimes)
+		reader, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		stop := errors.New("stop")
+		calls := 0
+		err = reader.MessagesFunc(func(*Schema, *Channel, *Message) (bool, error) {
+			calls++
+			return false, stop
+		})
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+// writeCompressedChunks writes a file whose chunks are compressed with an
+// encoder the writer does not support itself, and returns it along with the
+// data of its messages.
+func writeCompressedChunks(
+	t *testing.T,
+	compression CompressionFormat,
+	encoder func(io.Writer) resettableWriteCloser,
+) ([]byte, []string) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{Chunked: true, ChunkSize: 100, IncludeCRC: true})
+	assert.Nil(t, err)
+	w.compressedWriter = newCountingCRCWriter(encoder(w.compressed), true)
+	w.compression = compression
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	_, err = w.WriteChannel(&Channel{ID: 1, Topic: "/a", MessageEncoding: "json"})
+	assert.Nil(t, err)
+	var messages []string
+	for i := 0; i < 20; i++ {
+		messages = append(messages, fmt.Sprintf("message %d", i))
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: uint64(i), Data: []byte(messages[i])}))
+	}
+	assert.Nil(t, w.Close())
+	return buf.Bytes(), messages
+}
+
+// readMessageData reads the data of all messages in a file.
+func readMessageData(t *testing.T, data []byte, opts ...readopts.ReadOpt) ([]string, error) {
+	reader, err := NewReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	it, err := reader.Messages(opts...)
+	assert.Nil(t, err)
+	var messages []string
+	err = Range(it, func(_ *Schema, _ *Channel, m *Message) error {
+		messages = append(messages, string(m.Data))
+		return nil
+	})
+	return messages, err
+}
+
+func TestReaderSnappyChunks(t *testing.T) {
+	data, expected := writeCompressedChunks(t, CompressionSnappy, func(w io.Writer) resettableWriteCloser {
+		return s2.NewWriter(w, s2.WriterSnappyCompat())
+	})
+	for _, useIndex := range []bool{true, false} {
+		messages, err := readMessageData(t, data, readopts.UsingIndex(useIndex))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, messages, "using index: %v", useIndex)
+	}
+}
+
+// xorWriter is a toy compressor that XORs each byte with a key, the inverse of
+// xorReader.
+type xorWriter struct {
+	w   io.Writer
+	key byte
+}
+
+func (x *xorWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, len(p))
+	for i, b := range p {
+		buf[i] = b ^ x.key
+	}
+	return x.w.Write(buf)
+}
+
+func (x *xorWriter) Close() error {
+	return nil
+}
+
+func (x *xorWriter) Reset(w io.Writer) {
+	x.w = w
+}
+
+func TestReaderDecompressors(t *testing.T) {
+	data, expected := writeCompressedChunks(t, "xor", func(w io.Writer) resettableWriteCloser {
+		return &xorWriter{w: w, key: 0x5a}
+	})
+	for _, useIndex := range []bool{true, false} {
+		var decoders []*xorReader
+		messages, err := readMessageData(t, data, readopts.UsingIndex(useIndex), readopts.WithDecompressors(
+			map[string]func(io.Reader) (io.Reader, error){
+				"xor": func(r io.Reader) (io.Reader, error) {
+					decoder := &xorReader{r: r, key: 0x5a}
+					decoders = append(decoders, decoder)
+					return decoder, nil
+				},
+			},
+		))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, messages, "using index: %v", useIndex)
+		// the decompressor is reused across chunks.
+		assert.Equal(t, 1, len(decoders), "using index: %v", useIndex)
+		assert.Greater(t, decoders[0].resets, 0, "using index: %v", useIndex)
+
+		_, err = readMessageData(t, data, readopts.UsingIndex(useIndex))
+		var unsupported *UnsupportedCompressionError
+		assert.ErrorAs(t, err, &unsupported, "using index: %v", useIndex)
+	}
+}
@@ -2,7 +2,9 @@ package readopts
 
 import (
 	"fmt"
+	"io"
 	"math"
+	"time"
 )
 
 type ReadOrder int
@@ -19,6 +21,27 @@ type ReadOptions struct {
 	Topics   []string
 	UseIndex bool
 	Order    ReadOrder
+	// RetainChunkBuffers causes message data to alias the decompressed chunk
+	// it was read from, instead of the buffer passed to Next. See
+	// RetainingChunkBuffers.
+	RetainChunkBuffers bool
+	// Deadline bounds the time spent reading. See WithDeadline.
+	Deadline time.Time
+	// MaxMessages limits the number of messages read, if positive. See
+	// WithMaxMessages.
+	MaxMessages int
+	// CollectTimeSkew causes the reader to accumulate publish time skew
+	// statistics. See CollectingTimeSkew.
+	CollectTimeSkew bool
+	// IndexSidecar receives an index of the messages read. See
+	// WritingIndexSidecar.
+	IndexSidecar io.Writer
+	// ZSTDDictionary is the dictionary zstd chunks are decompressed with. See
+	// WithZSTDDictionary.
+	ZSTDDictionary []byte
+	// Decompressors registers decompressors for chunk compression formats
+	// not supported natively. See WithDecompressors.
+	Decompressors map[string]func(io.Reader) (io.Reader, error)
 }
 
 func Default() ReadOptions {
@@ -79,3 +102,83 @@ func UsingIndex(useIndex bool) ReadOpt {
 		return nil
 	}
 }
+
+// RetainingChunkBuffers controls whether message data returned by the iterator
+// aliases the decompressed chunk it was read from, avoiding a per-message
+// copy. The data of a message read from a chunk remains valid until the
+// iterator advances past that chunk; the chunk buffer may then be reused. When
+// reading with the index, each chunk is decompressed into a new buffer, so
+// message data remains valid indefinitely regardless of this option.
+func RetainingChunkBuffers(retain bool) ReadOpt {
+	return func(ro *ReadOptions) error {
+		ro.RetainChunkBuffers = retain
+		return nil
+	}
+}
+
+// WithDeadline causes the iterator to return mcap.ErrDeadlineExceeded once
+// the deadline has passed. The deadline is checked before each record or chunk
+// is read.
+func WithDeadline(deadline time.Time) ReadOpt {
+	return func(ro *ReadOptions) error {
+		ro.Deadline = deadline
+		return nil
+	}
+}
+
+// WithMaxMessages causes the iterator to return io.EOF after n messages have
+// been returned, without reading or decompressing any further records. Zero
+// means no limit.
+func WithMaxMessages(n int) ReadOpt {
+	return func(ro *ReadOptions) error {
+		if n < 0 {
+			return fmt.Errorf("max messages cannot be negative")
+		}
+		ro.MaxMessages = n
+		return nil
+	}
+}
+
+// CollectingTimeSkew causes the reader to accumulate, per channel, statistics
+// of the skew between the publish time and log time of the messages returned
+// by the iterator. They are available from the reader's TimeSkewStats method.
+func CollectingTimeSkew(collect bool) ReadOpt {
+	return func(ro *ReadOptions) error {
+		ro.CollectTimeSkew = collect
+		return nil
+	}
+}
+
+// WritingIndexSidecar causes the iterator to accumulate a compact index of
+// the messages it returns, by topic and log time, and write it to w once the
+// end of the file is reached, so that the index is built in the course of a
+// read that is needed anyway. The index may be loaded with
+// mcap.ReadIndexSidecar. It is written only by reads that do not use the
+// file's index, and only if the read reaches the end of the file.
+func WritingIndexSidecar(w io.Writer) ReadOpt {
+	return func(ro *ReadOptions) error {
+		ro.IndexSidecar = w
+		return nil
+	}
+}
+
+// WithZSTDDictionary causes zstd chunks compressed with the given dictionary,
+// such as by a writer with mcap.WriterOptions.ZSTDDictionary, to be
+// decompressed with it. Chunks compressed without a dictionary are read as
+// usual.
+func WithZSTDDictionary(dict []byte) ReadOpt {
+	return func(ro *ReadOptions) error {
+		ro.ZSTDDictionary = dict
+		return nil
+	}
+}
+
+// WithDecompressors registers decompressors for chunk compression formats
+// not supported natively, as with mcap.LexerOptions.Decompressors. They are
+// used both with and without the index.
+func WithDecompressors(decompressors map[string]func(io.Reader) (io.Reader, error)) ReadOpt {
+	return func(ro *ReadOptions) error {
+		ro.Decompressors = decompressors
+		return nil
+	}
+}
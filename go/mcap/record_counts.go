@@ -0,0 +1,38 @@
+package mcap
+
+import (
+	"errors"
+	"io"
+)
+
+// RecordCounts reads a file in a single pass and counts its records by opcode,
+// including index and summary records. With the EmitChunks lexer option, only
+// top-level records are counted. Otherwise, chunks are counted and the records
+// inside them are counted as well. Padding and records with unrecognized
+// opcodes are not counted.
+func RecordCounts(r io.Reader, opts ...*LexerOptions) (map[OpCode]uint64, error) {
+	lexer, err := NewLexer(r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[OpCode]uint64)
+	lexer.onChunk = func() {
+		counts[OpChunk]++
+	}
+	var buf []byte
+	for {
+		tokenType, record, err := lexer.Next(buf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return counts, nil
+			}
+			return nil, err
+		}
+		if len(record) > len(buf) {
+			buf = record
+		}
+		if rt, ok := recordTypes[tokenType]; ok {
+			counts[rt.opcode]++
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package mcap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordCounts(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{Chunked: true, Compression: CompressionLZ4})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	_, err = w.WriteSchema(&Schema{ID: 1})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 1, SchemaID: 1, Topic: "/a"})
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: uint64(i)}))
+	}
+	assert.Nil(t, w.Flush())
+	assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: 3}))
+	assert.Nil(t, w.WriteAttachment(&Attachment{Name: "a"}))
+	assert.Nil(t, w.WriteMetadata(&Metadata{Name: "m"}))
+	assert.Nil(t, w.Close())
+	summary := map[OpCode]uint64{
+		OpHeader:          1,
+		OpMessageIndex:    2,
+		OpAttachment:      1,
+		OpMetadata:        1,
+		OpDataEnd:         1,
+		OpChunk:           2,
+		OpChunkIndex:      2,
+		OpAttachmentIndex: 1,
+		OpMetadataIndex:   1,
+		OpStatistics:      1,
+		OpSummaryOffset:   6,
+		OpFooter:          1,
+	}
+	t.Run("top-level records", func(t *testing.T) {
+		counts, err := RecordCounts(bytes.NewReader(buf.Bytes()), &LexerOptions{EmitChunks: true})
+		assert.Nil(t, err)
+		expected := map[OpCode]uint64{OpSchema: 1, OpChannel: 1}
+		for k, v := range summary {
+			expected[k] = v
+		}
+		assert.Equal(t, expected, counts)
+	})
+	t.Run("including chunk contents", func(t *testing.T) {
+		counts, err := RecordCounts(bytes.NewReader(buf.Bytes()))
+		assert.Nil(t, err)
+		expected := map[OpCode]uint64{OpSchema: 2, OpChannel: 2, OpMessage: 4}
+		for k, v := range summary {
+			expected[k] = v
+		}
+		assert.Equal(t, expected, counts)
+	})
+}
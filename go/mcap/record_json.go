@@ -0,0 +1,296 @@
+package mcap
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type jsonMessageIndexEntry struct {
+	Timestamp uint64 `json:"timestamp"`
+	Offset    uint64 `json:"offset"`
+}
+
+// MarshalRecordJSON parses a record body of token type t and returns a
+// canonical JSON representation of it, suitable for emitting as JSON lines.
+// Each object has a "type" field naming the record type, followed by the
+// record's fields in camel case. Opaque payloads such as message data, schema
+// data, attachment data, and chunk records are base64-encoded.
+func (t TokenType) MarshalRecordJSON(body []byte) ([]byte, error) {
+	rt, ok := recordTypes[t]
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %s token to JSON", t)
+	}
+	record, err := rt.json(body)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(record)
+}
+
+func headerJSON(body []byte) (any, error) {
+	header, err := ParseHeader(body)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Type    string `json:"type"`
+		Profile string `json:"profile"`
+		Library string `json:"library"`
+	}{"header", header.Profile, header.Library}, nil
+}
+
+func footerJSON(body []byte) (any, error) {
+	footer, err := ParseFooter(body)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Type               string `json:"type"`
+		SummaryStart       uint64 `json:"summaryStart"`
+		SummaryOffsetStart uint64 `json:"summaryOffsetStart"`
+		SummaryCRC         uint32 `json:"summaryCrc"`
+	}{"footer", footer.SummaryStart, footer.SummaryOffsetStart, footer.SummaryCRC}, nil
+}
+
+func schemaJSON(body []byte) (any, error) {
+	schema, err := ParseSchema(body)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Type       string `json:"type"`
+		ID         uint16 `json:"id"`
+		Name       string `json:"name"`
+		Encoding   string `json:"encoding"`
+		DataBase64 []byte `json:"dataBase64"`
+	}{"schema", schema.ID, schema.Name, schema.Encoding, schema.Data}, nil
+}
+
+func channelJSON(body []byte) (any, error) {
+	channel, err := ParseChannel(body)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Type            string            `json:"type"`
+		ID              uint16            `json:"id"`
+		SchemaID        uint16            `json:"schemaId"`
+		Topic           string            `json:"topic"`
+		MessageEncoding string            `json:"messageEncoding"`
+		Metadata        map[string]string `json:"metadata"`
+	}{"channel", channel.ID, channel.SchemaID, channel.Topic, channel.MessageEncoding, channel.Metadata}, nil
+}
+
+func messageJSON(body []byte) (any, error) {
+	message, err := ParseMessage(body)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Type        string `json:"type"`
+		ChannelID   uint16 `json:"channelId"`
+		Sequence    uint32 `json:"sequence"`
+		LogTime     uint64 `json:"logTime"`
+		PublishTime uint64 `json:"publishTime"`
+		DataBase64  []byte `json:"dataBase64"`
+	}{"message", message.ChannelID, message.Sequence, message.LogTime, message.PublishTime, message.Data}, nil
+}
+
+func chunkJSON(body []byte) (any, error) {
+	chunk, err := ParseChunk(body)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Type             string `json:"type"`
+		MessageStartTime uint64 `json:"messageStartTime"`
+		MessageEndTime   uint64 `json:"messageEndTime"`
+		UncompressedSize uint64 `json:"uncompressedSize"`
+		UncompressedCRC  uint32 `json:"uncompressedCrc"`
+		Compression      string `json:"compression"`
+		RecordsBase64    []byte `json:"recordsBase64"`
+	}{
+		"chunk",
+		chunk.MessageStartTime,
+		chunk.MessageEndTime,
+		chunk.UncompressedSize,
+		chunk.UncompressedCRC,
+		chunk.Compression,
+		chunk.Records,
+	}, nil
+}
+
+func messageIndexJSON(body []byte) (any, error) {
+	idx, err := ParseMessageIndex(body)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]jsonMessageIndexEntry, 0, len(idx.Records))
+	for _, entry := range idx.Records {
+		records = append(records, jsonMessageIndexEntry{entry.Timestamp, entry.Offset})
+	}
+	return struct {
+		Type      string                  `json:"type"`
+		ChannelID uint16                  `json:"channelId"`
+		Records   []jsonMessageIndexEntry `json:"records"`
+	}{"messageIndex", idx.ChannelID, records}, nil
+}
+
+func chunkIndexJSON(body []byte) (any, error) {
+	idx, err := ParseChunkIndex(body)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Type                string            `json:"type"`
+		MessageStartTime    uint64            `json:"messageStartTime"`
+		MessageEndTime      uint64            `json:"messageEndTime"`
+		ChunkStartOffset    uint64            `json:"chunkStartOffset"`
+		ChunkLength         uint64            `json:"chunkLength"`
+		MessageIndexOffsets map[uint16]uint64 `json:"messageIndexOffsets"`
+		MessageIndexLength  uint64            `json:"messageIndexLength"`
+		Compression         string            `json:"compression"`
+		CompressedSize      uint64            `json:"compressedSize"`
+		UncompressedSize    uint64            `json:"uncompressedSize"`
+	}{
+		"chunkIndex",
+		idx.MessageStartTime,
+		idx.MessageEndTime,
+		idx.ChunkStartOffset,
+		idx.ChunkLength,
+		idx.MessageIndexOffsets,
+		idx.MessageIndexLength,
+		string(idx.Compression),
+		idx.CompressedSize,
+		idx.UncompressedSize,
+	}, nil
+}
+
+func attachmentJSON(body []byte) (any, error) {
+	attachment, err := ParseAttachment(body)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Type       string `json:"type"`
+		LogTime    uint64 `json:"logTime"`
+		CreateTime uint64 `json:"createTime"`
+		Name       string `json:"name"`
+		MediaType  string `json:"mediaType"`
+		DataBase64 []byte `json:"dataBase64"`
+		CRC        uint32 `json:"crc"`
+	}{
+		"attachment",
+		attachment.LogTime,
+		attachment.CreateTime,
+		attachment.Name,
+		attachment.MediaType,
+		attachment.Data,
+		attachment.CRC,
+	}, nil
+}
+
+func attachmentIndexJSON(body []byte) (any, error) {
+	idx, err := ParseAttachmentIndex(body)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Type       string `json:"type"`
+		Offset     uint64 `json:"offset"`
+		Length     uint64 `json:"length"`
+		LogTime    uint64 `json:"logTime"`
+		CreateTime uint64 `json:"createTime"`
+		DataSize   uint64 `json:"dataSize"`
+		Name       string `json:"name"`
+		MediaType  string `json:"mediaType"`
+	}{
+		"attachmentIndex",
+		idx.Offset,
+		idx.Length,
+		idx.LogTime,
+		idx.CreateTime,
+		idx.DataSize,
+		idx.Name,
+		idx.MediaType,
+	}, nil
+}
+
+func statisticsJSON(body []byte) (any, error) {
+	stats, err := ParseStatistics(body)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Type                 string            `json:"type"`
+		MessageCount         uint64            `json:"messageCount"`
+		SchemaCount          uint16            `json:"schemaCount"`
+		ChannelCount         uint32            `json:"channelCount"`
+		AttachmentCount      uint32            `json:"attachmentCount"`
+		MetadataCount        uint32            `json:"metadataCount"`
+		ChunkCount           uint32            `json:"chunkCount"`
+		MessageStartTime     uint64            `json:"messageStartTime"`
+		MessageEndTime       uint64            `json:"messageEndTime"`
+		ChannelMessageCounts map[uint16]uint64 `json:"channelMessageCounts"`
+	}{
+		"statistics",
+		stats.MessageCount,
+		stats.SchemaCount,
+		stats.ChannelCount,
+		stats.AttachmentCount,
+		stats.MetadataCount,
+		stats.ChunkCount,
+		stats.MessageStartTime,
+		stats.MessageEndTime,
+		stats.ChannelMessageCounts,
+	}, nil
+}
+
+func metadataJSON(body []byte) (any, error) {
+	metadata, err := ParseMetadata(body)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Type     string            `json:"type"`
+		Name     string            `json:"name"`
+		Metadata map[string]string `json:"metadata"`
+	}{"metadata", metadata.Name, metadata.Metadata}, nil
+}
+
+func metadataIndexJSON(body []byte) (any, error) {
+	idx, err := ParseMetadataIndex(body)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Type   string `json:"type"`
+		Offset uint64 `json:"offset"`
+		Length uint64 `json:"length"`
+		Name   string `json:"name"`
+	}{"metadataIndex", idx.Offset, idx.Length, idx.Name}, nil
+}
+
+func summaryOffsetJSON(body []byte) (any, error) {
+	summaryOffset, err := ParseSummaryOffset(body)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Type        string `json:"type"`
+		GroupOpcode OpCode `json:"groupOpcode"`
+		GroupStart  uint64 `json:"groupStart"`
+		GroupLength uint64 `json:"groupLength"`
+	}{"summaryOffset", summaryOffset.GroupOpcode, summaryOffset.GroupStart, summaryOffset.GroupLength}, nil
+}
+
+func dataEndJSON(body []byte) (any, error) {
+	dataEnd, err := ParseDataEnd(body)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		Type           string `json:"type"`
+		DataSectionCRC uint32 `json:"dataSectionCrc"`
+	}{"dataEnd", dataEnd.DataSectionCRC}, nil
+}
@@ -0,0 +1,63 @@
+package mcap
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalRecordJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{Chunked: true, Compression: CompressionNone, OverrideLibrary: true})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{Profile: "ros1", Library: "lib"}))
+	_, err = w.WriteSchema(&Schema{ID: 1, Name: "Foo", Encoding: "ros1msg", Data: []byte("int32 a")})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 3, SchemaID: 1, Topic: "/foo", MessageEncoding: "ros1"})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteMessage(&Message{ChannelID: 3, Sequence: 7, LogTime: 10, PublishTime: 9, Data: []byte("hi")}))
+	assert.Nil(t, w.WriteMetadata(&Metadata{Name: "meta", Metadata: map[string]string{"k": "v"}}))
+	assert.Nil(t, w.Close())
+
+	lexer, err := NewLexer(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+	lines := make(map[string]string)
+	for {
+		tokenType, record, err := lexer.Next(nil)
+		assert.Nil(t, err)
+		line, err := tokenType.MarshalRecordJSON(record)
+		assert.Nil(t, err)
+		assert.True(t, json.Valid(line))
+		var envelope struct {
+			Type string `json:"type"`
+		}
+		assert.Nil(t, json.Unmarshal(line, &envelope))
+		if _, ok := lines[envelope.Type]; !ok {
+			lines[envelope.Type] = string(line)
+		}
+		if tokenType == TokenFooter {
+			break
+		}
+	}
+	assert.Equal(t, `{"type":"header","profile":"ros1","library":"lib"}`, lines["header"])
+	assert.Equal(t,
+		`{"type":"schema","id":1,"name":"Foo","encoding":"ros1msg","dataBase64":"aW50MzIgYQ=="}`,
+		lines["schema"],
+	)
+	assert.Equal(t,
+		`{"type":"message","channelId":3,"sequence":7,"logTime":10,"publishTime":9,"dataBase64":"aGk="}`,
+		lines["message"],
+	)
+	assert.Equal(t, `{"type":"metadata","name":"meta","metadata":{"k":"v"}}`, lines["metadata"])
+	assert.Equal(t, `{"type":"messageIndex","channelId":3,"records":[{"timestamp":10,"offset":73}]}`, lines["messageIndex"])
+	for _, recordType := range []string{
+		"channel", "dataEnd", "statistics", "chunkIndex", "metadataIndex", "summaryOffset", "footer",
+	} {
+		assert.Contains(t, lines, recordType)
+	}
+
+	_, err = TokenError.MarshalRecordJSON(nil)
+	assert.NotNil(t, err)
+}
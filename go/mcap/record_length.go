@@ -0,0 +1,198 @@
+package mcap
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrRecordLengthMismatch indicates that the fields of a record do not
+// occupy exactly the record's declared length. It is returned by the lexer
+// with LexerOptions.StrictParsing.
+var ErrRecordLengthMismatch = errors.New("record fields do not match record length")
+
+// checkRecordLength checks that the fields of a record with a known opcode
+// occupy exactly the record, as parsed by the Parse functions. Records with
+// unknown opcodes are not checked.
+func checkRecordLength(opcode OpCode, record []byte) error {
+	n, err := fieldsLength(opcode, record)
+	if err != nil {
+		return fmt.Errorf("%w: failed to parse %s record: %s", ErrRecordLengthMismatch, opcode, err)
+	}
+	if n != len(record) {
+		return fmt.Errorf("%w: %s record has %d bytes of fields and length %d",
+			ErrRecordLengthMismatch, opcode, n, len(record))
+	}
+	return nil
+}
+
+// fieldsLength returns the number of bytes occupied by the fields of a record,
+// following the lengths declared within it, or the record's length if its
+// opcode is unknown. An error is returned if the fields run past the end of
+// the record.
+func fieldsLength(opcode OpCode, buf []byte) (int, error) {
+	var offset int
+	var err error
+	switch opcode {
+	case OpHeader:
+		// profile, library
+		offset, err = skipPrefixed(buf, 0, 2)
+	case OpFooter:
+		// summary start, summary offset start, summary crc
+		offset, err = skipFixed(buf, 0, 8+8+4)
+	case OpSchema:
+		// id, then name, encoding, data
+		if offset, err = skipFixed(buf, 0, 2); err == nil {
+			offset, err = skipPrefixed(buf, offset, 3)
+		}
+	case OpChannel:
+		// id, schema id, then topic, message encoding, metadata
+		if offset, err = skipFixed(buf, 0, 2+2); err == nil {
+			if offset, err = skipPrefixed(buf, offset, 2); err == nil {
+				offset, err = skipMap(buf, offset)
+			}
+		}
+	case OpMessage:
+		// channel id, sequence, log time, publish time, then data to the end
+		// of the record.
+		if _, err = skipFixed(buf, 0, 2+4+8+8); err == nil {
+			offset = len(buf)
+		}
+	case OpChunk:
+		// start, end, uncompressed size, uncompressed crc, then compression,
+		// records
+		if offset, err = skipFixed(buf, 0, 8+8+8+4); err == nil {
+			if offset, err = skipPrefixed(buf, offset, 1); err == nil {
+				offset, err = skipLengthPrefixed64(buf, offset)
+			}
+		}
+	case OpMessageIndex:
+		// channel id, then entries of a timestamp and offset each
+		if offset, err = skipFixed(buf, 0, 2); err == nil {
+			offset, err = skipEntries(buf, offset, 8+8)
+		}
+	case OpChunkIndex:
+		// start, end, chunk start offset, chunk length, then message index
+		// offsets of a channel id and offset each, message index length,
+		// compression, compressed size, uncompressed size
+		if offset, err = skipFixed(buf, 0, 8+8+8+8); err == nil {
+			if offset, err = skipEntries(buf, offset, 2+8); err == nil {
+				if offset, err = skipFixed(buf, offset, 8); err == nil {
+					if offset, err = skipPrefixed(buf, offset, 1); err == nil {
+						offset, err = skipFixed(buf, offset, 8+8)
+					}
+				}
+			}
+		}
+	case OpAttachment:
+		// log time, create time, then name, media type, data, crc
+		if offset, err = skipFixed(buf, 0, 8+8); err == nil {
+			if offset, err = skipPrefixed(buf, offset, 2); err == nil {
+				if offset, err = skipLengthPrefixed64(buf, offset); err == nil {
+					offset, err = skipFixed(buf, offset, 4)
+				}
+			}
+		}
+	case OpAttachmentIndex:
+		// offset, length, log time, create time, data size, then name, media
+		// type
+		if offset, err = skipFixed(buf, 0, 8+8+8+8+8); err == nil {
+			offset, err = skipPrefixed(buf, offset, 2)
+		}
+	case OpStatistics:
+		// message count, schema count, channel count, attachment count,
+		// metadata count, chunk count, start, end, then channel message
+		// counts of a channel id and count each
+		if offset, err = skipFixed(buf, 0, 8+2+4+4+4+4+8+8); err == nil {
+			offset, err = skipEntries(buf, offset, 2+8)
+		}
+	case OpMetadata:
+		// name, metadata
+		if offset, err = skipPrefixed(buf, 0, 1); err == nil {
+			offset, err = skipMap(buf, offset)
+		}
+	case OpMetadataIndex:
+		// offset, length, then name
+		if offset, err = skipFixed(buf, 0, 8+8); err == nil {
+			offset, err = skipPrefixed(buf, offset, 1)
+		}
+	case OpSummaryOffset:
+		// group opcode, group start, group length
+		offset, err = skipFixed(buf, 0, 1+8+8)
+	case OpDataEnd:
+		// data section crc
+		offset, err = skipFixed(buf, 0, 4)
+	default:
+		offset = len(buf)
+	}
+	return offset, err
+}
+
+// skipFixed returns the offset following n bytes of fixed-size fields.
+func skipFixed(buf []byte, offset int, n int) (int, error) {
+	if len(buf)-offset < n {
+		return 0, fmt.Errorf("%d bytes of fields at offset %d exceed record", n, offset)
+	}
+	return offset + n, nil
+}
+
+// skipPrefixed returns the offset following count strings or byte arrays
+// with uint32 length prefixes.
+func skipPrefixed(buf []byte, offset int, count int) (int, error) {
+	var err error
+	for i := 0; i < count; i++ {
+		_, offset, err = readPrefixedBytes(buf, offset)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return offset, nil
+}
+
+// skipMap returns the offset following a map of strings to strings with a
+// uint32 byte length prefix, whose entries must occupy exactly that length.
+func skipMap(buf []byte, offset int) (int, error) {
+	length, offset, err := getUint32(buf, offset)
+	if err != nil {
+		return 0, err
+	}
+	if uint64(length) > uint64(len(buf)-offset) {
+		return 0, fmt.Errorf("%d bytes of map at offset %d exceed record", length, offset)
+	}
+	entries := buf[offset : offset+int(length)]
+	inset := 0
+	for inset < len(entries) {
+		if inset, err = skipPrefixed(entries, inset, 2); err != nil {
+			return 0, fmt.Errorf("map entries overrun map length %d: %w", length, err)
+		}
+	}
+	return offset + int(length), nil
+}
+
+// skipLengthPrefixed64 returns the offset following a byte array with a
+// uint64 length prefix.
+func skipLengthPrefixed64(buf []byte, offset int) (int, error) {
+	length, offset, err := getUint64(buf, offset)
+	if err != nil {
+		return 0, err
+	}
+	if length > uint64(len(buf)-offset) {
+		return 0, fmt.Errorf("%d bytes of data at offset %d exceed record", length, offset)
+	}
+	return offset + int(length), nil
+}
+
+// skipEntries returns the offset following an array with a uint32 byte
+// length prefix, of entries of the given size.
+func skipEntries(buf []byte, offset int, entrySize int) (int, error) {
+	length, offset, err := getUint32(buf, offset)
+	if err != nil {
+		return 0, err
+	}
+	if int(length)%entrySize != 0 {
+		return 0, fmt.Errorf("array length %d is not a multiple of entry size %d", length, entrySize)
+	}
+	if uint64(length) > uint64(len(buf)-offset) {
+		return 0, fmt.Errorf("%d bytes of entries at offset %d exceed record", length, offset)
+	}
+	return offset + int(length), nil
+}
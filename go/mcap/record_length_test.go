@@ -0,0 +1,147 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// encodedRecord returns a record with the given opcode and content.
+func encodedRecord(op OpCode, content ...[]byte) []byte {
+	body := flatten(content...)
+	return flatten([]byte{byte(op)}, encodedUint64(uint64(len(body))), body)
+}
+
+func TestStrictParsing(t *testing.T) {
+	lexAll := func(data []byte, opts *LexerOptions) error {
+		lexer, err := NewLexer(bytes.NewReader(data), opts)
+		assert.Nil(t, err)
+		for {
+			_, _, err := lexer.Next(nil)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	t.Run("accepts well-formed files", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w, err := NewWriter(buf, &WriterOptions{Chunked: true, Compression: CompressionZSTD})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteHeader(&Header{Profile: "ros1", Library: "lib"}))
+		_, err = w.WriteSchema(&Schema{ID: 1, Name: "s", Encoding: "jsonschema", Data: []byte("{}")})
+		assert.Nil(t, err)
+		_, err = w.WriteChannel(&Channel{ID: 1, SchemaID: 1, Topic: "/a", MessageEncoding: "json",
+			Metadata: map[string]string{"k": "v"}})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: 1, Data: []byte("{}")}))
+		assert.Nil(t, w.WriteAttachment(&Attachment{Name: "a", MediaType: "text/plain", Data: []byte("hi")}))
+		assert.Nil(t, w.WriteMetadata(&Metadata{Name: "m", Metadata: map[string]string{"a": "b", "c": ""}}))
+		assert.Nil(t, w.Close())
+		assert.Nil(t, lexAll(buf.Bytes(), &LexerOptions{StrictParsing: true}))
+		assert.Nil(t, lexAll(buf.Bytes(), &LexerOptions{StrictParsing: true, EmitChunks: true}))
+	})
+	t.Run("rejects records longer than their fields", func(t *testing.T) {
+		paddedFooter := encodedRecord(OpFooter, encodedUint64(0), encodedUint64(0), encodedUint32(0), []byte{0})
+		paddedStatistics := encodedRecord(OpStatistics, make([]byte, 8+2+4+4+4+4+8+8),
+			encodedUint32(10), encodedUint16(1), encodedUint64(1), []byte{0, 0})
+		for _, data := range [][]byte{
+			file(encodedRecord(OpHeader, prefixedString(""), prefixedString(""), []byte{0}), paddedFooter),
+			file(encodedRecord(OpHeader, prefixedString(""), prefixedString("")), paddedStatistics, footer()),
+		} {
+			assert.Nil(t, lexAll(data, &LexerOptions{}))
+			assert.ErrorIs(t, lexAll(data, &LexerOptions{StrictParsing: true}), ErrRecordLengthMismatch)
+		}
+	})
+	t.Run("rejects records shorter than their fields", func(t *testing.T) {
+		data := file(
+			encodedRecord(OpHeader, prefixedString(""), prefixedString("")),
+			encodedRecord(OpSchema, encodedUint16(1), prefixedString("s"), prefixedString("e"), encodedUint32(8), []byte("{}")),
+			footer(),
+		)
+		assert.ErrorIs(t, lexAll(data, &LexerOptions{StrictParsing: true}), ErrRecordLengthMismatch)
+	})
+}
+
+func TestFieldsLength(t *testing.T) {
+	cases := []struct {
+		assertion string
+		opcode    OpCode
+		record    []byte
+		length    int
+		ok        bool
+	}{
+		{
+			"message data extends to the end",
+			OpMessage,
+			flatten(make([]byte, 2+4+8+8), []byte("data")),
+			26,
+			true,
+		},
+		{
+			"short message",
+			OpMessage,
+			make([]byte, 21),
+			0,
+			false,
+		},
+		{
+			"message index",
+			OpMessageIndex,
+			flatten(encodedUint16(1), encodedUint32(16), encodedUint64(1), encodedUint64(2), []byte{0}),
+			22,
+			true,
+		},
+		{
+			"partial message index entry",
+			OpMessageIndex,
+			flatten(encodedUint16(1), encodedUint32(12), make([]byte, 12)),
+			0,
+			false,
+		},
+		{
+			"metadata map overrunning its length",
+			OpMetadata,
+			flatten(prefixedString("m"), encodedUint32(4), prefixedString("k"), prefixedString("v")),
+			0,
+			false,
+		},
+		{
+			"metadata map",
+			OpMetadata,
+			flatten(prefixedString("m"), encodedUint32(10), prefixedString("k"), prefixedString("v")),
+			19,
+			true,
+		},
+		{
+			"attachment data exceeding the record",
+			OpAttachment,
+			flatten(make([]byte, 16), prefixedString(""), prefixedString(""), encodedUint64(100), encodedUint32(0)),
+			0,
+			false,
+		},
+		{
+			"unknown opcode",
+			OpCode(0x80),
+			[]byte{1, 2, 3},
+			3,
+			true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.assertion, func(t *testing.T) {
+			length, err := fieldsLength(c.opcode, c.record)
+			if !c.ok {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, c.length, length)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package mcap
+
+// recordType describes the record represented by a lexer token.
+type recordType struct {
+	opcode OpCode
+	// parse parses a record body into the struct for its type.
+	parse func(body []byte) (any, error)
+	// json parses a record body into the value marshalled by
+	// MarshalRecordJSON.
+	json func(body []byte) (any, error)
+}
+
+// recordTypes describes the record represented by each lexer token. Tokens
+// that do not represent a record of a known type, namely TokenError,
+// TokenInvalidChunk and TokenUnknown, are absent.
+var recordTypes = map[TokenType]recordType{
+	TokenHeader: {
+		opcode: OpHeader,
+		parse:  func(body []byte) (any, error) { return ParseHeader(body) },
+		json:   headerJSON,
+	},
+	TokenFooter: {
+		opcode: OpFooter,
+		parse:  func(body []byte) (any, error) { return ParseFooter(body) },
+		json:   footerJSON,
+	},
+	TokenSchema: {
+		opcode: OpSchema,
+		parse:  func(body []byte) (any, error) { return ParseSchema(body) },
+		json:   schemaJSON,
+	},
+	TokenChannel: {
+		opcode: OpChannel,
+		parse:  func(body []byte) (any, error) { return ParseChannel(body) },
+		json:   channelJSON,
+	},
+	TokenMessage: {
+		opcode: OpMessage,
+		parse:  func(body []byte) (any, error) { return ParseMessage(body) },
+		json:   messageJSON,
+	},
+	TokenChunk: {
+		opcode: OpChunk,
+		parse:  func(body []byte) (any, error) { return ParseChunk(body) },
+		json:   chunkJSON,
+	},
+	TokenMessageIndex: {
+		opcode: OpMessageIndex,
+		parse:  func(body []byte) (any, error) { return ParseMessageIndex(body) },
+		json:   messageIndexJSON,
+	},
+	TokenChunkIndex: {
+		opcode: OpChunkIndex,
+		parse:  func(body []byte) (any, error) { return ParseChunkIndex(body) },
+		json:   chunkIndexJSON,
+	},
+	TokenAttachment: {
+		opcode: OpAttachment,
+		parse:  func(body []byte) (any, error) { return ParseAttachment(body) },
+		json:   attachmentJSON,
+	},
+	TokenAttachmentIndex: {
+		opcode: OpAttachmentIndex,
+		parse:  func(body []byte) (any, error) { return ParseAttachmentIndex(body) },
+		json:   attachmentIndexJSON,
+	},
+	TokenStatistics: {
+		opcode: OpStatistics,
+		parse:  func(body []byte) (any, error) { return ParseStatistics(body) },
+		json:   statisticsJSON,
+	},
+	TokenMetadata: {
+		opcode: OpMetadata,
+		parse:  func(body []byte) (any, error) { return ParseMetadata(body) },
+		json:   metadataJSON,
+	},
+	TokenMetadataIndex: {
+		opcode: OpMetadataIndex,
+		parse:  func(body []byte) (any, error) { return ParseMetadataIndex(body) },
+		json:   metadataIndexJSON,
+	},
+	TokenSummaryOffset: {
+		opcode: OpSummaryOffset,
+		parse:  func(body []byte) (any, error) { return ParseSummaryOffset(body) },
+		json:   summaryOffsetJSON,
+	},
+	TokenDataEnd: {
+		opcode: OpDataEnd,
+		parse:  func(body []byte) (any, error) { return ParseDataEnd(body) },
+		json:   dataEndJSON,
+	},
+}
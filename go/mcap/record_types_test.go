@@ -0,0 +1,19 @@
+package mcap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordTypes(t *testing.T) {
+	for tokenType := TokenHeader; tokenType < TokenError; tokenType++ {
+		rt, ok := recordTypes[tokenType]
+		assert.True(t, ok, "%s", tokenType)
+		assert.Equal(t, tokenType, opcodeTokenType(rt.opcode), "%s", tokenType)
+	}
+	for _, tokenType := range []TokenType{TokenError, TokenInvalidChunk, TokenUnknown} {
+		_, ok := recordTypes[tokenType]
+		assert.False(t, ok, "%s", tokenType)
+	}
+}
@@ -0,0 +1,152 @@
+package mcap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrTopicCollision is returned by RemapTopics when two distinct topics map to
+// the same new topic and RemapOptions.ErrorOnCollision is set.
+var ErrTopicCollision = errors.New("topics collide after remapping")
+
+// RemapOptions are options for RemapTopics.
+type RemapOptions struct {
+	// ErrorOnCollision causes RemapTopics to fail with ErrTopicCollision if two
+	// distinct topics map to the same new topic. By default, the channels are
+	// kept separate and share the new topic string.
+	ErrorOnCollision bool
+	// Writer configures the output file. If nil, the output is written in
+	// zstd-compressed chunks with CRCs.
+	Writer *WriterOptions
+	// DropAttachments omits attachments, and their index records, from the
+	// output.
+	DropAttachments bool
+	// DropMetadata omits metadata records with these names, and their index
+	// records, from the output.
+	DropMetadata []string
+}
+
+// RemapTopics copies an MCAP file from r to w, rewriting the topic of each
+// channel with the mapping function. Schemas, channel IDs, and message
+// payloads are copied unchanged, as are attachments and metadata unless
+// dropped by the options. The summary section of the output is rebuilt, so
+// index records describe only the records that were copied.
+func RemapTopics(w io.Writer, r io.Reader, mapping func(oldTopic string) string, opts ...*RemapOptions) error {
+	remapOpts := RemapOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		remapOpts = *opts[0]
+	}
+	writerOpts := WriterOptions{
+		Chunked:     true,
+		Compression: CompressionZSTD,
+		IncludeCRC:  true,
+	}
+	if remapOpts.Writer != nil {
+		writerOpts = *remapOpts.Writer
+	}
+	// channels that collide after remapping are kept separate, so the writer
+	// must not merge identical definitions.
+	writerOpts.SkipDeduplication = true
+	lexer, err := NewLexer(r)
+	if err != nil {
+		return err
+	}
+	writer, err := NewWriter(w, &writerOpts)
+	if err != nil {
+		return err
+	}
+	dropMetadata := make(map[string]bool)
+	for _, name := range remapOpts.DropMetadata {
+		dropMetadata[name] = true
+	}
+	schemas := make(map[uint16]bool)
+	channels := make(map[uint16]bool)
+	sources := make(map[string]string)
+	var buf []byte
+	for {
+		tokenType, data, err := lexer.Next(buf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		if len(data) > len(buf) {
+			buf = data
+		}
+		switch tokenType {
+		case TokenHeader:
+			header, err := ParseHeader(data)
+			if err != nil {
+				return err
+			}
+			if err := writer.WriteHeader(header); err != nil {
+				return err
+			}
+		case TokenSchema:
+			schema, err := ParseSchema(data)
+			if err != nil {
+				return err
+			}
+			if schemas[schema.ID] {
+				continue
+			}
+			schemas[schema.ID] = true
+			if _, err := writer.WriteSchema(schema); err != nil {
+				return err
+			}
+		case TokenChannel:
+			channel, err := ParseChannel(data)
+			if err != nil {
+				return err
+			}
+			if channels[channel.ID] {
+				continue
+			}
+			channels[channel.ID] = true
+			oldTopic := channel.Topic
+			channel.Topic = mapping(oldTopic)
+			if source, ok := sources[channel.Topic]; ok && source != oldTopic && remapOpts.ErrorOnCollision {
+				return fmt.Errorf("%w: %q and %q both map to %q", ErrTopicCollision, source, oldTopic, channel.Topic)
+			}
+			sources[channel.Topic] = oldTopic
+			if _, err := writer.WriteChannel(channel); err != nil {
+				return err
+			}
+		case TokenMessage:
+			message, err := ParseMessage(data)
+			if err != nil {
+				return err
+			}
+			if err := writer.WriteMessage(message); err != nil {
+				return err
+			}
+		case TokenAttachment:
+			if remapOpts.DropAttachments {
+				continue
+			}
+			attachment, err := ParseAttachment(data)
+			if err != nil {
+				return err
+			}
+			if err := writer.WriteAttachment(attachment); err != nil {
+				return err
+			}
+		case TokenMetadata:
+			metadata, err := ParseMetadata(data)
+			if err != nil {
+				return err
+			}
+			if dropMetadata[metadata.Name] {
+				continue
+			}
+			if err := writer.WriteMetadata(metadata); err != nil {
+				return err
+			}
+		case TokenDataEnd, TokenFooter:
+			return writer.Close()
+		}
+	}
+	return writer.Close()
+}
@@ -0,0 +1,90 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemapTopics(t *testing.T) {
+	logTimes := []uint64{1, 2, 3, 4, 5, 6}
+	input := writeTestFile(t, &WriterOptions{Chunked: true, ChunkSize: 50, Compression: CompressionLZ4}, []string{"/a", "/b"}, logTimes)
+	t.Run("rewrites topics", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		err := RemapTopics(output, bytes.NewReader(input), func(topic string) string {
+			return "/robot1" + topic
+		})
+		assert.Nil(t, err)
+		reader, err := NewReader(bytes.NewReader(output.Bytes()))
+		assert.Nil(t, err)
+		info, err := reader.Info()
+		assert.Nil(t, err)
+		assert.Equal(t, "/robot1/a", info.Channels[1].Topic)
+		assert.Equal(t, "/robot1/b", info.Channels[2].Topic)
+		assert.Equal(t, uint64(len(logTimes)), info.Statistics.MessageCount)
+		it, err := reader.Messages()
+		assert.Nil(t, err)
+		for i := range logTimes {
+			schema, channel, message, err := it.Next(nil)
+			assert.Nil(t, err)
+			assert.Equal(t, "schema", schema.Name)
+			assert.Equal(t, uint16(i%2+1), channel.ID)
+			assert.Equal(t, []byte{byte(i)}, message.Data)
+		}
+		_, _, _, err = it.Next(nil)
+		assert.ErrorIs(t, err, io.EOF)
+	})
+	t.Run("keeps colliding topics as separate channels", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		err := RemapTopics(output, bytes.NewReader(input), func(string) string {
+			return "/merged"
+		})
+		assert.Nil(t, err)
+		reader, err := NewReader(bytes.NewReader(output.Bytes()))
+		assert.Nil(t, err)
+		info, err := reader.Info()
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(info.Channels))
+		assert.Equal(t, "/merged", info.Channels[1].Topic)
+		assert.Equal(t, "/merged", info.Channels[2].Topic)
+	})
+	t.Run("errors on collision when requested", func(t *testing.T) {
+		err := RemapTopics(io.Discard, bytes.NewReader(input), func(string) string {
+			return "/merged"
+		}, &RemapOptions{ErrorOnCollision: true})
+		assert.True(t, errors.Is(err, ErrTopicCollision))
+	})
+	t.Run("drops attachments and metadata", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w, err := NewWriter(buf, &WriterOptions{Chunked: true, Compression: CompressionZSTD})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteHeader(&Header{}))
+		_, err = w.WriteSchema(&Schema{ID: 1})
+		assert.Nil(t, err)
+		_, err = w.WriteChannel(&Channel{ID: 1, SchemaID: 1, Topic: "/a"})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: 1, Data: []byte("hello")}))
+		assert.Nil(t, w.WriteAttachment(&Attachment{Name: "video.mp4", Data: []byte{1, 2, 3}}))
+		assert.Nil(t, w.WriteMetadata(&Metadata{Name: "operator", Metadata: map[string]string{"name": "x"}}))
+		assert.Nil(t, w.WriteMetadata(&Metadata{Name: "calibration", Metadata: map[string]string{"k": "v"}}))
+		assert.Nil(t, w.Close())
+
+		output := &bytes.Buffer{}
+		err = RemapTopics(output, bytes.NewReader(buf.Bytes()), func(topic string) string {
+			return topic
+		}, &RemapOptions{DropAttachments: true, DropMetadata: []string{"operator"}})
+		assert.Nil(t, err)
+		reader, err := NewReader(bytes.NewReader(output.Bytes()))
+		assert.Nil(t, err)
+		info, err := reader.Info()
+		assert.Nil(t, err)
+		assert.Empty(t, info.AttachmentIndexes)
+		assert.Equal(t, uint32(0), info.Statistics.AttachmentCount)
+		assert.Equal(t, 1, len(info.MetadataIndexes))
+		assert.Equal(t, "calibration", info.MetadataIndexes[0].Name)
+		assert.Equal(t, uint64(1), info.Statistics.MessageCount)
+	})
+}
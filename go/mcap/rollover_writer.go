@@ -0,0 +1,199 @@
+package mcap
+
+import (
+	"fmt"
+	"io"
+)
+
+// RolloverWriterOptions are options for the RolloverWriter.
+type RolloverWriterOptions struct {
+	// MaxFileBytes bounds the size of the data section of each file. A
+	// message that could take the data section of the current file past it
+	// is written to a new file instead, unless the current file holds no
+	// messages yet, so that every message is written whole to a single file.
+	// Buffered chunk data is counted uncompressed, so compressed files may
+	// fall well short of the limit. The summary section written when a file
+	// is finalized is not counted.
+	MaxFileBytes int
+	// NextWriter is called with the sequence number of each file, starting
+	// from zero, and returns the output for the file.
+	NextWriter func(seq int) (io.Writer, error)
+	// WriterOptions are the options of the writer of each file.
+	WriterOptions *WriterOptions
+}
+
+// RolloverWriter writes MCAP data split across a sequence of files of bounded
+// size. Each file is a complete MCAP file: it begins with the header, schemas
+// and channels written so far, and is finalized with its summary section,
+// footer and closing magic before the next file is begun. Chunks never span
+// files. Outputs implementing io.Closer are closed once finalized.
+type RolloverWriter struct {
+	opts     RolloverWriterOptions
+	writer   *Writer
+	out      io.Writer
+	seq      int
+	messages uint64
+
+	header   *Header
+	schemas  []*Schema
+	channels []*Channel
+}
+
+// NewRolloverWriter returns a new RolloverWriter, opening its first file.
+func NewRolloverWriter(opts *RolloverWriterOptions) (*RolloverWriter, error) {
+	if opts.MaxFileBytes <= 0 {
+		return nil, fmt.Errorf("max file bytes must be positive")
+	}
+	if opts.NextWriter == nil {
+		return nil, fmt.Errorf("next writer function is required")
+	}
+	w := &RolloverWriter{opts: *opts}
+	if w.opts.WriterOptions == nil {
+		w.opts.WriterOptions = &WriterOptions{}
+	}
+	if err := w.open(0); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// WriteHeader writes a header record to the current file and to each later
+// file.
+func (w *RolloverWriter) WriteHeader(header *Header) error {
+	w.header = header
+	return w.writer.WriteHeader(header)
+}
+
+// WriteSchema writes a schema to the current file and to each later file. See
+// Writer.WriteSchema.
+func (w *RolloverWriter) WriteSchema(s *Schema) (uint16, error) {
+	id, err := w.writer.WriteSchema(s)
+	if err != nil {
+		return 0, err
+	}
+	w.schemas = append(w.schemas, s)
+	return id, nil
+}
+
+// WriteChannel writes a channel to the current file and to each later file.
+// See Writer.WriteChannel.
+func (w *RolloverWriter) WriteChannel(c *Channel) (uint16, error) {
+	id, err := w.writer.WriteChannel(c)
+	if err != nil {
+		return 0, err
+	}
+	w.channels = append(w.channels, c)
+	return id, nil
+}
+
+// WriteMessage writes a message, first rolling over to a new file if the
+// message would take the current file past MaxFileBytes.
+func (w *RolloverWriter) WriteMessage(m *Message) error {
+	if w.messages > 0 && w.projectedSize(m) > uint64(w.opts.MaxFileBytes) {
+		if err := w.rollover(); err != nil {
+			return err
+		}
+	}
+	if err := w.writer.WriteMessage(m); err != nil {
+		return err
+	}
+	w.messages++
+	return nil
+}
+
+// projectedSize returns the size the data section of the current file would
+// have if it were finalized after writing m, counting the active chunk
+// uncompressed.
+func (w *RolloverWriter) projectedSize(m *Message) uint64 {
+	writer := w.writer
+	size := writer.Offset() + 9 + 2 + 4 + 8 + 8 + uint64(len(m.Data))
+	// data end record
+	size += 9 + 4
+	if !writer.opts.Chunked {
+		return size
+	}
+	size += uint64(writer.BufferedBytes())
+	// chunk header
+	size += 9 + 8 + 8 + 8 + 4 + 4 + uint64(len(writer.compression)) + 8
+	if writer.opts.SkipMessageIndexing {
+		return size
+	}
+	channelID := m.ChannelID
+	if id, ok := writer.channelAliases[channelID]; ok {
+		channelID = id
+	}
+	// message index records, including m's entry
+	if _, ok := writer.messageIndexes[channelID]; !ok {
+		size += 9 + 2 + 4
+	}
+	size += 16
+	for _, idx := range writer.messageIndexes {
+		size += 9 + 2 + 4 + 16*uint64(len(idx.Entries()))
+	}
+	return size
+}
+
+// Files returns the number of files begun so far.
+func (w *RolloverWriter) Files() int {
+	return w.seq + 1
+}
+
+// Close finalizes the current file.
+func (w *RolloverWriter) Close() error {
+	return w.finalize()
+}
+
+// rollover finalizes the current file and begins the next, writing the
+// header, schemas and channels to it.
+func (w *RolloverWriter) rollover() error {
+	if err := w.finalize(); err != nil {
+		return err
+	}
+	if err := w.open(w.seq + 1); err != nil {
+		return err
+	}
+	if w.header != nil {
+		if err := w.writer.WriteHeader(w.header); err != nil {
+			return err
+		}
+	}
+	for _, schema := range w.schemas {
+		if _, err := w.writer.WriteSchema(schema); err != nil {
+			return fmt.Errorf("failed to write schema to file %d: %w", w.seq, err)
+		}
+	}
+	for _, channel := range w.channels {
+		if _, err := w.writer.WriteChannel(channel); err != nil {
+			return fmt.Errorf("failed to write channel to file %d: %w", w.seq, err)
+		}
+	}
+	return nil
+}
+
+func (w *RolloverWriter) open(seq int) error {
+	out, err := w.opts.NextWriter(seq)
+	if err != nil {
+		return fmt.Errorf("failed to open file %d: %w", seq, err)
+	}
+	writer, err := NewWriter(out, w.opts.WriterOptions)
+	if err != nil {
+		return err
+	}
+	w.out = out
+	w.writer = writer
+	w.seq = seq
+	w.messages = 0
+	return nil
+}
+
+func (w *RolloverWriter) finalize() error {
+	if err := w.writer.Close(); err != nil {
+		return fmt.Errorf("failed to finalize file %d: %w", w.seq, err)
+	}
+	if closer, ok := w.out.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return fmt.Errorf("failed to close file %d: %w", w.seq, err)
+		}
+	}
+	return nil
+}
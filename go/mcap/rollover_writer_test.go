@@ -0,0 +1,90 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRolloverWriter(t *testing.T) {
+	var files []*bytes.Buffer
+	w, err := NewRolloverWriter(&RolloverWriterOptions{
+		MaxFileBytes: 4096,
+		NextWriter: func(seq int) (io.Writer, error) {
+			assert.Equal(t, len(files), seq)
+			files = append(files, &bytes.Buffer{})
+			return files[seq], nil
+		},
+		WriterOptions: &WriterOptions{Chunked: true, ChunkSize: 1024, Compression: CompressionNone},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{Profile: "test"}))
+	schemaID, err := w.WriteSchema(&Schema{ID: 1, Name: "schema", Encoding: "raw"})
+	assert.Nil(t, err)
+	channelID, err := w.WriteChannel(&Channel{ID: 1, SchemaID: schemaID, Topic: "/a", MessageEncoding: "raw"})
+	assert.Nil(t, err)
+	data := make([]byte, 100)
+	for i := 0; i < 200; i++ {
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: channelID, Sequence: uint32(i), LogTime: uint64(i), Data: data}))
+	}
+	// a message larger than the limit is written whole to its own file.
+	assert.Nil(t, w.WriteMessage(&Message{ChannelID: channelID, Sequence: 200, LogTime: 200, Data: make([]byte, 5000)}))
+	assert.Nil(t, w.Close())
+	assert.Equal(t, len(files), w.Files())
+	assert.Greater(t, len(files), 5)
+
+	var sequences []uint32
+	for i, file := range files {
+		reader, err := NewReader(bytes.NewReader(file.Bytes()))
+		assert.Nil(t, err)
+		info, err := reader.Info()
+		assert.Nil(t, err)
+		assert.Equal(t, "test", info.Header.Profile)
+		assert.Equal(t, uint32(1), info.Statistics.ChannelCount)
+		assert.Equal(t, uint16(1), info.Statistics.SchemaCount)
+		assert.Greater(t, info.Statistics.MessageCount, uint64(0))
+		if i < len(files)-1 {
+			footer, err := readFooterAt(bytes.NewReader(file.Bytes()), int64(file.Len()))
+			assert.Nil(t, err)
+			assert.LessOrEqual(t, footer.SummaryStart, uint64(4096))
+		}
+		it, err := reader.Messages()
+		assert.Nil(t, err)
+		err = Range(it, func(_ *Schema, channel *Channel, message *Message) error {
+			assert.Equal(t, "/a", channel.Topic)
+			sequences = append(sequences, message.Sequence)
+			return nil
+		})
+		assert.Nil(t, err)
+	}
+	expected := make([]uint32, 201)
+	for i := range expected {
+		expected[i] = uint32(i)
+	}
+	assert.Equal(t, expected, sequences)
+
+	t.Run("reports next writer errors", func(t *testing.T) {
+		fail := errors.New("fail")
+		calls := 0
+		w, err := NewRolloverWriter(&RolloverWriterOptions{
+			MaxFileBytes: 100,
+			NextWriter: func(seq int) (io.Writer, error) {
+				calls++
+				if seq > 0 {
+					return nil, fail
+				}
+				return &bytes.Buffer{}, nil
+			},
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteHeader(&Header{}))
+		_, err = w.WriteChannel(&Channel{ID: 1, Topic: "/a"})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, Data: make([]byte, 100)}))
+		assert.ErrorIs(t, w.WriteMessage(&Message{ChannelID: 1}), fail)
+		assert.Equal(t, 2, calls)
+	})
+}
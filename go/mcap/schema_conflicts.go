@@ -0,0 +1,130 @@
+package mcap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SchemaConflict describes a pair of schemas in a file that are incompatible:
+// either two schemas with the same name and encoding but different data, or
+// the schemas of two channels on the same topic, which have different
+// encodings. The schema seen first in the file is listed first.
+type SchemaConflict struct {
+	// Topic is the topic of the channels whose schemas conflict, or empty for
+	// schemas that conflict by name.
+	Topic           string
+	SchemaIDs       [2]uint16
+	SchemaNames     [2]string
+	SchemaEncodings [2]string
+	// DataLengthDifference is the length of the second schema's data less
+	// that of the first.
+	DataLengthDifference int
+}
+
+func (c SchemaConflict) String() string {
+	if c.Topic == "" {
+		return fmt.Sprintf("schema %s (%s): schemas %d and %d differ in data (%+d bytes)",
+			c.SchemaNames[0], c.SchemaEncodings[0], c.SchemaIDs[0], c.SchemaIDs[1], c.DataLengthDifference)
+	}
+	return fmt.Sprintf("%s: schema %d is %q but schema %d is %q",
+		c.Topic, c.SchemaIDs[0], c.SchemaEncodings[0], c.SchemaIDs[1], c.SchemaEncodings[1])
+}
+
+// schemaNameKey identifies schemas that are expected to have the same data.
+type schemaNameKey struct {
+	name     string
+	encoding string
+}
+
+// schemaConflictKey identifies a conflict, so that each is reported once
+// however often its records are repeated.
+type schemaConflictKey struct {
+	topic     string
+	schemaIDs [2]uint16
+}
+
+// DetectSchemaConflicts reads a file in a single pass and reports its schema
+// conflicts, in the order they are found, as a check before the file is
+// merged with others or ingested. Schemas and channels repeated in the file,
+// such as in each chunk, are compared like any other. Channels without a
+// schema are compared as if their schema had an empty encoding, and channels
+// whose schema has not been seen are ignored. Message and attachment records
+// are skipped without being read into memory.
+func DetectSchemaConflicts(r io.Reader) ([]SchemaConflict, error) {
+	lexer, err := NewLexer(r, &LexerOptions{Skip: []TokenType{TokenMessage, TokenAttachment}})
+	if err != nil {
+		return nil, err
+	}
+	defer lexer.Close()
+	conflicts := []SchemaConflict{}
+	reported := make(map[schemaConflictKey]bool)
+	report := func(topic string, first, second *Schema) {
+		key := schemaConflictKey{topic: topic, schemaIDs: [2]uint16{first.ID, second.ID}}
+		if reported[key] {
+			return
+		}
+		reported[key] = true
+		conflicts = append(conflicts, SchemaConflict{
+			Topic:                topic,
+			SchemaIDs:            [2]uint16{first.ID, second.ID},
+			SchemaNames:          [2]string{first.Name, second.Name},
+			SchemaEncodings:      [2]string{first.Encoding, second.Encoding},
+			DataLengthDifference: len(second.Data) - len(first.Data),
+		})
+	}
+	// schemas holds the latest definition of each schema ID, and byName the
+	// first schema seen with each name and encoding.
+	schemas := map[uint16]*Schema{0: {}}
+	byName := make(map[schemaNameKey]*Schema)
+	byTopic := make(map[string]*Schema)
+	var buf []byte
+	for {
+		tokenType, record, err := lexer.Next(buf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return conflicts, nil
+			}
+			return nil, err
+		}
+		if len(record) > len(buf) {
+			buf = record
+		}
+		switch tokenType {
+		case TokenSchema:
+			schema, err := ParseSchema(record)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse schema: %w", err)
+			}
+			// the record's data aliases buf.
+			schema.Data = append([]byte{}, schema.Data...)
+			schemas[schema.ID] = schema
+			key := schemaNameKey{name: schema.Name, encoding: schema.Encoding}
+			first, ok := byName[key]
+			if !ok {
+				byName[key] = schema
+				continue
+			}
+			if string(first.Data) != string(schema.Data) {
+				report("", first, schema)
+			}
+		case TokenChannel:
+			channel, err := ParseChannel(record)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse channel: %w", err)
+			}
+			schema, ok := schemas[channel.SchemaID]
+			if !ok {
+				continue
+			}
+			first, ok := byTopic[channel.Topic]
+			if !ok {
+				byTopic[channel.Topic] = schema
+				continue
+			}
+			if first.Encoding != schema.Encoding {
+				report(channel.Topic, first, schema)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package mcap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectSchemaConflicts(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{Chunked: true, ChunkSize: 10, Compression: CompressionZSTD})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	for _, schema := range []*Schema{
+		{ID: 1, Name: "pose", Encoding: "jsonschema", Data: []byte("{}")},
+		{ID: 2, Name: "pose", Encoding: "jsonschema", Data: []byte(`{"type": "object"}`)},
+		{ID: 3, Name: "pose", Encoding: "ros2msg", Data: []byte("float64 x")},
+	} {
+		_, err := w.WriteSchema(schema)
+		assert.Nil(t, err)
+	}
+	for _, channel := range []*Channel{
+		{ID: 1, SchemaID: 1, Topic: "/pose", MessageEncoding: "json"},
+		{ID: 2, SchemaID: 3, Topic: "/pose", MessageEncoding: "cdr"},
+		{ID: 3, SchemaID: 2, Topic: "/pose", MessageEncoding: "json"},
+		{ID: 4, SchemaID: 0, Topic: "/raw", MessageEncoding: "json"},
+		{ID: 5, SchemaID: 3, Topic: "/raw", MessageEncoding: "cdr"},
+	} {
+		_, err := w.WriteChannel(channel)
+		assert.Nil(t, err)
+	}
+	// schemas and channels are repeated in each chunk.
+	for i := 0; i < 10; i++ {
+		for channelID := uint16(1); channelID <= 5; channelID++ {
+			assert.Nil(t, w.WriteMessage(&Message{ChannelID: channelID, LogTime: uint64(i), Data: []byte("{}")}))
+		}
+	}
+	assert.Nil(t, w.Close())
+
+	conflicts, err := DetectSchemaConflicts(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, []SchemaConflict{
+		{
+			SchemaIDs:            [2]uint16{1, 2},
+			SchemaNames:          [2]string{"pose", "pose"},
+			SchemaEncodings:      [2]string{"jsonschema", "jsonschema"},
+			DataLengthDifference: 16,
+		},
+		{
+			Topic:                "/pose",
+			SchemaIDs:            [2]uint16{1, 3},
+			SchemaNames:          [2]string{"pose", "pose"},
+			SchemaEncodings:      [2]string{"jsonschema", "ros2msg"},
+			DataLengthDifference: 7,
+		},
+		{
+			Topic:                "/raw",
+			SchemaIDs:            [2]uint16{0, 3},
+			SchemaNames:          [2]string{"", "pose"},
+			SchemaEncodings:      [2]string{"", "ros2msg"},
+			DataLengthDifference: 9,
+		},
+	}, conflicts)
+	assert.Equal(t, "schema pose (jsonschema): schemas 1 and 2 differ in data (+16 bytes)", conflicts[0].String())
+	assert.Equal(t, `/pose: schema 1 is "jsonschema" but schema 3 is "ros2msg"`, conflicts[1].String())
+
+	t.Run("no conflicts", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{Chunked: true}, []string{"/a", "/b"}, []uint64{1, 2, 3})
+		conflicts, err := DetectSchemaConflicts(bytes.NewReader(data))
+		assert.Nil(t, err)
+		assert.Empty(t, conflicts)
+	})
+	t.Run("not an mcap file", func(t *testing.T) {
+		_, err := DetectSchemaConflicts(bytes.NewReader([]byte("not an mcap file")))
+		assert.ErrorIs(t, err, ErrBadMagic)
+	})
+}
@@ -0,0 +1,104 @@
+package mcap
+
+import (
+	"fmt"
+	"sync"
+)
+
+// schemaMigration converts decoded messages from one schema to another.
+type schemaMigration struct {
+	to      *Schema
+	migrate func(old interface{}) (interface{}, error)
+}
+
+// migrationKey identifies the schema of a topic that a migration applies to.
+type migrationKey struct {
+	topic  string
+	schema schemaKey
+}
+
+var (
+	schemaMigrationsMtx sync.RWMutex
+	schemaMigrations    = map[migrationKey]schemaMigration{}
+)
+
+func keyOfSchema(s *Schema) schemaKey {
+	return schemaKey{name: s.Name, encoding: s.Encoding, data: string(s.Data)}
+}
+
+// RegisterMigration registers a migration of the decoded messages on a topic
+// from one schema to another, replacing any migration previously registered
+// from that schema on the topic. Schemas are matched by name, encoding and
+// data; their IDs are ignored, so that a migration applies to any file. The
+// migration is called with a message decoded with the from schema, as by
+// DecodeMessage, and returns the message as decoded with the to schema.
+//
+// Migrations are chained, so that messages recorded with any earlier version
+// of a schema can be brought to the latest version by registering a migration
+// from each version to the next. They are applied by MigrateMessage, and by
+// Transform and ExtractTimeSeries, so that the messages of a topic recorded
+// with several versions of its schema are seen with a single one.
+func RegisterMigration(topic string, from, to *Schema, migrate func(old interface{}) (interface{}, error)) {
+	schemaMigrationsMtx.Lock()
+	defer schemaMigrationsMtx.Unlock()
+	schemaMigrations[migrationKey{topic: topic, schema: keyOfSchema(from)}] = schemaMigration{
+		to:      to,
+		migrate: migrate,
+	}
+}
+
+// MigrateMessage applies the migrations registered for the channel's topic
+// to a message decoded with the given schema, and returns the schema reached
+// and the migrated message. If no migration applies, the schema and message
+// are returned unchanged.
+func MigrateMessage(schema *Schema, channel *Channel, decoded interface{}) (*Schema, interface{}, error) {
+	if schema == nil {
+		return nil, decoded, nil
+	}
+	seen := map[schemaKey]bool{}
+	for {
+		key := keyOfSchema(schema)
+		migration, ok := lookupMigration(channel.Topic, key)
+		if !ok {
+			return schema, decoded, nil
+		}
+		if seen[key] {
+			return nil, nil, fmt.Errorf("migrations of %s from schema %s form a cycle", channel.Topic, schema.Name)
+		}
+		seen[key] = true
+		migrated, err := migration.migrate(decoded)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to migrate message on %s from schema %s: %w",
+				channel.Topic, schema.Name, err)
+		}
+		schema, decoded = migration.to, migrated
+	}
+}
+
+// migrationTarget returns the schema that messages on a topic recorded with
+// the given schema are migrated to, or nil if no migration applies.
+func migrationTarget(topic string, schema *Schema) *Schema {
+	if schema == nil {
+		return nil
+	}
+	var target *Schema
+	seen := map[schemaKey]bool{}
+	key := keyOfSchema(schema)
+	for !seen[key] {
+		seen[key] = true
+		migration, ok := lookupMigration(topic, key)
+		if !ok {
+			break
+		}
+		target = migration.to
+		key = keyOfSchema(target)
+	}
+	return target
+}
+
+func lookupMigration(topic string, key schemaKey) (schemaMigration, bool) {
+	schemaMigrationsMtx.RLock()
+	defer schemaMigrationsMtx.RUnlock()
+	migration, ok := schemaMigrations[migrationKey{topic: topic, schema: key}]
+	return migration, ok
+}
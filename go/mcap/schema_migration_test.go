@@ -0,0 +1,157 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// renameField returns a migration of JSON messages renaming a field.
+func renameField(from, to string) func(interface{}) (interface{}, error) {
+	return func(old interface{}) (interface{}, error) {
+		fields := old.(map[string]interface{})
+		fields[to] = fields[from]
+		delete(fields, from)
+		return fields, nil
+	}
+}
+
+func TestMigrateMessage(t *testing.T) {
+	v1 := &Schema{ID: 1, Name: "reading", Encoding: "jsonschema", Data: []byte(`{"v":1}`)}
+	v2 := &Schema{ID: 2, Name: "reading", Encoding: "jsonschema", Data: []byte(`{"v":2}`)}
+	v3 := &Schema{ID: 3, Name: "reading", Encoding: "jsonschema", Data: []byte(`{"v":3}`)}
+	RegisterMigration("/migrate/chain", v1, v2, renameField("a", "b"))
+	RegisterMigration("/migrate/chain", v2, v3, renameField("b", "c"))
+	channel := &Channel{Topic: "/migrate/chain"}
+
+	t.Run("chains migrations", func(t *testing.T) {
+		// schemas are matched by content, not ID.
+		recorded := &Schema{ID: 7, Name: v1.Name, Encoding: v1.Encoding, Data: v1.Data}
+		schema, migrated, err := MigrateMessage(recorded, channel, map[string]interface{}{"a": 1.0})
+		assert.Nil(t, err)
+		assert.Equal(t, v3, schema)
+		assert.Equal(t, map[string]interface{}{"c": 1.0}, migrated)
+		schema, migrated, err = MigrateMessage(v2, channel, map[string]interface{}{"b": 2.0})
+		assert.Nil(t, err)
+		assert.Equal(t, v3, schema)
+		assert.Equal(t, map[string]interface{}{"c": 2.0}, migrated)
+	})
+	t.Run("leaves other messages unchanged", func(t *testing.T) {
+		decoded := map[string]interface{}{"c": 3.0}
+		schema, migrated, err := MigrateMessage(v3, channel, decoded)
+		assert.Nil(t, err)
+		assert.Equal(t, v3, schema)
+		assert.Equal(t, decoded, migrated)
+		schema, migrated, err = MigrateMessage(v1, &Channel{Topic: "/other"}, decoded)
+		assert.Nil(t, err)
+		assert.Equal(t, v1, schema)
+		assert.Equal(t, decoded, migrated)
+		schema, _, err = MigrateMessage(nil, channel, decoded)
+		assert.Nil(t, err)
+		assert.Nil(t, schema)
+	})
+	t.Run("reports errors", func(t *testing.T) {
+		failure := errors.New("bad message")
+		RegisterMigration("/migrate/failing", v1, v2, func(interface{}) (interface{}, error) {
+			return nil, failure
+		})
+		_, _, err := MigrateMessage(v1, &Channel{Topic: "/migrate/failing"}, nil)
+		assert.ErrorIs(t, err, failure)
+		RegisterMigration("/migrate/cycle", v1, v2, renameField("a", "b"))
+		RegisterMigration("/migrate/cycle", v2, v1, renameField("b", "a"))
+		_, _, err = MigrateMessage(v1, &Channel{Topic: "/migrate/cycle"}, map[string]interface{}{})
+		assert.Error(t, err)
+	})
+}
+
+func TestTransformMigratesSchemas(t *testing.T) {
+	v1 := &Schema{ID: 1, Name: "reading", Encoding: "jsonschema", Data: []byte(`{"version":1}`)}
+	v2 := &Schema{ID: 2, Name: "reading", Encoding: "jsonschema", Data: []byte(`{"version":2}`)}
+	other := &Schema{ID: 2, Name: "other", Encoding: "jsonschema", Data: []byte(`{}`)}
+	RegisterMigration("/migrate/readings", v1, v2, renameField("val", "value"))
+
+	// the producer was upgraded from v1 to v2 during the recording.
+	upgraded := &bytes.Buffer{}
+	w, err := NewWriter(upgraded, &WriterOptions{Chunked: true, Compression: CompressionZSTD})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	_, err = w.WriteSchema(v1)
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 1, SchemaID: 1, Topic: "/migrate/readings", MessageEncoding: "json"})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: 1, Data: []byte(`{"val":1}`)}))
+	_, err = w.WriteSchema(v2)
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 2, SchemaID: 2, Topic: "/migrate/readings", MessageEncoding: "json"})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteMessage(&Message{ChannelID: 2, LogTime: 2, Data: []byte(`{"value":2}`)}))
+	assert.Nil(t, w.Close())
+
+	// the file was recorded before the upgrade, and uses the ID of v2 for
+	// another schema.
+	old := &bytes.Buffer{}
+	w, err = NewWriter(old, &WriterOptions{Chunked: true, Compression: CompressionZSTD})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	_, err = w.WriteSchema(v1)
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 1, SchemaID: 1, Topic: "/migrate/readings", MessageEncoding: "json"})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: 1, Data: []byte(`{"val":1}`)}))
+	_, err = w.WriteSchema(other)
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 2, SchemaID: 2, Topic: "/other", MessageEncoding: "json"})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteMessage(&Message{ChannelID: 2, LogTime: 2, Data: []byte(`{"val":2}`)}))
+	assert.Nil(t, w.Close())
+
+	transform := func(t *testing.T, input []byte) *Info {
+		output := &bytes.Buffer{}
+		var seen []interface{}
+		err := Transform(output, bytes.NewReader(input), func(_ *Channel, decoded interface{}) (interface{}, error) {
+			seen = append(seen, decoded)
+			return decoded, nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(seen))
+		reader, err := NewReader(bytes.NewReader(output.Bytes()))
+		assert.Nil(t, err)
+		info, err := reader.Info()
+		assert.Nil(t, err)
+		it, err := reader.Messages()
+		assert.Nil(t, err)
+		var messages []string
+		for {
+			_, _, message, err := it.Next(nil)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			assert.Nil(t, err)
+			messages = append(messages, string(message.Data))
+		}
+		assert.Equal(t, `{"value":1}`, messages[0])
+		return info
+	}
+	t.Run("normalizes a topic to the latest schema", func(t *testing.T) {
+		info := transform(t, upgraded.Bytes())
+		assert.Equal(t, map[uint16]*Schema{1: v1, 2: v2}, info.Schemas)
+		assert.Equal(t, uint16(2), info.Channels[1].SchemaID)
+		assert.Equal(t, uint16(2), info.Channels[2].SchemaID)
+	})
+	t.Run("writes schemas migrated to", func(t *testing.T) {
+		info := transform(t, old.Bytes())
+		assert.Equal(t, 3, len(info.Schemas))
+		assert.Equal(t, v2.Data, info.Schemas[info.Channels[1].SchemaID].Data)
+		assert.Equal(t, other.Data, info.Schemas[info.Channels[2].SchemaID].Data)
+		assert.NotEqual(t, info.Channels[1].SchemaID, info.Channels[2].SchemaID)
+	})
+	t.Run("extracts time series across schemas", func(t *testing.T) {
+		csv := &bytes.Buffer{}
+		err := ExtractTimeSeries(csv, bytes.NewReader(upgraded.Bytes()), "/migrate/readings", "value")
+		assert.Nil(t, err)
+		assert.Equal(t, "log_time,value\n1,1\n2,2\n", csv.String())
+	})
+}
@@ -0,0 +1,69 @@
+package mcap
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrNoSchemaParser is returned when no parser is registered for a schema's
+// encoding.
+var ErrNoSchemaParser = errors.New("no parser registered for schema encoding")
+
+// ParsedSchema is the result of parsing a schema's data with a parser
+// registered by RegisterSchemaParser. Its type is defined by the parser, for
+// instance a reflection schema for the "flatbuffer" encoding.
+type ParsedSchema interface{}
+
+var (
+	schemaParsersMtx sync.RWMutex
+	schemaParsers    = make(map[string]func(*Schema) (ParsedSchema, error))
+)
+
+// RegisterSchemaParser registers a parser for schemas of the given encoding,
+// replacing any parser previously registered for it. It is typically called
+// from the init function of a package providing the parser. The parser must
+// not modify or retain the schema's Data, which may be shared with other
+// readers of the schema.
+func RegisterSchemaParser(encoding string, parse func(*Schema) (ParsedSchema, error)) {
+	schemaParsersMtx.Lock()
+	defer schemaParsersMtx.Unlock()
+	schemaParsers[encoding] = parse
+}
+
+// ParseSchemaData parses a schema's data with the parser registered for its
+// encoding. If there is none, it returns an error wrapping ErrNoSchemaParser.
+func ParseSchemaData(schema *Schema) (ParsedSchema, error) {
+	schemaParsersMtx.RLock()
+	parse, ok := schemaParsers[schema.Encoding]
+	schemaParsersMtx.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrNoSchemaParser, schema.Encoding)
+	}
+	parsed, err := parse(schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s schema %q: %w", schema.Encoding, schema.Name, err)
+	}
+	return parsed, nil
+}
+
+// ParsedSchema returns the schema with the given ID, among those the reader
+// has encountered so far through message iteration or Info, parsed with the
+// parser registered for its encoding. Parsed schemas are cached, so each
+// schema is parsed at most once per reader. If the schema has not been
+// encountered, ErrUnknownSchema is returned.
+func (r *Reader) ParsedSchema(id uint16) (ParsedSchema, error) {
+	if parsed, ok := r.parsedSchemas[id]; ok {
+		return parsed, nil
+	}
+	schema, ok := r.schemas[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownSchema, id)
+	}
+	parsed, err := ParseSchemaData(schema)
+	if err != nil {
+		return nil, err
+	}
+	r.parsedSchemas[id] = parsed
+	return parsed, nil
+}
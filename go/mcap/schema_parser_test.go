@@ -0,0 +1,57 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testParsedSchema struct {
+	name string
+	size int
+}
+
+func TestReaderParsedSchema(t *testing.T) {
+	calls := 0
+	RegisterSchemaParser("test-reflection", func(s *Schema) (ParsedSchema, error) {
+		calls++
+		if len(s.Data) == 0 {
+			return nil, errors.New("empty schema")
+		}
+		return &testParsedSchema{name: s.Name, size: len(s.Data)}, nil
+	})
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{Chunked: true, Compression: CompressionZSTD})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	for _, schema := range []*Schema{
+		{ID: 1, Name: "reflected", Encoding: "test-reflection", Data: []byte{1, 2, 3}},
+		{ID: 2, Name: "unregistered", Encoding: "test-unregistered", Data: []byte{1}},
+		{ID: 3, Name: "empty", Encoding: "test-reflection"},
+	} {
+		_, err = w.WriteSchema(schema)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, w.Close())
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	assert.Nil(t, err)
+	_, err = r.ParsedSchema(1)
+	assert.ErrorIs(t, err, ErrUnknownSchema)
+
+	_, err = r.Info()
+	assert.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		parsed, err := r.ParsedSchema(1)
+		assert.Nil(t, err)
+		assert.Equal(t, &testParsedSchema{name: "reflected", size: 3}, parsed)
+	}
+	assert.Equal(t, 1, calls)
+	_, err = r.ParsedSchema(2)
+	assert.ErrorIs(t, err, ErrNoSchemaParser)
+	_, err = r.ParsedSchema(3)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "empty schema")
+}
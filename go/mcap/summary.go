@@ -0,0 +1,166 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// ErrInvalidSummaryCRC indicates that the summary CRC in the footer does not
+// match the summary section.
+var ErrInvalidSummaryCRC = errors.New("invalid summary CRC")
+
+// footerLength is the length of a footer record, including its opcode and
+// length prefix.
+const footerLength = 1 + 8 + 8 + 8 + 4
+
+// Summary is the parsed summary section of a file.
+type Summary struct {
+	Info
+	// CRCValid reports whether the summary section matched the summary CRC in
+	// the footer. Files written without a summary CRC report true.
+	CRCValid bool
+}
+
+// SummaryOptions are options for ReadSummary.
+type SummaryOptions struct {
+	// AllowInvalidCRC causes ReadSummary to return the parsed summary when the
+	// summary CRC does not match, with CRCValid set to false, rather than
+	// failing with ErrInvalidSummaryCRC. The summary records may then be used on
+	// a best-effort basis.
+	AllowInvalidCRC bool
+}
+
+// ReadSummary reads and parses the summary section of a file, verifying it
+// against the summary CRC in the footer. By default, a CRC mismatch results in
+// an error wrapping ErrInvalidSummaryCRC.
+func ReadSummary(r io.ReaderAt, size int64, opts ...*SummaryOptions) (*Summary, error) {
+	summaryOpts := SummaryOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		summaryOpts = *opts[0]
+	}
+	footer, err := readFooterAt(r, size)
+	if err != nil {
+		return nil, err
+	}
+	crcValid := true
+	if footer.SummaryCRC != 0 {
+		crc, err := summaryCRC(r, size, footer)
+		if err != nil {
+			return nil, err
+		}
+		if crc != footer.SummaryCRC {
+			if !summaryOpts.AllowInvalidCRC {
+				return nil, fmt.Errorf("%w: %x != %x", ErrInvalidSummaryCRC, crc, footer.SummaryCRC)
+			}
+			crcValid = false
+		}
+	}
+	info, err := readInfo(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return &Summary{Info: *info, CRCValid: crcValid}, nil
+}
+
+// ValidateSummaryCRC checks the summary section of a file against the
+// summary CRC in its footer, returning an error wrapping ErrInvalidSummaryCRC
+// on a mismatch, so that the index may be trusted before it is read. Files
+// written without a summary CRC are not checked. The position of rs is left
+// unspecified.
+func ValidateSummaryCRC(rs io.ReadSeeker) error {
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to seek to end: %w", err)
+	}
+	r, ok := rs.(io.ReaderAt)
+	if !ok {
+		r = &readSeekerAt{rs: rs}
+	}
+	footer, err := readFooterAt(r, size)
+	if err != nil {
+		return err
+	}
+	if footer.SummaryCRC == 0 {
+		return nil
+	}
+	crc, err := summaryCRC(r, size, footer)
+	if err != nil {
+		return err
+	}
+	if crc != footer.SummaryCRC {
+		return fmt.Errorf("%w: %x != %x", ErrInvalidSummaryCRC, crc, footer.SummaryCRC)
+	}
+	return nil
+}
+
+// ReadFooter reads the footer record at the end of a file, validating the
+// trailing magic, so that the summary section can be located without reading
+// the rest of the file. On success, rs is left positioned at the end of the
+// file.
+func ReadFooter(rs io.ReadSeeker) (*Footer, error) {
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to seek to end: %w", err)
+	}
+	return readFooterAt(&readSeekerAt{rs: rs}, size)
+}
+
+// readSeekerAt implements io.ReaderAt by seeking an io.ReadSeeker.
+type readSeekerAt struct {
+	rs io.ReadSeeker
+}
+
+func (s *readSeekerAt) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := s.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(s.rs, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// readFooterAt reads the footer record and validates the trailing magic of a
+// file of the given size.
+func readFooterAt(r io.ReaderAt, size int64) (*Footer, error) {
+	if size < int64(len(Magic)+footerLength+len(Magic)) {
+		return nil, fmt.Errorf("file too small to contain footer: %w", io.ErrUnexpectedEOF)
+	}
+	buf := make([]byte, footerLength+len(Magic))
+	_, err := r.ReadAt(buf, size-int64(len(buf)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read footer: %w", err)
+	}
+	if !bytes.Equal(buf[footerLength:], Magic) {
+		return nil, ErrBadMagic
+	}
+	if OpCode(buf[0]) != OpFooter {
+		return nil, fmt.Errorf("unexpected opcode %s in footer position", OpCode(buf[0]))
+	}
+	return ParseFooter(buf[9:footerLength])
+}
+
+// summaryCRC computes the CRC of the bytes covered by the footer's summary
+// CRC: the summary section, if any, through the summary offset start field of
+// the footer.
+func summaryCRC(r io.ReaderAt, size int64, footer *Footer) (uint32, error) {
+	footerStart := size - int64(len(Magic)) - footerLength
+	start := footerStart
+	if footer.SummaryStart != 0 {
+		start = int64(footer.SummaryStart)
+	}
+	end := footerStart + footerLength - 4
+	if start > footerStart {
+		return 0, fmt.Errorf("summary start %d is beyond footer", start)
+	}
+	crc := crc32.NewIEEE()
+	_, err := io.Copy(crc, io.NewSectionReader(r, start, end-start))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read summary section: %w", err)
+	}
+	return crc.Sum32(), nil
+}
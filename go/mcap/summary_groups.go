@@ -0,0 +1,122 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SummaryGroups returns an iterator over the groups of records in the summary
+// section, in the order of the file's summary offset records. Each group is
+// yielded with a function that reads and lexes the group's records when
+// called, so that a large summary need not be held in memory at once. The
+// iterator has the signature of iter.Seq2[*SummaryOffset, func() ([]Record, error)]
+// and may be used as one. If the summary offsets cannot be read, the iterator
+// yields a nil summary offset with a function returning the error. Files
+// without summary offset records yield nothing. Reading a group seeks the
+// underlying reader, and must not be interleaved with a message iterator.
+func (r *Reader) SummaryGroups() func(yield func(*SummaryOffset, func() ([]Record, error)) bool) {
+	return func(yield func(*SummaryOffset, func() ([]Record, error)) bool) {
+		offsets, footerStart, err := r.summaryOffsets()
+		if err != nil {
+			yield(nil, func() ([]Record, error) { return nil, err })
+			return
+		}
+		for _, offset := range offsets {
+			offset := offset
+			if !yield(offset, func() ([]Record, error) { return r.readSummaryGroup(offset, footerStart) }) {
+				return
+			}
+		}
+	}
+}
+
+// summaryOffsets reads the summary offset records of the file, returning them
+// with the offset of the footer.
+func (r *Reader) summaryOffsets() ([]*SummaryOffset, uint64, error) {
+	if r.rs == nil {
+		return nil, 0, fmt.Errorf("reading summary groups requires a seekable reader")
+	}
+	footer, footerStart, err := r.readFooter()
+	if err != nil {
+		return nil, 0, err
+	}
+	if footer.SummaryOffsetStart == 0 {
+		return nil, 0, nil
+	}
+	end := uint64(footerStart)
+	if footer.SummaryOffsetStart > end {
+		return nil, 0, fmt.Errorf("summary offset start %d is beyond footer", footer.SummaryOffsetStart)
+	}
+	records, err := r.readSummaryRecords(footer.SummaryOffsetStart, end-footer.SummaryOffsetStart, end)
+	if err != nil {
+		return nil, 0, err
+	}
+	offsets := make([]*SummaryOffset, 0, len(records))
+	for _, record := range records {
+		if record.TokenType != TokenSummaryOffset {
+			continue
+		}
+		offset, err := ParseSummaryOffset(record.Data)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to parse summary offset: %w", err)
+		}
+		offsets = append(offsets, offset)
+	}
+	return offsets, end, nil
+}
+
+// readFooter reads the footer record and validates the trailing magic,
+// returning the footer and its offset in the file.
+func (r *Reader) readFooter() (*Footer, int64, error) {
+	size, err := r.rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to seek to end: %w", err)
+	}
+	footer, err := readFooterAt(&readSeekerAt{rs: r.rs}, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	return footer, size - int64(len(Magic)) - footerLength, nil
+}
+
+// readSummaryGroup reads the records of the group located by a summary
+// offset, which must end before the footer.
+func (r *Reader) readSummaryGroup(offset *SummaryOffset, footerStart uint64) ([]Record, error) {
+	return r.readSummaryRecords(offset.GroupStart, offset.GroupLength, footerStart)
+}
+
+// readSummaryRecords reads and lexes the records in a region of the file,
+// which must end by the given offset.
+func (r *Reader) readSummaryRecords(start uint64, length uint64, end uint64) ([]Record, error) {
+	if start > end || length > end-start {
+		return nil, fmt.Errorf("summary group of length %d at offset %d exceeds summary section ending at %d",
+			length, start, end)
+	}
+	if _, err := r.rs.Seek(int64(start), io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf, err := makeSafe(length)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r.rs, buf); err != nil {
+		return nil, fmt.Errorf("failed to read summary records: %w", err)
+	}
+	lexer, err := NewLexer(bytes.NewReader(buf), &LexerOptions{SkipMagic: true})
+	if err != nil {
+		return nil, err
+	}
+	records := []Record{}
+	for {
+		tokenType, data, err := lexer.Next(nil)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return records, nil
+			}
+			return nil, err
+		}
+		records = append(records, Record{TokenType: tokenType, Data: append([]byte{}, data...)})
+	}
+}
@@ -0,0 +1,92 @@
+package mcap
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderSummaryGroups(t *testing.T) {
+	logTimes := make([]uint64, 50)
+	for i := range logTimes {
+		logTimes[i] = uint64(i)
+	}
+	data := writeTestFile(t, &WriterOptions{
+		Chunked:     true,
+		ChunkSize:   100,
+		Compression: CompressionZSTD,
+	}, []string{"/a", "/b"}, logTimes)
+	info, err := readInfo(bytes.NewReader(data), int64(len(data)))
+	assert.Nil(t, err)
+
+	t.Run("yields groups in summary offset order", func(t *testing.T) {
+		r, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		var opcodes []OpCode
+		counts := make(map[TokenType]int)
+		r.SummaryGroups()(func(offset *SummaryOffset, read func() ([]Record, error)) bool {
+			assert.NotNil(t, offset)
+			opcodes = append(opcodes, offset.GroupOpcode)
+			records, err := read()
+			assert.Nil(t, err)
+			for _, record := range records {
+				assert.Equal(t, offset.GroupOpcode, recordTypes[record.TokenType].opcode)
+				counts[record.TokenType]++
+			}
+			return true
+		})
+		assert.Equal(t, []OpCode{OpSchema, OpChannel, OpStatistics, OpChunkIndex}, opcodes)
+		assert.Equal(t, len(info.ChunkIndexes), counts[TokenChunkIndex])
+		assert.Equal(t, 2, counts[TokenChannel])
+		assert.Equal(t, 1, counts[TokenSchema])
+	})
+	t.Run("reads groups lazily", func(t *testing.T) {
+		r, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		var reads []func() ([]Record, error)
+		r.SummaryGroups()(func(_ *SummaryOffset, read func() ([]Record, error)) bool {
+			reads = append(reads, read)
+			return len(reads) < 4
+		})
+		assert.Equal(t, 4, len(reads))
+		records, err := reads[3]()
+		assert.Nil(t, err)
+		chunkIndex, err := ParseChunkIndex(records[0].Data)
+		assert.Nil(t, err)
+		assert.Equal(t, info.ChunkIndexes[0].ChunkStartOffset, chunkIndex.ChunkStartOffset)
+	})
+	t.Run("rejects groups extending beyond the footer", func(t *testing.T) {
+		footer, err := ReadFooter(bytes.NewReader(data))
+		assert.Nil(t, err)
+		corrupt := append([]byte{}, data...)
+		// the group length of the first summary offset record.
+		putUint64(corrupt[footer.SummaryOffsetStart+9+1+8:], 1<<62)
+		r, err := NewReader(bytes.NewReader(corrupt))
+		assert.Nil(t, err)
+		var errs []error
+		r.SummaryGroups()(func(_ *SummaryOffset, read func() ([]Record, error)) bool {
+			_, err := read()
+			errs = append(errs, err)
+			return true
+		})
+		assert.Equal(t, 4, len(errs))
+		assert.Error(t, errs[0])
+		assert.Contains(t, errs[0].Error(), "exceeds summary section")
+		assert.Nil(t, errs[1])
+	})
+	t.Run("requires a seekable reader", func(t *testing.T) {
+		r, err := NewReader(io.MultiReader(bytes.NewReader(data)))
+		assert.Nil(t, err)
+		called := false
+		r.SummaryGroups()(func(offset *SummaryOffset, read func() ([]Record, error)) bool {
+			called = true
+			assert.Nil(t, offset)
+			_, err := read()
+			assert.Error(t, err)
+			return true
+		})
+		assert.True(t, called)
+	})
+}
@@ -0,0 +1,119 @@
+package mcap
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadSummary(t *testing.T) {
+	opts := &WriterOptions{Chunked: true, Compression: CompressionZSTD, IncludeCRC: true}
+	data := writeTestFile(t, opts, []string{"/a", "/b"}, []uint64{1, 2, 3})
+	t.Run("valid summary", func(t *testing.T) {
+		summary, err := ReadSummary(bytes.NewReader(data), int64(len(data)))
+		assert.Nil(t, err)
+		assert.True(t, summary.CRCValid)
+		assert.Equal(t, 1, len(summary.ChunkIndexes))
+		assert.Equal(t, uint64(3), summary.Statistics.MessageCount)
+	})
+	// corrupt the topic of the first channel in the summary, which leaves the
+	// summary parseable.
+	footer, err := readFooterAt(bytes.NewReader(data), int64(len(data)))
+	assert.Nil(t, err)
+	corrupt := append([]byte{}, data...)
+	topicOffset := bytes.Index(corrupt[footer.SummaryStart:], []byte("/a"))
+	assert.Greater(t, topicOffset, 0)
+	corrupt[int(footer.SummaryStart)+topicOffset+1] = 'x'
+	t.Run("rejects invalid CRC by default", func(t *testing.T) {
+		_, err := ReadSummary(bytes.NewReader(corrupt), int64(len(corrupt)))
+		assert.ErrorIs(t, err, ErrInvalidSummaryCRC)
+	})
+	t.Run("returns partial summary on request", func(t *testing.T) {
+		summary, err := ReadSummary(bytes.NewReader(corrupt), int64(len(corrupt)), &SummaryOptions{
+			AllowInvalidCRC: true,
+		})
+		assert.Nil(t, err)
+		assert.False(t, summary.CRCValid)
+		assert.Equal(t, "/x", summary.Channels[1].Topic)
+		assert.Equal(t, 1, len(summary.ChunkIndexes))
+	})
+	t.Run("files without summary CRC", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{}, []string{"/a"}, []uint64{1})
+		summary, err := ReadSummary(bytes.NewReader(data), int64(len(data)))
+		assert.Nil(t, err)
+		assert.True(t, summary.CRCValid)
+	})
+}
+
+func TestValidateSummaryCRC(t *testing.T) {
+	opts := &WriterOptions{Chunked: true, Compression: CompressionZSTD, IncludeCRC: true}
+	data := writeTestFile(t, opts, []string{"/a", "/b"}, []uint64{1, 2, 3})
+	footer, err := readFooterAt(bytes.NewReader(data), int64(len(data)))
+	assert.Nil(t, err)
+	assert.NotZero(t, footer.SummaryCRC)
+	corrupt := append([]byte{}, data...)
+	corrupt[footer.SummaryStart+10]++
+	// readSeeker hides the io.ReaderAt implementation of bytes.Reader.
+	type readSeeker struct{ io.ReadSeeker }
+	t.Run("valid summary", func(t *testing.T) {
+		assert.Nil(t, ValidateSummaryCRC(bytes.NewReader(data)))
+		assert.Nil(t, ValidateSummaryCRC(readSeeker{bytes.NewReader(data)}))
+	})
+	t.Run("invalid summary", func(t *testing.T) {
+		assert.ErrorIs(t, ValidateSummaryCRC(bytes.NewReader(corrupt)), ErrInvalidSummaryCRC)
+		assert.ErrorIs(t, ValidateSummaryCRC(readSeeker{bytes.NewReader(corrupt)}), ErrInvalidSummaryCRC)
+	})
+	t.Run("files without summary CRC", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{}, []string{"/a"}, []uint64{1})
+		assert.Nil(t, ValidateSummaryCRC(bytes.NewReader(data)))
+	})
+	t.Run("truncated file", func(t *testing.T) {
+		assert.Error(t, ValidateSummaryCRC(bytes.NewReader(data[:len(data)-1])))
+	})
+}
+
+func TestReadFooter(t *testing.T) {
+	opts := &WriterOptions{Chunked: true, Compression: CompressionZSTD, IncludeCRC: true}
+	data := writeTestFile(t, opts, []string{"/a", "/b"}, []uint64{1, 2, 3})
+	lexer, err := NewLexer(bytes.NewReader(data), &LexerOptions{})
+	assert.Nil(t, err)
+	var expected *Footer
+	for tokenType := TokenHeader; tokenType != TokenFooter; {
+		var record []byte
+		tokenType, record, err = lexer.Next(nil)
+		assert.Nil(t, err)
+		if tokenType == TokenFooter {
+			expected, err = ParseFooter(record)
+			assert.Nil(t, err)
+		}
+	}
+	assert.NotZero(t, expected.SummaryStart)
+	assert.NotZero(t, expected.SummaryOffsetStart)
+	assert.NotZero(t, expected.SummaryCRC)
+	// readSeeker hides the io.ReaderAt implementation of bytes.Reader.
+	type readSeeker struct{ io.ReadSeeker }
+	t.Run("reads the footer", func(t *testing.T) {
+		for _, rs := range []io.ReadSeeker{bytes.NewReader(data), readSeeker{bytes.NewReader(data)}} {
+			footer, err := ReadFooter(rs)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, footer)
+			offset, err := rs.Seek(0, io.SeekCurrent)
+			assert.Nil(t, err)
+			assert.Equal(t, int64(len(data)), offset)
+		}
+	})
+	t.Run("bad trailing magic", func(t *testing.T) {
+		corrupt := append([]byte{}, data...)
+		corrupt[len(corrupt)-1]++
+		_, err := ReadFooter(bytes.NewReader(corrupt))
+		assert.ErrorIs(t, err, ErrBadMagic)
+	})
+	t.Run("truncated file", func(t *testing.T) {
+		_, err := ReadFooter(bytes.NewReader(data[:len(data)-1]))
+		assert.Error(t, err)
+		_, err = ReadFooter(bytes.NewReader(data[:len(Magic)+footerLength]))
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
@@ -0,0 +1,107 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// TeeValidate copies an MCAP stream from src to both dst1 and dst2, validating
+// chunk CRCs and the data section CRC as it goes. Each record is written to the
+// destinations only after it has been validated, so a corrupt chunk is never
+// propagated. On the first error, TeeValidate stops copying, flushes any
+// destination that implements `Flush() error`, and returns the error. The
+// EmitChunks and ValidateCRC lexer options are implied.
+func TeeValidate(dst1, dst2 io.Writer, src io.Reader, opts ...*LexerOptions) error {
+	dst := io.MultiWriter(dst1, dst2)
+	err := teeValidate(dst, src, opts...)
+	for _, w := range []io.Writer{dst1, dst2} {
+		if flusher, ok := w.(interface{ Flush() error }); ok {
+			if flushErr := flusher.Flush(); flushErr != nil && err == nil {
+				err = flushErr
+			}
+		}
+	}
+	return err
+}
+
+func teeValidate(dst io.Writer, src io.Reader, opts ...*LexerOptions) error {
+	lexerOpts := LexerOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		lexerOpts = *opts[0]
+	}
+	lexerOpts.EmitChunks = true
+	lexerOpts.ValidateCRC = false
+	pending := &bytes.Buffer{}
+	lexer, err := NewLexer(io.TeeReader(src, pending), &lexerOpts)
+	if err != nil {
+		return err
+	}
+	decompressor := &chunkDecompressor{}
+	defer decompressor.close()
+	dataSectionCRC := crc32.NewIEEE()
+	inDataSection := true
+	footerSeen := false
+	var buf []byte
+	for {
+		tokenType, record, err := lexer.Next(buf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				// a stream cut at a record boundary lexes cleanly, but is
+				// missing its footer.
+				if !footerSeen {
+					return fmt.Errorf("stream ended without footer: %w", io.ErrUnexpectedEOF)
+				}
+				// unless skipping magic, the lexer consumes and checks the
+				// closing magic along with the footer.
+				if !lexerOpts.SkipMagic {
+					return nil
+				}
+				if !bytes.Equal(pending.Bytes(), Magic) {
+					return fmt.Errorf("stream ended without closing magic: %w", io.ErrUnexpectedEOF)
+				}
+				_, err = dst.Write(pending.Bytes())
+				return err
+			}
+			return err
+		}
+		if len(record) > len(buf) {
+			buf = record
+		}
+		switch tokenType {
+		case TokenChunk:
+			_, err := decompressChunkRecord(decompressor, record, true, lexerOpts.RequireChunkCRC,
+				lexerOpts.MaxDecompressedChunkSize)
+			if err != nil {
+				return err
+			}
+		case TokenDataEnd:
+			dataEnd, err := ParseDataEnd(record)
+			if err != nil {
+				return fmt.Errorf("failed to parse data end: %w", err)
+			}
+			// the data section CRC covers everything preceding the data end
+			// record, including any padding buffered along with it.
+			preceding := pending.Len() - 9 - len(record)
+			_, _ = dataSectionCRC.Write(pending.Bytes()[:preceding])
+			if dataEnd.DataSectionCRC > 0 && dataEnd.DataSectionCRC != dataSectionCRC.Sum32() {
+				return fmt.Errorf(
+					"invalid data section CRC: %x != %x",
+					dataSectionCRC.Sum32(), dataEnd.DataSectionCRC,
+				)
+			}
+			inDataSection = false
+		case TokenFooter:
+			footerSeen = true
+		}
+		if inDataSection {
+			_, _ = dataSectionCRC.Write(pending.Bytes())
+		}
+		if _, err := dst.Write(pending.Bytes()); err != nil {
+			return err
+		}
+		pending.Reset()
+	}
+}
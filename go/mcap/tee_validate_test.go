@@ -0,0 +1,77 @@
+package mcap
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeeValidate(t *testing.T) {
+	logTimes := make([]uint64, 100)
+	for i := range logTimes {
+		logTimes[i] = uint64(i)
+	}
+	data := writeTestFile(t, &WriterOptions{
+		Chunked:     true,
+		ChunkSize:   200,
+		Compression: CompressionLZ4,
+		IncludeCRC:  true,
+	}, []string{"/a", "/b"}, logTimes)
+	t.Run("copies valid file", func(t *testing.T) {
+		dst1 := &flushCountingWriter{}
+		dst2 := &bytes.Buffer{}
+		assert.Nil(t, TeeValidate(dst1, dst2, bytes.NewReader(data)))
+		assert.Equal(t, data, dst1.Bytes())
+		assert.Equal(t, data, dst2.Bytes())
+		assert.Equal(t, 1, dst1.flushes)
+	})
+	t.Run("stops before corrupt chunk", func(t *testing.T) {
+		info, err := readInfo(bytes.NewReader(data), int64(len(data)))
+		assert.Nil(t, err)
+		corruptOffset := info.ChunkIndexes[2].ChunkStartOffset
+		corrupt := append([]byte{}, data...)
+		corrupt[corruptOffset+9+8+8+8] ^= 0xff // uncompressed CRC
+		dst1 := &flushCountingWriter{}
+		dst2 := &bytes.Buffer{}
+		err = TeeValidate(dst1, dst2, bytes.NewReader(corrupt))
+		assert.Contains(t, err.Error(), "invalid chunk CRC")
+		assert.Equal(t, corrupt[:corruptOffset], dst1.Bytes())
+		assert.Equal(t, corrupt[:corruptOffset], dst2.Bytes())
+		assert.Equal(t, 1, dst1.flushes)
+	})
+	t.Run("rejects truncated stream", func(t *testing.T) {
+		err := TeeValidate(io.Discard, io.Discard, bytes.NewReader(data[:len(data)-20]))
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+	t.Run("rejects stream truncated at a record boundary", func(t *testing.T) {
+		info, err := readInfo(bytes.NewReader(data), int64(len(data)))
+		assert.Nil(t, err)
+		truncated := data[:info.ChunkIndexes[2].ChunkStartOffset]
+		dst1 := &flushCountingWriter{}
+		dst2 := &bytes.Buffer{}
+		err = TeeValidate(dst1, dst2, bytes.NewReader(truncated))
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		assert.Equal(t, 1, dst1.flushes)
+	})
+	t.Run("rejects bad data section CRC", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(data), &LexerOptions{EmitChunks: true})
+		assert.Nil(t, err)
+		// flip a byte in the first message index record, which is covered
+		// only by the data section CRC.
+		offset := len(Magic)
+		for {
+			tokenType, record, err := lexer.Next(nil)
+			assert.Nil(t, err)
+			if tokenType == TokenMessageIndex {
+				break
+			}
+			offset += 9 + len(record)
+		}
+		corrupt := append([]byte{}, data...)
+		corrupt[offset+9] ^= 0xff
+		err = TeeValidate(io.Discard, io.Discard, bytes.NewReader(corrupt))
+		assert.Contains(t, err.Error(), "invalid data section CRC")
+	})
+}
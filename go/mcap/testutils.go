@@ -7,6 +7,7 @@ import (
 	"io"
 	"testing"
 
+	"github.com/klauspost/compress/s2"
 	"github.com/klauspost/compress/zstd"
 	"github.com/pierrec/lz4/v4"
 	"github.com/stretchr/testify/assert"
@@ -86,6 +87,12 @@ func message() []byte {
 
 func chunk(t *testing.T, compression CompressionFormat, includeCRC bool, records ...[]byte) []byte {
 	data := flatten(records...)
+	return chunkRecord(t, compression, includeCRC, data, compress(t, compression, data))
+}
+
+// compress compresses data in the given format, returning it as is if the
+// format is unrecognized.
+func compress(t *testing.T, compression CompressionFormat, data []byte) []byte {
 	buf := &bytes.Buffer{}
 	switch compression {
 	case CompressionZSTD:
@@ -101,6 +108,11 @@ func chunk(t *testing.T, compression CompressionFormat, includeCRC bool, records
 		_, err := io.Copy(w, bytes.NewReader(data))
 		assert.Nil(t, err)
 		w.Close()
+	case CompressionSnappy:
+		w := s2.NewWriter(buf, s2.WriterSnappyCompat())
+		_, err := io.Copy(w, bytes.NewReader(data))
+		assert.Nil(t, err)
+		assert.Nil(t, w.Close())
 	case CompressionNone:
 		_, err := buf.Write(data)
 		assert.Nil(t, err)
@@ -108,8 +120,14 @@ func chunk(t *testing.T, compression CompressionFormat, includeCRC bool, records
 		_, err := buf.Write(data) // unrecognized compression
 		assert.Nil(t, err)
 	}
+	return buf.Bytes()
+}
+
+// chunkRecord builds a chunk record for data, which has already been
+// compressed as compressed.
+func chunkRecord(t *testing.T, compression CompressionFormat, includeCRC bool, data []byte, compressed []byte) []byte {
 	compressionLen := len(compression)
-	compressedLen := buf.Len()
+	compressedLen := len(compressed)
 	uncompressedLen := len(data)
 	msglen := uint64(8 + 8 + 8 + 4 + 4 + compressionLen + 8 + compressedLen)
 	record := make([]byte, msglen+9)
@@ -130,8 +148,8 @@ func chunk(t *testing.T, compression CompressionFormat, includeCRC bool, records
 	}
 	offset += putUint32(record[offset:], crc)
 	offset += putPrefixedString(record[offset:], string(compression))
-	offset += putUint64(record[offset:], uint64(buf.Len()))
-	_ = copy(record[offset:], buf.Bytes())
+	offset += putUint64(record[offset:], uint64(compressedLen))
+	_ = copy(record[offset:], compressed)
 	return record
 }
 
@@ -0,0 +1,143 @@
+package mcap
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/foxglove/mcap/go/mcap/readopts"
+)
+
+// ExtractTimeSeries writes the value of a scalar field of each message on a
+// topic to w as CSV, with a header row followed by a row of log time and value
+// for each message. Messages are decoded with the decoder registered for
+// their message encoding, see RegisterMessageDecoder, and migrated with the
+// migrations registered for the topic, see RegisterMigration. The field path
+// is a dotted path into the decoded message, whose elements name map keys or
+// struct fields, matched by name or by json tag, or index into slices. An
+// error is returned if the path does not exist in a message or does not
+// locate a boolean, number or string. The options select messages as for
+// Reader.Messages; if r is not seekable, the messages are read without the
+// index.
+func ExtractTimeSeries(w io.Writer, r io.Reader, topic string, fieldPath string, opts ...readopts.ReadOpt) error {
+	reader, err := NewReader(r)
+	if err != nil {
+		return err
+	}
+	readOpts := []readopts.ReadOpt{readopts.WithTopics([]string{topic})}
+	if _, ok := r.(io.ReadSeeker); !ok {
+		readOpts = append(readOpts, readopts.UsingIndex(false))
+	}
+	it, err := reader.Messages(append(readOpts, opts...)...)
+	if err != nil {
+		return err
+	}
+	path := strings.Split(fieldPath, ".")
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"log_time", fieldPath}); err != nil {
+		return err
+	}
+	err = Range(it, func(schema *Schema, channel *Channel, message *Message) error {
+		decoded, err := DecodeMessage(schema, channel, message)
+		if err != nil {
+			return err
+		}
+		_, decoded, err = MigrateMessage(schema, channel, decoded)
+		if err != nil {
+			return err
+		}
+		value, err := scalarField(decoded, path)
+		if err != nil {
+			return fmt.Errorf("message at %d: %w", message.LogTime, err)
+		}
+		return cw.Write([]string{strconv.FormatUint(message.LogTime, 10), value})
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// scalarField formats the scalar at the given path into a decoded message.
+func scalarField(decoded interface{}, path []string) (string, error) {
+	value := reflect.ValueOf(decoded)
+	for i, name := range path {
+		value = indirect(value)
+		var ok bool
+		switch value.Kind() {
+		case reflect.Map:
+			if value.Type().Key().Kind() != reflect.String {
+				return "", fmt.Errorf("field %q is not a struct, map or list", strings.Join(path[:i], "."))
+			}
+			value = value.MapIndex(reflect.ValueOf(name).Convert(value.Type().Key()))
+			ok = value.IsValid()
+		case reflect.Struct:
+			value, ok = structField(value, name)
+		case reflect.Slice, reflect.Array:
+			index, err := strconv.Atoi(name)
+			ok = err == nil && index >= 0 && index < value.Len()
+			if ok {
+				value = value.Index(index)
+			}
+		case reflect.Invalid:
+			return "", fmt.Errorf("field %q is null", strings.Join(path[:i], "."))
+		default:
+			return "", fmt.Errorf("field %q is not a struct, map or list", strings.Join(path[:i], "."))
+		}
+		if !ok {
+			return "", fmt.Errorf("field %q does not exist", strings.Join(path[:i+1], "."))
+		}
+	}
+	value = indirect(value)
+	switch value.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(value.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(value.Float(), 'g', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'g', -1, 64), nil
+	case reflect.String:
+		return value.String(), nil
+	case reflect.Invalid:
+		return "", fmt.Errorf("field %q is null", strings.Join(path, "."))
+	default:
+		return "", fmt.Errorf("field %q is not scalar: found %s", strings.Join(path, "."), value.Type())
+	}
+}
+
+// indirect dereferences pointers and interfaces, returning the zero Value for
+// nil ones.
+func indirect(value reflect.Value) reflect.Value {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+	return value
+}
+
+// structField returns the exported field of a struct with the given name or
+// json tag name.
+func structField(value reflect.Value, name string) (reflect.Value, bool) {
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Name == name || tag == name {
+			return value.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
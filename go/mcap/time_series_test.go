@@ -0,0 +1,99 @@
+package mcap
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testPose struct {
+	Position struct {
+		X float64 `json:"x"`
+	} `json:"position"`
+	Label string
+	Tags  []string
+}
+
+func TestExtractTimeSeries(t *testing.T) {
+	RegisterMessageDecoder("test-pose", func(_ *Schema, data []byte) (interface{}, error) {
+		pose := &testPose{}
+		err := json.Unmarshal(data, pose)
+		return pose, err
+	})
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{Chunked: true, Compression: CompressionZSTD})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	_, err = w.WriteChannel(&Channel{ID: 1, Topic: "/json", MessageEncoding: "json"})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 2, Topic: "/pose", MessageEncoding: "test-pose"})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 3, Topic: "/raw", MessageEncoding: "test-unregistered"})
+	assert.Nil(t, err)
+	for i, message := range []string{
+		`{"position": {"x": 1.5}, "label": "a", "tags": ["x", "y"]}`,
+		`{"position": {"x": -2}, "label": "b,c", "tags": ["z"]}`,
+	} {
+		for channelID := uint16(1); channelID <= 3; channelID++ {
+			assert.Nil(t, w.WriteMessage(&Message{
+				ChannelID: channelID,
+				LogTime:   uint64(100 * (i + 1)),
+				Data:      []byte(message),
+			}))
+		}
+	}
+	assert.Nil(t, w.Close())
+
+	extract := func(topic string, fieldPath string) (string, error) {
+		out := &bytes.Buffer{}
+		err := ExtractTimeSeries(out, bytes.NewReader(buf.Bytes()), topic, fieldPath)
+		return out.String(), err
+	}
+	for _, c := range []struct {
+		assertion string
+		topic     string
+		fieldPath string
+		output    string
+	}{
+		{"json number", "/json", "position.x", "log_time,position.x\n100,1.5\n200,-2\n"},
+		{"json string", "/json", "label", "log_time,label\n100,a\n200,\"b,c\"\n"},
+		{"json list element", "/json", "tags.0", "log_time,tags.0\n100,x\n200,z\n"},
+		{"struct field by json tag", "/pose", "position.x", "log_time,position.x\n100,1.5\n200,-2\n"},
+		{"struct field by name", "/pose", "Label", "log_time,Label\n100,a\n200,\"b,c\"\n"},
+	} {
+		t.Run(c.assertion, func(t *testing.T) {
+			output, err := extract(c.topic, c.fieldPath)
+			assert.Nil(t, err)
+			assert.Equal(t, c.output, output)
+		})
+	}
+	for _, c := range []struct {
+		assertion string
+		topic     string
+		fieldPath string
+		message   string
+	}{
+		{"missing field", "/json", "position.y", `field "position.y" does not exist`},
+		{"out of range index", "/pose", "Tags.1", `field "Tags.1" does not exist`},
+		{"non-scalar field", "/json", "position", `field "position" is not scalar`},
+		{"path through scalar", "/json", "label.x", `field "label" is not a struct, map or list`},
+	} {
+		t.Run(c.assertion, func(t *testing.T) {
+			_, err := extract(c.topic, c.fieldPath)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), c.message)
+		})
+	}
+	t.Run("unregistered encoding", func(t *testing.T) {
+		_, err := extract("/raw", "label")
+		assert.ErrorIs(t, err, ErrNoMessageDecoder)
+	})
+	t.Run("unseekable input", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		err := ExtractTimeSeries(out, bytes.NewBuffer(buf.Bytes()), "/json", "position.x")
+		assert.Nil(t, err)
+		assert.Equal(t, "log_time,position.x\n100,1.5\n200,-2\n", out.String())
+	})
+}
@@ -0,0 +1,46 @@
+package mcap
+
+// TimeSkew summarizes the skew, in nanoseconds, of the publish times of a
+// channel's messages relative to their log times, computed as publish time
+// minus log time. A skew that is consistently large or negative indicates a
+// clock synchronization problem in the recorder.
+type TimeSkew struct {
+	MessageCount uint64
+	Min          int64
+	Max          int64
+	Mean         float64
+}
+
+func (r *Reader) observeTimeSkew(message *Message) {
+	// the wrapping difference is the signed skew for times within 2^63 ns
+	// of each other.
+	skew := int64(message.PublishTime - message.LogTime)
+	stats, ok := r.timeSkew[message.ChannelID]
+	if !ok {
+		stats = &TimeSkew{Min: skew, Max: skew}
+		r.timeSkew[message.ChannelID] = stats
+	}
+	if skew < stats.Min {
+		stats.Min = skew
+	}
+	if skew > stats.Max {
+		stats.Max = skew
+	}
+	stats.MessageCount++
+	stats.Mean += (float64(skew) - stats.Mean) / float64(stats.MessageCount)
+}
+
+// TimeSkewStats returns a snapshot of the publish time skew statistics of
+// each channel, accumulated from the messages returned by the reader's
+// iterators created with readopts.CollectingTimeSkew. It returns nil if no
+// such iterator has been created. Channels without messages are omitted.
+func (r *Reader) TimeSkewStats() map[uint16]TimeSkew {
+	if r.timeSkew == nil {
+		return nil
+	}
+	result := make(map[uint16]TimeSkew, len(r.timeSkew))
+	for id, stats := range r.timeSkew {
+		result[id] = *stats
+	}
+	return result
+}
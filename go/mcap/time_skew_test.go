@@ -0,0 +1,52 @@
+package mcap
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/foxglove/mcap/go/mcap/readopts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderTimeSkewStats(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{Chunked: true, Compression: CompressionLZ4})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	for _, id := range []uint16{1, 2, 3} {
+		_, err = w.WriteChannel(&Channel{ID: id, Topic: fmt.Sprintf("/topic%d", id), MessageEncoding: "raw"})
+		assert.Nil(t, err)
+	}
+	for _, m := range []struct {
+		channelID   uint16
+		logTime     uint64
+		publishTime uint64
+	}{
+		{1, 100, 90},
+		{1, 200, 170},
+		{1, 300, 295},
+		{2, 100, 150},
+		{2, 200, 200},
+	} {
+		assert.Nil(t, w.WriteMessage(&Message{
+			ChannelID:   m.channelID,
+			LogTime:     m.logTime,
+			PublishTime: m.publishTime,
+		}))
+	}
+	assert.Nil(t, w.Close())
+
+	for _, useIndex := range []bool{true, false} {
+		reader, err := NewReader(bytes.NewReader(buf.Bytes()))
+		assert.Nil(t, err)
+		assert.Nil(t, reader.TimeSkewStats())
+		it, err := reader.Messages(readopts.UsingIndex(useIndex), readopts.CollectingTimeSkew(true))
+		assert.Nil(t, err)
+		assert.Nil(t, Range(it, func(*Schema, *Channel, *Message) error { return nil }))
+		assert.Equal(t, map[uint16]TimeSkew{
+			1: {MessageCount: 3, Min: -30, Max: -5, Mean: -15},
+			2: {MessageCount: 2, Min: 0, Max: 50, Mean: 25},
+		}, reader.TimeSkewStats())
+	}
+}
@@ -0,0 +1,185 @@
+package mcap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// TopicBound describes the first and last messages on a topic.
+type TopicBound struct {
+	FirstLogTime uint64
+	LastLogTime  uint64
+	First        *Message
+	Last         *Message
+}
+
+func (b *TopicBound) update(message *Message) {
+	if b.First == nil || message.LogTime < b.FirstLogTime {
+		b.FirstLogTime = message.LogTime
+		b.First = message
+	}
+	if b.Last == nil || message.LogTime >= b.LastLogTime {
+		b.LastLogTime = message.LogTime
+		b.Last = message
+	}
+}
+
+// TopicBounds returns the first and last message on each topic in the file.
+// When the file is indexed, only the message indexes of candidate chunks and
+// the chunks containing the boundary messages are read. Files without chunk
+// and message indexes fall back to a full scan.
+func TopicBounds(r io.ReaderAt, size int64) (map[string]TopicBound, error) {
+	info, err := readInfo(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read summary: %w", err)
+	}
+	indexed := len(info.ChunkIndexes) > 0
+	for _, idx := range info.ChunkIndexes {
+		if idx.MessageIndexLength == 0 {
+			indexed = false
+			break
+		}
+	}
+	if !indexed {
+		return scanTopicBounds(io.NewSectionReader(r, 0, size))
+	}
+	chunkData := make(map[uint64][]byte)
+	loadMessage := func(idx *ChunkIndex, offset uint64) (*Message, error) {
+		data, ok := chunkData[idx.ChunkStartOffset]
+		if !ok {
+			chunk, err := readChunkAt(r, idx)
+			if err != nil {
+				return nil, err
+			}
+			data, err = decompressChunk(chunk)
+			if err != nil {
+				return nil, err
+			}
+			chunkData[idx.ChunkStartOffset] = data
+		}
+		return messageAt(data, offset)
+	}
+	bounds := make(map[string]TopicBound)
+	for channelID, channel := range info.Channels {
+		candidates := []*ChunkIndex{}
+		for _, idx := range info.ChunkIndexes {
+			if _, ok := idx.MessageIndexOffsets[channelID]; ok {
+				candidates = append(candidates, idx)
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+
+		// the first message is in the chunk holding the smallest indexed
+		// timestamp. Chunks starting after the best timestamp found so far
+		// cannot improve on it.
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].MessageStartTime < candidates[j].MessageStartTime
+		})
+		var first, last MessageIndexEntry
+		var firstChunk, lastChunk *ChunkIndex
+		first.Timestamp = math.MaxUint64
+		for _, idx := range candidates {
+			if firstChunk != nil && idx.MessageStartTime > first.Timestamp {
+				break
+			}
+			messageIndex, err := readMessageIndexAt(r, idx.MessageIndexOffsets[channelID])
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range messageIndex.Records {
+				if firstChunk == nil || entry.Timestamp < first.Timestamp {
+					first = entry
+					firstChunk = idx
+				}
+			}
+		}
+
+		// likewise, the last message is in the chunk holding the largest
+		// indexed timestamp.
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].MessageEndTime > candidates[j].MessageEndTime
+		})
+		for _, idx := range candidates {
+			if lastChunk != nil && idx.MessageEndTime < last.Timestamp {
+				break
+			}
+			messageIndex, err := readMessageIndexAt(r, idx.MessageIndexOffsets[channelID])
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range messageIndex.Records {
+				if lastChunk == nil || entry.Timestamp > last.Timestamp {
+					last = entry
+					lastChunk = idx
+				}
+			}
+		}
+		if firstChunk == nil || lastChunk == nil {
+			continue
+		}
+		firstMessage, err := loadMessage(firstChunk, first.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read first message on %s: %w", channel.Topic, err)
+		}
+		lastMessage, err := loadMessage(lastChunk, last.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read last message on %s: %w", channel.Topic, err)
+		}
+		bound := bounds[channel.Topic]
+		bound.update(firstMessage)
+		bound.update(lastMessage)
+		bounds[channel.Topic] = bound
+	}
+	return bounds, nil
+}
+
+func scanTopicBounds(r io.Reader) (map[string]TopicBound, error) {
+	lexer, err := NewLexer(r)
+	if err != nil {
+		return nil, err
+	}
+	topics := make(map[uint16]string)
+	bounds := make(map[string]TopicBound)
+	buf := make([]byte, 1024)
+	for {
+		tokenType, record, err := lexer.Next(buf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return bounds, nil
+			}
+			return nil, err
+		}
+		if len(record) > len(buf) {
+			buf = record
+		}
+		switch tokenType {
+		case TokenChannel:
+			channel, err := ParseChannel(record)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse channel: %w", err)
+			}
+			topics[channel.ID] = channel.Topic
+		case TokenMessage:
+			message, err := ParseMessage(record)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse message: %w", err)
+			}
+			topic, ok := topics[message.ChannelID]
+			if !ok {
+				continue
+			}
+			bound := bounds[topic]
+			if bound.First == nil || message.LogTime < bound.FirstLogTime ||
+				bound.Last == nil || message.LogTime >= bound.LastLogTime {
+				message.Data = append([]byte{}, message.Data...)
+				bound.update(message)
+				bounds[topic] = bound
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package mcap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestFile writes a file with a schema and a channel per topic, and
+// messages assigned round-robin to the topics with the provided log times.
+func writeTestFile(t *testing.T, opts *WriterOptions, topics []string, logTimes []uint64) []byte {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, opts)
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	_, err = w.WriteSchema(&Schema{ID: 1, Name: "schema", Encoding: "jsonschema", Data: []byte("{}")})
+	assert.Nil(t, err)
+	for i, topic := range topics {
+		_, err = w.WriteChannel(&Channel{
+			ID:              uint16(i + 1),
+			SchemaID:        1,
+			Topic:           topic,
+			MessageEncoding: "json",
+		})
+		assert.Nil(t, err)
+	}
+	for i, logTime := range logTimes {
+		assert.Nil(t, w.WriteMessage(&Message{
+			ChannelID:   uint16(i%len(topics) + 1),
+			Sequence:    uint32(i),
+			LogTime:     logTime,
+			PublishTime: logTime,
+			Data:        []byte{byte(i)},
+		}))
+	}
+	assert.Nil(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestTopicBounds(t *testing.T) {
+	logTimes := []uint64{50, 10, 70, 20, 30, 90, 5, 40, 60, 80, 100, 15}
+	expected := map[string]TopicBound{
+		"/a": {FirstLogTime: 5, LastLogTime: 100},
+		"/b": {FirstLogTime: 10, LastLogTime: 90},
+	}
+	cases := []struct {
+		assertion string
+		opts      *WriterOptions
+	}{
+		{"chunked and indexed", &WriterOptions{Chunked: true, ChunkSize: 40, Compression: CompressionZSTD}},
+		{"single chunk", &WriterOptions{Chunked: true, Compression: CompressionLZ4}},
+		{"chunked without message indexes", &WriterOptions{Chunked: true, ChunkSize: 40, SkipMessageIndexing: true}},
+		{"unchunked", &WriterOptions{}},
+	}
+	for _, c := range cases {
+		t.Run(c.assertion, func(t *testing.T) {
+			data := writeTestFile(t, c.opts, []string{"/a", "/b"}, logTimes)
+			bounds, err := TopicBounds(bytes.NewReader(data), int64(len(data)))
+			assert.Nil(t, err)
+			assert.Equal(t, len(expected), len(bounds))
+			for topic, expectedBound := range expected {
+				bound := bounds[topic]
+				assert.Equal(t, expectedBound.FirstLogTime, bound.FirstLogTime, topic)
+				assert.Equal(t, expectedBound.LastLogTime, bound.LastLogTime, topic)
+				assert.Equal(t, bound.FirstLogTime, bound.First.LogTime)
+				assert.Equal(t, bound.LastLogTime, bound.Last.LogTime)
+			}
+			assert.Equal(t, []byte{6}, bounds["/a"].First.Data)
+			assert.Equal(t, []byte{10}, bounds["/a"].Last.Data)
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package mcap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// TransformOptions are options for Transform.
+type TransformOptions struct {
+	// Writer configures the output file. If nil, the output is written in
+	// zstd-compressed chunks with CRCs.
+	Writer *WriterOptions
+	// CopyUndecodable causes messages on channels whose message encoding has
+	// no registered decoder or encoder to be copied unchanged, without being
+	// passed to the transform function. By default, Transform fails on them.
+	// Messages on channels with migrations are never copied unchanged.
+	CopyUndecodable bool
+}
+
+// Transform copies an MCAP file from r to w, rewriting each message with fn.
+// Each message is decoded with the decoder registered for its channel's
+// message encoding, passed to fn with its channel, and the result is encoded
+// with the registered encoder and written in place of the message. Messages
+// for which fn returns nil are dropped. Schemas, channels, attachments and
+// metadata are copied unchanged, and the summary section of the output is
+// rebuilt.
+//
+// Messages on topics with migrations registered with RegisterMigration are
+// migrated before being passed to fn, and their channels are written with the
+// schema migrated to in place of the schema they were recorded with. Schemas
+// keep their IDs unless an ID is needed for a schema migrated to, in which
+// case the channels referring to it are written with its new ID. Schemas
+// migrated to that are not in the input are written before the first channel
+// migrated, and are not written again if they appear later in the input.
+func Transform(
+	w io.Writer,
+	r io.Reader,
+	fn func(channel *Channel, decoded interface{}) (interface{}, error),
+	opts ...*TransformOptions,
+) error {
+	transformOpts := TransformOptions{}
+	if len(opts) > 0 && opts[0] != nil {
+		transformOpts = *opts[0]
+	}
+	writerOpts := WriterOptions{
+		Chunked:     true,
+		Compression: CompressionZSTD,
+		IncludeCRC:  true,
+	}
+	if transformOpts.Writer != nil {
+		writerOpts = *transformOpts.Writer
+	}
+	// channel IDs are preserved, so the writer must not merge identical
+	// definitions.
+	writerOpts.SkipDeduplication = true
+	lexer, err := NewLexer(r)
+	if err != nil {
+		return err
+	}
+	writer, err := NewWriter(w, &writerOpts)
+	if err != nil {
+		return err
+	}
+	schemas := make(map[uint16]*Schema)
+	channels := make(map[uint16]*Channel)
+	ids := newTransformSchemaIDs()
+	// migrated holds the schema migrated to for channels with migrations.
+	migrated := make(map[uint16]*Schema)
+	var buf []byte
+	for {
+		tokenType, data, err := lexer.Next(buf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		if len(data) > len(buf) {
+			buf = data
+		}
+		switch tokenType {
+		case TokenHeader:
+			header, err := ParseHeader(data)
+			if err != nil {
+				return err
+			}
+			if err := writer.WriteHeader(header); err != nil {
+				return err
+			}
+		case TokenSchema:
+			schema, err := ParseSchema(data)
+			if err != nil {
+				return err
+			}
+			if _, ok := schemas[schema.ID]; ok {
+				continue
+			}
+			// the schema data is retained, and must not alias the buffer.
+			schema.Data = append([]byte(nil), schema.Data...)
+			schemas[schema.ID] = schema
+			if err := ids.writeSchema(writer, schema); err != nil {
+				return err
+			}
+		case TokenChannel:
+			channel, err := ParseChannel(data)
+			if err != nil {
+				return err
+			}
+			if _, ok := channels[channel.ID]; ok {
+				continue
+			}
+			channels[channel.ID] = channel
+			output := *channel
+			if id, ok := ids.output[channel.SchemaID]; ok {
+				output.SchemaID = id
+			}
+			if target := migrationTarget(channel.Topic, schemas[channel.SchemaID]); target != nil {
+				migrated[channel.ID] = target
+				if output.SchemaID, err = ids.writeTarget(writer, target); err != nil {
+					return err
+				}
+			}
+			if _, err := writer.WriteChannel(&output); err != nil {
+				return err
+			}
+		case TokenMessage:
+			message, err := ParseMessage(data)
+			if err != nil {
+				return err
+			}
+			channel, ok := channels[message.ChannelID]
+			if !ok {
+				return fmt.Errorf("message on unknown channel %d", message.ChannelID)
+			}
+			schema := schemas[channel.SchemaID]
+			target, isMigrated := migrated[channel.ID]
+			undecodable := !hasMessageEncoder(channel.MessageEncoding)
+			decoded, err := DecodeMessage(schema, channel, message)
+			if errors.Is(err, ErrNoMessageDecoder) {
+				undecodable = true
+			}
+			if undecodable && transformOpts.CopyUndecodable && !isMigrated {
+				if err := writer.WriteMessage(message); err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if isMigrated {
+				if _, decoded, err = MigrateMessage(schema, channel, decoded); err != nil {
+					return err
+				}
+				schema = target
+			}
+			transformed, err := fn(channel, decoded)
+			if err != nil {
+				return fmt.Errorf("failed to transform message on %s: %w", channel.Topic, err)
+			}
+			if transformed == nil {
+				continue
+			}
+			message.Data, err = EncodeMessage(schema, channel, transformed)
+			if err != nil {
+				return err
+			}
+			if err := writer.WriteMessage(message); err != nil {
+				return err
+			}
+		case TokenAttachment:
+			attachment, err := ParseAttachment(data)
+			if err != nil {
+				return err
+			}
+			if err := writer.WriteAttachment(attachment); err != nil {
+				return err
+			}
+		case TokenMetadata:
+			metadata, err := ParseMetadata(data)
+			if err != nil {
+				return err
+			}
+			if err := writer.WriteMetadata(metadata); err != nil {
+				return err
+			}
+		case TokenDataEnd, TokenFooter:
+			return writer.Close()
+		}
+	}
+	return writer.Close()
+}
+
+// transformSchemaIDs assigns the IDs of the schemas written by Transform,
+// which are those of the input except where an ID is needed for a schema
+// migrated to.
+type transformSchemaIDs struct {
+	// output maps the IDs of input schemas to their IDs in the output.
+	output map[uint16]uint16
+	// written maps the content of the schemas written to their IDs, and
+	// targets that of the schemas written only as schemas migrated to.
+	written map[schemaKey]uint16
+	targets map[schemaKey]uint16
+	used    map[uint16]bool
+}
+
+func newTransformSchemaIDs() *transformSchemaIDs {
+	return &transformSchemaIDs{
+		output:  make(map[uint16]uint16),
+		written: make(map[schemaKey]uint16),
+		targets: make(map[schemaKey]uint16),
+		used:    make(map[uint16]bool),
+	}
+}
+
+// writeSchema writes a schema of the input, with its own ID if it is free. A
+// schema already written as a schema migrated to is not written again.
+func (ids *transformSchemaIDs) writeSchema(writer *Writer, schema *Schema) error {
+	if id, ok := ids.targets[keyOfSchema(schema)]; ok {
+		ids.output[schema.ID] = id
+		return nil
+	}
+	id, err := ids.write(writer, schema)
+	if err != nil {
+		return err
+	}
+	ids.output[schema.ID] = id
+	return nil
+}
+
+// writeTarget returns the ID of a schema migrated to, writing it first if no
+// schema with the same content has been written.
+func (ids *transformSchemaIDs) writeTarget(writer *Writer, schema *Schema) (uint16, error) {
+	key := keyOfSchema(schema)
+	if id, ok := ids.written[key]; ok {
+		return id, nil
+	}
+	id, err := ids.write(writer, schema)
+	if err != nil {
+		return 0, err
+	}
+	ids.targets[key] = id
+	return id, nil
+}
+
+func (ids *transformSchemaIDs) write(writer *Writer, schema *Schema) (uint16, error) {
+	id := schema.ID
+	if id == 0 || ids.used[id] {
+		id = 1
+		for ids.used[id] {
+			if id == math.MaxUint16 {
+				return 0, fmt.Errorf("no schema ID available for %s", schema.Name)
+			}
+			id++
+		}
+	}
+	output := *schema
+	output.ID = id
+	if _, err := writer.WriteSchema(&output); err != nil {
+		return 0, err
+	}
+	ids.used[id] = true
+	if _, ok := ids.written[keyOfSchema(schema)]; !ok {
+		ids.written[keyOfSchema(schema)] = id
+	}
+	return id, nil
+}
@@ -0,0 +1,84 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransform(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{Chunked: true, ChunkSize: 128, Compression: CompressionZSTD})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{Profile: "test"}))
+	_, err = w.WriteSchema(&Schema{ID: 1, Name: "reading", Encoding: "jsonschema", Data: []byte("{}")})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 1, SchemaID: 1, Topic: "/readings", MessageEncoding: "json"})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 2, Topic: "/raw", MessageEncoding: "raw"})
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, w.WriteMessage(&Message{
+			ChannelID: 1,
+			LogTime:   uint64(i),
+			Data:      []byte(fmt.Sprintf(`{"secret":"s%d","value":%d}`, i, i)),
+		}))
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: 2, LogTime: uint64(i), Data: []byte{byte(i)}}))
+	}
+	assert.Nil(t, w.WriteMetadata(&Metadata{Name: "info", Metadata: map[string]string{"a": "b"}}))
+	assert.Nil(t, w.Close())
+	input := buf.Bytes()
+
+	// scrub the secret field, and drop messages with odd values.
+	scrub := func(_ *Channel, decoded interface{}) (interface{}, error) {
+		fields := decoded.(map[string]interface{})
+		if int(fields["value"].(float64))%2 == 1 {
+			return nil, nil
+		}
+		delete(fields, "secret")
+		return fields, nil
+	}
+	t.Run("rewrites and drops messages", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		err := Transform(output, bytes.NewReader(input), scrub, &TransformOptions{CopyUndecodable: true})
+		assert.Nil(t, err)
+		reader, err := NewReader(bytes.NewReader(output.Bytes()))
+		assert.Nil(t, err)
+		info, err := reader.Info()
+		assert.Nil(t, err)
+		assert.Equal(t, "test", info.Header.Profile)
+		assert.Equal(t, "reading", info.Schemas[1].Name)
+		assert.Equal(t, "/raw", info.Channels[2].Topic)
+		assert.Equal(t, map[uint16]uint64{1: 5, 2: 10}, info.Statistics.ChannelMessageCounts)
+		assert.Equal(t, uint32(1), info.Statistics.MetadataCount)
+		it, err := reader.Messages()
+		assert.Nil(t, err)
+		var readings []string
+		assert.Nil(t, Range(it, func(_ *Schema, channel *Channel, message *Message) error {
+			if channel.ID == 1 {
+				readings = append(readings, string(message.Data))
+			} else {
+				assert.Equal(t, []byte{byte(message.LogTime)}, message.Data)
+			}
+			return nil
+		}))
+		assert.Equal(t, []string{
+			`{"value":0}`, `{"value":2}`, `{"value":4}`, `{"value":6}`, `{"value":8}`,
+		}, readings)
+	})
+	t.Run("fails on undecodable messages by default", func(t *testing.T) {
+		err := Transform(io.Discard, bytes.NewReader(input), scrub)
+		assert.ErrorIs(t, err, ErrNoMessageDecoder)
+	})
+	t.Run("propagates transform errors", func(t *testing.T) {
+		failed := errors.New("failed")
+		err := Transform(io.Discard, bytes.NewReader(input), func(*Channel, interface{}) (interface{}, error) {
+			return nil, failed
+		}, &TransformOptions{CopyUndecodable: true})
+		assert.ErrorIs(t, err, failed)
+	})
+}
@@ -1,7 +1,9 @@
 package mcap
 
 import (
+	"errors"
 	"fmt"
+	"io"
 )
 
 type unindexedMessageIterator struct {
@@ -11,12 +13,32 @@ type unindexedMessageIterator struct {
 	topics   map[string]bool
 	start    uint64
 	end      uint64
+
+	// maxMessages, if positive, is the number of messages after which the
+	// iterator stops reading.
+	maxMessages int
+	count       int
+
+	// sidecar, if set, accumulates an index of the messages returned.
+	sidecar *indexSidecarBuilder
+
+	onSchema  func(*Schema)
+	onChannel func(*Channel)
+	onMessage func(*Schema, *Channel, *Message)
 }
 
 func (it *unindexedMessageIterator) Next(p []byte) (*Schema, *Channel, *Message, error) {
+	if it.maxMessages > 0 && it.count >= it.maxMessages {
+		return nil, nil, nil, io.EOF
+	}
 	for {
 		tokenType, record, err := it.lexer.Next(p)
 		if err != nil {
+			if it.sidecar != nil && errors.Is(err, io.EOF) {
+				if err := it.sidecar.write(); err != nil {
+					return nil, nil, nil, err
+				}
+			}
 			return nil, nil, nil, err
 		}
 		switch tokenType {
@@ -27,6 +49,7 @@ func (it *unindexedMessageIterator) Next(p []byte) (*Schema, *Channel, *Message,
 			}
 			if _, ok := it.schemas[schema.ID]; !ok {
 				it.schemas[schema.ID] = schema
+				it.onSchema(schema)
 			}
 		case TokenChannel:
 			channelInfo, err := ParseChannel(record)
@@ -34,6 +57,7 @@ func (it *unindexedMessageIterator) Next(p []byte) (*Schema, *Channel, *Message,
 				return nil, nil, nil, fmt.Errorf("failed to parse channel info: %w", err)
 			}
 			if _, ok := it.channels[channelInfo.ID]; !ok {
+				it.onChannel(channelInfo)
 				if len(it.topics) == 0 || it.topics[channelInfo.Topic] {
 					it.channels[channelInfo.ID] = channelInfo
 				}
@@ -53,6 +77,11 @@ func (it *unindexedMessageIterator) Next(p []byte) (*Schema, *Channel, *Message,
 			if message.LogTime >= it.start && message.LogTime < it.end {
 				channel := it.channels[message.ChannelID]
 				schema := it.schemas[channel.SchemaID]
+				it.onMessage(schema, channel, message)
+				it.count++
+				if it.sidecar != nil {
+					it.sidecar.add(channel.Topic, it.messageLocation(message, len(record)))
+				}
 				return schema, channel, message, nil
 			}
 		default:
@@ -60,3 +89,18 @@ func (it *unindexedMessageIterator) Next(p []byte) (*Schema, *Channel, *Message,
 		}
 	}
 }
+
+// messageLocation returns the index sidecar entry of the message just read
+// from a record of length recordLen.
+func (it *unindexedMessageIterator) messageLocation(message *Message, recordLen int) IndexSidecarEntry {
+	entry := IndexSidecarEntry{LogTime: message.LogTime}
+	if chunkOffset, recordOffset, inChunk := it.lexer.ChunkOffsets(); inChunk {
+		entry.Offset = chunkOffset
+		entry.RecordOffset = recordOffset
+		entry.InChunk = true
+		return entry
+	}
+	// the lexer has just consumed the message record.
+	entry.Offset = uint64(it.lexer.Offset()) - 9 - uint64(recordLen)
+	return entry
+}
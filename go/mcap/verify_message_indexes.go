@@ -0,0 +1,110 @@
+package mcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MessageIndexMismatch describes a message index record, or an entry within
+// one, that is inconsistent with the chunk it indexes.
+type MessageIndexMismatch struct {
+	// ChunkStartOffset is the offset of the chunk whose index is inconsistent.
+	ChunkStartOffset uint64
+	// ChannelID is the channel the chunk index claims the message index
+	// record is for.
+	ChannelID uint16
+	// EntryOffset is the offset into the decompressed chunk claimed by the
+	// inconsistent entry, for mismatches of individual entries.
+	EntryOffset uint64
+	Reason      string
+}
+
+func (m MessageIndexMismatch) String() string {
+	return fmt.Sprintf("chunk at %d, channel %d: %s", m.ChunkStartOffset, m.ChannelID, m.Reason)
+}
+
+// VerifyMessageIndexes checks the message indexes of each chunk listed in the
+// summary section against the chunk's contents. Each message index offset in
+// a chunk index must locate a message index record for the claimed channel,
+// and each entry in that record must locate, within the decompressed chunk, a
+// message record on the channel with the indexed log time. The mismatches
+// found are returned in chunk index order; an empty result means the indexes
+// are consistent. Chunks that cannot be read or decompressed result in an
+// error.
+func VerifyMessageIndexes(r io.ReaderAt, size int64) ([]MessageIndexMismatch, error) {
+	info, err := readInfo(r, size)
+	if err != nil {
+		return nil, err
+	}
+	decompressor := &chunkDecompressor{}
+	defer decompressor.close()
+	mismatches := []MessageIndexMismatch{}
+	for _, idx := range info.ChunkIndexes {
+		if len(idx.MessageIndexOffsets) == 0 {
+			continue
+		}
+		chunk, err := readChunkAt(r, idx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chunk at %d: %w", idx.ChunkStartOffset, err)
+		}
+		data, err := decompressor.decompress(chunk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress chunk at %d: %w", idx.ChunkStartOffset, err)
+		}
+		for _, channelID := range sortedIDs(idx.MessageIndexOffsets) {
+			mismatch := func(entryOffset uint64, format string, args ...any) {
+				mismatches = append(mismatches, MessageIndexMismatch{
+					ChunkStartOffset: idx.ChunkStartOffset,
+					ChannelID:        channelID,
+					EntryOffset:      entryOffset,
+					Reason:           fmt.Sprintf(format, args...),
+				})
+			}
+			offset := idx.MessageIndexOffsets[channelID]
+			messageIndex, err := readMessageIndexAt(r, offset)
+			if err != nil {
+				mismatch(0, "invalid message index at %d: %s", offset, err)
+				continue
+			}
+			if messageIndex.ChannelID != channelID {
+				mismatch(0, "message index at %d is for channel %d", offset, messageIndex.ChannelID)
+				continue
+			}
+			for _, entry := range messageIndex.Records {
+				if reason := checkIndexedMessage(data, entry, channelID); reason != "" {
+					mismatch(entry.Offset, "entry at offset %d: %s", entry.Offset, reason)
+				}
+			}
+		}
+	}
+	return mismatches, nil
+}
+
+// checkIndexedMessage checks that a message index entry locates a message on
+// the channel with the indexed log time within the decompressed chunk data,
+// and otherwise describes the inconsistency.
+func checkIndexedMessage(data []byte, entry MessageIndexEntry, channelID uint16) string {
+	if entry.Offset > uint64(len(data)) || uint64(len(data))-entry.Offset < 9 {
+		return fmt.Sprintf("beyond end of chunk of length %d", len(data))
+	}
+	record := data[entry.Offset:]
+	if opcode := OpCode(record[0]); opcode != OpMessage {
+		return fmt.Sprintf("found %s record", opcode)
+	}
+	recordLen := binary.LittleEndian.Uint64(record[1:])
+	if recordLen > uint64(len(record))-9 || recordLen < 2+4+8+8 {
+		return fmt.Sprintf("invalid message record length %d", recordLen)
+	}
+	message, err := ParseMessage(record[9 : 9+recordLen])
+	if err != nil {
+		return fmt.Sprintf("invalid message record: %s", err)
+	}
+	if message.ChannelID != channelID {
+		return fmt.Sprintf("message is on channel %d", message.ChannelID)
+	}
+	if message.LogTime != entry.Timestamp {
+		return fmt.Sprintf("message log time %d differs from indexed time %d", message.LogTime, entry.Timestamp)
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package mcap
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyMessageIndexes(t *testing.T) {
+	logTimes := []uint64{10, 20, 30, 40, 50, 60}
+	t.Run("consistent indexes", func(t *testing.T) {
+		for _, compression := range []CompressionFormat{CompressionNone, CompressionZSTD, CompressionLZ4} {
+			data := writeTestFile(t, &WriterOptions{Chunked: true, ChunkSize: 50, Compression: compression},
+				[]string{"/a", "/b"}, logTimes)
+			mismatches, err := VerifyMessageIndexes(bytes.NewReader(data), int64(len(data)))
+			assert.Nil(t, err)
+			assert.Empty(t, mismatches)
+		}
+	})
+	t.Run("reports mismatches", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{Chunked: true, Compression: CompressionZSTD},
+			[]string{"/a", "/b"}, logTimes)
+		info, err := readInfo(bytes.NewReader(data), int64(len(data)))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(info.ChunkIndexes))
+		idx := info.ChunkIndexes[0]
+		channel2Index, err := readMessageIndexAt(bytes.NewReader(data), idx.MessageIndexOffsets[2])
+		assert.Nil(t, err)
+		otherChannelOffset := channel2Index.Records[0].Offset
+		// point the first two entries for channel 1 at a message on channel 2
+		// and beyond the end of the chunk.
+		entries := idx.MessageIndexOffsets[1] + 9 + 2 + 4
+		putUint64(data[entries+8:], otherChannelOffset)
+		putUint64(data[entries+16+8:], 1000)
+		// relabel the message index for channel 2.
+		putUint16(data[idx.MessageIndexOffsets[2]+9:], 7)
+
+		mismatches, err := VerifyMessageIndexes(bytes.NewReader(data), int64(len(data)))
+		assert.Nil(t, err)
+		assert.Equal(t, []MessageIndexMismatch{
+			{
+				ChunkStartOffset: idx.ChunkStartOffset,
+				ChannelID:        1,
+				EntryOffset:      otherChannelOffset,
+				Reason:           fmt.Sprintf("entry at offset %d: message is on channel 2", otherChannelOffset),
+			},
+			{
+				ChunkStartOffset: idx.ChunkStartOffset,
+				ChannelID:        1,
+				EntryOffset:      1000,
+				Reason:           fmt.Sprintf("entry at offset 1000: beyond end of chunk of length %d", idx.UncompressedSize),
+			},
+			{
+				ChunkStartOffset: idx.ChunkStartOffset,
+				ChannelID:        2,
+				Reason:           fmt.Sprintf("message index at %d is for channel 7", idx.MessageIndexOffsets[2]),
+			},
+		}, mismatches)
+	})
+}
@@ -0,0 +1,163 @@
+package mcap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ErrNoStatistics indicates that a file has no statistics record in its
+// summary section.
+var ErrNoStatistics = errors.New("file has no statistics record")
+
+// StatisticsMismatch describes a statistics field whose declared value differs
+// from the value found by scanning the file.
+type StatisticsMismatch struct {
+	Field    string
+	Declared uint64
+	Actual   uint64
+}
+
+func (m StatisticsMismatch) String() string {
+	return fmt.Sprintf("%s: declared %d, actual %d", m.Field, m.Declared, m.Actual)
+}
+
+// StatisticsDiff is the result of comparing a file's declared statistics
+// against a full scan of its data section.
+type StatisticsDiff struct {
+	Declared   *Statistics
+	Actual     *Statistics
+	Mismatches []StatisticsMismatch
+}
+
+// Empty reports whether the declared statistics match the scanned statistics.
+func (d *StatisticsDiff) Empty() bool {
+	return len(d.Mismatches) == 0
+}
+
+// VerifyStatistics compares the statistics record in the summary section of a
+// file with counts gathered by scanning the data section. If the file has no
+// statistics record, ErrNoStatistics is returned.
+func VerifyStatistics(r io.ReaderAt, size int64) (*StatisticsDiff, error) {
+	info, err := readInfo(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if info.Statistics == nil {
+		return nil, ErrNoStatistics
+	}
+	actual, _, err := scanStatistics(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, err
+	}
+	return diffStatistics(info.Statistics, actual), nil
+}
+
+// scanStatistics computes statistics for the data section of a file, and
+// returns the channels encountered.
+func scanStatistics(r io.Reader) (*Statistics, map[uint16]*Channel, error) {
+	lexer, err := NewLexer(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	stats := &Statistics{ChannelMessageCounts: make(map[uint16]uint64)}
+	lexer.onChunk = func() {
+		stats.ChunkCount++
+	}
+	schemas := make(map[uint16]bool)
+	channels := make(map[uint16]*Channel)
+	var buf []byte
+	for {
+		tokenType, data, err := lexer.Next(buf)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return stats, channels, nil
+			}
+			return nil, nil, err
+		}
+		if len(data) > len(buf) {
+			buf = data
+		}
+		switch tokenType {
+		case TokenSchema:
+			schema, err := ParseSchema(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !schemas[schema.ID] {
+				schemas[schema.ID] = true
+				stats.SchemaCount++
+			}
+		case TokenChannel:
+			channel, err := ParseChannel(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			if _, ok := channels[channel.ID]; !ok {
+				channels[channel.ID] = channel
+				stats.ChannelCount++
+			}
+		case TokenMessage:
+			message, err := ParseMessage(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			if stats.MessageCount == 0 || message.LogTime < stats.MessageStartTime {
+				stats.MessageStartTime = message.LogTime
+			}
+			if message.LogTime > stats.MessageEndTime {
+				stats.MessageEndTime = message.LogTime
+			}
+			stats.MessageCount++
+			stats.ChannelMessageCounts[message.ChannelID]++
+		case TokenAttachment:
+			stats.AttachmentCount++
+		case TokenMetadata:
+			stats.MetadataCount++
+		case TokenDataEnd, TokenFooter:
+			return stats, channels, nil
+		}
+	}
+}
+
+func diffStatistics(declared, actual *Statistics) *StatisticsDiff {
+	diff := &StatisticsDiff{Declared: declared, Actual: actual}
+	compare := func(field string, declared, actual uint64) {
+		if declared != actual {
+			diff.Mismatches = append(diff.Mismatches, StatisticsMismatch{
+				Field:    field,
+				Declared: declared,
+				Actual:   actual,
+			})
+		}
+	}
+	compare("MessageCount", declared.MessageCount, actual.MessageCount)
+	compare("SchemaCount", uint64(declared.SchemaCount), uint64(actual.SchemaCount))
+	compare("ChannelCount", uint64(declared.ChannelCount), uint64(actual.ChannelCount))
+	compare("AttachmentCount", uint64(declared.AttachmentCount), uint64(actual.AttachmentCount))
+	compare("MetadataCount", uint64(declared.MetadataCount), uint64(actual.MetadataCount))
+	compare("ChunkCount", uint64(declared.ChunkCount), uint64(actual.ChunkCount))
+	compare("MessageStartTime", declared.MessageStartTime, actual.MessageStartTime)
+	compare("MessageEndTime", declared.MessageEndTime, actual.MessageEndTime)
+	channelIDs := make(map[uint16]bool)
+	for id := range declared.ChannelMessageCounts {
+		channelIDs[id] = true
+	}
+	for id := range actual.ChannelMessageCounts {
+		channelIDs[id] = true
+	}
+	ids := make([]uint16, 0, len(channelIDs))
+	for id := range channelIDs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		compare(
+			fmt.Sprintf("ChannelMessageCounts[%d]", id),
+			declared.ChannelMessageCounts[id],
+			actual.ChannelMessageCounts[id],
+		)
+	}
+	return diff
+}
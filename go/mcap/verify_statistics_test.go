@@ -0,0 +1,52 @@
+package mcap
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyStatistics(t *testing.T) {
+	logTimes := []uint64{30, 10, 20, 40, 50}
+	t.Run("matching statistics", func(t *testing.T) {
+		for _, opts := range []*WriterOptions{
+			{},
+			{Chunked: true, ChunkSize: 50, Compression: CompressionZSTD},
+		} {
+			data := writeTestFile(t, opts, []string{"/a", "/b"}, logTimes)
+			diff, err := VerifyStatistics(bytes.NewReader(data), int64(len(data)))
+			assert.Nil(t, err)
+			assert.True(t, diff.Empty(), diff.Mismatches)
+			assert.Equal(t, uint64(5), diff.Actual.MessageCount)
+			assert.Equal(t, uint64(10), diff.Actual.MessageStartTime)
+			assert.Equal(t, uint64(50), diff.Actual.MessageEndTime)
+		}
+	})
+	t.Run("reports mismatches", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w, err := NewWriter(buf, &WriterOptions{Chunked: true, Compression: CompressionLZ4})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteHeader(&Header{}))
+		_, err = w.WriteSchema(&Schema{ID: 1})
+		assert.Nil(t, err)
+		_, err = w.WriteChannel(&Channel{ID: 1, SchemaID: 1, Topic: "/a"})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: 1}))
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: 2}))
+		w.Statistics.MessageCount = 3
+		w.Statistics.ChannelMessageCounts[1] = 1
+		assert.Nil(t, w.Close())
+		diff, err := VerifyStatistics(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.Nil(t, err)
+		assert.Equal(t, []StatisticsMismatch{
+			{Field: "MessageCount", Declared: 3, Actual: 2},
+			{Field: "ChannelMessageCounts[1]", Declared: 1, Actual: 2},
+		}, diff.Mismatches)
+	})
+	t.Run("missing statistics", func(t *testing.T) {
+		data := writeTestFile(t, &WriterOptions{SkipStatistics: true}, []string{"/a"}, logTimes)
+		_, err := VerifyStatistics(bytes.NewReader(data), int64(len(data)))
+		assert.ErrorIs(t, err, ErrNoStatistics)
+	})
+}
@@ -0,0 +1,75 @@
+package mcap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/foxglove/mcap/go/mcap/readopts"
+)
+
+// TimeWindow is the half-open interval of log times [Start, End).
+type TimeWindow struct {
+	Start uint64
+	End   uint64
+}
+
+// Windows groups the file's messages into consecutive windows of the given
+// duration in nanoseconds and calls f with each window and its messages, in
+// log time order. Windows are aligned to multiples of the duration, so that
+// windows of files covering the same time agree, and windows containing no
+// messages are skipped. Messages are read in log time order with the file's
+// index, which loads only the chunks overlapping the current read position;
+// the messages of a window are buffered until the window is complete, so
+// memory use grows with the number of messages in a window plus the
+// chunks overlapping it. The options select the messages as for Messages,
+// except that the read order may not be set. Errors returned by f stop the
+// iteration and are returned wrapped.
+func (r *Reader) Windows(duration uint64, f func(TimeWindow, []*Message) error, opts ...readopts.ReadOpt) error {
+	if duration == 0 {
+		return fmt.Errorf("window duration must be positive")
+	}
+	it, err := r.Messages(append(opts, readopts.InOrder(readopts.LogTimeOrder))...)
+	if err != nil {
+		return err
+	}
+	var window TimeWindow
+	var messages []*Message
+	flush := func() error {
+		if len(messages) == 0 {
+			return nil
+		}
+		if err := f(window, messages); err != nil {
+			return fmt.Errorf("failed to process window: %w", err)
+		}
+		messages = nil
+		return nil
+	}
+	for {
+		_, _, message, err := it.Next(nil)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return flush()
+			}
+			return fmt.Errorf("failed to read record: %w", err)
+		}
+		if len(messages) == 0 || message.LogTime >= window.End {
+			if err := flush(); err != nil {
+				return err
+			}
+			window = timeWindow(message.LogTime, duration)
+		}
+		messages = append(messages, message)
+	}
+}
+
+// timeWindow returns the window of the given duration containing t.
+func timeWindow(t uint64, duration uint64) TimeWindow {
+	start := t - t%duration
+	end := start + duration
+	if end < start {
+		end = math.MaxUint64
+	}
+	return TimeWindow{Start: start, End: end}
+}
@@ -0,0 +1,72 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/foxglove/mcap/go/mcap/readopts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderWindows(t *testing.T) {
+	logTimes := []uint64{50, 10, 70, 20, 30, 95, 5, 40, 61, 80, 100, 15, 12}
+	data := writeTestFile(t, &WriterOptions{
+		Chunked:     true,
+		ChunkSize:   64,
+		Compression: CompressionZSTD,
+	}, []string{"/a", "/b"}, logTimes)
+
+	readWindows := func(t *testing.T, duration uint64, opts ...readopts.ReadOpt) map[TimeWindow][]uint64 {
+		reader, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		windows := make(map[TimeWindow][]uint64)
+		var last TimeWindow
+		err = reader.Windows(duration, func(window TimeWindow, messages []*Message) error {
+			assert.GreaterOrEqual(t, window.Start, last.End)
+			last = window
+			for _, message := range messages {
+				windows[window] = append(windows[window], message.LogTime)
+			}
+			return nil
+		}, opts...)
+		assert.Nil(t, err)
+		return windows
+	}
+
+	t.Run("groups messages by aligned window", func(t *testing.T) {
+		assert.Equal(t, map[TimeWindow][]uint64{
+			{Start: 0, End: 20}:    {5, 10, 12, 15},
+			{Start: 20, End: 40}:   {20, 30},
+			{Start: 40, End: 60}:   {40, 50},
+			{Start: 60, End: 80}:   {61, 70},
+			{Start: 80, End: 100}:  {80, 95},
+			{Start: 100, End: 120}: {100},
+		}, readWindows(t, 20))
+	})
+	t.Run("applies read options", func(t *testing.T) {
+		// messages on /a have even indexes.
+		assert.Equal(t, map[TimeWindow][]uint64{
+			{Start: 0, End: 50}:    {5, 12, 30},
+			{Start: 50, End: 100}:  {50, 61, 70},
+			{Start: 100, End: 150}: {100},
+		}, readWindows(t, 50, readopts.WithTopics([]string{"/a"})))
+	})
+	t.Run("stops on callback error", func(t *testing.T) {
+		reader, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		stop := errors.New("stop")
+		calls := 0
+		err = reader.Windows(20, func(TimeWindow, []*Message) error {
+			calls++
+			return stop
+		})
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, 1, calls)
+	})
+	t.Run("rejects zero duration", func(t *testing.T) {
+		reader, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		assert.Error(t, reader.Windows(0, func(TimeWindow, []*Message) error { return nil }))
+	})
+}
@@ -29,6 +29,31 @@ func newWriteSizer(w io.Writer, calculateCRC bool) *writeSizer {
 	}
 }
 
+// Flush flushes the underlying writer, if it supports flushing.
+func (w *writeSizer) Flush() error {
+	if f, ok := w.out().(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// out returns the underlying writer.
+func (w *writeSizer) out() io.Writer {
+	if w.crc != nil {
+		return w.crc.w
+	}
+	return w.w
+}
+
+// rewind restores the size and checksum recorded at an earlier point in the
+// output, once the underlying writer has been seeked back to that point.
+func (w *writeSizer) rewind(size uint64, crc uint32) {
+	w.size = size
+	if w.crc != nil {
+		w.crc.crc = crc
+	}
+}
+
 func (w *writeSizer) Size() uint64 {
 	return w.size
 }
@@ -16,7 +16,26 @@ import (
 // ErrUnknownSchema is returned when a schema ID is not known to the writer.
 var ErrUnknownSchema = errors.New("unknown schema")
 
-// Writer is a writer for the MCAP format.
+// schemaKey identifies a schema by its content, for deduplication of repeated
+// schema definitions.
+type schemaKey struct {
+	name     string
+	encoding string
+	data     string
+}
+
+// channelKey identifies a channel by its content, for deduplication of
+// repeated channel definitions. The metadata is held in serialized form.
+type channelKey struct {
+	schemaID        uint16
+	topic           string
+	messageEncoding string
+	metadata        string
+}
+
+// Writer is a writer for the MCAP format. Unless checkpoints are written, the
+// Writer only ever appends to its output and never seeks, so it may be used
+// with forward-only destinations such as multipart object storage uploads.
 type Writer struct {
 	// Statistics collected over the course of the recording.
 	Statistics *Statistics
@@ -31,6 +50,10 @@ type Writer struct {
 	schemaIDs        []uint16
 	channels         map[uint16]*Channel
 	schemas          map[uint16]*Schema
+	schemaKeys       map[schemaKey]uint16
+	channelKeys      map[channelKey]uint16
+	schemaAliases    map[uint16]uint16
+	channelAliases   map[uint16]uint16
 	messageIndexes   map[uint16]*MessageIndex
 	w                *writeSizer
 	buf              []byte
@@ -39,12 +62,28 @@ type Writer struct {
 	uncompressed     *bytes.Buffer
 	compressed       *bytes.Buffer
 	compressedWriter *countingCRCWriter
+	// compression is the format chunks are compressed with. With
+	// AutoCompression, chunks are buffered uncompressed and compressed by
+	// autoCompression when flushed, until it has chosen a format.
+	compression     CompressionFormat
+	autoCompression *autoCompressor
 
 	currentChunkStartTime uint64
 	currentChunkEndTime   uint64
 
+	// chunkSize is the uncompressed size at which the active chunk is flushed.
+	// It is adjusted after each chunk when targeting a compressed chunk size.
+	chunkSize        int64
+	compressionRatio float64
+
 	opts *WriterOptions
 
+	// checkpointChunkCount is the chunk count at the last checkpoint, and
+	// checkpointEnd the furthest extent of the output written by a
+	// checkpoint.
+	checkpointChunkCount uint32
+	checkpointEnd        uint64
+
 	closed bool
 }
 
@@ -63,8 +102,17 @@ func (w *Writer) WriteHeader(header *Header) error {
 	w.ensureSized(msglen)
 	offset := putPrefixedString(w.msg, header.Profile)
 	offset += putPrefixedString(w.msg[offset:], library)
-	_, err := w.writeRecord(w.w, OpHeader, w.msg[:offset])
-	return err
+	if _, err := w.writeRecord(w.w, OpHeader, w.msg[:offset]); err != nil {
+		return err
+	}
+	if len(w.opts.ZSTDDictionary) > 0 {
+		metadata, err := zstdDictionaryMetadata(w.opts.ZSTDDictionary)
+		if err != nil {
+			return err
+		}
+		return w.WriteMetadata(metadata)
+	}
+	return nil
 }
 
 // Offset returns the current offset of the writer, or the size of the written
@@ -73,6 +121,85 @@ func (w *Writer) Offset() uint64 {
 	return w.w.Size()
 }
 
+// BufferedBytes returns the number of uncompressed bytes held in the active
+// chunk that have not yet been written to the output. It is zero for unchunked
+// writers.
+func (w *Writer) BufferedBytes() int64 {
+	if w.compressedWriter == nil {
+		return 0
+	}
+	return w.compressedWriter.Size()
+}
+
+// Flush closes the active chunk, if any, and writes it to the output. If the
+// output implements a Flush method, it is called afterward. Flush may be used
+// to align chunk boundaries with the part boundaries of a streaming upload.
+func (w *Writer) Flush() error {
+	if w.opts.Chunked && !w.closed {
+		if err := w.flushActiveChunk(); err != nil {
+			return err
+		}
+		if err := w.maybeCheckpoint(); err != nil {
+			return err
+		}
+	}
+	return w.w.Flush()
+}
+
+// Checkpoint writes a Data End record, a summary section describing the
+// records written so far, a footer and the closing magic, after closing the
+// active chunk, so that the output is a valid MCAP file at this point. The
+// output is then seeked back to the end of the data section, and writing
+// continues over the checkpoint, which is overwritten by subsequent records
+// and replaced by the next checkpoint or by Close. Checkpoint requires an
+// output that implements io.Seeker.
+func (w *Writer) Checkpoint() error {
+	if w.closed {
+		return fmt.Errorf("cannot checkpoint a closed writer")
+	}
+	seeker, ok := w.w.out().(io.Seeker)
+	if !ok {
+		return fmt.Errorf("checkpoints require a seekable output")
+	}
+	if w.opts.Chunked {
+		if err := w.flushActiveChunk(); err != nil {
+			return fmt.Errorf("failed to flush active chunk: %w", err)
+		}
+	}
+	dataEnd := w.w.Size()
+	dataSectionCRC := w.w.Checksum()
+	// the summary is written as on close, outside of any chunk.
+	w.closed = true
+	err := w.WriteDataEnd(&DataEnd{DataSectionCRC: dataSectionCRC})
+	if err == nil {
+		err = w.writeSummaryAndFooter()
+	}
+	w.closed = false
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	end := w.w.Size()
+	if end > w.checkpointEnd {
+		w.checkpointEnd = end
+	}
+	if _, err := seeker.Seek(-int64(end-dataEnd), io.SeekCurrent); err != nil {
+		return fmt.Errorf("failed to seek to end of data section: %w", err)
+	}
+	w.w.rewind(dataEnd, dataSectionCRC)
+	w.checkpointChunkCount = w.Statistics.ChunkCount
+	return nil
+}
+
+// maybeCheckpoint writes a checkpoint if opts.CheckpointEveryChunks chunks
+// have been written since the last one.
+func (w *Writer) maybeCheckpoint() error {
+	n := w.opts.CheckpointEveryChunks
+	if n <= 0 || w.Statistics.ChunkCount-w.checkpointChunkCount < uint32(n) {
+		return nil
+	}
+	return w.Checkpoint()
+}
+
 // WriteFooter writes a footer record to the output. A Footer record contains end-of-file
 // information. It must be the last record in the file. Readers using the index to read the file
 // will begin with by reading the footer and trailing magic.
@@ -96,10 +223,38 @@ func (w *Writer) WriteFooter(f *Footer) error {
 	return err
 }
 
-// WriteSchema writes a schema record to the output. Schema records are uniquely
-// identified within a file by their schema ID. A Schema record must occur at
-// least once in the file prior to any Channel Info referring to its ID.
-func (w *Writer) WriteSchema(s *Schema) (err error) {
+// WriteSchema writes a schema record to the output and returns its ID. Schema
+// records are uniquely identified within a file by their schema ID. A Schema
+// record must occur at least once in the file prior to any Channel Info
+// referring to its ID.
+//
+// Unless opts.SkipDeduplication is set, if a schema with the same name,
+// encoding and data has already been written, no record is written and the ID
+// of the existing schema is returned. Channels subsequently written with s.ID
+// refer to the existing schema.
+func (w *Writer) WriteSchema(s *Schema) (uint16, error) {
+	if w.opts.SkipDeduplication {
+		return s.ID, w.writeSchema(s)
+	}
+	key := schemaKey{name: s.Name, encoding: s.Encoding, data: string(s.Data)}
+	if id, ok := w.schemaKeys[key]; ok {
+		if _, known := w.schemas[s.ID]; !known && id != s.ID {
+			w.schemaAliases[s.ID] = id
+		}
+		return id, nil
+	}
+	_, known := w.schemas[s.ID]
+	if err := w.writeSchema(s); err != nil {
+		return 0, err
+	}
+	if !known {
+		w.schemaKeys[key] = s.ID
+		delete(w.schemaAliases, s.ID)
+	}
+	return s.ID, nil
+}
+
+func (w *Writer) writeSchema(s *Schema) (err error) {
 	msglen := 2 + 4 + len(s.Name) + 4 + len(s.Encoding) + 4 + len(s.Data)
 	w.ensureSized(msglen)
 	offset := putUint16(w.msg, s.ID)
@@ -114,25 +269,68 @@ func (w *Writer) WriteSchema(s *Schema) (err error) {
 	if err != nil {
 		return err
 	}
+	w.registerSchema(s)
+	return nil
+}
+
+// registerSchema records a schema written to the output, for the summary
+// section and statistics.
+func (w *Writer) registerSchema(s *Schema) {
 	if _, ok := w.schemas[s.ID]; !ok {
 		w.schemaIDs = append(w.schemaIDs, s.ID)
 		w.schemas[s.ID] = s
 		w.Statistics.SchemaCount++
 	}
-	return nil
 }
 
-// WriteChannel writes a channel info record to the output. Channel Info
-// records are uniquely identified within a file by their channel ID. A Channel
-// Info record must occur at least once in the file prior to any message
-// referring to its channel ID.
-func (w *Writer) WriteChannel(c *Channel) error {
+// WriteChannel writes a channel info record to the output and returns its ID.
+// Channel Info records are uniquely identified within a file by their channel
+// ID. A Channel Info record must occur at least once in the file prior to any
+// message referring to its channel ID.
+//
+// Unless opts.SkipDeduplication is set, if a channel with the same schema,
+// topic, message encoding and metadata has already been written, no record is
+// written and the ID of the existing channel is returned. Messages
+// subsequently written with c.ID are recorded on the existing channel.
+func (w *Writer) WriteChannel(c *Channel) (uint16, error) {
+	if id, ok := w.schemaAliases[c.SchemaID]; ok {
+		resolved := *c
+		resolved.SchemaID = id
+		c = &resolved
+	}
 	if c.SchemaID > 0 {
 		if _, ok := w.schemas[c.SchemaID]; !ok {
-			return ErrUnknownSchema
+			return 0, ErrUnknownSchema
 		}
 	}
 	userdata := makePrefixedMap(c.Metadata)
+	if w.opts.SkipDeduplication {
+		return c.ID, w.writeChannel(c, userdata)
+	}
+	key := channelKey{
+		schemaID:        c.SchemaID,
+		topic:           c.Topic,
+		messageEncoding: c.MessageEncoding,
+		metadata:        string(userdata),
+	}
+	if id, ok := w.channelKeys[key]; ok {
+		if _, known := w.channels[c.ID]; !known && id != c.ID {
+			w.channelAliases[c.ID] = id
+		}
+		return id, nil
+	}
+	_, known := w.channels[c.ID]
+	if err := w.writeChannel(c, userdata); err != nil {
+		return 0, err
+	}
+	if !known {
+		w.channelKeys[key] = c.ID
+		delete(w.channelAliases, c.ID)
+	}
+	return c.ID, nil
+}
+
+func (w *Writer) writeChannel(c *Channel, userdata []byte) error {
 	msglen := (2 +
 		4 + len(c.Topic) +
 		4 + len(c.MessageEncoding) +
@@ -156,12 +354,18 @@ func (w *Writer) WriteChannel(c *Channel) error {
 			return err
 		}
 	}
+	w.registerChannel(c)
+	return nil
+}
+
+// registerChannel records a channel written to the output, for the summary
+// section and statistics.
+func (w *Writer) registerChannel(c *Channel) {
 	if _, ok := w.channels[c.ID]; !ok {
 		w.Statistics.ChannelCount++
 		w.channels[c.ID] = c
 		w.channelIDs = append(w.channelIDs, c.ID)
 	}
-	return nil
 }
 
 // WriteMessage writes a message to the output. A message record encodes a
@@ -169,26 +373,29 @@ func (w *Writer) WriteChannel(c *Channel) error {
 // match that of the channel info record corresponding to the message's channel
 // ID.
 func (w *Writer) WriteMessage(m *Message) error {
-	if w.channels[m.ChannelID] == nil {
+	channelID := m.ChannelID
+	if id, ok := w.channelAliases[channelID]; ok {
+		channelID = id
+	}
+	if w.channels[channelID] == nil {
 		return fmt.Errorf("unrecognized channel %d", m.ChannelID)
 	}
 	msglen := 2 + 4 + 8 + 8 + len(m.Data)
 	w.ensureSized(msglen)
-	offset := putUint16(w.msg, m.ChannelID)
+	offset := putUint16(w.msg, channelID)
 	offset += putUint32(w.msg[offset:], m.Sequence)
 	offset += putUint64(w.msg[offset:], m.LogTime)
 	offset += putUint64(w.msg[offset:], m.PublishTime)
 	offset += copy(w.msg[offset:], m.Data)
-	w.Statistics.ChannelMessageCounts[m.ChannelID]++
-	w.Statistics.MessageCount++
+	w.observeMessage(channelID, m.LogTime)
 	if w.opts.Chunked && !w.closed {
-		idx, ok := w.messageIndexes[m.ChannelID]
+		idx, ok := w.messageIndexes[channelID]
 		if !ok {
 			idx = &MessageIndex{
-				ChannelID: m.ChannelID,
+				ChannelID: channelID,
 				Records:   nil,
 			}
-			w.messageIndexes[m.ChannelID] = idx
+			w.messageIndexes[channelID] = idx
 		}
 		idx.Add(m.LogTime, uint64(w.compressedWriter.Size()))
 		_, err := w.writeRecord(w.compressedWriter, OpMessage, w.msg[:offset])
@@ -201,11 +408,14 @@ func (w *Writer) WriteMessage(m *Message) error {
 		if m.LogTime < w.currentChunkStartTime {
 			w.currentChunkStartTime = m.LogTime
 		}
-		if w.compressedWriter.Size() > w.opts.ChunkSize {
+		if w.compressedWriter.Size() > w.chunkSize {
 			err := w.flushActiveChunk()
 			if err != nil {
 				return err
 			}
+			if err := w.maybeCheckpoint(); err != nil {
+				return err
+			}
 		}
 	} else {
 		_, err := w.writeRecord(w.w, OpMessage, w.msg[:offset])
@@ -213,13 +423,33 @@ func (w *Writer) WriteMessage(m *Message) error {
 			return err
 		}
 	}
-	if m.LogTime > w.Statistics.MessageEndTime {
-		w.Statistics.MessageEndTime = m.LogTime
+	return nil
+}
+
+// observeMessage updates the statistics for a message written to the output.
+func (w *Writer) observeMessage(channelID uint16, logTime uint64) {
+	stats := w.Statistics
+	if stats.MessageCount == 0 || logTime < stats.MessageStartTime {
+		stats.MessageStartTime = logTime
 	}
-	if m.LogTime < w.Statistics.MessageStartTime || w.Statistics.MessageStartTime == 0 {
-		w.Statistics.MessageStartTime = m.LogTime
+	if logTime > stats.MessageEndTime {
+		stats.MessageEndTime = logTime
 	}
-	return nil
+	stats.MessageCount++
+	stats.ChannelMessageCounts[channelID]++
+}
+
+// CurrentStatistics returns a snapshot of the statistics accumulated from the
+// records written so far. These are the statistics written to the summary
+// section on Close. Chunks are counted as they are flushed to the output, so
+// messages held in the active chunk are counted before the chunk is.
+func (w *Writer) CurrentStatistics() Statistics {
+	stats := *w.Statistics
+	stats.ChannelMessageCounts = make(map[uint16]uint64, len(w.Statistics.ChannelMessageCounts))
+	for k, v := range w.Statistics.ChannelMessageCounts {
+		stats.ChannelMessageCounts[k] = v
+	}
+	return stats
 }
 
 // WriteMessageIndex writes a message index record to the output. A Message
@@ -392,9 +622,17 @@ func (w *Writer) flushActiveChunk() error {
 		return err
 	}
 	crc := w.compressedWriter.CRC()
-	compressedlen := w.compressed.Len()
+	compression := w.compression
+	data := w.compressed.Bytes()
+	if w.autoCompression != nil {
+		compression, data, err = w.autoCompression.compress(data)
+		if err != nil {
+			return err
+		}
+	}
+	compressedlen := len(data)
 	uncompressedlen := w.compressedWriter.Size()
-	msglen := 8 + 8 + 8 + 4 + 4 + len(w.opts.Compression) + 8 + compressedlen
+	msglen := 8 + 8 + 8 + 4 + 4 + len(compression) + 8 + compressedlen
 	chunkStartOffset := w.w.Size()
 	start := w.currentChunkStartTime
 	end := w.currentChunkEndTime
@@ -415,9 +653,9 @@ func (w *Writer) flushActiveChunk() error {
 	offset += putUint64(w.chunk[offset:], end)
 	offset += putUint64(w.chunk[offset:], uint64(uncompressedlen))
 	offset += putUint32(w.chunk[offset:], crc)
-	offset += putPrefixedString(w.chunk[offset:], string(w.opts.Compression))
-	offset += putUint64(w.chunk[offset:], uint64(w.compressed.Len()))
-	offset += copy(w.chunk[offset:recordlen], w.compressed.Bytes())
+	offset += putPrefixedString(w.chunk[offset:], string(compression))
+	offset += putUint64(w.chunk[offset:], uint64(compressedlen))
+	offset += copy(w.chunk[offset:recordlen], data)
 	_, err = w.w.Write(w.chunk[:offset])
 	if err != nil {
 		return err
@@ -426,6 +664,11 @@ func (w *Writer) flushActiveChunk() error {
 	w.compressedWriter.Reset(w.compressed)
 	w.compressedWriter.ResetSize()
 	w.compressedWriter.ResetCRC()
+	if w.autoCompression != nil && w.autoCompression.done() {
+		if err := w.useCompression(w.autoCompression.selected); err != nil {
+			return err
+		}
+	}
 	chunkEndOffset := w.w.Size()
 
 	// message indexes
@@ -456,7 +699,7 @@ func (w *Writer) flushActiveChunk() error {
 		ChunkLength:         chunkEndOffset - chunkStartOffset,
 		MessageIndexOffsets: messageIndexOffsets,
 		MessageIndexLength:  messageIndexLength,
-		Compression:         w.opts.Compression,
+		Compression:         compression,
 		CompressedSize:      uint64(compressedlen),
 		UncompressedSize:    uint64(uncompressedlen),
 	})
@@ -466,9 +709,50 @@ func (w *Writer) flushActiveChunk() error {
 	w.Statistics.ChunkCount++
 	w.currentChunkStartTime = math.MaxUint64
 	w.currentChunkEndTime = 0
+	if w.opts.TargetCompressedChunkSize > 0 && compressedlen > 0 {
+		w.adaptChunkSize(float64(uncompressedlen) / float64(compressedlen))
+	}
 	return nil
 }
 
+// useCompression compresses later chunks in the format chosen by
+// AutoCompression, in place of buffering them uncompressed.
+func (w *Writer) useCompression(compression CompressionFormat) error {
+	encoder, err := newChunkCompressor(compression, w.compressed, w.opts)
+	if err != nil {
+		return err
+	}
+	w.compressedWriter = newCountingCRCWriter(encoder, w.opts.IncludeCRC)
+	w.compression = compression
+	w.autoCompression = nil
+	return nil
+}
+
+// maxChunkSizeFactor bounds the uncompressed chunk size, as a multiple of the
+// target compressed chunk size, to limit memory use on highly compressible
+// data.
+const maxChunkSizeFactor = 64
+
+// adaptChunkSize updates the uncompressed flush threshold from the compression
+// ratio achieved by the most recent chunk. The ratio is smoothed over recent
+// chunks so that a single outlier does not swing the chunk size.
+func (w *Writer) adaptChunkSize(ratio float64) {
+	if w.compressionRatio == 0 {
+		w.compressionRatio = ratio
+	} else {
+		w.compressionRatio = 0.5*w.compressionRatio + 0.5*ratio
+	}
+	target := w.opts.TargetCompressedChunkSize
+	chunkSize := int64(float64(target) * w.compressionRatio)
+	if chunkSize < target {
+		chunkSize = target
+	}
+	if chunkSize > target*maxChunkSizeFactor {
+		chunkSize = target * maxChunkSizeFactor
+	}
+	w.chunkSize = chunkSize
+}
+
 func makePrefixedMap(m map[string]string) []byte {
 	maplen := 0
 	mapkeys := make([]string, 0, len(m))
@@ -523,7 +807,7 @@ func (w *Writer) writeSummarySection() ([]*SummaryOffset, error) {
 			schemaOffset := w.w.Size()
 			for _, schemaID := range w.schemaIDs {
 				if schema, ok := w.schemas[schemaID]; ok {
-					err := w.WriteSchema(schema)
+					err := w.writeSchema(schema)
 					if err != nil {
 						return offsets, fmt.Errorf("failed to write schema: %w", err)
 					}
@@ -541,7 +825,7 @@ func (w *Writer) writeSummarySection() ([]*SummaryOffset, error) {
 			channelInfoOffset := w.w.Size()
 			for _, chanID := range w.channelIDs {
 				if channelInfo, ok := w.channels[chanID]; ok {
-					err := w.WriteChannel(channelInfo)
+					err := w.writeChannel(channelInfo, makePrefixedMap(channelInfo.Metadata))
 					if err != nil {
 						return offsets, fmt.Errorf("failed to write channel info: %w", err)
 					}
@@ -633,7 +917,33 @@ func (w *Writer) Close() error {
 	if err != nil {
 		return fmt.Errorf("failed to write data end: %w", err)
 	}
+	if err := w.writeSummaryAndFooter(); err != nil {
+		return err
+	}
+	if w.w.Size() < w.checkpointEnd {
+		return w.truncateCheckpoint()
+	}
+	return nil
+}
 
+// truncateCheckpoint removes the remainder of an earlier checkpoint that
+// extends beyond the end of the file.
+func (w *Writer) truncateCheckpoint() error {
+	out := w.w.out()
+	truncater, ok := out.(interface{ Truncate(size int64) error })
+	if !ok {
+		return fmt.Errorf("cannot truncate checkpoint data beyond end of file")
+	}
+	end, err := out.(io.Seeker).Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	return truncater.Truncate(end)
+}
+
+// writeSummaryAndFooter writes the summary section, the footer, and the
+// closing magic. It must follow the Data End record.
+func (w *Writer) writeSummaryAndFooter() error {
 	// summary section
 	w.w.ResetCRC() // reset CRC to begin computing summaryCrc
 	summarySectionStart := w.w.Size()
@@ -645,7 +955,7 @@ func (w *Writer) Close() error {
 		summarySectionStart = 0
 	}
 	var summaryOffsetStart uint64
-	if !w.opts.SkipSummaryOffsets {
+	if !w.opts.SkipSummaryOffsets && len(summaryOffsets) > 0 {
 		summaryOffsetStart = w.w.Size()
 		for _, summaryOffset := range summaryOffsets {
 			err := w.WriteSummaryOffset(summaryOffset)
@@ -697,6 +1007,48 @@ type WriterOptions struct {
 	ChunkSize int64
 	// Compression indicates the compression format to use for chunk compression.
 	Compression CompressionFormat
+	// CompressionLevel selects the level of chunk compression. It is mapped
+	// to the zstd encoder levels, from zstd.SpeedFastest to
+	// zstd.SpeedBestCompression, and to the lz4 levels, from lz4.Fast to
+	// lz4.Level9. It has no effect on uncompressed chunks. NewWriter rejects
+	// levels out of range.
+	CompressionLevel CompressionLevel
+	// TargetCompressedChunkSize specifies a target size for chunks after
+	// compression. If set, it takes precedence over ChunkSize: the uncompressed
+	// size at which chunks are flushed is adjusted after each chunk based on
+	// the compression ratio achieved by recent chunks, starting from the
+	// target size itself. Individual chunks may still miss the target when
+	// the compressibility of the data changes.
+	TargetCompressedChunkSize int64
+	// DeterministicCompression pins chunk compression to single-threaded
+	// encoding with fixed parameters, so that identical input and options
+	// produce byte-identical chunks. All of the writer's compression formats
+	// support it: the output of the zstd and lz4 encoders is then determined
+	// by the input, though it may change between versions of the compression
+	// libraries, and uncompressed chunks are always deterministic. Formats
+	// the writer does not support are rejected by NewWriter regardless.
+	DeterministicCompression bool
+	// AutoCompression causes the writer to choose the chunk compression
+	// format itself, in place of Compression. Each of the first few chunks
+	// is compressed with every format the writer supports, and written in
+	// the format chosen by CompressionSelector from the size and duration of
+	// the results so far. The format chosen after the last of these chunks
+	// is used for the rest of the file. Files written with it may therefore
+	// contain chunks in several formats, as readers allow. It requires a
+	// chunked writer, and is incompatible with DeterministicCompression,
+	// since the choice depends on timing, and with ZSTDDictionary.
+	AutoCompression bool
+	// CompressionSelector chooses the chunk compression format with
+	// AutoCompression. If nil, the format achieving the best compression
+	// ratio is chosen, unless a faster format comes within 10% of it.
+	CompressionSelector CompressionSelector
+	// ZSTDDictionary is a zstd dictionary with which to compress chunks,
+	// which improves the compression of small chunks whose contents resemble
+	// the data the dictionary was trained on. It requires zstd compression.
+	// The ID of the dictionary is recorded in a metadata record named
+	// ZSTDDictionaryMetadataName, written following the header, and readers
+	// must supply the same dictionary with LexerOptions.ZSTDDictionary.
+	ZSTDDictionary []byte
 
 	// SkipMessageIndexing skips the message and chunk indexes for a chunked
 	// file.
@@ -724,49 +1076,187 @@ type WriterOptions struct {
 	// SkipSummaryOffsets skips summary offset records.
 	SkipSummaryOffsets bool
 
+	// Minimal produces the smallest valid file, for append-only workflows
+	// that never seek: a header, the data section without message indexes,
+	// the data end record, and a footer with no summary section. It implies
+	// SkipMessageIndexing, SkipStatistics and all the other options skipping
+	// summary records, so that readers of the file must scan it in full, as
+	// with readopts.UsingIndex(false).
+	Minimal bool
+
 	// OverrideLibrary causes the default header library to be overridden, not
 	// appended to.
 	OverrideLibrary bool
+
+	// SkipDeduplication causes every call to WriteSchema and WriteChannel to
+	// write a record, even if an identical schema or channel has already been
+	// written under another ID.
+	SkipDeduplication bool
+
+	// CheckpointEveryChunks causes a checkpoint to be written, as by
+	// Writer.Checkpoint, each time this many chunks have been written since
+	// the last. It requires a chunked writer and a seekable output.
+	CheckpointEveryChunks int
+}
+
+// zstdLevels and lz4Levels map compression levels to the levels of the
+// encoders.
+var (
+	zstdLevels = [...]zstd.EncoderLevel{
+		CompressionLevelDefault:  zstd.SpeedFastest,
+		CompressionLevelFastest:  zstd.SpeedFastest,
+		CompressionLevelBalanced: zstd.SpeedDefault,
+		CompressionLevelBetter:   zstd.SpeedBetterCompression,
+		CompressionLevelBest:     zstd.SpeedBestCompression,
+	}
+	lz4Levels = [...]lz4.CompressionLevel{
+		CompressionLevelDefault:  lz4.Fast,
+		CompressionLevelFastest:  lz4.Fast,
+		CompressionLevelBalanced: lz4.Level3,
+		CompressionLevelBetter:   lz4.Level6,
+		CompressionLevelBest:     lz4.Level9,
+	}
+)
+
+// newChunkCompressor returns an encoder of chunk records in the given format
+// into buf.
+func newChunkCompressor(compression CompressionFormat, buf *bytes.Buffer, opts *WriterOptions) (resettableWriteCloser, error) {
+	switch compression {
+	case CompressionZSTD:
+		zstdOpts := []zstd.EOption{zstd.WithEncoderLevel(zstdLevels[opts.CompressionLevel])}
+		if opts.DeterministicCompression {
+			zstdOpts = append(zstdOpts, zstd.WithEncoderConcurrency(1), zstd.WithEncoderCRC(true))
+		}
+		if len(opts.ZSTDDictionary) > 0 {
+			zstdOpts = append(zstdOpts, zstd.WithEncoderDict(opts.ZSTDDictionary))
+		}
+		zw, err := zstd.NewWriter(buf, zstdOpts...)
+		if err != nil {
+			return nil, err
+		}
+		return zw, nil
+	case CompressionLZ4:
+		lw := lz4.NewWriter(buf)
+		if err := lw.Apply(lz4.CompressionLevelOption(lz4Levels[opts.CompressionLevel])); err != nil {
+			return nil, err
+		}
+		if opts.DeterministicCompression {
+			err := lw.Apply(
+				lz4.ConcurrencyOption(1),
+				lz4.BlockSizeOption(lz4.Block4Mb),
+				lz4.ChecksumOption(true),
+			)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return lw, nil
+	case CompressionNone:
+		return bufCloser{buf}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression")
+	}
 }
 
 // NewWriter returns a new MCAP writer.
 func NewWriter(w io.Writer, opts *WriterOptions) (*Writer, error) {
-	writer := newWriteSizer(w, opts.IncludeCRC)
-	if _, err := writer.Write(Magic); err != nil {
+	writer, err := newWriter(w, opts)
+	if err != nil {
 		return nil, err
 	}
+	if _, err := writer.w.Write(Magic); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+// newWriter returns a writer to w, without writing the leading magic.
+func newWriter(w io.Writer, opts *WriterOptions) (*Writer, error) {
+	if opts.CheckpointEveryChunks > 0 {
+		if !opts.Chunked {
+			return nil, fmt.Errorf("CheckpointEveryChunks requires a chunked writer")
+		}
+		if _, ok := w.(io.Seeker); !ok {
+			return nil, fmt.Errorf("checkpoints require a seekable output")
+		}
+	}
+	if opts.CompressionLevel < CompressionLevelDefault || opts.CompressionLevel > CompressionLevelBest {
+		return nil, fmt.Errorf("compression level %d out of range [%d, %d]",
+			opts.CompressionLevel, CompressionLevelDefault, CompressionLevelBest)
+	}
+	if len(opts.ZSTDDictionary) > 0 {
+		if !opts.Chunked || opts.Compression != CompressionZSTD {
+			return nil, fmt.Errorf("ZSTDDictionary requires zstd chunk compression")
+		}
+		if _, err := ZSTDDictionaryID(opts.ZSTDDictionary); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Minimal {
+		opts.SkipMessageIndexing = true
+		opts.SkipStatistics = true
+		opts.SkipRepeatedSchemas = true
+		opts.SkipRepeatedChannelInfos = true
+		opts.SkipAttachmentIndex = true
+		opts.SkipMetadataIndex = true
+		opts.SkipChunkIndex = true
+		opts.SkipSummaryOffsets = true
+	}
+	if opts.AutoCompression {
+		if !opts.Chunked {
+			return nil, fmt.Errorf("AutoCompression requires a chunked writer")
+		}
+		if opts.DeterministicCompression || len(opts.ZSTDDictionary) > 0 {
+			return nil, fmt.Errorf("AutoCompression is incompatible with DeterministicCompression and ZSTDDictionary")
+		}
+	}
+	writer := newWriteSizer(w, opts.IncludeCRC)
 	compressed := bytes.Buffer{}
 	var compressedWriter *countingCRCWriter
+	var compression CompressionFormat
+	var auto *autoCompressor
 	if opts.Chunked {
-		switch opts.Compression {
-		case CompressionZSTD:
-			zw, err := zstd.NewWriter(&compressed, zstd.WithEncoderLevel(zstd.SpeedFastest))
+		compression = opts.Compression
+		if opts.AutoCompression {
+			// chunks are buffered uncompressed until a format is chosen.
+			compression = CompressionNone
+			var err error
+			auto, err = newAutoCompressor(opts)
 			if err != nil {
 				return nil, err
 			}
-			compressedWriter = newCountingCRCWriter(zw, opts.IncludeCRC)
-		case CompressionLZ4:
-			compressedWriter = newCountingCRCWriter(lz4.NewWriter(&compressed), opts.IncludeCRC)
-		case CompressionNone:
-			compressedWriter = newCountingCRCWriter(bufCloser{&compressed}, opts.IncludeCRC)
-		default:
-			return nil, fmt.Errorf("unsupported compression")
 		}
+		encoder, err := newChunkCompressor(compression, &compressed, opts)
+		if err != nil {
+			return nil, err
+		}
+		compressedWriter = newCountingCRCWriter(encoder, opts.IncludeCRC)
 		if opts.ChunkSize == 0 {
 			opts.ChunkSize = 1024 * 1024
 		}
 	}
+	chunkSize := opts.ChunkSize
+	if opts.TargetCompressedChunkSize > 0 {
+		chunkSize = opts.TargetCompressedChunkSize
+	}
 	return &Writer{
 		w:                     writer,
 		buf:                   make([]byte, 32),
 		channels:              make(map[uint16]*Channel),
 		schemas:               make(map[uint16]*Schema),
+		schemaKeys:            make(map[schemaKey]uint16),
+		channelKeys:           make(map[channelKey]uint16),
+		schemaAliases:         make(map[uint16]uint16),
+		channelAliases:        make(map[uint16]uint16),
 		messageIndexes:        make(map[uint16]*MessageIndex),
 		uncompressed:          &bytes.Buffer{},
 		compressed:            &compressed,
 		compressedWriter:      compressedWriter,
+		compression:           compression,
+		autoCompression:       auto,
 		currentChunkStartTime: math.MaxUint64,
 		currentChunkEndTime:   0,
+		chunkSize:             chunkSize,
 		Statistics: &Statistics{
 			ChannelMessageCounts: make(map[uint16]uint64),
 			MessageStartTime:     0,
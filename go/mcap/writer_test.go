@@ -3,10 +3,17 @@ package mcap
 import (
 	"bytes"
 	"crypto/md5"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/foxglove/mcap/go/mcap/readopts"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -40,7 +47,7 @@ func TestMCAPReadWrite(t *testing.T) {
 		buf := &bytes.Buffer{}
 		w, err := NewWriter(buf, &WriterOptions{Compression: CompressionLZ4})
 		assert.Nil(t, err)
-		err = w.WriteChannel(&Channel{
+		_, err = w.WriteChannel(&Channel{
 			ID:              0,
 			SchemaID:        0,
 			Topic:           "/foo",
@@ -55,7 +62,7 @@ func TestMCAPReadWrite(t *testing.T) {
 		buf := &bytes.Buffer{}
 		w, err := NewWriter(buf, &WriterOptions{Compression: CompressionLZ4})
 		assert.Nil(t, err)
-		err = w.WriteChannel(&Channel{
+		_, err = w.WriteChannel(&Channel{
 			ID:              0,
 			SchemaID:        1,
 			Topic:           "/foo",
@@ -84,20 +91,22 @@ func TestOutputDeterminism(t *testing.T) {
 			Profile: "ros1",
 			Library: libraryString,
 		}))
-		assert.Nil(t, w.WriteSchema(&Schema{
+		_, err = w.WriteSchema(&Schema{
 			ID:       1,
 			Name:     "foo",
 			Encoding: "ros1msg",
 			Data:     []byte{},
-		}))
+		})
+		assert.Nil(t, err)
 		for i := 0; i < 3; i++ {
-			assert.Nil(t, w.WriteChannel(&Channel{
+			_, err = w.WriteChannel(&Channel{
 				ID:              uint16(i),
 				Topic:           fmt.Sprintf("/test-%d", i),
 				MessageEncoding: "ros1",
 				SchemaID:        1,
 				Metadata:        map[string]string{},
-			}))
+			})
+			assert.Nil(t, err)
 		}
 		for i := 0; i < 1000; i++ {
 			channelID := uint16(i % 3)
@@ -156,13 +165,14 @@ func TestChunkedReadWrite(t *testing.T) {
 				Profile: "ros1",
 				Library: libraryString,
 			}))
-			assert.Nil(t, w.WriteSchema(&Schema{
+			_, err = w.WriteSchema(&Schema{
 				ID:       1,
 				Name:     "schema",
 				Encoding: "msg",
 				Data:     []byte{},
-			}))
-			assert.Nil(t, w.WriteChannel(&Channel{
+			})
+			assert.Nil(t, err)
+			_, err = w.WriteChannel(&Channel{
 				ID:              1,
 				Topic:           "/test",
 				MessageEncoding: "ros1",
@@ -170,7 +180,8 @@ func TestChunkedReadWrite(t *testing.T) {
 				Metadata: map[string]string{
 					"callerid": "100", // cspell:disable-line
 				},
-			}))
+			})
+			assert.Nil(t, err)
 			assert.Nil(t, w.WriteMessage(&Message{
 				ChannelID:   1,
 				Sequence:    0,
@@ -236,13 +247,14 @@ func TestChunkBoundaryIndexing(t *testing.T) {
 		Library: libraryString,
 	})
 	assert.Nil(t, err)
-	assert.Nil(t, w.WriteSchema(&Schema{
+	_, err = w.WriteSchema(&Schema{
 		ID:       1,
 		Name:     "schema",
 		Data:     []byte{},
 		Encoding: "msg",
-	}))
-	err = w.WriteChannel(&Channel{
+	})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{
 		ID:              1,
 		SchemaID:        1,
 		Topic:           "/test",
@@ -286,13 +298,14 @@ func TestIndexStructures(t *testing.T) {
 		Library: libraryString,
 	})
 	assert.Nil(t, err)
-	assert.Nil(t, w.WriteSchema(&Schema{
+	_, err = w.WriteSchema(&Schema{
 		ID:       1,
 		Name:     "schema",
 		Data:     []byte{},
 		Encoding: "msg",
-	}))
-	err = w.WriteChannel(&Channel{
+	})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{
 		ID:              1,
 		SchemaID:        1,
 		Topic:           "/test",
@@ -360,19 +373,21 @@ func TestStatistics(t *testing.T) {
 		Profile: "ros1",
 		Library: libraryString,
 	}))
-	assert.Nil(t, w.WriteSchema(&Schema{
+	_, err = w.WriteSchema(&Schema{
 		ID:       1,
 		Name:     "schema",
 		Encoding: "msg",
 		Data:     []byte{},
-	}))
-	assert.Nil(t, w.WriteChannel(&Channel{
+	})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{
 		ID:              1,
 		SchemaID:        1,
 		Topic:           "/test",
 		MessageEncoding: "ros1",
 		Metadata:        make(map[string]string),
-	}))
+	})
+	assert.Nil(t, err)
 	for i := 0; i < 1000; i++ {
 		assert.Nil(t, w.WriteMessage(&Message{
 			ChannelID:   1,
@@ -406,14 +421,14 @@ func TestUnchunkedReadWrite(t *testing.T) {
 		Library: libraryString,
 	})
 	assert.Nil(t, err)
-	err = w.WriteSchema(&Schema{
+	_, err = w.WriteSchema(&Schema{
 		ID:       1,
 		Name:     "schema",
 		Encoding: "msg",
 		Data:     []byte{},
 	})
 	assert.Nil(t, err)
-	err = w.WriteChannel(&Channel{
+	_, err = w.WriteChannel(&Channel{
 		ID:              1,
 		SchemaID:        1,
 		Topic:           "/test",
@@ -581,13 +596,14 @@ func BenchmarkWriterAllocs(b *testing.B) {
 					Library: "foo",
 				}))
 				for i := 0; i < c.channelCount; i++ {
-					assert.Nil(b, writer.WriteSchema(&Schema{
+					_, err = writer.WriteSchema(&Schema{
 						ID:       uint16(i),
 						Name:     stringData,
 						Encoding: "ros1msg",
 						Data:     messageData,
-					}))
-					assert.Nil(b, writer.WriteChannel(&Channel{
+					})
+					assert.Nil(b, err)
+					_, err = writer.WriteChannel(&Channel{
 						ID:              uint16(i),
 						SchemaID:        uint16(i),
 						Topic:           stringData,
@@ -595,7 +611,8 @@ func BenchmarkWriterAllocs(b *testing.B) {
 						Metadata: map[string]string{
 							"": "",
 						},
-					}))
+					})
+					assert.Nil(b, err)
 				}
 				channelID := 0
 				messageCount := 0
@@ -618,3 +635,506 @@ func BenchmarkWriterAllocs(b *testing.B) {
 		})
 	}
 }
+
+type flushCountingWriter struct {
+	bytes.Buffer
+	flushes int
+}
+
+func (w *flushCountingWriter) Flush() error {
+	w.flushes++
+	return nil
+}
+
+func TestWriterFlush(t *testing.T) {
+	out := &flushCountingWriter{}
+	w, err := NewWriter(out, &WriterOptions{
+		Chunked:     true,
+		ChunkSize:   1024 * 1024,
+		Compression: CompressionZSTD,
+		IncludeCRC:  true,
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	_, err = w.WriteSchema(&Schema{ID: 1, Name: "schema", Encoding: "msg", Data: []byte{}})
+	assert.Nil(t, err)
+	_, err = w.WriteChannel(&Channel{ID: 1, SchemaID: 1, Topic: "/test", MessageEncoding: "ros1"})
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: uint64(i), Data: []byte("hello")}))
+	}
+	assert.Greater(t, w.BufferedBytes(), int64(0))
+	sizeBeforeFlush := out.Len()
+	assert.Nil(t, w.Flush())
+	assert.Equal(t, int64(0), w.BufferedBytes())
+	assert.Greater(t, out.Len(), sizeBeforeFlush)
+	assert.Equal(t, 1, out.flushes)
+	assert.Equal(t, int(w.Offset()), out.Len())
+
+	// flushing with no active chunk is a no-op for the chunk
+	assert.Nil(t, w.Flush())
+	assert.Equal(t, 1, len(w.ChunkIndexes))
+
+	assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: 10, Data: []byte("hello")}))
+	assert.Nil(t, w.Close())
+	assert.Equal(t, 2, len(w.ChunkIndexes))
+
+	reader, err := NewReader(bytes.NewReader(out.Bytes()))
+	assert.Nil(t, err)
+	it, err := reader.Messages(readopts.UsingIndex(true))
+	assert.Nil(t, err)
+	count := 0
+	for {
+		_, _, _, err := it.Next(nil)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.Nil(t, err)
+		count++
+	}
+	assert.Equal(t, 11, count)
+}
+
+func TestSummaryOmitsEmptyIndexGroups(t *testing.T) {
+	data := writeTestFile(t, &WriterOptions{Chunked: true, Compression: CompressionZSTD}, []string{"/a"}, []uint64{1, 2})
+	lexer, err := NewLexer(bytes.NewReader(data), &LexerOptions{EmitChunks: true})
+	assert.Nil(t, err)
+	var groups []OpCode
+	for {
+		tokenType, record, err := lexer.Next(nil)
+		assert.Nil(t, err)
+		assert.NotEqual(t, TokenAttachmentIndex, tokenType)
+		assert.NotEqual(t, TokenMetadataIndex, tokenType)
+		if tokenType == TokenSummaryOffset {
+			summaryOffset, err := ParseSummaryOffset(record)
+			assert.Nil(t, err)
+			assert.Greater(t, summaryOffset.GroupLength, uint64(0))
+			// every record in the group has the group's opcode
+			group := data[summaryOffset.GroupStart : summaryOffset.GroupStart+summaryOffset.GroupLength]
+			for len(group) > 0 {
+				assert.Equal(t, summaryOffset.GroupOpcode, OpCode(group[0]))
+				group = group[9+binary.LittleEndian.Uint64(group[1:9]):]
+			}
+			groups = append(groups, summaryOffset.GroupOpcode)
+		}
+		if tokenType == TokenFooter {
+			break
+		}
+	}
+	assert.Equal(t, []OpCode{OpSchema, OpChannel, OpStatistics, OpChunkIndex}, groups)
+
+	t.Run("no summary offsets without groups", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w, err := NewWriter(buf, &WriterOptions{SkipStatistics: true})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteHeader(&Header{}))
+		assert.Nil(t, w.Close())
+		footerStart := buf.Len() - len(Magic) - 8 - 8 - 4
+		footer, err := ParseFooter(buf.Bytes()[footerStart : buf.Len()-len(Magic)])
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(0), footer.SummaryStart)
+		assert.Equal(t, uint64(0), footer.SummaryOffsetStart)
+	})
+}
+
+func TestWriterMinimal(t *testing.T) {
+	logTimes := []uint64{1, 2, 3, 4, 5, 6}
+	data := writeTestFile(t, &WriterOptions{
+		Chunked:     true,
+		ChunkSize:   100,
+		Compression: CompressionZSTD,
+		IncludeCRC:  true,
+		Minimal:     true,
+	}, []string{"/a", "/b"}, logTimes)
+	lexer, err := NewLexer(bytes.NewReader(data), &LexerOptions{ValidateCRC: true})
+	assert.Nil(t, err)
+	var tokens []TokenType
+	var footer *Footer
+	for {
+		tokenType, record, err := lexer.Next(nil)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.Nil(t, err)
+		switch tokenType {
+		case TokenHeader, TokenSchema, TokenChannel, TokenMessage, TokenDataEnd:
+		case TokenFooter:
+			footer, err = ParseFooter(record)
+			assert.Nil(t, err)
+		default:
+			t.Errorf("unexpected %s in minimal file", tokenType)
+		}
+		tokens = append(tokens, tokenType)
+	}
+	assert.Equal(t, TokenHeader, tokens[0])
+	assert.Equal(t, []TokenType{TokenDataEnd, TokenFooter}, tokens[len(tokens)-2:])
+	assert.Equal(t, uint64(0), footer.SummaryStart)
+	assert.Equal(t, uint64(0), footer.SummaryOffsetStart)
+	assert.Nil(t, ValidateTrailingMagic(bytes.NewReader(data), int64(len(data))))
+
+	// without a summary, messages can only be read by scanning the file.
+	reader, err := NewReader(bytes.NewReader(data))
+	assert.Nil(t, err)
+	it, err := reader.Messages(readopts.UsingIndex(false))
+	assert.Nil(t, err)
+	count := 0
+	for {
+		_, _, _, err := it.Next(nil)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		assert.Nil(t, err)
+		count++
+	}
+	assert.Equal(t, len(logTimes), count)
+}
+
+func TestTargetCompressedChunkSize(t *testing.T) {
+	for _, compression := range []CompressionFormat{CompressionZSTD, CompressionLZ4} {
+		t.Run(string(compression), func(t *testing.T) {
+			target := int64(16 * 1024)
+			buf := &bytes.Buffer{}
+			w, err := NewWriter(buf, &WriterOptions{
+				Chunked:                   true,
+				Compression:               compression,
+				TargetCompressedChunkSize: target,
+			})
+			assert.Nil(t, err)
+			assert.Nil(t, w.WriteHeader(&Header{}))
+			_, err = w.WriteSchema(&Schema{ID: 1})
+			assert.Nil(t, err)
+			_, err = w.WriteChannel(&Channel{ID: 1, SchemaID: 1, Topic: "/a"})
+			assert.Nil(t, err)
+			// repeated random segments compress to a fraction of their size.
+			rng := rand.New(rand.NewSource(0))
+			segment := make([]byte, 64)
+			for i := 0; i < 4000; i++ {
+				_, _ = rng.Read(segment)
+				data := bytes.Repeat(segment, 8)
+				assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: uint64(i), Data: data}))
+			}
+			assert.Nil(t, w.Close())
+			assert.Greater(t, len(w.ChunkIndexes), 5)
+			// the first chunk is flushed at the target uncompressed size, and
+			// the last chunk is partial.
+			assert.Less(t, w.ChunkIndexes[0].CompressedSize, uint64(target/2))
+			for _, chunkIndex := range w.ChunkIndexes[2 : len(w.ChunkIndexes)-1] {
+				assert.InDelta(t, target, chunkIndex.CompressedSize, float64(target)/4)
+				assert.Greater(t, chunkIndex.UncompressedSize, 2*chunkIndex.CompressedSize)
+			}
+		})
+	}
+}
+
+func TestWriterDeduplicatesDefinitions(t *testing.T) {
+	t.Run("repeated definitions are written once", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w, err := NewWriter(buf, &WriterOptions{Chunked: true, Compression: CompressionZSTD})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteHeader(&Header{}))
+		for i := 0; i < 3; i++ {
+			schemaID, err := w.WriteSchema(&Schema{ID: 1, Name: "schema", Encoding: "jsonschema", Data: []byte("{}")})
+			assert.Nil(t, err)
+			assert.Equal(t, uint16(1), schemaID)
+			channelID, err := w.WriteChannel(&Channel{
+				ID:              1,
+				SchemaID:        1,
+				Topic:           "/a",
+				MessageEncoding: "json",
+				Metadata:        map[string]string{"foo": "bar"},
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, uint16(1), channelID)
+			assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: uint64(i)}))
+		}
+		assert.Nil(t, w.Close())
+		assert.Equal(t, uint16(1), w.Statistics.SchemaCount)
+		assert.Equal(t, uint32(1), w.Statistics.ChannelCount)
+		counts, err := RecordCounts(bytes.NewReader(buf.Bytes()))
+		assert.Nil(t, err)
+		// one in the data section, and one repeated in the summary.
+		assert.Equal(t, uint64(2), counts[OpSchema])
+		assert.Equal(t, uint64(2), counts[OpChannel])
+	})
+	t.Run("identical definitions under new IDs return the existing ID", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w, err := NewWriter(buf, &WriterOptions{Chunked: true, Compression: CompressionZSTD})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteHeader(&Header{}))
+		_, err = w.WriteSchema(&Schema{ID: 1, Name: "schema", Encoding: "jsonschema", Data: []byte("{}")})
+		assert.Nil(t, err)
+		_, err = w.WriteChannel(&Channel{ID: 1, SchemaID: 1, Topic: "/a", MessageEncoding: "json"})
+		assert.Nil(t, err)
+		schemaID, err := w.WriteSchema(&Schema{ID: 2, Name: "schema", Encoding: "jsonschema", Data: []byte("{}")})
+		assert.Nil(t, err)
+		assert.Equal(t, uint16(1), schemaID)
+		channelID, err := w.WriteChannel(&Channel{ID: 2, SchemaID: 2, Topic: "/a", MessageEncoding: "json"})
+		assert.Nil(t, err)
+		assert.Equal(t, uint16(1), channelID)
+		channelID, err = w.WriteChannel(&Channel{ID: 3, SchemaID: 2, Topic: "/b", MessageEncoding: "json"})
+		assert.Nil(t, err)
+		assert.Equal(t, uint16(3), channelID)
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: 1}))
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: 2, LogTime: 2}))
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: 3, LogTime: 3}))
+		assert.Nil(t, w.Close())
+
+		reader, err := NewReader(bytes.NewReader(buf.Bytes()))
+		assert.Nil(t, err)
+		info, err := reader.Info()
+		assert.Nil(t, err)
+		assert.Equal(t, 1, len(info.Schemas))
+		assert.Equal(t, 2, len(info.Channels))
+		assert.Equal(t, uint16(1), info.Channels[3].SchemaID)
+		assert.Equal(t, uint64(2), info.Statistics.ChannelMessageCounts[1])
+		assert.Equal(t, uint64(1), info.Statistics.ChannelMessageCounts[3])
+	})
+	t.Run("deduplication can be skipped", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w, err := NewWriter(buf, &WriterOptions{
+			Chunked:           true,
+			Compression:       CompressionZSTD,
+			SkipDeduplication: true,
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteHeader(&Header{}))
+		for _, id := range []uint16{1, 2} {
+			schemaID, err := w.WriteSchema(&Schema{ID: id, Name: "schema"})
+			assert.Nil(t, err)
+			assert.Equal(t, id, schemaID)
+			channelID, err := w.WriteChannel(&Channel{ID: id, SchemaID: id, Topic: "/a"})
+			assert.Nil(t, err)
+			assert.Equal(t, id, channelID)
+		}
+		assert.Nil(t, w.Close())
+		assert.Equal(t, uint16(2), w.Statistics.SchemaCount)
+		assert.Equal(t, uint32(2), w.Statistics.ChannelCount)
+	})
+}
+
+func TestWriterCheckpoints(t *testing.T) {
+	writeFile := func(t *testing.T, w io.Writer, opts *WriterOptions, messages int, atCheckpoint func(*Writer)) {
+		writer, err := NewWriter(w, opts)
+		assert.Nil(t, err)
+		assert.Nil(t, writer.WriteHeader(&Header{Profile: "test"}))
+		_, err = writer.WriteSchema(&Schema{ID: 1, Name: "schema", Encoding: "jsonschema", Data: []byte("{}")})
+		assert.Nil(t, err)
+		_, err = writer.WriteChannel(&Channel{ID: 1, SchemaID: 1, Topic: "/a", MessageEncoding: "json"})
+		assert.Nil(t, err)
+		for i := 0; i < messages; i++ {
+			chunks := writer.Statistics.ChunkCount
+			assert.Nil(t, writer.WriteMessage(&Message{ChannelID: 1, LogTime: uint64(i), Data: []byte("hello")}))
+			if atCheckpoint != nil && writer.Statistics.ChunkCount != chunks && writer.Statistics.ChunkCount%2 == 0 {
+				atCheckpoint(writer)
+			}
+		}
+		assert.Nil(t, writer.Close())
+	}
+	countMessages := func(t *testing.T, data []byte) uint64 {
+		reader, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		info, err := reader.Info()
+		assert.Nil(t, err)
+		it, err := reader.Messages()
+		assert.Nil(t, err)
+		var count uint64
+		assert.Nil(t, Range(it, func(*Schema, *Channel, *Message) error {
+			count++
+			return nil
+		}))
+		assert.Equal(t, info.Statistics.MessageCount, count)
+		return count
+	}
+	opts := func() *WriterOptions {
+		return &WriterOptions{
+			Chunked:     true,
+			ChunkSize:   100,
+			Compression: CompressionZSTD,
+			IncludeCRC:  true,
+		}
+	}
+	expected := &bytes.Buffer{}
+	writeFile(t, expected, opts(), 50, nil)
+
+	t.Run("file is valid at each checkpoint", func(t *testing.T) {
+		f, err := os.Create(filepath.Join(t.TempDir(), "checkpoints.mcap"))
+		assert.Nil(t, err)
+		defer f.Close()
+		checkpointOpts := opts()
+		checkpointOpts.CheckpointEveryChunks = 2
+		checkpoints := 0
+		writeFile(t, f, checkpointOpts, 50, func(w *Writer) {
+			checkpoints++
+			data, err := os.ReadFile(f.Name())
+			assert.Nil(t, err)
+			assert.Nil(t, TeeValidate(io.Discard, io.Discard, bytes.NewReader(data)))
+			assert.Equal(t, w.Statistics.MessageCount, countMessages(t, data))
+		})
+		assert.Greater(t, checkpoints, 1)
+		data, err := os.ReadFile(f.Name())
+		assert.Nil(t, err)
+		assert.Equal(t, expected.Bytes(), data)
+	})
+	t.Run("truncates a longer checkpoint", func(t *testing.T) {
+		f, err := os.Create(filepath.Join(t.TempDir(), "truncate.mcap"))
+		assert.Nil(t, err)
+		defer f.Close()
+		writer, err := NewWriter(f, &WriterOptions{})
+		assert.Nil(t, err)
+		assert.Nil(t, writer.WriteHeader(&Header{}))
+		assert.Nil(t, writer.WriteMetadata(&Metadata{Name: "a long metadata name"}))
+		assert.Nil(t, writer.Checkpoint())
+		// drop the metadata index, so that the final summary is shorter.
+		writer.MetadataIndexes = nil
+		assert.Nil(t, writer.Close())
+		data, err := os.ReadFile(f.Name())
+		assert.Nil(t, err)
+		assert.Equal(t, int(writer.Offset()), len(data))
+		assert.Nil(t, TeeValidate(io.Discard, io.Discard, bytes.NewReader(data)))
+	})
+	t.Run("requires a seekable output", func(t *testing.T) {
+		checkpointOpts := opts()
+		checkpointOpts.CheckpointEveryChunks = 2
+		_, err := NewWriter(&bytes.Buffer{}, checkpointOpts)
+		assert.Error(t, err)
+		writer, err := NewWriter(&bytes.Buffer{}, opts())
+		assert.Nil(t, err)
+		assert.Error(t, writer.Checkpoint())
+	})
+}
+
+func TestWriterCurrentStatistics(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, &WriterOptions{Chunked: true, ChunkSize: 1024, Compression: CompressionZSTD})
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	_, err = w.WriteSchema(&Schema{ID: 1, Name: "schema", Encoding: "jsonschema", Data: []byte("{}")})
+	assert.Nil(t, err)
+	for _, id := range []uint16{1, 2} {
+		_, err = w.WriteChannel(&Channel{ID: id, SchemaID: 1, Topic: fmt.Sprintf("/%d", id), MessageEncoding: "json"})
+		assert.Nil(t, err)
+	}
+	// the earliest log time is zero, and is not the first written.
+	for i, logTime := range []uint64{5, 0, 3, 9} {
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: uint16(i%2 + 1), LogTime: logTime}))
+	}
+	assert.Nil(t, w.WriteAttachment(&Attachment{Name: "a"}))
+	assert.Nil(t, w.WriteMetadata(&Metadata{Name: "m"}))
+
+	snapshot := w.CurrentStatistics()
+	assert.Equal(t, Statistics{
+		MessageCount:         4,
+		SchemaCount:          1,
+		ChannelCount:         2,
+		AttachmentCount:      1,
+		MetadataCount:        1,
+		ChunkCount:           0,
+		MessageStartTime:     0,
+		MessageEndTime:       9,
+		ChannelMessageCounts: map[uint16]uint64{1: 2, 2: 2},
+	}, snapshot)
+	assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: 10}))
+	assert.Equal(t, uint64(2), snapshot.ChannelMessageCounts[1])
+	assert.Nil(t, w.Close())
+	assert.Equal(t, uint32(1), w.CurrentStatistics().ChunkCount)
+
+	diff, err := VerifyStatistics(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err)
+	assert.True(t, diff.Empty(), diff.Mismatches)
+	assert.Equal(t, uint64(0), diff.Declared.MessageStartTime)
+}
+
+func TestWriterCompressionLevel(t *testing.T) {
+	write := func(t *testing.T, compression CompressionFormat, level CompressionLevel) []byte {
+		buf := &bytes.Buffer{}
+		w, err := NewWriter(buf, &WriterOptions{
+			Chunked:                  true,
+			ChunkSize:                64 * 1024,
+			Compression:              compression,
+			CompressionLevel:         level,
+			DeterministicCompression: true,
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteHeader(&Header{}))
+		_, err = w.WriteChannel(&Channel{ID: 1, Topic: "/a", MessageEncoding: "raw"})
+		assert.Nil(t, err)
+		data := make([]byte, 1024)
+		for i := 0; i < 200; i++ {
+			for j := range data {
+				data[j] = byte((i*j/7 + j%13) % 251)
+			}
+			assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: uint64(i), Data: data}))
+		}
+		assert.Nil(t, w.Close())
+		return buf.Bytes()
+	}
+	for _, compression := range []CompressionFormat{CompressionZSTD, CompressionLZ4} {
+		t.Run(string(compression), func(t *testing.T) {
+			sizes := make(map[CompressionLevel]int)
+			for level := CompressionLevelDefault; level <= CompressionLevelBest; level++ {
+				output := write(t, compression, level)
+				sizes[level] = len(output)
+				reader, err := NewReader(bytes.NewReader(output))
+				assert.Nil(t, err)
+				info, err := reader.Info()
+				assert.Nil(t, err)
+				assert.Equal(t, uint64(200), info.Statistics.MessageCount)
+			}
+			assert.Equal(t,
+				write(t, compression, CompressionLevelDefault),
+				write(t, compression, CompressionLevelFastest),
+			)
+			assert.Less(t, sizes[CompressionLevelBest], sizes[CompressionLevelFastest])
+		})
+	}
+	t.Run("rejects levels out of range", func(t *testing.T) {
+		for _, level := range []CompressionLevel{-1, CompressionLevelBest + 1} {
+			_, err := NewWriter(&bytes.Buffer{}, &WriterOptions{
+				Chunked:          true,
+				Compression:      CompressionZSTD,
+				CompressionLevel: level,
+			})
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), "compression level")
+		}
+	})
+}
+
+func TestWriterDeterministicCompression(t *testing.T) {
+	write := func(t *testing.T, compression CompressionFormat) []byte {
+		buf := &bytes.Buffer{}
+		w, err := NewWriter(buf, &WriterOptions{
+			Chunked:                  true,
+			ChunkSize:                64 * 1024,
+			Compression:              compression,
+			IncludeCRC:               true,
+			DeterministicCompression: true,
+		})
+		assert.Nil(t, err)
+		assert.Nil(t, w.WriteHeader(&Header{}))
+		_, err = w.WriteChannel(&Channel{ID: 1, Topic: "/a", MessageEncoding: "raw"})
+		assert.Nil(t, err)
+		data := make([]byte, 1024)
+		for i := 0; i < 500; i++ {
+			for j := range data {
+				data[j] = byte((i * j) % 251)
+			}
+			assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: uint64(i), Data: data}))
+		}
+		assert.Nil(t, w.Close())
+		return buf.Bytes()
+	}
+	for _, compression := range []CompressionFormat{CompressionZSTD, CompressionLZ4, CompressionNone} {
+		t.Run(string(compression), func(t *testing.T) {
+			first := write(t, compression)
+			second := write(t, compression)
+			assert.Equal(t, first, second)
+			reader, err := NewReader(bytes.NewReader(first))
+			assert.Nil(t, err)
+			info, err := reader.Info()
+			assert.Nil(t, err)
+			assert.Greater(t, len(info.ChunkIndexes), 1)
+			assert.Equal(t, uint64(500), info.Statistics.MessageCount)
+		})
+	}
+}
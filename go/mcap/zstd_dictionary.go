@@ -0,0 +1,66 @@
+package mcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ZSTDDictionaryMetadataName is the name of the metadata record in which the
+// writer records the ID of the zstd dictionary its chunks are compressed with,
+// under the key ZSTDDictionaryIDKey, so that readers know which dictionary to
+// supply with LexerOptions.ZSTDDictionary.
+const ZSTDDictionaryMetadataName = "mcap_zstd_dictionary"
+
+// ZSTDDictionaryIDKey is the key of the dictionary ID, in decimal, in the
+// metadata record named ZSTDDictionaryMetadataName.
+const ZSTDDictionaryIDKey = "id"
+
+// zstdDictionaryMagic begins a zstd dictionary.
+var zstdDictionaryMagic = []byte{0x37, 0xa4, 0x30, 0xec}
+
+// ZSTDDictionaryID returns the ID of a zstd dictionary, as recorded by the
+// writer in the metadata record named ZSTDDictionaryMetadataName and in the
+// frame header of each chunk compressed with it.
+func ZSTDDictionaryID(dict []byte) (uint32, error) {
+	if len(dict) < 8 || !bytes.Equal(dict[:4], zstdDictionaryMagic) {
+		return 0, fmt.Errorf("not a zstd dictionary")
+	}
+	id := binary.LittleEndian.Uint32(dict[4:8])
+	if id == 0 {
+		return 0, fmt.Errorf("zstd dictionary has no ID")
+	}
+	return id, nil
+}
+
+// zstdDictionaryMetadata returns the metadata record identifying a zstd
+// dictionary.
+func zstdDictionaryMetadata(dict []byte) (*Metadata, error) {
+	id, err := ZSTDDictionaryID(dict)
+	if err != nil {
+		return nil, err
+	}
+	return &Metadata{
+		Name:     ZSTDDictionaryMetadataName,
+		Metadata: map[string]string{ZSTDDictionaryIDKey: strconv.FormatUint(uint64(id), 10)},
+	}, nil
+}
+
+// newZSTDDecoder returns a zstd decoder of r, with a dictionary if one is
+// given. Frames compressed without a dictionary are decoded either way.
+func newZSTDDecoder(r io.Reader, dict []byte, opts ...zstd.DOption) (*zstd.Decoder, error) {
+	if len(dict) > 0 {
+		opts = append(opts, zstd.WithDecoderDicts(dict))
+	}
+	return zstd.NewReader(r, opts...)
+}
+
+// sameBytes reports whether two slices are the same slice, rather than merely
+// equal.
+func sameBytes(a, b []byte) bool {
+	return len(a) == len(b) && (len(a) == 0 || &a[0] == &b[0])
+}
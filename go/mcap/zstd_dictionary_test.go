@@ -0,0 +1,205 @@
+package mcap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/foxglove/mcap/go/mcap/readopts"
+	"github.com/stretchr/testify/assert"
+)
+
+// poseMessage returns a small JSON message resembling those the dictionary
+// in testdata/messages.zdict was trained on.
+func poseMessage(r *rand.Rand, i int) []byte {
+	return []byte(fmt.Sprintf(`{"header": {"stamp": {"sec": %d, "nsec": %d}, "frame_id": "base_link"}, `+
+		`"pose": {"position": {"x": %.3f, "y": %.3f, "z": 0.0}, `+
+		`"orientation": {"x": 0.0, "y": 0.0, "z": %.4f, "w": %.4f}}, "status": "%s"}`,
+		1700000000+i, r.Intn(1e9), r.Float64()*20-10, r.Float64()*20-10, r.Float64()*2-1, r.Float64()*2-1,
+		[]string{"OK", "WARN", "ERROR"}[r.Intn(3)]))
+}
+
+// writePoses writes a file of pose messages with the given options.
+func writePoses(t testing.TB, opts *WriterOptions, count int) []byte {
+	buf := &bytes.Buffer{}
+	w, err := NewWriter(buf, opts)
+	assert.Nil(t, err)
+	assert.Nil(t, w.WriteHeader(&Header{}))
+	_, err = w.WriteChannel(&Channel{ID: 1, Topic: "/pose", MessageEncoding: "json"})
+	assert.Nil(t, err)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < count; i++ {
+		assert.Nil(t, w.WriteMessage(&Message{ChannelID: 1, LogTime: uint64(i), Data: poseMessage(r, i)}))
+	}
+	assert.Nil(t, w.Close())
+	return buf.Bytes()
+}
+
+func readDictionary(t testing.TB) []byte {
+	dict, err := os.ReadFile("testdata/messages.zdict")
+	assert.Nil(t, err)
+	return dict
+}
+
+func TestZSTDDictionary(t *testing.T) {
+	dict := readDictionary(t)
+	id, err := ZSTDDictionaryID(dict)
+	assert.Nil(t, err)
+	data := writePoses(t, &WriterOptions{
+		Chunked:        true,
+		ChunkSize:      1024,
+		Compression:    CompressionZSTD,
+		IncludeCRC:     true,
+		ZSTDDictionary: dict,
+	}, 100)
+	lexMessages := func(opts *LexerOptions) ([][]byte, error) {
+		lexer, err := NewLexer(bytes.NewReader(data), opts)
+		assert.Nil(t, err)
+		defer lexer.Close()
+		var messages [][]byte
+		for {
+			tokenType, record, err := lexer.Next(nil)
+			if errors.Is(err, io.EOF) {
+				return messages, nil
+			}
+			if err != nil {
+				return messages, err
+			}
+			if tokenType == TokenMessage {
+				message, err := ParseMessage(record)
+				assert.Nil(t, err)
+				messages = append(messages, message.Data)
+			}
+		}
+	}
+	r := rand.New(rand.NewSource(1))
+	expected := make([][]byte, 100)
+	for i := range expected {
+		expected[i] = poseMessage(r, i)
+	}
+
+	t.Run("records the dictionary ID", func(t *testing.T) {
+		reader, err := NewReader(bytes.NewReader(data))
+		assert.Nil(t, err)
+		info, err := reader.Info()
+		assert.Nil(t, err)
+		assert.Greater(t, info.Statistics.ChunkCount, uint32(1))
+		assert.Equal(t, 1, len(info.MetadataIndexes))
+		opcode, record, err := readRecordAt(bytes.NewReader(data), info.MetadataIndexes[0].Offset)
+		assert.Nil(t, err)
+		assert.Equal(t, OpMetadata, opcode)
+		metadata, err := ParseMetadata(record)
+		assert.Nil(t, err)
+		assert.Equal(t, ZSTDDictionaryMetadataName, metadata.Name)
+		assert.Equal(t, strconv.FormatUint(uint64(id), 10), metadata.Metadata[ZSTDDictionaryIDKey])
+	})
+	t.Run("lexer", func(t *testing.T) {
+		_, err := lexMessages(&LexerOptions{})
+		assert.Error(t, err)
+		for _, opts := range []*LexerOptions{
+			{ZSTDDictionary: dict},
+			{ZSTDDictionary: dict, ValidateCRC: true},
+			{ZSTDDictionary: dict, ReadAheadChunks: 4},
+		} {
+			messages, err := lexMessages(opts)
+			assert.Nil(t, err)
+			assert.Equal(t, expected, messages)
+		}
+	})
+	t.Run("lexer reset", func(t *testing.T) {
+		lexer, err := NewLexer(bytes.NewReader(data), &LexerOptions{ZSTDDictionary: dict})
+		assert.Nil(t, err)
+		for tokenType := TokenHeader; tokenType != TokenMessage; {
+			tokenType, _, err = lexer.Next(nil)
+			assert.Nil(t, err)
+		}
+		// the decoder created with the dictionary is not reused without it.
+		plain := writePoses(t, &WriterOptions{Chunked: true, Compression: CompressionZSTD}, 10)
+		assert.Nil(t, lexer.Reset(bytes.NewReader(data), &LexerOptions{}))
+		var lexErr error
+		for lexErr == nil {
+			_, _, lexErr = lexer.Next(nil)
+		}
+		assert.NotErrorIs(t, lexErr, io.EOF)
+		assert.Nil(t, lexer.Reset(bytes.NewReader(plain), &LexerOptions{}))
+		for lexErr = nil; lexErr == nil; {
+			_, _, lexErr = lexer.Next(nil)
+		}
+		assert.ErrorIs(t, lexErr, io.EOF)
+	})
+	t.Run("reader", func(t *testing.T) {
+		for _, useIndex := range []bool{true, false} {
+			reader, err := NewReader(bytes.NewReader(data))
+			assert.Nil(t, err)
+			it, err := reader.Messages(readopts.UsingIndex(useIndex), readopts.WithZSTDDictionary(dict))
+			assert.Nil(t, err)
+			var messages [][]byte
+			assert.Nil(t, Range(it, func(_ *Schema, _ *Channel, m *Message) error {
+				messages = append(messages, m.Data)
+				return nil
+			}))
+			assert.Equal(t, expected, messages, "using index: %v", useIndex)
+		}
+	})
+	t.Run("parallel", func(t *testing.T) {
+		pool := NewDecoderPool(2)
+		defer pool.Close()
+		for _, p := range []*DecoderPool{nil, pool} {
+			it, err := ParallelMessagesWithPool(bytes.NewReader(data), int64(len(data)), 4, p,
+				&LexerOptions{ZSTDDictionary: dict})
+			assert.Nil(t, err)
+			var messages [][]byte
+			assert.Nil(t, Range(it, func(_ *Schema, _ *Channel, m *Message) error {
+				messages = append(messages, m.Data)
+				return nil
+			}))
+			assert.Equal(t, expected, messages)
+		}
+	})
+	t.Run("writer requires zstd and a valid dictionary", func(t *testing.T) {
+		_, err := NewWriter(&bytes.Buffer{}, &WriterOptions{
+			Chunked: true, Compression: CompressionLZ4, ZSTDDictionary: dict,
+		})
+		assert.Error(t, err)
+		_, err = NewWriter(&bytes.Buffer{}, &WriterOptions{ZSTDDictionary: dict})
+		assert.Error(t, err)
+		_, err = NewWriter(&bytes.Buffer{}, &WriterOptions{
+			Chunked: true, Compression: CompressionZSTD, ZSTDDictionary: []byte("not a dictionary"),
+		})
+		assert.Error(t, err)
+	})
+}
+
+// BenchmarkZSTDDictionary compares the size of files of small chunks of small
+// messages compressed with and without a dictionary, reported as the
+// compression ratio of the file.
+func BenchmarkZSTDDictionary(b *testing.B) {
+	dict := readDictionary(b)
+	uncompressed := writePoses(b, &WriterOptions{Chunked: true, ChunkSize: 2048, Compression: CompressionNone}, 1000)
+	for _, c := range []struct {
+		name string
+		dict []byte
+	}{
+		{"without dictionary", nil},
+		{"with dictionary", dict},
+	} {
+		b.Run(c.name, func(b *testing.B) {
+			var size int
+			for i := 0; i < b.N; i++ {
+				size = len(writePoses(b, &WriterOptions{
+					Chunked:        true,
+					ChunkSize:      2048,
+					Compression:    CompressionZSTD,
+					ZSTDDictionary: c.dict,
+				}, 1000))
+			}
+			b.ReportMetric(float64(len(uncompressed))/float64(size), "ratio")
+			b.ReportMetric(float64(size), "bytes")
+		})
+	}
+}
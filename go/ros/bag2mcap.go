@@ -280,7 +280,7 @@ func Bag2MCAP(w io.Writer, r io.Reader, opts *mcap.WriterOptions) error {
 				schemaID := uint16(len(schemas) + 1)
 				msgdefCopy := make([]byte, len(msgdef))
 				copy(msgdefCopy, msgdef)
-				err := writer.WriteSchema(&mcap.Schema{
+				_, err := writer.WriteSchema(&mcap.Schema{
 					ID:       schemaID,
 					Encoding: "ros1msg",
 					Name:     typ,
@@ -298,7 +298,8 @@ func Bag2MCAP(w io.Writer, r io.Reader, opts *mcap.WriterOptions) error {
 				SchemaID:        schemas[key],
 				Metadata:        connectionDataHeader,
 			}
-			return writer.WriteChannel(channelInfo)
+			_, err = writer.WriteChannel(channelInfo)
+			return err
 		},
 		func(header, data []byte) error {
 			conn, err := extractHeaderValue(header, headerConn)
@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/foxglove/mcap/go/mcap"
 	"github.com/foxglove/mcap/go/ros"
 )
 
@@ -170,6 +171,30 @@ func ParseMessageDefinition(parentPackage string, data []byte) ([]Field, error)
 	return fields, nil
 }
 
+// ROS1MessageDefinition is the parsed form of a ros1msg schema.
+type ROS1MessageDefinition struct {
+	Name   string
+	Fields []Field
+}
+
+// ParseROS1Schema parses the concatenated message definition held by a schema
+// with "ros1msg" encoding. Dependent types following "===" separators are
+// resolved into the fields that reference them.
+func ParseROS1Schema(s *mcap.Schema) (*ROS1MessageDefinition, error) {
+	if s.Encoding != "ros1msg" {
+		return nil, fmt.Errorf("schema %q has encoding %q, expected ros1msg", s.Name, s.Encoding)
+	}
+	parentPackage := strings.Split(s.Name, "/")[0]
+	fields, err := ParseMessageDefinition(parentPackage, s.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema %q: %w", s.Name, err)
+	}
+	return &ROS1MessageDefinition{
+		Name:   s.Name,
+		Fields: fields,
+	}, nil
+}
+
 func splitLines(s string, predicate func(string) bool) []string {
 	chunks := []string{}
 	chunk := &strings.Builder{}
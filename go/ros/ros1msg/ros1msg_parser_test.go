@@ -3,6 +3,7 @@ package ros1msg
 import (
 	"testing"
 
+	"github.com/foxglove/mcap/go/mcap"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -283,3 +284,58 @@ func TestROS1MSGParser(t *testing.T) {
 		})
 	}
 }
+
+func TestParseROS1Schema(t *testing.T) {
+	t.Run("parses dependent types", func(t *testing.T) {
+		definition, err := ParseROS1Schema(&mcap.Schema{
+			Name:     "my_package/Outer",
+			Encoding: "ros1msg",
+			Data: []byte(`Inner inner
+uint8[4] bytes
+================================================================================
+MSG: my_package/Inner
+string name`),
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "my_package/Outer", definition.Name)
+		assert.Equal(t, []Field{
+			{
+				Name: "inner",
+				Type: Type{
+					BaseType: "Inner",
+					IsRecord: true,
+					Fields: []Field{
+						{
+							Name: "name",
+							Type: Type{BaseType: "string"},
+						},
+					},
+				},
+			},
+			{
+				Name: "bytes",
+				Type: Type{
+					BaseType:  "uint8[4]",
+					IsArray:   true,
+					FixedSize: 4,
+					Items:     &Type{BaseType: "uint8"},
+				},
+			},
+		}, definition.Fields)
+	})
+	t.Run("rejects other encodings", func(t *testing.T) {
+		_, err := ParseROS1Schema(&mcap.Schema{
+			Name:     "foo.Bar",
+			Encoding: "protobuf",
+		})
+		assert.Contains(t, err.Error(), `has encoding "protobuf", expected ros1msg`)
+	})
+	t.Run("reports missing dependencies", func(t *testing.T) {
+		_, err := ParseROS1Schema(&mcap.Schema{
+			Name:     "my_package/Outer",
+			Encoding: "ros1msg",
+			Data:     []byte("Missing field"),
+		})
+		assert.Contains(t, err.Error(), "dependency my_package/Missing not found")
+	})
+}
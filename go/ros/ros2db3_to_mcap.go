@@ -286,7 +286,7 @@ func DB3ToMCAP(w io.Writer, db *sql.DB, opts *mcap.WriterOptions, searchdirs []s
 		if !ok {
 			return fmt.Errorf("unrecognized schema for %s", t.typ)
 		}
-		err = writer.WriteSchema(&mcap.Schema{
+		_, err = writer.WriteSchema(&mcap.Schema{
 			ID:       schemaID,
 			Data:     schema,
 			Name:     t.typ,
@@ -299,7 +299,7 @@ func DB3ToMCAP(w io.Writer, db *sql.DB, opts *mcap.WriterOptions, searchdirs []s
 		if t.offeredQOSProfiles != nil {
 			metadata["offered_qos_profiles"] = *t.offeredQOSProfiles
 		}
-		err = writer.WriteChannel(&mcap.Channel{
+		_, err = writer.WriteChannel(&mcap.Channel{
 			ID:              t.id,
 			Topic:           t.name,
 			MessageEncoding: t.serializationFormat,
@@ -0,0 +1,783 @@
+package ros2idl
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/foxglove/mcap/go/mcap"
+)
+
+func init() {
+	mcap.RegisterSchemaParser("ros2idl", func(s *mcap.Schema) (mcap.ParsedSchema, error) {
+		return ParseROS2IDLSchema(s)
+	})
+}
+
+// IDLSchema is the parsed form of a ros2idl schema. Definitions are keyed by
+// their names qualified with the enclosing modules, such as
+// "geometry_msgs::msg::Point".
+type IDLSchema struct {
+	// Name is the name of the schema, such as "geometry_msgs/msg/Pose".
+	Name string
+	// Root is the struct named by the schema.
+	Root      *Struct
+	Structs   map[string]*Struct
+	Enums     map[string]*Enum
+	Constants map[string]*Constant
+}
+
+// Struct is a struct definition.
+type Struct struct {
+	Name   string
+	Fields []Field
+}
+
+// Field is a member of a struct.
+type Field struct {
+	Name string
+	Type Type
+}
+
+// Enum is an enum definition.
+type Enum struct {
+	Name        string
+	Enumerators []string
+}
+
+// Constant is a constant definition. Its value is the source text of the
+// constant's expression.
+type Constant struct {
+	Name  string
+	Type  Type
+	Value string
+}
+
+// Type describes the type of a field or constant, with typedefs resolved.
+type Type struct {
+	// Name is a primitive type, such as "double", "unsigned long" or
+	// "string", or the qualified name of a struct or enum. It is empty for
+	// sequences.
+	Name string
+	// Struct and Enum are set to the definitions of struct and enum types.
+	Struct *Struct
+	Enum   *Enum
+	// Sequence is the element type of a sequence.
+	Sequence *Type
+	// Bound is the maximum length of a bounded string or sequence, or zero
+	// if it is unbounded.
+	Bound int
+	// ArrayLengths, if set, make the type a fixed size array of the type
+	// described by the other fields, with the given dimensions, outermost
+	// first.
+	ArrayLengths []int
+}
+
+var primitiveTypes = map[string]bool{
+	"boolean":            true,
+	"octet":              true,
+	"char":               true,
+	"wchar":              true,
+	"float":              true,
+	"double":             true,
+	"long double":        true,
+	"short":              true,
+	"unsigned short":     true,
+	"long":               true,
+	"unsigned long":      true,
+	"long long":          true,
+	"unsigned long long": true,
+	"int8":               true,
+	"uint8":              true,
+	"int16":              true,
+	"uint16":             true,
+	"int32":              true,
+	"uint32":             true,
+	"int64":              true,
+	"uint64":             true,
+	"string":             true,
+	"wstring":            true,
+}
+
+// idlSeparator is the line preceding each definition in ros2idl schema data.
+var idlSeparator = strings.Repeat("=", 80)
+
+// ParseROS2IDLSchema parses the concatenated IDL definitions held by a schema
+// with "ros2idl" encoding. References between types are resolved following
+// the scoping rules of IDL, and an error is returned if any referenced type
+// is not defined in the schema data, or if the struct named by the schema is
+// not defined. Importing this package also registers the parser for use with
+// mcap.ParseSchemaData.
+func ParseROS2IDLSchema(s *mcap.Schema) (*IDLSchema, error) {
+	if s.Encoding != "ros2idl" {
+		return nil, fmt.Errorf("schema %q has encoding %q, expected ros2idl", s.Name, s.Encoding)
+	}
+	p := &parser{
+		schema: &IDLSchema{
+			Name:      s.Name,
+			Structs:   make(map[string]*Struct),
+			Enums:     make(map[string]*Enum),
+			Constants: make(map[string]*Constant),
+		},
+		typedefs: make(map[string]*unresolvedType),
+	}
+	for _, section := range splitSections(string(s.Data)) {
+		if err := p.parseSection(section.text); err != nil {
+			return nil, fmt.Errorf("failed to parse schema %q: %s: %w", s.Name, section.name, err)
+		}
+	}
+	if err := p.resolve(); err != nil {
+		return nil, fmt.Errorf("failed to parse schema %q: %w", s.Name, err)
+	}
+	rootName := strings.ReplaceAll(s.Name, "/", "::")
+	root, ok := p.schema.Structs[rootName]
+	if !ok {
+		return nil, fmt.Errorf("failed to parse schema %q: struct %s is not defined", s.Name, rootName)
+	}
+	p.schema.Root = root
+	return p.schema, nil
+}
+
+type section struct {
+	name string
+	text string
+}
+
+// splitSections splits schema data into the IDL definitions following each
+// separator. Text preceding the first separator is treated as a definition of
+// the schema's own type.
+func splitSections(data string) []section {
+	sections := []section{}
+	current := section{name: "schema definition"}
+	lines := strings.Split(data, "\n")
+	for i := 0; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) != idlSeparator {
+			current.text += lines[i] + "\n"
+			continue
+		}
+		if strings.TrimSpace(current.text) != "" {
+			sections = append(sections, current)
+		}
+		current = section{name: "definition"}
+		if i+1 < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i+1]), "IDL: ") {
+			current.name = strings.TrimSpace(lines[i+1])
+			i++
+		}
+	}
+	if strings.TrimSpace(current.text) != "" {
+		sections = append(sections, current)
+	}
+	return sections
+}
+
+// unresolvedType is a type as written, whose references have not yet been
+// resolved.
+type unresolvedType struct {
+	name         string
+	scope        []string
+	sequence     *unresolvedType
+	bound        int
+	arrayLengths []int
+}
+
+// unresolvedField is a member of a struct, or a constant, whose type has not
+// yet been resolved.
+type unresolvedField struct {
+	name string
+	typ  *unresolvedType
+}
+
+type parser struct {
+	schema   *IDLSchema
+	typedefs map[string]*unresolvedType
+	// fields and constantTypes hold the unresolved types of struct members
+	// and constants, keyed by qualified name.
+	fields        map[string][]unresolvedField
+	constantTypes map[string]*unresolvedType
+	// resolving detects typedefs that refer to themselves.
+	resolving map[string]bool
+
+	tokens []token
+	pos    int
+	scope  []string
+}
+
+func (p *parser) parseSection(text string) error {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return err
+	}
+	p.tokens = tokens
+	p.pos = 0
+	p.scope = nil
+	for !p.done() {
+		if err := p.parseDefinition(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{kind: tokenEOF}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if !p.done() {
+		p.pos++
+	}
+	return t
+}
+
+// expect consumes the next token, which must have the given text.
+func (p *parser) expect(text string) error {
+	t := p.next()
+	if t.text != text || t.kind == tokenString {
+		return t.errorf("expected %q, found %s", text, t)
+	}
+	return nil
+}
+
+// identifier consumes an unscoped identifier.
+func (p *parser) identifier() (string, error) {
+	t := p.next()
+	if t.kind != tokenIdentifier || strings.Contains(t.text, "::") {
+		return "", t.errorf("expected identifier, found %s", t)
+	}
+	return t.text, nil
+}
+
+// integer consumes a positive integer literal.
+func (p *parser) integer() (int, error) {
+	t := p.next()
+	if t.kind == tokenNumber {
+		if n, err := strconv.ParseInt(t.text, 0, 64); err == nil && n > 0 {
+			return int(n), nil
+		}
+	}
+	return 0, t.errorf("expected positive integer, found %s", t)
+}
+
+// skipAnnotations consumes any annotations, such as @key or
+// @verbatim (language="comment", text="..."), preceding a definition.
+func (p *parser) skipAnnotations() error {
+	for p.peek().is("@") {
+		p.next()
+		if t := p.next(); t.kind != tokenIdentifier {
+			return t.errorf("expected annotation name, found %s", t)
+		}
+		if !p.peek().is("(") {
+			continue
+		}
+		depth := 0
+		for {
+			t := p.next()
+			switch {
+			case t.kind == tokenEOF:
+				return t.errorf("unterminated annotation")
+			case t.is("("):
+				depth++
+			case t.is(")"):
+				depth--
+			}
+			if depth == 0 {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (p *parser) qualify(name string) string {
+	return strings.Join(append(append([]string{}, p.scope...), name), "::")
+}
+
+// define records that a name is defined, rejecting duplicate definitions.
+func (p *parser) define(name string, t token) error {
+	_, isStruct := p.schema.Structs[name]
+	_, isEnum := p.schema.Enums[name]
+	_, isConstant := p.schema.Constants[name]
+	_, isTypedef := p.typedefs[name]
+	if isStruct || isEnum || isConstant || isTypedef {
+		return t.errorf("%s is defined more than once", name)
+	}
+	return nil
+}
+
+func (p *parser) parseDefinition() error {
+	if err := p.skipAnnotations(); err != nil {
+		return err
+	}
+	t := p.next()
+	switch {
+	case t.is(";"):
+		return nil
+	case t.is("module"):
+		name, err := p.identifier()
+		if err != nil {
+			return err
+		}
+		if err := p.expect("{"); err != nil {
+			return err
+		}
+		p.scope = append(p.scope, name)
+		for !p.peek().is("}") {
+			if p.done() {
+				return p.peek().errorf("unterminated module %s", name)
+			}
+			if err := p.parseDefinition(); err != nil {
+				return err
+			}
+		}
+		p.next()
+		p.scope = p.scope[:len(p.scope)-1]
+		return p.expect(";")
+	case t.is("struct"):
+		return p.parseStruct()
+	case t.is("enum"):
+		return p.parseEnum()
+	case t.is("const"):
+		return p.parseConstant()
+	case t.is("typedef"):
+		typ, err := p.parseType()
+		if err != nil {
+			return err
+		}
+		name, lengths, err := p.parseDeclarator()
+		if err != nil {
+			return err
+		}
+		qualified := p.qualify(name)
+		if err := p.define(qualified, t); err != nil {
+			return err
+		}
+		typ.arrayLengths = append(lengths, typ.arrayLengths...)
+		p.typedefs[qualified] = typ
+		return p.expect(";")
+	default:
+		return t.errorf("unexpected %s", t)
+	}
+}
+
+func (p *parser) parseStruct() error {
+	start := p.peek()
+	name, err := p.identifier()
+	if err != nil {
+		return err
+	}
+	// forward declaration
+	if p.peek().is(";") {
+		p.next()
+		return nil
+	}
+	qualified := p.qualify(name)
+	if err := p.define(qualified, start); err != nil {
+		return err
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	var fields []unresolvedField
+	for {
+		if err := p.skipAnnotations(); err != nil {
+			return err
+		}
+		if p.peek().is("}") {
+			p.next()
+			break
+		}
+		typ, err := p.parseType()
+		if err != nil {
+			return err
+		}
+		for {
+			fieldName, lengths, err := p.parseDeclarator()
+			if err != nil {
+				return err
+			}
+			fieldType := *typ
+			fieldType.arrayLengths = lengths
+			fields = append(fields, unresolvedField{name: fieldName, typ: &fieldType})
+			if !p.peek().is(",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expect(";"); err != nil {
+			return err
+		}
+	}
+	if p.fields == nil {
+		p.fields = make(map[string][]unresolvedField)
+	}
+	p.fields[qualified] = fields
+	p.schema.Structs[qualified] = &Struct{Name: qualified}
+	return p.expect(";")
+}
+
+func (p *parser) parseEnum() error {
+	start := p.peek()
+	name, err := p.identifier()
+	if err != nil {
+		return err
+	}
+	qualified := p.qualify(name)
+	if err := p.define(qualified, start); err != nil {
+		return err
+	}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	enum := &Enum{Name: qualified}
+	for {
+		if err := p.skipAnnotations(); err != nil {
+			return err
+		}
+		enumerator, err := p.identifier()
+		if err != nil {
+			return err
+		}
+		enum.Enumerators = append(enum.Enumerators, enumerator)
+		t := p.next()
+		if t.is("}") {
+			break
+		}
+		if !t.is(",") {
+			return t.errorf("expected \",\" or \"}\", found %s", t)
+		}
+	}
+	p.schema.Enums[qualified] = enum
+	return p.expect(";")
+}
+
+func (p *parser) parseConstant() error {
+	typ, err := p.parseType()
+	if err != nil {
+		return err
+	}
+	start := p.peek()
+	name, err := p.identifier()
+	if err != nil {
+		return err
+	}
+	qualified := p.qualify(name)
+	if err := p.define(qualified, start); err != nil {
+		return err
+	}
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	var value []string
+	for !p.peek().is(";") {
+		t := p.next()
+		if t.kind == tokenEOF {
+			return t.errorf("unterminated constant %s", name)
+		}
+		value = append(value, t.source)
+	}
+	p.next()
+	if len(value) == 0 {
+		return start.errorf("constant %s has no value", name)
+	}
+	if p.constantTypes == nil {
+		p.constantTypes = make(map[string]*unresolvedType)
+	}
+	p.constantTypes[qualified] = typ
+	p.schema.Constants[qualified] = &Constant{Name: qualified, Value: strings.Join(value, " ")}
+	return nil
+}
+
+// parseType parses a type specification.
+func (p *parser) parseType() (*unresolvedType, error) {
+	t := p.next()
+	switch {
+	case t.is("sequence"):
+		if err := p.expect("<"); err != nil {
+			return nil, err
+		}
+		elem, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		typ := &unresolvedType{sequence: elem}
+		if p.peek().is(",") {
+			p.next()
+			if typ.bound, err = p.integer(); err != nil {
+				return nil, err
+			}
+		}
+		return typ, p.expect(">")
+	case t.is("string") || t.is("wstring"):
+		typ := &unresolvedType{name: t.text}
+		if p.peek().is("<") {
+			p.next()
+			var err error
+			if typ.bound, err = p.integer(); err != nil {
+				return nil, err
+			}
+			return typ, p.expect(">")
+		}
+		return typ, nil
+	case t.is("unsigned"):
+		name := "unsigned"
+		switch next := p.next(); {
+		case next.is("short"):
+			name += " short"
+		case next.is("long"):
+			name += " long"
+			if p.peek().is("long") {
+				p.next()
+				name += " long"
+			}
+		default:
+			return nil, next.errorf("expected \"short\" or \"long\", found %s", next)
+		}
+		return &unresolvedType{name: name}, nil
+	case t.is("long"):
+		if p.peek().is("long") || p.peek().is("double") {
+			return &unresolvedType{name: "long " + p.next().text}, nil
+		}
+		return &unresolvedType{name: "long"}, nil
+	case t.kind == tokenIdentifier:
+		return &unresolvedType{name: t.text, scope: append([]string{}, p.scope...)}, nil
+	default:
+		return nil, t.errorf("expected type, found %s", t)
+	}
+}
+
+// parseDeclarator parses a name with optional array dimensions.
+func (p *parser) parseDeclarator() (string, []int, error) {
+	name, err := p.identifier()
+	if err != nil {
+		return "", nil, err
+	}
+	var lengths []int
+	for p.peek().is("[") {
+		p.next()
+		length, err := p.integer()
+		if err != nil {
+			return "", nil, err
+		}
+		lengths = append(lengths, length)
+		if err := p.expect("]"); err != nil {
+			return "", nil, err
+		}
+	}
+	return name, lengths, nil
+}
+
+// resolve resolves the types of struct members and constants.
+func (p *parser) resolve() error {
+	p.resolving = make(map[string]bool)
+	for name, fields := range p.fields {
+		s := p.schema.Structs[name]
+		for _, field := range fields {
+			typ, err := p.resolveType(field.typ)
+			if err != nil {
+				return fmt.Errorf("field %s of %s: %w", field.name, name, err)
+			}
+			s.Fields = append(s.Fields, Field{Name: field.name, Type: typ})
+		}
+	}
+	for name, unresolved := range p.constantTypes {
+		typ, err := p.resolveType(unresolved)
+		if err != nil {
+			return fmt.Errorf("constant %s: %w", name, err)
+		}
+		p.schema.Constants[name].Type = typ
+	}
+	return nil
+}
+
+func (p *parser) resolveType(u *unresolvedType) (Type, error) {
+	if u.sequence != nil {
+		elem, err := p.resolveType(u.sequence)
+		if err != nil {
+			return Type{}, err
+		}
+		return Type{Sequence: &elem, Bound: u.bound, ArrayLengths: u.arrayLengths}, nil
+	}
+	if primitiveTypes[u.name] {
+		return Type{Name: u.name, Bound: u.bound, ArrayLengths: u.arrayLengths}, nil
+	}
+	name, ok := p.lookup(u.name, u.scope)
+	if !ok {
+		return Type{}, fmt.Errorf("type %s is not defined", u.name)
+	}
+	if s, ok := p.schema.Structs[name]; ok {
+		return Type{Name: name, Struct: s, ArrayLengths: u.arrayLengths}, nil
+	}
+	if e, ok := p.schema.Enums[name]; ok {
+		return Type{Name: name, Enum: e, ArrayLengths: u.arrayLengths}, nil
+	}
+	if p.resolving[name] {
+		return Type{}, fmt.Errorf("typedef %s refers to itself", name)
+	}
+	p.resolving[name] = true
+	defer delete(p.resolving, name)
+	typ, err := p.resolveType(p.typedefs[name])
+	if err != nil {
+		return Type{}, fmt.Errorf("typedef %s: %w", name, err)
+	}
+	typ.ArrayLengths = append(append([]int{}, u.arrayLengths...), typ.ArrayLengths...)
+	return typ, nil
+}
+
+// lookup resolves a possibly scoped type name referenced within the given
+// module scope, searching from the innermost enclosing module outwards.
+func (p *parser) lookup(name string, scope []string) (string, bool) {
+	if strings.HasPrefix(name, "::") {
+		scope = nil
+		name = strings.TrimPrefix(name, "::")
+	}
+	for i := len(scope); i >= 0; i-- {
+		candidate := strings.Join(append(append([]string{}, scope[:i]...), name), "::")
+		_, isStruct := p.schema.Structs[candidate]
+		_, isEnum := p.schema.Enums[candidate]
+		_, isTypedef := p.typedefs[candidate]
+		if isStruct || isEnum || isTypedef {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdentifier
+	tokenNumber
+	tokenString
+	tokenPunctuation
+)
+
+type token struct {
+	kind tokenKind
+	// text is the identifier, number or punctuation, or the contents of a
+	// string literal.
+	text string
+	// source is the token as it appears in the IDL.
+	source string
+	line   int
+}
+
+func (t token) is(text string) bool {
+	return t.kind != tokenString && t.kind != tokenEOF && t.text == text
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of definition"
+	}
+	return strconv.Quote(t.source)
+}
+
+func (t token) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s", t.line, fmt.Sprintf(format, args...))
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentifierPart(c byte) bool {
+	return isIdentifierStart(c) || (c >= '0' && c <= '9')
+}
+
+// tokenize splits IDL into tokens, dropping comments and preprocessor
+// directives. Scoped names such as "::std_msgs::msg::Header" are returned as
+// a single identifier.
+func tokenize(text string) ([]token, error) {
+	var tokens []token
+	line := 1
+	lineStart := true
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\n':
+			line++
+			lineStart = true
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+			continue
+		case c == '#' && lineStart:
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+			continue
+		case strings.HasPrefix(text[i:], "//"):
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+			continue
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated comment", line)
+			}
+			line += strings.Count(text[i:i+2+end], "\n")
+			i += end + 4
+			continue
+		}
+		lineStart = false
+		start := i
+		t := token{line: line}
+		switch {
+		case isIdentifierStart(c) || (strings.HasPrefix(text[i:], "::") && i+2 < len(text) && isIdentifierStart(text[i+2])):
+			t.kind = tokenIdentifier
+			for {
+				if strings.HasPrefix(text[i:], "::") {
+					i += 2
+				}
+				for i < len(text) && isIdentifierPart(text[i]) {
+					i++
+				}
+				if !strings.HasPrefix(text[i:], "::") || i+2 >= len(text) || !isIdentifierStart(text[i+2]) {
+					break
+				}
+			}
+			t.text = text[start:i]
+		case c >= '0' && c <= '9' || (c == '.' && i+1 < len(text) && text[i+1] >= '0' && text[i+1] <= '9'):
+			t.kind = tokenNumber
+			for i < len(text) && (isIdentifierPart(text[i]) || text[i] == '.') {
+				if (text[i] == 'e' || text[i] == 'E') && i+1 < len(text) && (text[i+1] == '-' || text[i+1] == '+') {
+					i++
+				}
+				i++
+			}
+			t.text = text[start:i]
+		case c == '"' || c == '\'':
+			t.kind = tokenString
+			i++
+			for i < len(text) && text[i] != c && text[i] != '\n' {
+				if text[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(text) || text[i] != c {
+				return nil, fmt.Errorf("line %d: unterminated string literal", line)
+			}
+			i++
+			t.text = text[start+1 : i-1]
+		default:
+			t.kind = tokenPunctuation
+			i++
+			t.text = text[start:i]
+		}
+		t.source = text[start:i]
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
@@ -0,0 +1,163 @@
+package ros2idl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/foxglove/mcap/go/mcap"
+	"github.com/stretchr/testify/assert"
+)
+
+var separator = strings.Repeat("=", 80)
+
+func idlSchema(name string, sections ...string) *mcap.Schema {
+	return &mcap.Schema{
+		Name:     name,
+		Encoding: "ros2idl",
+		Data:     []byte(strings.Join(sections, "\n")),
+	}
+}
+
+func TestParseROS2IDLSchema(t *testing.T) {
+	t.Run("parses dependent types", func(t *testing.T) {
+		schema, err := ParseROS2IDLSchema(idlSchema("my_package/msg/Outer",
+			separator,
+			"IDL: my_package/msg/Outer",
+			`// generated from rosidl_adapter/resource/msg.idl.em
+#include "my_package/msg/Inner.idl"
+
+module my_package {
+  module msg {
+    typedef double double__9[9];
+    module Outer_Constants {
+      const uint8 MAX = 10;
+      const string NAME = "outer";
+    };
+    @verbatim (language="comment", text=
+      "A message" "\n" "with an inner message")
+    struct Outer {
+      Inner inner;
+      ::my_package::msg::Inner others[2];
+      sequence<Inner, 3> bounded;
+      double__9 covariance;
+      sequence<double__9> covariances;
+      string<16> label;
+      unsigned long long count, total;
+      Kind kind;
+    };
+  };
+};`,
+			separator,
+			"IDL: my_package/msg/Inner",
+			`module my_package {
+  module msg {
+    enum Kind { SMALL, LARGE };
+    /* the inner
+       message */
+    struct Inner {
+      @default (value=1.5e-3)
+      float value;
+    };
+  };
+};`))
+		assert.Nil(t, err)
+		inner := &Struct{
+			Name:   "my_package::msg::Inner",
+			Fields: []Field{{Name: "value", Type: Type{Name: "float"}}},
+		}
+		kind := &Enum{Name: "my_package::msg::Kind", Enumerators: []string{"SMALL", "LARGE"}}
+		innerType := Type{Name: "my_package::msg::Inner", Struct: inner}
+		assert.Equal(t, "my_package/msg/Outer", schema.Name)
+		assert.Equal(t, &Struct{
+			Name: "my_package::msg::Outer",
+			Fields: []Field{
+				{Name: "inner", Type: innerType},
+				{Name: "others", Type: Type{Name: "my_package::msg::Inner", Struct: inner, ArrayLengths: []int{2}}},
+				{Name: "bounded", Type: Type{Sequence: &innerType, Bound: 3}},
+				{Name: "covariance", Type: Type{Name: "double", ArrayLengths: []int{9}}},
+				{Name: "covariances", Type: Type{Sequence: &Type{Name: "double", ArrayLengths: []int{9}}}},
+				{Name: "label", Type: Type{Name: "string", Bound: 16}},
+				{Name: "count", Type: Type{Name: "unsigned long long"}},
+				{Name: "total", Type: Type{Name: "unsigned long long"}},
+				{Name: "kind", Type: Type{Name: "my_package::msg::Kind", Enum: kind}},
+			},
+		}, schema.Root)
+		assert.Equal(t, inner, schema.Structs["my_package::msg::Inner"])
+		assert.Equal(t, 2, len(schema.Structs))
+		assert.Equal(t, map[string]*Enum{"my_package::msg::Kind": kind}, schema.Enums)
+		assert.Equal(t, map[string]*Constant{
+			"my_package::msg::Outer_Constants::MAX": {
+				Name:  "my_package::msg::Outer_Constants::MAX",
+				Type:  Type{Name: "uint8"},
+				Value: "10",
+			},
+			"my_package::msg::Outer_Constants::NAME": {
+				Name:  "my_package::msg::Outer_Constants::NAME",
+				Type:  Type{Name: "string"},
+				Value: `"outer"`,
+			},
+		}, schema.Constants)
+	})
+	t.Run("registers schema parser", func(t *testing.T) {
+		parsed, err := mcap.ParseSchemaData(idlSchema("a/msg/B",
+			"module a { module msg { struct B { boolean b; }; }; };"))
+		assert.Nil(t, err)
+		assert.IsType(t, &IDLSchema{}, parsed)
+	})
+	t.Run("rejects other encodings", func(t *testing.T) {
+		_, err := ParseROS2IDLSchema(&mcap.Schema{
+			Name:     "foo.Bar",
+			Encoding: "protobuf",
+		})
+		assert.Contains(t, err.Error(), `has encoding "protobuf", expected ros2idl`)
+	})
+	cases := []struct {
+		assertion string
+		schema    *mcap.Schema
+		err       string
+	}{
+		{
+			"dangling reference",
+			idlSchema("a/msg/B", "module a { module msg { struct B { Missing m; }; }; };"),
+			"field m of a::msg::B: type Missing is not defined",
+		},
+		{
+			"reference outside of scope",
+			idlSchema("a/msg/B",
+				separator,
+				"IDL: a/msg/B",
+				"module a { module msg { struct B { C c; }; }; };",
+				separator,
+				"IDL: c/msg/C",
+				"module c { module msg { struct C { long x; }; }; };"),
+			"type C is not defined",
+		},
+		{
+			"dangling typedef",
+			idlSchema("a/msg/B", "module a { module msg { typedef Missing M[2]; struct B { M m; }; }; };"),
+			"typedef a::msg::M: type Missing is not defined",
+		},
+		{
+			"missing root type",
+			idlSchema("a/msg/B", "module a { module msg { struct C { long x; }; }; };"),
+			"struct a::msg::B is not defined",
+		},
+		{
+			"duplicate definition",
+			idlSchema("a/msg/B", "module a { module msg { struct B { long x; }; struct B { long y; }; }; };"),
+			"line 1: a::msg::B is defined more than once",
+		},
+		{
+			"syntax error",
+			idlSchema("a/msg/B", "module a {\nmodule msg {\nstruct B { long x }; }; };"),
+			`schema definition: line 3: expected ";", found "}"`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.assertion, func(t *testing.T) {
+			_, err := ParseROS2IDLSchema(c.schema)
+			assert.NotNil(t, err)
+			assert.Contains(t, err.Error(), c.err)
+		})
+	}
+}